@@ -25,5 +25,5 @@ func aboutJson() AboutInfo {
 }
 func About(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
-	http.ServeFile(w, r, "./api/template/index.html")
+	http.ServeFileFS(w, r, templateFiles(), "index.html")
 }
@@ -2,7 +2,11 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime"
+	"sync"
+	"time"
 
 	"github.com/anthriscus/appcli/store"
 )
@@ -13,7 +17,7 @@ type StoreRequest struct {
 }
 
 type StoreResult struct {
-	todoListItems store.TodoListItems
+	todoListItems store.List
 	todoListItem  store.TodoListItem
 	err           error
 }
@@ -36,29 +40,90 @@ func actorHandler(handler actorCommand, respChan chan StoreResult) {
 	var request RequestChannel
 	request.command = handler
 	request.responseChannel = &respChan
+	actorQueueDepth.Add(1)
 	RequestsChan <- request
 	fmt.Println("Actor pushed results to request channel")
 }
 
-func Actor() {
+// actorDo runs change as a command on the request actors like the other
+// handlers, so it is queued and timed with them
+func actorDo(change func() error) error {
+	_, err := actorGet(func() (struct{}, error) { return struct{}{}, change() })
+	return err
+}
+
+// actorGet is actorDo for a command with a result, read once the actor has answered
+func actorGet[T any](command func() (T, error)) (T, error) {
+	var value T
+	resultsChan := make(chan StoreResult)
+	actorHandler(func() StoreResult {
+		var err error
+		value, err = command()
+		return StoreResult{err: err}
+	}, resultsChan)
+	result := <-resultsChan
+	return value, result.err
+}
+
+// actor loops started by StartActor, commands run inline so a busy server
+// has this many commands in flight rather than a goroutine per request
+var actorWorkers = runtime.GOMAXPROCS(0)
+
+// runs commands one at a time until ctx ends, the command in hand finishes first
+func Actor(ctx context.Context) {
 	fmt.Printf("Actor started with channel size of %d\n", cap(RequestsChan))
-	for req := range RequestsChan {
-		go func() {
+	actorsRunning.Add(1)
+	defer actorsRunning.Add(-1)
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Actor stopped")
+			return
+		case req := <-RequestsChan:
+			started := time.Now()
 			result := req.command()
+			actorCommandSeconds.Observe(time.Since(started).Seconds())
+			actorQueueDepth.Add(-1)
 			// return the result of the command in the returning channel
 			*req.responseChannel <- result
 			fmt.Println("Actor pushed results to response channel")
+		}
+	}
+}
+
+// StartActor runs the actor loops, the stop func waits for their commands to finish or ctx to end
+func StartActor() func(context.Context) error {
+	actorCtx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for range actorWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Actor(actorCtx)
 		}()
 	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return func(ctx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
 var apiCreate = func(storeRequest StoreRequest) actorCommand {
 	return func() StoreResult {
 		newItem, ok := store.Create(storeRequest.ctx, storeRequest.todoListItem)
 		return StoreResult{
-			todoListItem:  newItem,
-			err:           ok,
-			todoListItems: store.TodoListItems{},
+			todoListItem: newItem,
+			err:          ok,
 		}
 	}
 }
@@ -83,6 +148,44 @@ var apiDelete = func(storeRequest StoreRequest) actorCommand {
 	}
 }
 
+// apiStateChange changes only the state, the rest of the task is left as it is now
+var apiStateChange = func(storeRequest StoreRequest) actorCommand {
+	return func() StoreResult {
+		ok := store.StateChange(storeRequest.ctx, storeRequest.todoListItem.Line, storeRequest.todoListItem.State)
+		return StoreResult{
+			todoListItem: store.TodoListItem{},
+			err:          ok,
+		}
+	}
+}
+
+// apiUpdateTree is apiUpdate with the new state given to the subtasks as well
+var apiUpdateTree = func(storeRequest StoreRequest) actorCommand {
+	return func() StoreResult {
+		newItem, ok := store.Update(storeRequest.ctx, storeRequest.todoListItem)
+		if ok == nil {
+			ok = store.StateChangeTree(storeRequest.ctx, newItem.Line, newItem.State)
+		}
+		if ok == nil {
+			newItem, ok = store.GetByIndex(newItem.Line)
+		}
+		return StoreResult{
+			todoListItem: newItem,
+			err:          ok,
+		}
+	}
+}
+
+var apiDeleteTree = func(storeRequest StoreRequest) actorCommand {
+	return func() StoreResult {
+		ok := store.DeleteTree(storeRequest.ctx, storeRequest.todoListItem.Line)
+		return StoreResult{
+			todoListItem: store.TodoListItem{},
+			err:          ok,
+		}
+	}
+}
+
 var apiGetList = func() actorCommand {
 	return func() StoreResult {
 		items, ok := store.GetList()
@@ -103,3 +206,39 @@ var apiGetListByIndex = func(storeRequest StoreRequest) actorCommand {
 		}
 	}
 }
+
+// apiPutIf writes the item as given over the version expected, or when none
+// is given over an older version than the item's own
+var apiPutIf = func(storeRequest StoreRequest, expect store.Expected, given bool) actorCommand {
+	return func() StoreResult {
+		item := storeRequest.todoListItem
+		if !given {
+			current, ok := store.GetByIndex(item.Line)
+			switch {
+			case errors.Is(ok, store.ErrNotFound):
+				expect = store.Expected{}
+			case ok != nil:
+				return StoreResult{err: ok}
+			case current.Version >= item.Version:
+				return StoreResult{todoListItem: current, err: store.ErrVersionConflict}
+			default:
+				expect = store.Expected{Found: true, Version: current.Version}
+			}
+		}
+		_, ok := store.PutIf(storeRequest.ctx, item, expect)
+		return StoreResult{
+			todoListItem: item,
+			err:          ok,
+		}
+	}
+}
+
+var apiRemove = func(storeRequest StoreRequest) actorCommand {
+	return func() StoreResult {
+		item, ok := store.Remove(storeRequest.ctx, storeRequest.todoListItem.Line)
+		return StoreResult{
+			todoListItem: item,
+			err:          ok,
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"sync"
 	"testing"
@@ -17,23 +18,34 @@ import (
 	"github.com/anthriscus/appcli/store"
 )
 
+// working copy of the sample data the tests run against
+var dataFile string
+
 func TestMain(m *testing.M) {
 	logging.Default()
-	// load the sample todolists into memory
-	dataFile, _ := filepath.Abs("../testdata/todolist.500.json")
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// load a working copy of the sample todolists into memory, the shutdown test commits to it
+	workDir, _ := os.MkdirTemp("", "appcli")
+	defer os.RemoveAll(workDir)
+	dataFile = filepath.Join(workDir, "todolist.json")
+	if sample, ok := os.ReadFile("../testdata/todolist.500.json"); ok == nil {
+		os.WriteFile(dataFile, sample, 0600)
+	}
+
 	store.OpenSession(ctx, dataFile)
 	store.StartActor(ctx)
 
 	// startup the api actor to open the channels
 	go func() {
-		Actor()
+		Actor(ctx)
 	}()
 	m.Run()
-	testDataResults := "C:\\Users\\piers.kenyon\\AppData\\Local\\appcli\\testsresults.json"
-	store.SaveSession(ctx, testDataResults)
+	testDataResults := filepath.Join(os.TempDir(), "appcli", "testsresults.json")
+	if ok := os.MkdirAll(filepath.Dir(testDataResults), 0700); ok == nil {
+		store.SaveSession(ctx, testDataResults)
+	}
 }
 
 // here we mock the server call
@@ -4,36 +4,43 @@ import (
 	"context"
 	"encoding/json" // only temp in this package for our mock data which later will be removed and will become a byte stream
 	"fmt"
-	"html/template"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/anthriscus/appcli/appcontext"
+	"github.com/anthriscus/appcli/config"
+	"github.com/anthriscus/appcli/grpcapi"
 	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/replica"
 	"github.com/anthriscus/appcli/store"
 )
 
-const (
-	applicationHttpPort int = 8080 // maybe get from env (which case would be a string...)
-)
-
 type apiError struct {
 	Error string
 }
 
-func Run() {
+// the running pieces of the server, torn down in order by handleShutdown
+type apiServer struct {
+	srv          *http.Server
+	debugSrv     *http.Server // nil unless a debug address is configured
+	stopWatches  func()       // ends the grpc watch streams, they would hold up the drain
+	replication  *replica.Node
+	drainTimeout time.Duration
+	stopActor    func(context.Context) error
+	stopAutosave func()
+}
+
+func Run(cfg config.Config) {
 	id := appcontext.GenerateId()
 	ctx := context.WithValue(context.Background(), appcontext.TraceIdKey, id)
 
-	mux := http.NewServeMux()
-	addRoutes(mux)
-	listenOn := strconv.Itoa(applicationHttpPort)
-	endPoint := ":" + listenOn
-	muxChain := addMiddleware(mux)
-
+	listenOn := cfg.ListenAddr
 	logging.Log().InfoContext(ctx, "Starting server", "listeningOn", listenOn)
 	fmt.Printf("Starting server listening on:%s\n ", listenOn)
 
@@ -42,50 +49,127 @@ func Run() {
 	// define what we will wait for
 	signal.Notify(shutdownChan, syscall.SIGINT, syscall.SIGTERM)
 
-	srv := &http.Server{
-		Addr:    endPoint,
-		Handler: muxChain,
+	listener, err := net.Listen("tcp", listenOn)
+	if err != nil {
+		fmt.Printf("Cannot listen on %s err:%s\n", listenOn, err)
+		logging.Log().ErrorContext(ctx, "Cannot listen", "listeningOn", listenOn, "error", err)
+		return
+	}
+	server := newServer(ctx, cfg)
+	if cfg.DebugAddr != "" {
+		if server.debugSrv, err = startDebugServer(ctx, cfg.DebugAddr); err != nil {
+			fmt.Printf("Cannot start debug server on %s err:%s\n", cfg.DebugAddr, err)
+			logging.Log().ErrorContext(ctx, "Cannot start debug server", "debugAddr", cfg.DebugAddr, "error", err)
+		}
 	}
 
 	// start server on a routine so we can catch the shutdownChan cancel below.
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
+		if err := server.srv.Serve(listener); err != nil {
 			logging.Log().ErrorContext(ctx, "Listening ended", "error", err)
 		}
 	}()
 
-	// spin up the actor
-	go func() {
-		Actor()
-	}()
-
 	// block until the signal
 	fmt.Println("waiting for your signal")
 	sig := <-shutdownChan
-	handleShutdown(ctx, srv, sig)
+
+	// a second signal while draining means stop now
+	go func() {
+		sig := <-shutdownChan
+		fmt.Printf("Got second signal %+v, quitting without waiting\n", sig)
+		logging.Log().ErrorContext(ctx, "Forced quit, unsaved changes are lost", "signal", sig)
+		os.Exit(1)
+	}()
+	handleShutdown(ctx, server, sig.String())
 }
 
-func handleShutdown(ctx context.Context, srv *http.Server, sig os.Signal) {
-	fmt.Printf("Got cancel signal %+v\n", sig)
-	logging.Log().InfoContext(ctx, "Shutdown requested", "signal", sig)
+// builds the http server and starts the actor and autosave, the caller does the listening
+func newServer(ctx context.Context, cfg config.Config) *apiServer {
+	SetWebDir(cfg.WebDir)
+	authToken = cfg.Auth.Token
+	startTime = time.Now().UTC()
+	shuttingDown.Store(false)
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	muxChain := addMiddleware(mux)
+
+	// grpc shares the listener, it needs http/2 which without tls is h2c
+	stopWatches := make(chan struct{})
+	grpcSrv := grpcapi.NewServer(cfg.Auth.Token, stopWatches)
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	// every server logs its changes for followers, given a leader it follows it
+	replication = replica.Start(ctx, cfg.Follow, cfg.ListenAddr, cfg.Auth.Token)
+
+	return &apiServer{
+		srv: &http.Server{
+			Addr:      cfg.ListenAddr,
+			Handler:   grpcMiddleware(grpcSrv, muxChain),
+			Protocols: protocols,
+		},
+		stopWatches:  sync.OnceFunc(func() { close(stopWatches) }),
+		replication:  replication,
+		drainTimeout: cfg.ShutdownTimeout,
+		// spin up the actor
+		stopActor: StartActor(),
+		// background saves while the server runs
+		stopAutosave: store.StartAutosave(ctx, cfg.AutosaveInterval, cfg.AutosaveChanges),
+	}
+}
 
-	// shutdown the server
-	if ok := srv.Shutdown(ctx); ok != nil {
-		logging.Log().ErrorContext(ctx, "Shutdown server failed", "error", ok)
+// ordered teardown, stop accepting and drain http, drain the actor, final commit.
+// The log is closed by main once this returns.
+func handleShutdown(ctx context.Context, server *apiServer, reason string) error {
+	fmt.Printf("Got cancel signal %s\n", reason)
+	logging.Log().InfoContext(ctx, "Shutdown requested", "signal", reason, "drainTimeout", server.drainTimeout)
+	// tell load balancers to stop sending traffic
+	shuttingDown.Store(true)
+	server.stopWatches()
+	// held log reads end and a follower stops applying before the final commit
+	server.replication.Stop()
+
+	// everything below shares the one drain deadline
+	drainCtx, cancel := context.WithTimeout(ctx, server.drainTimeout)
+	defer cancel()
+
+	// shutdown the server, stops accepting and waits for open requests
+	if ok := server.srv.Shutdown(drainCtx); ok != nil {
+		logging.Log().ErrorContext(ctx, "Shutdown server failed, closing open connections", "error", ok)
+		server.srv.Close()
 	} else {
 		logging.Log().InfoContext(ctx, "Server shutdown")
 	}
 
+	// commands already handed to the actor finish before the commit
+	if ok := server.stopActor(drainCtx); ok != nil {
+		logging.Log().ErrorContext(ctx, "Actor drain timed out", "error", ok)
+	} else {
+		logging.Log().InfoContext(ctx, "Actor stopped")
+	}
+
+	// no more background saves, the final commit is below
+	server.stopAutosave()
+
 	// commit the data
 	fmt.Println("Commiting data in shutdown")
 	logging.Log().InfoContext(ctx, "Commiting data in shutdown")
-	if ok := store.Commit(ctx); ok != nil {
-		logging.Log().ErrorContext(ctx, "Data commit failed", "error", ok)
+	err := store.Commit(ctx)
+	if err != nil {
+		logging.Log().ErrorContext(ctx, "Data commit failed", "error", err)
 	} else {
 		logging.Log().InfoContext(ctx, "Committed")
 	}
+
+	// diagnostics stay up to the end so a slow drain can still be profiled
+	if server.debugSrv != nil {
+		server.debugSrv.Close()
+	}
 	fmt.Println("Goodbye")
 	logging.Log().InfoContext(ctx, "Goodbye")
+	return err
 }
 
 func Create(w http.ResponseWriter, r *http.Request) {
@@ -160,12 +244,21 @@ func UpdateTask(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(jsonError(fmt.Errorf("invalid json")))
 		return
 	} else {
+		// ?cascade=true gives the subtasks the new state too
+		update := apiUpdate
+		if r.URL.Query().Get("cascade") == "true" {
+			update = apiUpdateTree
+		}
+		// ?force=true starts a task even when its blockers are not completed
+		ctx := r.Context()
+		if r.URL.Query().Get("force") == "true" {
+			ctx = store.OverrideBlockers(ctx)
+		}
 		resultsChan := make(chan StoreResult)
-		actorHandler(apiUpdate(StoreRequest{ctx: r.Context(), todoListItem: item}), resultsChan)
+		actorHandler(update(StoreRequest{ctx: ctx, todoListItem: item}), resultsChan)
 		result := <-resultsChan
 		if result.err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(jsonError(result.err))
+			writeStoreError(w, result.err)
 		} else {
 			if ok := json.NewEncoder(w).Encode(&result.todoListItem); ok != nil {
 				logging.Log().ErrorContext(r.Context(), "UpdateTask", "error", ok)
@@ -182,8 +275,13 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		deleteData := store.TodoListItem{Line: id}
+		// ?cascade=true deletes the subtasks too, otherwise they move up
+		remove := apiDelete
+		if r.URL.Query().Get("cascade") == "true" {
+			remove = apiDeleteTree
+		}
 		resultsChan := make(chan StoreResult)
-		actorHandler(apiDelete(StoreRequest{ctx: r.Context(), todoListItem: deleteData}), resultsChan)
+		actorHandler(remove(StoreRequest{ctx: r.Context(), todoListItem: deleteData}), resultsChan)
 		result := <-resultsChan
 		if result.err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -195,19 +293,17 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func GetActiveList(w http.ResponseWriter, r *http.Request) {
-	if items, ok := store.GetList(); ok != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	} else {
-		if t, ok := template.ParseFiles("./api/template/activetodolist.html"); ok != nil {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			// compile the template and serve to the response writer
-			if ok := t.Execute(w, items); ok != nil {
-				logging.Log().ErrorContext(r.Context(), "template parse failed")
-			}
-		}
+type storeStats struct {
+	Items int             `json:"items"`
+	Dirty bool            `json:"dirty"`
+	Save  store.SaveStats `json:"save"`
+}
+
+// save latency and last save time for monitoring
+func StoreStats(w http.ResponseWriter, r *http.Request) {
+	stats := storeStats{Items: store.Count(), Dirty: store.Dirty(), Save: store.Stats()}
+	if ok := json.NewEncoder(w).Encode(&stats); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "StoreStats", "error", ok)
 	}
 }
 
@@ -215,3 +311,9 @@ func GetActiveList(w http.ResponseWriter, r *http.Request) {
 func jsonError(err error) apiError {
 	return apiError{Error: err.Error()}
 }
+
+// the list could not be read, only happens with store servers behind the store
+func listFailed(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(jsonError(err))
+}
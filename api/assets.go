@@ -0,0 +1,53 @@
+package api
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// the web pages and static files are built into the binary so the server
+// runs from any folder. For development point the web dir at the api folder
+// of a checkout and templates are parsed again on every request.
+
+//go:embed template/*.html
+var embeddedTemplates embed.FS
+
+//go:embed files
+var embeddedFiles embed.FS
+
+var (
+	webDir string
+	pages  = template.Must(template.ParseFS(embeddedTemplates, "template/*.html"))
+)
+
+// SetWebDir overrides the embedded assets with a folder holding template and files sub folders
+func SetWebDir(dir string) {
+	webDir = dir
+}
+
+func templateFiles() fs.FS {
+	if webDir != "" {
+		return os.DirFS(filepath.Join(webDir, "template"))
+	}
+	sub, _ := fs.Sub(embeddedTemplates, "template")
+	return sub
+}
+
+func staticFiles() fs.FS {
+	if webDir != "" {
+		return os.DirFS(filepath.Join(webDir, "files"))
+	}
+	sub, _ := fs.Sub(embeddedFiles, "files")
+	return sub
+}
+
+// parsed once at startup unless the override folder is in use
+func loadTemplates() (*template.Template, error) {
+	if webDir != "" {
+		return template.ParseFS(templateFiles(), "*.html")
+	}
+	return pages, nil
+}
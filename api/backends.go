@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/remote"
+	"github.com/anthriscus/appcli/store"
+)
+
+type backendRequest struct {
+	Addr string `json:"addr"`
+}
+
+type rebalanceResult struct {
+	Addr  string `json:"addr,omitempty"`
+	Moved int    `json:"moved"` // items copied to their new store server
+}
+
+// the store server router, false when the list is kept in this process
+func storeRouter(w http.ResponseWriter) (*remote.Router, bool) {
+	router, ok := store.CurrentBackend().(*remote.Router)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(jsonError(errors.New("not using store servers, start with -backends")))
+	}
+	return router, ok
+}
+
+// store servers in use and how many items each holds
+func GetBackends(w http.ResponseWriter, r *http.Request) {
+	router, ok := storeRouter(w)
+	if !ok {
+		return
+	}
+	if ok := json.NewEncoder(w).Encode(router.Backends(r.Context())); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "GetBackends", "error", ok)
+	}
+}
+
+// adds a store server to the ring, moving the items it now owns before answering
+func AddBackend(w http.ResponseWriter, r *http.Request) {
+	router, ok := storeRouter(w)
+	if !ok {
+		return
+	}
+	var request backendRequest
+	if ok := json.NewDecoder(r.Body).Decode(&request); ok != nil || request.Addr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(fmt.Errorf("invalid json, want {\"addr\": \"host:port\"}")))
+		return
+	}
+	moved, err := router.AddBackend(r.Context(), request.Addr)
+	writeRebalance(w, r, "Added store server", request.Addr, moved, err)
+}
+
+// takes a store server off the ring once its items are on the others
+func RemoveBackend(w http.ResponseWriter, r *http.Request) {
+	router, ok := storeRouter(w)
+	if !ok {
+		return
+	}
+	addr := r.PathValue("addr")
+	moved, err := router.RemoveBackend(r.Context(), addr)
+	writeRebalance(w, r, "Removed store server", addr, moved, err)
+}
+
+// moves every item that is not on the store server owning it
+func Rebalance(w http.ResponseWriter, r *http.Request) {
+	router, ok := storeRouter(w)
+	if !ok {
+		return
+	}
+	moved, err := router.Rebalance(r.Context())
+	writeRebalance(w, r, "Rebalanced store servers", "", moved, err)
+}
+
+func writeRebalance(w http.ResponseWriter, r *http.Request, message string, addr string, moved int, err error) {
+	if err != nil {
+		logging.Log().ErrorContext(r.Context(), message, "addr", addr, "moved", moved, "error", err)
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(jsonError(err))
+		return
+	}
+	logging.Log().InfoContext(r.Context(), message, "addr", addr, "moved", moved)
+	json.NewEncoder(w).Encode(rebalanceResult{Addr: addr, Moved: moved})
+}
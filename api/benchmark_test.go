@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/anthriscus/appcli/api/internal"
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+// seed for the create and update payloads, fixed so runs can be compared with benchstat
+const benchSeed = 42
+
+// benchHandler is the full server path, middleware, mux, actor and store,
+// running over the 500 item sample list loaded by TestMain
+func benchHandler(b *testing.B) http.Handler {
+	b.Helper()
+	// logs and the trace lines on stdout would swamp the timings
+	logging.Setup(io.Discard, "text", slog.HandlerOptions{})
+	stdout := os.Stdout
+	if devNull, ok := os.Open(os.DevNull); ok == nil {
+		os.Stdout = devNull
+	}
+	// creates are removed again so later benchmarks see the same list
+	before, _ := store.GetList()
+	b.Cleanup(func() {
+		after, _ := store.GetList()
+		for item := range after.All() {
+			if _, found := before.Get(item.Line); !found {
+				store.Delete(context.Background(), item.Line)
+			}
+		}
+		os.Stdout = stdout
+		logging.Default()
+	})
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	return addMiddleware(mux)
+}
+
+// the lowest id in the sample list so every run reads the same task
+func benchTaskId(b *testing.B) int64 {
+	b.Helper()
+	items, _ := store.GetList()
+	for item := range items.All() {
+		return item.Line
+	}
+	b.Fatal("no sample items loaded")
+	return 0
+}
+
+func benchPayloads(n int64) [][]byte {
+	payloads := [][]byte{}
+	for _, item := range internal.GenerateSeededTasks(n, benchSeed) {
+		data, _ := json.Marshal(item)
+		payloads = append(payloads, data)
+	}
+	return payloads
+}
+
+func serveBench(b *testing.B, handler http.Handler, method string, target string, body []byte, want int) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, target, reader))
+	if w.Code != want {
+		// Errorf as RunParallel bodies are not on the benchmark goroutine
+		b.Errorf("%s %s wanted %d got %d %s", method, target, want, w.Code, w.Body.String())
+	}
+}
+
+func BenchmarkHandlerGetList(b *testing.B) {
+	handler := benchHandler(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		serveBench(b, handler, http.MethodGet, "/get", nil, http.StatusOK)
+	}
+}
+
+func BenchmarkHandlerGetByIndex(b *testing.B) {
+	handler := benchHandler(b)
+	target := "/get/" + strconv.FormatInt(benchTaskId(b), 10)
+	b.ReportAllocs()
+	for b.Loop() {
+		serveBench(b, handler, http.MethodGet, target, nil, http.StatusOK)
+	}
+}
+
+func BenchmarkHandlerGetByIndexParallel(b *testing.B) {
+	handler := benchHandler(b)
+	target := "/get/" + strconv.FormatInt(benchTaskId(b), 10)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			serveBench(b, handler, http.MethodGet, target, nil, http.StatusOK)
+		}
+	})
+}
+
+func BenchmarkHandlerCreate(b *testing.B) {
+	handler := benchHandler(b)
+	payloads := benchPayloads(100)
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		serveBench(b, handler, http.MethodPost, "/create", payloads[i%len(payloads)], http.StatusCreated)
+		i++
+	}
+}
+
+func BenchmarkHandlerCreateParallel(b *testing.B) {
+	handler := benchHandler(b)
+	payloads := benchPayloads(100)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			serveBench(b, handler, http.MethodPost, "/create", payloads[i%len(payloads)], http.StatusCreated)
+			i++
+		}
+	})
+}
+
+func BenchmarkHandlerUpdate(b *testing.B) {
+	handler := benchHandler(b)
+	id := benchTaskId(b)
+	original, _ := store.GetByIndex(id)
+	b.Cleanup(func() { store.Update(context.Background(), original) })
+
+	payloads := [][]byte{}
+	for _, item := range internal.GenerateSeededTasks(100, benchSeed) {
+		item.Line = id
+		item.State = int(item.Line % 3)
+		data, _ := json.Marshal(item)
+		payloads = append(payloads, data)
+	}
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		serveBench(b, handler, http.MethodPut, "/update", payloads[i%len(payloads)], http.StatusOK)
+		i++
+	}
+}
+
+// the html list page, template execution on top of the list read
+func BenchmarkHandlerWebList(b *testing.B) {
+	handler := benchHandler(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		serveBench(b, handler, http.MethodGet, "/list", nil, http.StatusOK)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+type boardCard struct {
+	Line        int64
+	Description string
+	Age         string
+	Tags        []string
+}
+
+type boardColumn struct {
+	State int
+	Name  string
+	Cards []boardCard
+}
+
+type boardPage struct {
+	Columns   []boardColumn
+	States    []stateOption
+	CSRFToken string
+	Error     string
+}
+
+// kanban board, one column for each workflow state
+func GetBoard(w http.ResponseWriter, r *http.Request) {
+	renderBoard(w, r, http.StatusOK, "")
+}
+
+// move a card to another column, posted by the drag and drop script or the fallback form
+func BoardMove(w http.ResponseWriter, r *http.Request) {
+	id, ok := webTaskId(r)
+	if ok != nil {
+		renderBoard(w, r, http.StatusBadRequest, ok.Error())
+		return
+	}
+	state, ok := strconv.Atoi(r.PostFormValue("state"))
+	if ok != nil {
+		renderBoard(w, r, http.StatusBadRequest, "state is out of range")
+		return
+	}
+	// only the state changes, an edit made since the board was shown stays
+	item := store.TodoListItem{Line: id, State: state}
+	resultsChan := make(chan StoreResult)
+	actorHandler(apiStateChange(StoreRequest{ctx: r.Context(), todoListItem: item}), resultsChan)
+	if result := <-resultsChan; result.err != nil {
+		status := http.StatusBadRequest
+		var blocked *store.BlockedError
+		if errors.As(result.err, &blocked) {
+			status = http.StatusConflict
+		}
+		renderBoard(w, r, status, result.err.Error())
+		return
+	}
+	http.Redirect(w, r, "/board", http.StatusSeeOther)
+}
+
+func renderBoard(w http.ResponseWriter, r *http.Request, status int, message string) {
+	items, ok := store.GetList()
+	if ok != nil {
+		listFailed(w, ok)
+		return
+	}
+	page := boardPage{
+		Columns:   boardColumns(items.All(), time.Now()),
+		States:    stateOptions(),
+		CSRFToken: csrfToken(w, r),
+		Error:     message,
+	}
+	renderTemplate(w, r, "board.html", status, page)
+}
+
+// cards are placed in the order items gives them, line order from the store
+func boardColumns(items iter.Seq[store.TodoListItem], now time.Time) []boardColumn {
+	states := stateOptions()
+	columns := make([]boardColumn, 0, len(states))
+	index := make(map[int]int, len(states))
+	for i, s := range states {
+		columns = append(columns, boardColumn{State: s.Value, Name: s.Name, Cards: []boardCard{}})
+		index[s.Value] = i
+	}
+
+	for item := range items {
+		if i, found := index[item.State]; found {
+			columns[i].Cards = append(columns[i].Cards, boardCard{
+				Line:        item.Line,
+				Description: item.Description,
+				Age:         ageOf(item.Created, now),
+				Tags:        item.Tags,
+			})
+		}
+	}
+	return columns
+}
+
+// short human age of a card in its largest whole unit, 12m, 5h or 3d
+func ageOf(created time.Time, now time.Time) string {
+	age := now.Sub(created)
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestBoardColumns(t *testing.T) {
+	now := time.Date(2025, 10, 30, 12, 0, 0, 0, time.UTC)
+	items := []store.TodoListItem{
+		{Line: 1, Description: "one", State: store.StateNotStarted, Created: now.Add(-3 * 24 * time.Hour)},
+		{Line: 2, Description: "two", State: store.StateStarted, Created: now.Add(-5 * time.Hour), Tags: []string{"home"}},
+		{Line: 3, Description: "three", State: store.StateStarted, Created: now.Add(-12 * time.Minute)},
+		{Line: 4, Description: "four", State: store.StateCompleted, Created: now},
+	}
+	var tests = []struct {
+		state int
+		want  []string
+	}{
+		{state: store.StateNotStarted, want: []string{"3d"}},
+		{state: store.StateStarted, want: []string{"5h", "12m"}},
+		{state: store.StateCompleted, want: []string{"just now"}},
+	}
+
+	columns := boardColumns(slices.Values(items), now)
+	if len(columns) != len(store.StatusName) {
+		t.Fatalf("wanted %d columns got %d", len(store.StatusName), len(columns))
+	}
+	for i, tc := range tests {
+		column := columns[i]
+		if column.State != tc.state {
+			t.Errorf("column %d wanted state %d got %d", i, tc.state, column.State)
+		} else if len(column.Cards) != len(tc.want) {
+			t.Errorf("column %d wanted %d cards got %d", i, len(tc.want), len(column.Cards))
+		} else {
+			for j, age := range tc.want {
+				if column.Cards[j].Age != age {
+					t.Errorf("column %d card %d wanted age %s got %s", i, j, age, column.Cards[j].Age)
+				}
+			}
+		}
+	}
+}
+
+func TestBoardMove(t *testing.T) {
+	created, ok := store.Create(t.Context(), store.TodoListItem{Description: "board move task", Tags: []string{"Work"}})
+	if ok != nil {
+		t.Fatalf("board move task not created %s", ok)
+	}
+
+	form := url.Values{"state": {fmt.Sprint(store.StateCompleted)}, csrfFieldName: {testCsrfToken}}
+	req := newFormRequest(fmt.Sprintf("/board/%d/state", created.Line), form, testCsrfToken)
+	req.SetPathValue("taskId", fmt.Sprint(created.Line))
+	w := httptest.NewRecorder()
+	csrfMiddleware(http.HandlerFunc(BoardMove))(w, req)
+
+	if w.Result().StatusCode != http.StatusSeeOther {
+		t.Errorf("move wanted: %d got: %d", http.StatusSeeOther, w.Result().StatusCode)
+	} else if moved, _ := store.GetByIndex(created.Line); moved.State != store.StateCompleted {
+		t.Errorf("move wanted state %d got %d", store.StateCompleted, moved.State)
+	} else if moved.Description != "board move task" || len(moved.Tags) != 1 || moved.Tags[0] != "work" {
+		t.Errorf("move should keep description and tags got: %+v", moved)
+	}
+}
+
+// a card blocked by an open task stays in its column
+func TestBoardMoveBlocked(t *testing.T) {
+	ctx := t.Context()
+	blocker, _ := store.Create(ctx, store.TodoListItem{Description: "board blocker"})
+	blocked, _ := store.Create(ctx, store.TodoListItem{Description: "board blocked task"})
+	if ok := store.AddBlocker(ctx, blocked.Line, blocker.Line); ok != nil {
+		t.Fatal(ok)
+	}
+
+	form := url.Values{"state": {fmt.Sprint(store.StateStarted)}, csrfFieldName: {testCsrfToken}}
+	req := newFormRequest(fmt.Sprintf("/board/%d/state", blocked.Line), form, testCsrfToken)
+	req.SetPathValue("taskId", fmt.Sprint(blocked.Line))
+	w := httptest.NewRecorder()
+	csrfMiddleware(http.HandlerFunc(BoardMove))(w, req)
+
+	if w.Result().StatusCode != http.StatusConflict {
+		t.Errorf("move of a blocked card wanted: %d got: %d", http.StatusConflict, w.Result().StatusCode)
+	} else if item, _ := store.GetByIndex(blocked.Line); item.State != store.StateNotStarted {
+		t.Errorf("blocked card moved to %d", item.State)
+	}
+}
+
+// a list that cannot be read is the server failing, not a bad request
+func TestBoardListDown(t *testing.T) {
+	store.SetBackend(downBackend{})
+	defer store.SetBackend(nil)
+	w := httptest.NewRecorder()
+	GetBoard(w, httptest.NewRequest(http.MethodGet, "/board", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("board with the backend down wanted 503 got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+const (
+	csrfCookieName string = "appcli_csrf"
+	csrfFieldName  string = "csrf_token"
+	csrfTokenBytes int    = 32
+)
+
+// double submit cookie pattern
+// the token lives in a cookie and must be echoed back in the posted form,
+// a cross site form post cannot read our cookie so cannot supply the token.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if c, ok := r.Cookie(csrfCookieName); ok == nil && len(c.Value) == csrfTokenBytes*2 {
+		return c.Value
+	}
+	token := newCsrfToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+func newCsrfToken() string {
+	b := make([]byte, csrfTokenBytes)
+	// crypto/rand read never returns an error
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validCsrfToken(r *http.Request) bool {
+	c, ok := r.Cookie(csrfCookieName)
+	if ok != nil || c.Value == "" {
+		return false
+	}
+	posted := r.PostFormValue(csrfFieldName)
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(posted)) == 1
+}
+
+// only for the web form posts
+func csrfMiddleware(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !validCsrfToken(r) {
+			logging.Log().WarnContext(r.Context(), "csrf token rejected", "route", r.URL.Path)
+			http.Error(w, "invalid or missing form token, reload the page and try again", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/anthriscus/appcli/filer"
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/remote"
+	"github.com/anthriscus/appcli/store"
+)
+
+// profiles the capture command knows, the ones taken over a period have a duration
+var profileKinds = map[string]struct {
+	path   string
+	period bool
+}{
+	"cpu":       {path: "/debug/pprof/profile", period: true},
+	"trace":     {path: "/debug/pprof/trace", period: true},
+	"heap":      {path: "/debug/pprof/heap"},
+	"allocs":    {path: "/debug/pprof/allocs"},
+	"goroutine": {path: "/debug/pprof/goroutine"},
+	"block":     {path: "/debug/pprof/block"},
+	"mutex":     {path: "/debug/pprof/mutex"},
+}
+
+func init() {
+	expvar.Publish("appcli", expvar.Func(debugVars))
+}
+
+// diagnostics get their own mux and listener so they are never on the public port
+func newDebugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("GET /debug/actors", ActorDump)
+	return mux
+}
+
+// startDebugServer listens on addr and serves the debug mux until closed
+func startDebugServer(ctx context.Context, addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopback(addr) {
+		fmt.Printf("Warning: debug listener on %s is reachable from other machines\n", addr)
+		logging.Log().WarnContext(ctx, "Debug listener is not on a loopback address", "debugAddr", addr)
+	}
+	srv := &http.Server{Addr: addr, Handler: newDebugMux()}
+	go func() {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logging.Log().ErrorContext(ctx, "Debug listening ended", "error", err)
+		}
+	}()
+	logging.Log().InfoContext(ctx, "Debug server started", "debugAddr", listener.Addr().String())
+	fmt.Printf("Debug server listening on:%s\n", listener.Addr())
+	return srv, nil
+}
+
+// an empty host listens on every interface so it is not loopback
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// the numbers behind /metrics in one json object under /debug/vars
+func debugVars() any {
+	vars := map[string]any{
+		"actorsRunning":   actorsRunning.Load(),
+		"actorQueueDepth": actorQueueDepth.Value(),
+		"shuttingDown":    shuttingDown.Load(),
+		"uptime":          time.Since(startTime).Round(time.Second).String(),
+		"save":            store.Stats(),
+		"storeShards":     store.ShardCount(),
+	}
+	if store.IsOpen() && store.ActorRunning() {
+		vars["items"] = store.Count()
+	}
+	return vars
+}
+
+// state of the actors followed by every goroutine stack
+func ActorDump(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	stats := store.Stats()
+	fmt.Fprintf(w, "api actors running: %d\n", actorsRunning.Load())
+	fmt.Fprintf(w, "api actor queue depth: %v\n", actorQueueDepth.Value())
+	fmt.Fprintf(w, "store open: %t\n", store.IsOpen())
+	fmt.Fprintf(w, "store actor running: %t\n", store.ActorRunning())
+	fmt.Fprintf(w, "store shards: %d\n", store.ShardCount())
+	if router, ok := store.CurrentBackend().(*remote.Router); ok {
+		for _, b := range router.Backends(r.Context()) {
+			fmt.Fprintf(w, "store server %s: %d items %s\n", b.Addr, b.Items, b.Error)
+		}
+	}
+	fmt.Fprintf(w, "unsaved changes: %d\n", stats.Unsaved)
+	lastSave := "never"
+	if !stats.LastSave.IsZero() {
+		lastSave = stats.LastSave.Format(time.RFC3339)
+	}
+	fmt.Fprintf(w, "last save: %s\n", lastSave)
+	fmt.Fprintf(w, "shutting down: %t\n", shuttingDown.Load())
+	fmt.Fprintf(w, "goroutines: %d\n\n", runtime.NumGoroutine())
+	if ok := runtimepprof.Lookup("goroutine").WriteTo(w, 2); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "ActorDump", "error", ok)
+	}
+}
+
+// ProfileKinds lists the profiles CaptureProfile accepts
+func ProfileKinds() []string {
+	return slices.Sorted(maps.Keys(profileKinds))
+}
+
+// CaptureProfile asks the debug server on debugAddr for a profile and saves it
+// under dir/profiles, seconds is used by the cpu and trace profiles.
+// Returns the file written.
+func CaptureProfile(ctx context.Context, debugAddr string, kind string, seconds int, dir string) (string, error) {
+	profile, found := profileKinds[kind]
+	if !found {
+		return "", fmt.Errorf("unknown profile %s, try one of %v", kind, ProfileKinds())
+	}
+	host, port, err := net.SplitHostPort(debugAddr)
+	if err != nil {
+		return "", fmt.Errorf("debug address %s: %w", debugAddr, err)
+	}
+	// a server listening on every interface is reached on the local machine
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	url := "http://" + net.JoinHostPort(host, port) + profile.path
+	timeout := 30 * time.Second
+	if profile.period {
+		url += "?seconds=" + strconv.Itoa(seconds)
+		timeout += time.Duration(seconds) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("profile %s: %s %s", kind, resp.Status, body)
+	}
+
+	profileDir := filepath.Join(dir, "profiles")
+	if err := filer.CreateFolder(profileDir); err != nil {
+		return "", err
+	}
+	extension := ".pprof"
+	if kind == "trace" {
+		extension = ".trace"
+	}
+	fileName := filepath.Join(profileDir, kind+"-"+time.Now().Format("20060102-150405")+extension)
+	f, err := filer.OpenFileTruncate(fileName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return "", err
+	}
+	return fileName, f.Close()
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugMux(t *testing.T) {
+	mux := newDebugMux()
+	var tests = []struct {
+		path string
+		want string
+	}{
+		{path: "/debug/pprof/", want: "goroutine"},
+		{path: "/debug/vars", want: `"appcli"`},
+		{path: "/debug/actors", want: "api actors running: 1"},
+		{path: "/debug/actors", want: "goroutine "},
+	}
+	for i, tc := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("test %d %s code %d missing %q", i, tc.path, w.Code, tc.want)
+		}
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	var tests = []struct {
+		addr string
+		want bool
+	}{
+		{addr: "localhost:6060", want: true},
+		{addr: "127.0.0.1:6060", want: true},
+		{addr: "[::1]:6060", want: true},
+		{addr: ":6060", want: false},
+		{addr: "0.0.0.0:6060", want: false},
+		{addr: "192.168.1.10:6060", want: false},
+		{addr: "nonsense", want: false},
+	}
+	for _, tc := range tests {
+		if got := isLoopback(tc.addr); got != tc.want {
+			t.Errorf("isLoopback(%s) wanted %t got %t", tc.addr, tc.want, got)
+		}
+	}
+}
+
+func TestCaptureProfile(t *testing.T) {
+	server := httptest.NewServer(newDebugMux())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+	dir := t.TempDir()
+
+	fileName, ok := CaptureProfile(t.Context(), addr, "heap", 1, dir)
+	if ok != nil {
+		t.Fatalf("capture failed %s", ok)
+	}
+	if filepath.Dir(fileName) != filepath.Join(dir, "profiles") {
+		t.Errorf("profile saved outside the profiles folder %s", fileName)
+	}
+	if info, ok := os.Stat(fileName); ok != nil || info.Size() == 0 {
+		t.Errorf("profile file empty or missing %s", fileName)
+	}
+
+	if _, ok := CaptureProfile(t.Context(), addr, "nosuch", 1, dir); ok == nil {
+		t.Errorf("unknown profile kind should fail")
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+// GetBlocked is every task waiting on blockers not yet completed
+func GetBlocked(w http.ResponseWriter, r *http.Request) {
+	blocked, ok := actorGet(store.Blocked)
+	if ok != nil {
+		listFailed(w, ok)
+		return
+	}
+	if ok := json.NewEncoder(w).Encode(blocked); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "GetBlocked", "error", ok)
+	}
+}
+
+// AddBlocker marks the task as blocked by another, {"line":blocker}
+func AddBlocker(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	var blocker store.TodoListItem
+	if ok := json.NewDecoder(r.Body).Decode(&blocker); ok != nil || blocker.Line == 0 {
+		badRequest(w, fmt.Errorf("invalid json, want the blocking task's line"))
+		return
+	}
+	if ok := actorDo(func() error { return store.AddBlocker(r.Context(), id, blocker.Line) }); ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeTask(w, r, http.StatusCreated, id)
+}
+
+// RemoveBlocker drops the link, the task no longer waits for the blocker
+func RemoveBlocker(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	blocker, ok := pathId(r, "blockerId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	if ok := actorDo(func() error { return store.RemoveBlocker(r.Context(), id, blocker) }); ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeTask(w, r, http.StatusOK, id)
+}
+
+func writeTask(w http.ResponseWriter, r *http.Request, status int, id int64) {
+	item, ok := actorGet(func() (store.TodoListItem, error) { return store.GetByIndex(id) })
+	if errors.Is(ok, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return
+	} else if ok != nil {
+		listFailed(w, ok)
+		return
+	}
+	w.WriteHeader(status)
+	if ok := json.NewEncoder(w).Encode(&item); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Task", "path", r.URL.Path, "error", ok)
+	}
+}
+
+// a change refused as the task is blocked is a conflict, the blockers are in the body
+type blockedError struct {
+	Error    string
+	Blockers []int64 `json:"blockers"`
+}
+
+// writeStoreError is 409 with the blockers for a blocked task, 400 otherwise
+func writeStoreError(w http.ResponseWriter, err error) {
+	var blocked *store.BlockedError
+	if errors.As(err, &blocked) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(blockedError{Error: err.Error(), Blockers: blocked.Blockers})
+		return
+	}
+	badRequest(w, err)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestBlockerRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	ctx := t.Context()
+	blocker, _ := store.AddTask(ctx, "Get the quote")
+	task, _ := store.AddTask(ctx, "Order the boiler")
+	defer store.DeleteTask(ctx, blocker)
+	defer store.DeleteTask(ctx, task)
+	start := fmt.Sprintf(`{"line":%d,"description":"Order the boiler","state":1}`, task)
+
+	var tests = []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{name: "block", method: http.MethodPost, target: fmt.Sprintf("/blockers/%d", task), body: fmt.Sprintf(`{"line":%d}`, blocker), want: http.StatusCreated},
+		{name: "loop", method: http.MethodPost, target: fmt.Sprintf("/blockers/%d", blocker), body: fmt.Sprintf(`{"line":%d}`, task), want: http.StatusBadRequest},
+		{name: "start blocked", method: http.MethodPut, target: "/update", body: start, want: http.StatusConflict},
+		{name: "blocked view", method: http.MethodGet, target: "/blocked", want: http.StatusOK},
+		{name: "override", method: http.MethodPut, target: "/update?force=true", body: start, want: http.StatusOK},
+		{name: "unblock", method: http.MethodDelete, target: fmt.Sprintf("/blockers/%d/%d", task, blocker), want: http.StatusOK},
+		{name: "unblock again", method: http.MethodDelete, target: fmt.Sprintf("/blockers/%d/%d", task, blocker), want: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		w := serve(mux, tc.method, tc.target, tc.body)
+		if w.Code != tc.want {
+			t.Errorf("%s: wanted %d got %d %s", tc.name, tc.want, w.Code, w.Body.String())
+			continue
+		}
+		switch tc.name {
+		case "start blocked":
+			var refused blockedError
+			if json.NewDecoder(w.Body).Decode(&refused); len(refused.Blockers) != 1 || refused.Blockers[0] != blocker {
+				t.Errorf("%s: wanted blocker %d got %+v", tc.name, blocker, refused)
+			}
+		case "blocked view":
+			var blocked []store.BlockedTask
+			json.NewDecoder(w.Body).Decode(&blocked)
+			found := false
+			for _, b := range blocked {
+				found = found || b.Item.Line == task
+			}
+			if !found {
+				t.Errorf("%s: task %d missing from %+v", tc.name, task, blocked)
+			}
+		}
+	}
+}
+
+// the blocker routes run on the request actors like the other writes
+func TestBlockersThroughActor(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	ctx := t.Context()
+	blocker, _ := store.AddTask(ctx, "Measure the window")
+	task, _ := store.AddTask(ctx, "Order the blind")
+	defer store.DeleteTask(ctx, blocker)
+	defer store.DeleteTask(ctx, task)
+	before := actorCommandSeconds.Count()
+	if w := serve(mux, http.MethodPost, fmt.Sprintf("/blockers/%d", task), fmt.Sprintf(`{"line":%d}`, blocker)); w.Code != http.StatusCreated {
+		t.Fatalf("add blocker wanted %d got %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if got := actorCommandSeconds.Count() - before; got < 2 {
+		t.Errorf("wanted the link and the read on the actor, %d commands ran", got)
+	}
+}
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"iter"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+// The feeds list the activity the stored items show, the times are saved
+// with the items so the feeds read the same after a restart or on a follower.
+
+const (
+	feedCreated   = "created"
+	feedCompleted = "completed"
+	feedDeleted   = "deleted"
+
+	defaultFeedLimit = 50
+	maxFeedLimit     = 500
+)
+
+// feedEvent is a task created, completed or deleted
+type feedEvent struct {
+	kind string
+	item store.TodoListItem
+	at   time.Time
+}
+
+// the order of a task's events made at the same time, newest first
+var feedOrder = map[string]int{feedDeleted: 0, feedCompleted: 1, feedCreated: 2}
+
+// feedEvents is the events of the items and of the deleted ones kept as
+// tombstones, newest first. A task is created at its created time, completed
+// when its state last changed and deleted when it was buried.
+func feedEvents(items iter.Seq[store.TodoListItem], buried store.TodoListItems) []feedEvent {
+	events := []feedEvent{}
+	for item := range items {
+		events = appendItemEvents(events, item)
+	}
+	for _, item := range buried {
+		events = appendItemEvents(events, item)
+		events = append(events, feedEvent{kind: feedDeleted, item: item, at: hlcTime(item.Deleted, item.Updated)})
+	}
+	slices.SortFunc(events, func(a feedEvent, b feedEvent) int {
+		return cmp.Or(b.at.Compare(a.at), cmp.Compare(feedOrder[a.kind], feedOrder[b.kind]), cmp.Compare(a.item.Line, b.item.Line))
+	})
+	return events
+}
+
+func appendItemEvents(events []feedEvent, item store.TodoListItem) []feedEvent {
+	events = append(events, feedEvent{kind: feedCreated, item: item, at: item.Created})
+	if item.State == store.StateCompleted {
+		events = append(events, feedEvent{kind: feedCompleted, item: item, at: hlcTime(item.Clocks.State, item.Updated)})
+	}
+	return events
+}
+
+// the wall time of the clock, or of fallback for an item saved before the clocks
+func hlcTime(clock store.HLC, fallback time.Time) time.Time {
+	if clock.IsZero() {
+		return fallback.UTC()
+	}
+	return time.Unix(0, clock.Wall).UTC()
+}
+
+// the events matching ?state=n and every ?tag=, at most ?limit=
+func filterFeed(r *http.Request, events []feedEvent) []feedEvent {
+	state := listFilter(r)
+	tags := []string{}
+	for _, t := range r.URL.Query()["tag"] {
+		tags = append(tags, store.ParseTags(t)...)
+	}
+	limit := defaultFeedLimit
+	if n, ok := strconv.Atoi(r.URL.Query().Get("limit")); ok == nil && n > 0 {
+		limit = min(n, maxFeedLimit)
+	}
+	matched := []feedEvent{}
+	for _, e := range events {
+		if len(matched) == limit {
+			break
+		}
+		if state != filterAll && e.item.State != state {
+			continue
+		}
+		if slices.ContainsFunc(tags, func(t string) bool { return !slices.Contains(e.item.Tags, t) }) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	return matched
+}
+
+// the server as the client reached it, for links in the feed
+func baseUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (e feedEvent) title() string {
+	switch e.kind {
+	case feedCreated:
+		return "Created: " + e.item.Description
+	case feedCompleted:
+		return "Completed: " + e.item.Description
+	}
+	return "Deleted: " + e.item.Description
+}
+
+// the task's page, the list once it is deleted
+func (e feedEvent) link(base string) string {
+	if e.kind == feedDeleted {
+		return base + "/list"
+	}
+	return fmt.Sprintf("%s/list/%d", base, e.item.Line)
+}
+
+// stable across fetches so readers do not show an event twice
+func (e feedEvent) id() string {
+	return fmt.Sprintf("urn:appcli:task:%d:%s:%d", e.item.Line, e.kind, e.at.UnixNano())
+}
+
+func (e feedEvent) summary() string {
+	text := store.StatusName[e.item.State]
+	for _, t := range e.item.Tags {
+		text += " #" + t
+	}
+	return text
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	Id         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Summary    string         `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title      string   `xml:"title"`
+	Link       string   `xml:"link"`
+	Guid       rssGuid  `xml:"guid"`
+	PubDate    string   `xml:"pubDate"`
+	Desc       string   `xml:"description"`
+	Categories []string `xml:"category"`
+}
+
+type rssGuid struct {
+	Value     string `xml:",chardata"`
+	Permalink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssFeed struct {
+	XMLName   xml.Name  `xml:"rss"`
+	Version   string    `xml:"version,attr"`
+	Title     string    `xml:"channel>title"`
+	Link      string    `xml:"channel>link"`
+	Desc      string    `xml:"channel>description"`
+	LastBuild string    `xml:"channel>lastBuildDate"`
+	Items     []rssItem `xml:"channel>item"`
+}
+
+const feedTitle = "Todo list activity"
+
+// the newest event's time, now when there are none
+func feedUpdated(events []feedEvent) time.Time {
+	if len(events) > 0 {
+		return events[0].at
+	}
+	return time.Now()
+}
+
+// the events of the list matching the query, false with the answer written
+// when the list cannot be read
+func readFeed(w http.ResponseWriter, r *http.Request) ([]feedEvent, bool) {
+	list, ok := actorGet(store.GetList)
+	if ok != nil {
+		listFailed(w, ok)
+		return nil, false
+	}
+	return filterFeed(r, feedEvents(list.All(), store.Tombstones())), true
+}
+
+// FeedAtom is recent activity as an Atom feed, GET /feed.atom?state=2&tag=home
+func FeedAtom(w http.ResponseWriter, r *http.Request) {
+	events, found := readFeed(w, r)
+	if !found {
+		return
+	}
+	base := baseUrl(r)
+	feed := atomFeed{
+		Title:   feedTitle,
+		Id:      base + "/feed.atom",
+		Updated: feedUpdated(events).UTC().Format(time.RFC3339),
+		Author:  "appcli",
+		// the query may hold the token, it stays out of the feed
+		Links:   []atomLink{{Href: base + r.URL.Path, Rel: "self"}, {Href: base + "/list"}},
+		Entries: []atomEntry{},
+	}
+	for _, e := range events {
+		entry := atomEntry{Title: e.title(), Id: e.id(), Updated: e.at.UTC().Format(time.RFC3339), Link: atomLink{Href: e.link(base)}, Summary: e.summary()}
+		for _, t := range e.item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: t})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	writeFeed(w, r, "application/atom+xml; charset=utf-8", feed)
+}
+
+// FeedRss is recent activity as an RSS 2.0 feed, GET /feed.rss?state=2&tag=home
+func FeedRss(w http.ResponseWriter, r *http.Request) {
+	events, found := readFeed(w, r)
+	if !found {
+		return
+	}
+	base := baseUrl(r)
+	feed := rssFeed{
+		Version:   "2.0",
+		Title:     feedTitle,
+		Link:      base + "/list",
+		Desc:      "Tasks created, completed and deleted",
+		LastBuild: feedUpdated(events).UTC().Format(time.RFC1123Z),
+		Items:     []rssItem{},
+	}
+	for _, e := range events {
+		feed.Items = append(feed.Items, rssItem{
+			Title:      e.title(),
+			Link:       e.link(base),
+			Guid:       rssGuid{Value: e.id()},
+			PubDate:    e.at.UTC().Format(time.RFC1123Z),
+			Desc:       e.summary(),
+			Categories: e.item.Tags,
+		})
+	}
+	writeFeed(w, r, "application/rss+xml; charset=utf-8", feed)
+}
+
+func writeFeed(w http.ResponseWriter, r *http.Request, contentType string, feed any) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	out := xml.NewEncoder(w)
+	out.Indent("", "  ")
+	if ok := out.Encode(feed); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Feed", "path", r.URL.Path, "error", ok)
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/config"
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestFeedEvents(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2026, 1, 2, 3, minute, 0, 0, time.UTC) }
+	clock := func(minute int) store.HLC { return store.HLC{Wall: at(minute).UnixNano()} }
+	items := []store.TodoListItem{
+		{Line: 1, State: store.StateStarted, Created: at(1), Clocks: store.FieldClocks{State: clock(5)}},
+		{Line: 2, State: store.StateCompleted, Created: at(2), Clocks: store.FieldClocks{State: clock(4)}},
+		// saved before the clocks, completed when last updated
+		{Line: 3, State: store.StateCompleted, Created: at(0), Updated: at(3)},
+	}
+	buried := store.TodoListItems{
+		4: {Line: 4, Created: at(6), Deleted: clock(6)},
+	}
+	got := []string{}
+	for _, e := range feedEvents(slices.Values(items), buried) {
+		got = append(got, fmt.Sprintf("%s %d %d", e.kind, e.item.Line, e.at.Minute()))
+	}
+	want := "deleted 4 6,created 4 6,completed 2 4,completed 3 3,created 2 2,created 1 1,created 3 0"
+	if strings.Join(got, ",") != want {
+		t.Errorf("wanted %s got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	cfg := config.Default()
+	cfg.AutosaveInterval = 0
+	server := newServer(t.Context(), cfg)
+	t.Cleanup(func() {
+		handleShutdown(t.Context(), server, "test")
+		shuttingDown.Store(false)
+	})
+	handler := server.srv.Handler
+
+	ctx := t.Context()
+	home, _ := store.AddTaskWithTags(ctx, "Feed the cat", []string{"home"})
+	work, _ := store.AddTaskWithTags(ctx, "File the report", []string{"office"})
+	store.StateChange(ctx, home, store.StateCompleted)
+	store.DeleteTask(ctx, work)
+	defer store.DeleteTask(ctx, home)
+	// the times are saved with the items, a restart reads the same feed
+	if ok := store.Commit(ctx); ok != nil {
+		t.Fatal(ok)
+	}
+	if ok := store.OpenSession(ctx, store.DataFile()); ok != nil {
+		t.Fatal(ok)
+	}
+
+	var tests = []struct {
+		target string
+		want   []string
+	}{
+		{target: "/feed.atom", want: []string{"Deleted: File the report", "Completed: Feed the cat", "Created: File the report", "Created: Feed the cat"}},
+		{target: "/feed.atom?tag=home", want: []string{"Completed: Feed the cat", "Created: Feed the cat"}},
+		{target: "/feed.atom?state=2&limit=1", want: []string{"Completed: Feed the cat"}},
+	}
+	for _, tc := range tests {
+		w := serve(handler, http.MethodGet, tc.target, "")
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/atom+xml") {
+			t.Fatalf("%s wanted an atom feed got %d %s", tc.target, w.Code, w.Header().Get("Content-Type"))
+		}
+		var feed atomFeed
+		if ok := xml.NewDecoder(w.Body).Decode(&feed); ok != nil {
+			t.Fatal(ok)
+		}
+		got := []string{}
+		for _, e := range feed.Entries {
+			if strings.HasSuffix(e.Title, "the cat") || strings.HasSuffix(e.Title, "the report") {
+				got = append(got, e.Title)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s wanted %v got %v", tc.target, tc.want, got)
+		}
+	}
+
+	// other tests leave deleted tasks behind, the tag is only on this one
+	w := serve(handler, http.MethodGet, "/feed.rss?tag=office", "")
+	var rss rssFeed
+	if ok := xml.NewDecoder(w.Body).Decode(&rss); ok != nil || w.Code != http.StatusOK {
+		t.Fatalf("rss %d %v", w.Code, ok)
+	}
+	if len(rss.Items) != 2 || rss.Items[1].Link != fmt.Sprintf("http://example.com/list/%d", work) {
+		t.Errorf("unexpected rss items %+v", rss.Items)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/anthriscus/appcli/config"
+	"github.com/anthriscus/appcli/grpcapi/todopb"
+)
+
+// grpc and the http api answer on the one port, an open watch does not hold up the shutdown
+func TestGrpcSharesListener(t *testing.T) {
+	ctx := t.Context()
+	cfg := config.Default()
+	cfg.ShutdownTimeout = 5 * time.Second
+	cfg.AutosaveInterval = 0
+
+	listener, ok := net.Listen("tcp", "127.0.0.1:0")
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	server := newServer(ctx, cfg)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+	go server.srv.Serve(listener)
+	addr := listener.Addr().String()
+
+	resp, ok := http.Get("http://" + addr + "/healthz")
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("healthz wanted 200 got %d", resp.StatusCode)
+	}
+
+	conn, ok := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	defer conn.Close()
+	client := todopb.NewTodoStoreClient(conn)
+	task, ok := client.Create(ctx, &todopb.CreateRequest{Description: "Over grpc"})
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	got, ok := client.Get(ctx, &todopb.GetRequest{Line: task.Line})
+	if ok != nil || got.Description != "Over grpc" {
+		t.Errorf("get %v %v", got, ok)
+	}
+
+	stream, ok := client.Watch(ctx, &todopb.WatchRequest{})
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	client.Delete(ctx, &todopb.DeleteRequest{Line: task.Line})
+	if event, ok := stream.Recv(); ok != nil || event.Kind != todopb.TaskEvent_DELETED {
+		t.Fatalf("wanted the delete event got %v %v", event, ok)
+	}
+
+	start := time.Now()
+	if ok := handleShutdown(ctx, server, "test"); ok != nil {
+		t.Fatalf("shutdown failed %s", ok)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("shutdown waited %s on the watch stream", took)
+	}
+	if _, ok := stream.Recv(); status.Code(ok) != codes.Unavailable {
+		t.Errorf("wanted Unavailable after shutdown got %v", ok)
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+type readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"` // ok or the reason it failed
+}
+
+type versionInfo struct {
+	Version     string    `json:"version"`
+	Revision    string    `json:"revision"`
+	RevisionAt  string    `json:"revisionTime,omitempty"`
+	Modified    bool      `json:"modified"`
+	GoVersion   string    `json:"goVersion"`
+	Started     time.Time `json:"started"`
+	Uptime      string    `json:"uptime"`
+	Items       int       `json:"items"`
+	Description string    `json:"description"`
+}
+
+var (
+	startTime     = time.Now().UTC()
+	shuttingDown  atomic.Bool  // readiness fails once shutdown starts
+	actorsRunning atomic.Int32 // api actors in their command loop
+)
+
+// process is alive, nothing more
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ready for traffic, 503 with the failing checks when not
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	ready := readinessChecks(r.Context())
+	if !ready.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if ok := json.NewEncoder(w).Encode(&ready); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Readyz", "error", ok)
+	}
+}
+
+func Version(w http.ResponseWriter, r *http.Request) {
+	info := buildInfo()
+	if ok := json.NewEncoder(w).Encode(&info); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Version", "error", ok)
+	}
+}
+
+func readinessChecks(ctx context.Context) readiness {
+	checks := map[string]string{
+		"shutdown": "ok",
+		"store":    "ok",
+		"actor":    "ok",
+		"save":     "ok",
+		"disk":     "ok",
+	}
+	if shuttingDown.Load() {
+		checks["shutdown"] = "shutting down"
+	}
+	if store.Remote() {
+		// the store servers keep and save the list
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		if ok := store.Ping(pingCtx); ok != nil {
+			checks["store"] = ok.Error()
+		}
+		cancel()
+	} else if !store.IsOpen() || store.DataFile() == "" {
+		checks["store"] = "store not opened"
+	} else if !store.ActorRunning() {
+		checks["store"] = "store actor not running"
+	}
+	if replication != nil && replication.Following() {
+		checks["replication"] = "ok"
+		if state := replication.Status().Following; state != nil && !state.Synced {
+			checks["replication"] = "catching up with the leader"
+		}
+	}
+	if actorsRunning.Load() == 0 {
+		checks["actor"] = "api actor not running"
+	}
+	if stats := store.Stats(); stats.LastError != "" {
+		checks["save"] = "last save failed: " + stats.LastError
+	}
+	if store.DataFile() != "" {
+		if ok := diskWritable(filepath.Dir(store.DataFile())); ok != nil {
+			checks["disk"] = ok.Error()
+		}
+	}
+
+	ready := true
+	for _, v := range checks {
+		ready = ready && v == "ok"
+	}
+	return readiness{Ready: ready, Checks: checks}
+}
+
+// the folder the list is saved in accepts a new file
+func diskWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+func buildInfo() versionInfo {
+	info := versionInfo{
+		Version:     "(devel)",
+		Revision:    "unknown",
+		Started:     startTime,
+		Uptime:      time.Since(startTime).Round(time.Second).String(),
+		Description: StoreDescription,
+	}
+	if store.Remote() || store.IsOpen() && store.ActorRunning() {
+		info.Items = store.Count()
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Version = bi.Main.Version
+		info.GoVersion = bi.GoVersion
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.time":
+				info.RevisionAt = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	return info
+}
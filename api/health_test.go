@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	var tests = []struct {
+		handler  http.HandlerFunc
+		shutdown bool
+		want     int
+	}{
+		{handler: Healthz, want: http.StatusOK},
+		{handler: Readyz, want: http.StatusOK},
+		{handler: Version, want: http.StatusOK},
+		// readiness flips while shutting down, liveness does not
+		{handler: Readyz, shutdown: true, want: http.StatusServiceUnavailable},
+		{handler: Healthz, shutdown: true, want: http.StatusOK},
+	}
+	defer shuttingDown.Store(false)
+
+	for i, tc := range tests {
+		shuttingDown.Store(tc.shutdown)
+		w := httptest.NewRecorder()
+		tc.handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := w.Result().StatusCode; got != tc.want {
+			t.Errorf("test %d wanted: %d got: %d body: %s", i, tc.want, got, w.Body.String())
+		}
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	w := httptest.NewRecorder()
+	Version(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var info versionInfo
+	if ok := json.Unmarshal(w.Body.Bytes(), &info); ok != nil {
+		t.Fatalf("bad version json %s", ok)
+	}
+	if info.Items == 0 {
+		t.Errorf("version should count the sample items")
+	} else if info.Started.IsZero() || info.GoVersion == "" {
+		t.Errorf("version missing start time or go version %+v", info)
+	}
+}
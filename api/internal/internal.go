@@ -3,32 +3,40 @@ package internal
 import (
 	"fmt"
 	"math/rand"
+	"time"
 
 	"github.com/anthriscus/appcli/store"
 )
 
-func dummyTaskItem() store.TodoListItem {
-	return store.TodoListItem{Description: dummyTaskDescription()}
+func dummyTaskItem(random *rand.Rand) store.TodoListItem {
+	return store.TodoListItem{Description: dummyTaskDescription(random)}
 }
 
-func dummyTaskDescription() string {
-	return fmt.Sprintf("Buy %d apples for %s", rand.Intn(1e4), randomString(62))
+func dummyTaskDescription(random *rand.Rand) string {
+	return fmt.Sprintf("Buy %d apples for %s", random.Intn(1e4), randomString(random, 62))
 }
 
-func randomString(length int) string {
+func randomString(random *rand.Rand, length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	result := make([]byte, length)
 
 	for i := range result {
-		result[i] = charset[rand.Intn(len(charset))]
+		result[i] = charset[random.Intn(len(charset))]
 	}
 	return string(result)
 }
 
 func GenerateDummyTasks(size int64) store.TodoListItems {
+	return GenerateSeededTasks(size, time.Now().UnixNano())
+}
+
+// GenerateSeededTasks gives the same tasks for the same seed, for benchmarks
+// that are compared between runs
+func GenerateSeededTasks(size int64, seed int64) store.TodoListItems {
+	random := rand.New(rand.NewSource(seed))
 	items := store.TodoListItems{}
 	for i := range size {
-		items[i] = dummyTaskItem()
+		items[i] = dummyTaskItem(random)
 	}
 	return items
 }
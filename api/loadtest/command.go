@@ -0,0 +1,60 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Command runs the loadtest sub command, args are the ones after "loadtest".
+// defaults carries the target and token worked out from the app config.
+func Command(ctx context.Context, defaults Config, args []string, w io.Writer) error {
+	cfg := defaults
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	flags.SetOutput(w)
+	flags.StringVar(&cfg.Target, "target", cfg.Target, "server base url")
+	flags.StringVar(&cfg.Token, "token", cfg.Token, "bearer token when the server needs auth (default from config auth.token)")
+	flags.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "parallel clients")
+	flags.Float64Var(&cfg.Rate, "rate", cfg.Rate, "requests per second over all clients, 0 is as fast as possible")
+	flags.DurationVar(&cfg.Duration, "duration", cfg.Duration, "how long to run")
+	flags.Int64Var(&cfg.Requests, "requests", cfg.Requests, "total requests to send instead of a duration")
+	flags.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "per request timeout")
+	mix := flags.String("mix", cfg.Mix.String(), "weights of each operation, create get list update delete")
+	asJson := flags.Bool("json", false, "write the report as json instead of text")
+	out := flags.String("out", "", "also save the json report to this file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	if cfg.Mix, err = ParseMix(*mix); err != nil {
+		return err
+	}
+
+	if !*asJson {
+		fmt.Fprintf(w, "Load testing %s with %d clients, mix %s\n\n", cfg.Target, cfg.Concurrency, cfg.Mix)
+	}
+	report, err := Run(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if *asJson {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(&report); err != nil {
+			return err
+		}
+	} else {
+		report.WriteText(w)
+	}
+	if *out != "" {
+		data, err := json.MarshalIndent(&report, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(*out, data, 0644)
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+// Package loadtest drives a running server with a mix of api calls and reports
+// throughput, errors and latency. Updates and deletes only touch tasks the run
+// created itself so existing lists are not damaged.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthriscus/appcli/api/internal"
+	"github.com/anthriscus/appcli/store"
+)
+
+const (
+	OpCreate string = "create"
+	OpGet    string = "get"
+	OpList   string = "list"
+	OpUpdate string = "update"
+	OpDelete string = "delete"
+)
+
+// operations in report order
+var operations = []string{OpCreate, OpGet, OpList, OpUpdate, OpDelete}
+
+// number of payloads generated up front and cycled through
+const payloadCount = 1000
+
+// Mix is the relative weight of each operation
+type Mix map[string]int
+
+type Config struct {
+	Target      string        // base url of the server such as http://localhost:8080
+	Token       string        // bearer token when the server has auth turned on
+	Concurrency int           // parallel clients
+	Rate        float64       // requests per second over all clients, 0 is as fast as possible
+	Duration    time.Duration // how long to run, ignored when Requests is set
+	Requests    int64         // total requests to send, 0 runs for Duration
+	Timeout     time.Duration // per request
+	Mix         Mix
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Target:      "http://localhost:8080",
+		Concurrency: 10,
+		Duration:    10 * time.Second,
+		Timeout:     10 * time.Second,
+		Mix:         Mix{OpCreate: 20, OpGet: 40, OpList: 10, OpUpdate: 20, OpDelete: 10},
+	}
+}
+
+// ParseMix reads weights such as "create=20,get=40,list=10"
+func ParseMix(value string) (Mix, error) {
+	mix := Mix{}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		op, weight, found := strings.Cut(part, "=")
+		op = strings.ToLower(strings.TrimSpace(op))
+		if !found || !slices.Contains(operations, op) {
+			return nil, fmt.Errorf("mix %q should be op=weight with op one of %s", part, strings.Join(operations, ", "))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("mix %q weight is not a whole number", part)
+		}
+		mix[op] = n
+	}
+	total := 0
+	for _, n := range mix {
+		total += n
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("mix %q has no operations", value)
+	}
+	return mix, nil
+}
+
+func (m Mix) String() string {
+	parts := []string{}
+	for _, op := range operations {
+		if m[op] > 0 {
+			parts = append(parts, op+"="+strconv.Itoa(m[op]))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// pick an operation by weight
+func (m Mix) pick(r *rand.Rand) string {
+	total := 0
+	for _, op := range operations {
+		total += m[op]
+	}
+	n := r.Intn(total)
+	for _, op := range operations {
+		if n < m[op] {
+			return op
+		}
+		n -= m[op]
+	}
+	return OpList
+}
+
+// ids of tasks the run created, the only ones it updates or deletes.
+// An id in use by a get or update is not handed out for delete.
+type taskPool struct {
+	mutex sync.Mutex
+	ids   []int64
+	inUse map[int64]int
+}
+
+func (p *taskPool) add(id int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.ids = append(p.ids, id)
+}
+
+// borrow an id, give it back with release
+func (p *taskPool) borrow(r *rand.Rand) (int64, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.ids) == 0 {
+		return 0, false
+	}
+	id := p.ids[r.Intn(len(p.ids))]
+	if p.inUse == nil {
+		p.inUse = map[int64]int{}
+	}
+	p.inUse[id]++
+	return id, true
+}
+
+func (p *taskPool) release(id int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.inUse[id]--; p.inUse[id] <= 0 {
+		delete(p.inUse, id)
+	}
+}
+
+// take removes an id nobody is using so it can be deleted
+func (p *taskPool) take(r *rand.Rand) (int64, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.ids) == 0 {
+		return 0, false
+	}
+	start := r.Intn(len(p.ids))
+	for n := range len(p.ids) {
+		i := (start + n) % len(p.ids)
+		if id := p.ids[i]; p.inUse[id] == 0 {
+			p.ids[i] = p.ids[len(p.ids)-1]
+			p.ids = p.ids[:len(p.ids)-1]
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+type runner struct {
+	cfg      Config
+	client   *http.Client
+	pool     taskPool
+	payloads store.TodoListItems
+	sent     atomic.Int64
+}
+
+// Run sends requests until the duration or request count is reached, or ctx ends
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	if cfg.Concurrency < 1 {
+		return Report{}, fmt.Errorf("concurrency must be at least 1")
+	}
+	if cfg.Requests <= 0 && cfg.Duration <= 0 {
+		return Report{}, fmt.Errorf("need a duration or a request count")
+	}
+	cfg.Target = strings.TrimSuffix(cfg.Target, "/")
+	r := &runner{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		payloads: internal.GenerateDummyTasks(payloadCount),
+	}
+
+	if cfg.Requests <= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	// one shared ticker hands out turns when a rate is set
+	var turns <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+		defer ticker.Stop()
+		turns = ticker.C
+	}
+
+	started := time.Now()
+	results := make([]clientStats, cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i := range cfg.Concurrency {
+		wg.Add(1)
+		go func(clientId int) {
+			defer wg.Done()
+			results[clientId] = r.clientLoop(ctx, clientId, turns)
+		}(i)
+	}
+	wg.Wait()
+	return buildReport(cfg, time.Since(started), results), nil
+}
+
+// one client sending requests one after another
+func (r *runner) clientLoop(ctx context.Context, clientId int, turns <-chan time.Time) clientStats {
+	random := rand.New(rand.NewSource(time.Now().UnixNano() + int64(clientId)))
+	stats := newClientStats()
+	for {
+		if turns != nil {
+			select {
+			case <-ctx.Done():
+				return stats
+			case <-turns:
+			}
+		}
+		if ctx.Err() != nil {
+			return stats
+		}
+		n := r.sent.Add(1)
+		if r.cfg.Requests > 0 && n > r.cfg.Requests {
+			return stats
+		}
+		op := r.cfg.Mix.pick(random)
+		started := time.Now()
+		op, code, err := r.do(ctx, op, random, n)
+		// requests cut off by the end of the run are not counted
+		if ctx.Err() != nil && err != nil {
+			return stats
+		}
+		stats.record(op, time.Since(started), code, err)
+	}
+}
+
+// do sends one operation, update and delete become a create until the run has tasks of its own
+func (r *runner) do(ctx context.Context, op string, random *rand.Rand, n int64) (string, int, error) {
+	payload := r.payloads[n%payloadCount]
+	switch op {
+	case OpGet:
+		if id, found := r.pool.borrow(random); found {
+			defer r.pool.release(id)
+			code, _, err := r.send(ctx, http.MethodGet, "/get/"+strconv.FormatInt(id, 10), nil, http.StatusOK)
+			return op, code, err
+		}
+		code, _, err := r.send(ctx, http.MethodGet, "/get", nil, http.StatusOK)
+		return OpList, code, err
+	case OpList:
+		code, _, err := r.send(ctx, http.MethodGet, "/get", nil, http.StatusOK)
+		return op, code, err
+	case OpUpdate:
+		if id, found := r.pool.borrow(random); found {
+			defer r.pool.release(id)
+			payload.Line = id
+			payload.State = random.Intn(3)
+			code, _, err := r.send(ctx, http.MethodPut, "/update", &payload, http.StatusOK)
+			return op, code, err
+		}
+	case OpDelete:
+		if id, found := r.pool.take(random); found {
+			code, _, err := r.send(ctx, http.MethodDelete, "/delete/"+strconv.FormatInt(id, 10), nil, http.StatusNoContent)
+			return op, code, err
+		}
+	}
+	code, body, err := r.send(ctx, http.MethodPost, "/create", &payload, http.StatusCreated)
+	if err == nil {
+		var created store.TodoListItem
+		if json.Unmarshal(body, &created) == nil {
+			r.pool.add(created.Line)
+		}
+	}
+	return OpCreate, code, err
+}
+
+// send one request, any status other than want is an error
+func (r *runner) send(ctx context.Context, method string, path string, item *store.TodoListItem, want int) (int, []byte, error) {
+	var body io.Reader
+	if item != nil {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.cfg.Target+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.cfg.Token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	if resp.StatusCode != want {
+		return resp.StatusCode, data, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return resp.StatusCode, data, nil
+}
@@ -0,0 +1,201 @@
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+// just enough of the api for the load test to drive, it fails the test when
+// asked about a task the run did not create or has already deleted
+func fakeServer(t *testing.T, failList bool) *httptest.Server {
+	var mutex sync.Mutex
+	items := map[int64]bool{}
+	var next int64
+	known := func(w http.ResponseWriter, id int64) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !items[id] {
+			t.Errorf("request for unknown task %d", id)
+			w.WriteHeader(http.StatusBadRequest)
+			return false
+		}
+		return true
+	}
+	pathId := func(r *http.Request) int64 {
+		id, _ := strconv.ParseInt(r.PathValue("taskId"), 10, 64)
+		return id
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /create", func(w http.ResponseWriter, r *http.Request) {
+		var item store.TodoListItem
+		json.NewDecoder(r.Body).Decode(&item)
+		mutex.Lock()
+		next++
+		item.Line = next
+		items[item.Line] = true
+		mutex.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&item)
+	})
+	mux.HandleFunc("GET /get", func(w http.ResponseWriter, r *http.Request) {
+		if failList {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("GET /get/{taskId}", func(w http.ResponseWriter, r *http.Request) {
+		if known(w, pathId(r)) {
+			w.Write([]byte("{}"))
+		}
+	})
+	mux.HandleFunc("PUT /update", func(w http.ResponseWriter, r *http.Request) {
+		var item store.TodoListItem
+		json.NewDecoder(r.Body).Decode(&item)
+		if known(w, item.Line) {
+			w.Write([]byte("{}"))
+		}
+	})
+	mux.HandleFunc("DELETE /delete/{taskId}", func(w http.ResponseWriter, r *http.Request) {
+		if id := pathId(r); known(w, id) {
+			mutex.Lock()
+			delete(items, id)
+			mutex.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRunRequests(t *testing.T) {
+	server := fakeServer(t, false)
+	cfg := DefaultConfig()
+	cfg.Target = server.URL
+	cfg.Requests = 500
+	cfg.Concurrency = 8
+
+	report, ok := Run(t.Context(), cfg)
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	if report.Requests != cfg.Requests {
+		t.Errorf("wanted %d requests got %d", cfg.Requests, report.Requests)
+	}
+	if report.Errors != 0 {
+		t.Errorf("wanted no errors got %d %v", report.Errors, report.FirstErrors)
+	}
+	var total int64
+	for op, o := range report.Operations {
+		total += o.Requests
+		if o.Latency.P50 > o.Latency.P99 || o.Latency.P99 > o.Latency.Max {
+			t.Errorf("%s percentiles out of order %+v", op, o.Latency)
+		}
+	}
+	if total != report.Requests || report.StatusCodes["200"]+report.StatusCodes["201"]+report.StatusCodes["204"] != total {
+		t.Errorf("operation and status counts do not add up %+v", report)
+	}
+}
+
+func TestRunErrorsAndDuration(t *testing.T) {
+	server := fakeServer(t, true)
+	cfg := DefaultConfig()
+	cfg.Target = server.URL
+	cfg.Duration = 200 * time.Millisecond
+	cfg.Concurrency = 2
+	cfg.Mix = Mix{OpList: 1}
+
+	started := time.Now()
+	report, ok := Run(t.Context(), cfg)
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("run overran its duration %s", elapsed)
+	}
+	if report.Requests == 0 || report.Errors != report.Requests || report.ErrorRate != 1 {
+		t.Errorf("every list should fail %+v", report)
+	}
+	if report.StatusCodes["500"] != report.Requests || len(report.FirstErrors) == 0 {
+		t.Errorf("status codes or errors not reported %+v", report)
+	}
+}
+
+func TestRate(t *testing.T) {
+	server := fakeServer(t, false)
+	cfg := DefaultConfig()
+	cfg.Target = server.URL
+	cfg.Rate = 100
+	cfg.Requests = 20
+	cfg.Mix = Mix{OpList: 1}
+
+	started := time.Now()
+	if _, ok := Run(t.Context(), cfg); ok != nil {
+		t.Fatal(ok)
+	}
+	// 20 turns at 100 a second cannot finish much under 200ms
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond {
+		t.Errorf("rate not applied, 20 requests took %s", elapsed)
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	var tests = []struct {
+		value string
+		want  Mix
+		fails bool
+	}{
+		{value: "create=1,get=2", want: Mix{OpCreate: 1, OpGet: 2}},
+		{value: " LIST = 5 ", want: Mix{OpList: 5}},
+		{value: "create=0", fails: true},
+		{value: "fetch=1", fails: true},
+		{value: "get=x", fails: true},
+		{value: "", fails: true},
+	}
+	for _, tc := range tests {
+		got, ok := ParseMix(tc.value)
+		if tc.fails != (ok != nil) {
+			t.Errorf("ParseMix(%q) error %v", tc.value, ok)
+		} else if !tc.fails && got.String() != tc.want.String() {
+			t.Errorf("ParseMix(%q) wanted %s got %s", tc.value, tc.want, got)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := []time.Duration{}
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	l := summarise(latencies)
+	if l.P50 != 50 || l.P90 != 90 || l.P99 != 99 || l.Max != 100 || l.Min != 1 || l.Mean != 50.5 {
+		t.Errorf("unexpected percentiles %+v", l)
+	}
+}
+
+func TestCommandJson(t *testing.T) {
+	server := fakeServer(t, false)
+	var out bytes.Buffer
+	args := []string{"-target", server.URL, "-requests", "50", "-mix", "create=1,get=1", "-json"}
+	if ok := Command(t.Context(), DefaultConfig(), args, &out); ok != nil {
+		t.Fatal(ok)
+	}
+	var report Report
+	if ok := json.Unmarshal(out.Bytes(), &report); ok != nil {
+		t.Fatalf("report is not json %s\n%s", ok, out.String())
+	}
+	if report.Requests != 50 || !strings.Contains(report.Mix, "get=1") {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,186 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Latency in milliseconds so the json reads without unit conversion
+type Latency struct {
+	Min  float64 `json:"minMs"`
+	Mean float64 `json:"meanMs"`
+	P50  float64 `json:"p50Ms"`
+	P90  float64 `json:"p90Ms"`
+	P95  float64 `json:"p95Ms"`
+	P99  float64 `json:"p99Ms"`
+	Max  float64 `json:"maxMs"`
+}
+
+type OpReport struct {
+	Requests int64   `json:"requests"`
+	Errors   int64   `json:"errors"`
+	Latency  Latency `json:"latency"`
+}
+
+type Report struct {
+	Target      string              `json:"target"`
+	Concurrency int                 `json:"concurrency"`
+	Rate        float64             `json:"rate"` // requested, 0 is unlimited
+	Mix         string              `json:"mix"`
+	Elapsed     string              `json:"elapsed"`
+	Requests    int64               `json:"requests"`
+	Errors      int64               `json:"errors"`
+	Throughput  float64             `json:"throughput"` // requests per second
+	ErrorRate   float64             `json:"errorRate"`  // 0 to 1
+	Latency     Latency             `json:"latency"`
+	Operations  map[string]OpReport `json:"operations"`
+	StatusCodes map[string]int64    `json:"statusCodes"` // "error" when no response came back
+	FirstErrors []string            `json:"firstErrors,omitempty"`
+}
+
+// most errors listed in a report, the counts cover the rest
+const keepErrors = 5
+
+// what one client saw, merged into the report at the end
+type clientStats struct {
+	latencies map[string][]time.Duration
+	errors    map[string]int64
+	codes     map[string]int64
+	messages  []string
+}
+
+func newClientStats() clientStats {
+	return clientStats{latencies: map[string][]time.Duration{}, errors: map[string]int64{}, codes: map[string]int64{}}
+}
+
+func (s *clientStats) record(op string, elapsed time.Duration, code int, err error) {
+	s.latencies[op] = append(s.latencies[op], elapsed)
+	status := "error"
+	if code != 0 {
+		status = strconv.Itoa(code)
+	}
+	s.codes[status]++
+	if err != nil {
+		s.errors[op]++
+		if len(s.messages) < keepErrors {
+			s.messages = append(s.messages, err.Error())
+		}
+	}
+}
+
+func buildReport(cfg Config, elapsed time.Duration, clients []clientStats) Report {
+	report := Report{
+		Target:      cfg.Target,
+		Concurrency: cfg.Concurrency,
+		Rate:        cfg.Rate,
+		Mix:         cfg.Mix.String(),
+		Elapsed:     elapsed.Round(time.Millisecond).String(),
+		Operations:  map[string]OpReport{},
+		StatusCodes: map[string]int64{},
+	}
+	all := []time.Duration{}
+	for _, op := range operations {
+		latencies := []time.Duration{}
+		var errors int64
+		for _, c := range clients {
+			latencies = append(latencies, c.latencies[op]...)
+			errors += c.errors[op]
+		}
+		if len(latencies) == 0 {
+			continue
+		}
+		report.Operations[op] = OpReport{Requests: int64(len(latencies)), Errors: errors, Latency: summarise(latencies)}
+		report.Requests += int64(len(latencies))
+		report.Errors += errors
+		all = append(all, latencies...)
+	}
+	for _, c := range clients {
+		for code, n := range c.codes {
+			report.StatusCodes[code] += n
+		}
+		for _, message := range c.messages {
+			if len(report.FirstErrors) < keepErrors {
+				report.FirstErrors = append(report.FirstErrors, message)
+			}
+		}
+	}
+	report.Latency = summarise(all)
+	if elapsed > 0 {
+		report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	}
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	}
+	return report
+}
+
+func summarise(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sorted := slices.Sorted(slices.Values(latencies))
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+	return Latency{
+		Min:  millis(sorted[0]),
+		Mean: millis(total / time.Duration(len(sorted))),
+		P50:  millis(percentile(sorted, 50)),
+		P90:  millis(percentile(sorted, 90)),
+		P95:  millis(percentile(sorted, 95)),
+		P99:  millis(percentile(sorted, 99)),
+		Max:  millis(sorted[len(sorted)-1]),
+	}
+}
+
+// nearest rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// WriteText writes the report as a table for people
+func (r Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "target       %s\n", r.Target)
+	fmt.Fprintf(w, "concurrency  %d\n", r.Concurrency)
+	if r.Rate > 0 {
+		fmt.Fprintf(w, "rate         %g/s\n", r.Rate)
+	} else {
+		fmt.Fprintf(w, "rate         unlimited\n")
+	}
+	fmt.Fprintf(w, "mix          %s\n", r.Mix)
+	fmt.Fprintf(w, "elapsed      %s\n", r.Elapsed)
+	fmt.Fprintf(w, "requests     %d\n", r.Requests)
+	fmt.Fprintf(w, "throughput   %.1f/s\n", r.Throughput)
+	fmt.Fprintf(w, "errors       %d (%.2f%%)\n\n", r.Errors, r.ErrorRate*100)
+
+	fmt.Fprintf(w, "%-8s %9s %7s %9s %9s %9s %9s %9s %9s\n", "op", "requests", "errors", "mean ms", "p50 ms", "p90 ms", "p95 ms", "p99 ms", "max ms")
+	for _, op := range operations {
+		if o, found := r.Operations[op]; found {
+			writeRow(w, op, o.Requests, o.Errors, o.Latency)
+		}
+	}
+	writeRow(w, "all", r.Requests, r.Errors, r.Latency)
+
+	fmt.Fprintf(w, "\nstatus codes")
+	for _, code := range slices.Sorted(maps.Keys(r.StatusCodes)) {
+		fmt.Fprintf(w, "  %s:%d", code, r.StatusCodes[code])
+	}
+	fmt.Fprintln(w)
+	for _, message := range r.FirstErrors {
+		fmt.Fprintf(w, "error: %s\n", message)
+	}
+}
+
+func writeRow(w io.Writer, op string, requests int64, errors int64, l Latency) {
+	fmt.Fprintf(w, "%-8s %9d %7d %9.2f %9.2f %9.2f %9.2f %9.2f %9.2f\n", op, requests, errors, l.Mean, l.P50, l.P90, l.P95, l.P99, l.Max)
+}
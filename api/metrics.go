@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthriscus/appcli/metrics"
+)
+
+var (
+	httpRequests        = metrics.NewCounter("appcli_http_requests_total", "HTTP requests by route, method and status code.", "route", "method", "code")
+	httpRequestSeconds  = metrics.NewHistogram("appcli_http_request_duration_seconds", "HTTP request latency by route.", metrics.DefaultBuckets, "route")
+	actorQueueDepth     = metrics.NewGauge("appcli_actor_queue_depth", "Commands waiting for or running in the api actor.")
+	actorCommandSeconds = metrics.NewHistogram("appcli_actor_command_duration_seconds", "Time the api actor takes to run a store command.", metrics.DefaultBuckets)
+)
+
+// prometheus text format
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Write(w)
+}
+
+// keeps the status code for the request metrics
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// a streamed response can still flush through the recorder
+func (s *statusRecorder) Flush() {
+	http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+// counts and times every request by the mux pattern it matched
+func metricsMiddleware(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		// the mux fills in the pattern on the way through
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.Inc(route, r.Method, strconv.Itoa(recorder.status))
+		httpRequestSeconds.Observe(time.Since(started).Seconds(), route)
+	})
+}
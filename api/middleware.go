@@ -2,21 +2,39 @@ package api
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/anthriscus/appcli/appcontext"
+	"github.com/anthriscus/appcli/grpcapi"
 	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
 )
 
 func addMiddleware(mux *http.ServeMux) http.HandlerFunc {
 	//muxChain := tracerMiddleware(contentTypeMiddleware(mux))
 	// potential for more middleware wrappers here
 	// but we apply contentType only to REST calls so don't add it to all pathways in here
-	muxChain := tracerMiddleware(mux)
+	muxChain := tracerMiddleware(metricsMiddleware(mux))
 	return muxChain
 }
 
+// grpc calls go to the grpc server, which traces and authorises them itself
+func grpcMiddleware(grpcSrv http.Handler, next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grpcapi.IsGrpc(r.Header.Get("Content-Type"), r.ProtoMajor) {
+			grpcSrv.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func tracerMiddleware(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Printf("ROUTE path: %s\n", r.URL.Path)
@@ -35,3 +53,89 @@ func contentTypeMiddleware(next http.Handler) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// bearer token for the json api and the web pages, empty leaves them open
+var authToken string
+
+// only for api calls, the web pages use webAuthMiddleware
+func authMiddleware(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authToken != "" {
+			want := "Bearer " + authToken
+			if got := r.Header.Get("Authorization"); subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+				logging.Log().WarnContext(r.Context(), "unauthorised", "route", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(jsonError(fmt.Errorf("unauthorised")))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// the web pages' session cookie, a hash of the token so the cookie is no use to the json api
+const authCookieName string = "appcli_session"
+
+func webSession() string {
+	mac := hmac.New(sha256.New, []byte(authToken))
+	mac.Write([]byte("appcli web session"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// a browser cannot send the bearer header, so the web pages are opened once
+// with ?token=, which is swapped for a session cookie and dropped from the url
+func webAuthMiddleware(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authToken == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		query := r.URL.Query()
+		if token := query.Get("token"); token != "" && r.Method == http.MethodGet && subtle.ConstantTimeCompare([]byte(token), []byte(authToken)) == 1 {
+			http.SetCookie(w, &http.Cookie{
+				Name:     authCookieName,
+				Value:    webSession(),
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+			query.Del("token")
+			target := *r.URL
+			target.RawQuery = query.Encode()
+			http.Redirect(w, r, target.RequestURI(), http.StatusSeeOther)
+			return
+		}
+		c, ok := r.Cookie(authCookieName)
+		if ok != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(webSession())) != 1 {
+			logging.Log().WarnContext(r.Context(), "unauthorised", "route", r.URL.Path)
+			http.Error(w, "unauthorised, open the page once with ?token=", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// calendar apps and feed readers can only be given a url, so the token
+// comes in the query and is passed on as the header authMiddleware checks
+func queryTokenMiddleware(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// a follower takes reads only, writes go to its leader
+func readOnlyMiddleware(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if store.ReadOnly() {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(jsonError(store.ErrReadOnly))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	var tests = []struct {
+		token  string
+		header string
+		want   int
+	}{
+		{token: "", header: "", want: http.StatusOK},
+		{token: "s3cret", header: "Bearer s3cret", want: http.StatusOK},
+		{token: "s3cret", header: "", want: http.StatusUnauthorized},
+		{token: "s3cret", header: "Bearer wrong", want: http.StatusUnauthorized},
+		{token: "s3cret", header: "s3cret", want: http.StatusUnauthorized},
+	}
+	defer func() { authToken = "" }()
+
+	for i, tc := range tests {
+		authToken = tc.token
+		req := httptest.NewRequest(http.MethodGet, "/aboutapi", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		w := httptest.NewRecorder()
+		authMiddleware(http.HandlerFunc(AboutJson))(w, req)
+		if got := w.Result().StatusCode; got != tc.want {
+			t.Errorf("test %d wanted: %d got: %d", i, tc.want, got)
+		}
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /aboutapi", AboutJson)
+	mux.HandleFunc("GET /metrics", Metrics)
+	chain := metricsMiddleware(mux)
+	before := httpRequests.Value("GET /aboutapi", http.MethodGet, "200")
+
+	chain(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/aboutapi", nil))
+	chain(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nothing/here", nil))
+	if got := httpRequests.Value("GET /aboutapi", http.MethodGet, "200"); got != before+1 {
+		t.Errorf("request count wanted %v got %v", before+1, got)
+	}
+	if got := httpRequests.Value("unmatched", http.MethodGet, "404"); got < 1 {
+		t.Errorf("unmatched request not counted")
+	}
+
+	// a streamed response can still flush behind the recorder
+	flushed := httptest.NewRecorder()
+	metricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("part"))
+		w.(http.Flusher).Flush()
+	}))(flushed, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if !flushed.Flushed {
+		t.Errorf("flush did not reach the response writer")
+	}
+
+	w := httptest.NewRecorder()
+	chain(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{"appcli_http_requests_total{", "appcli_actor_queue_depth", "appcli_store_items{state=", "appcli_store_save_seconds", "go_goroutines"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestWebAuthMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	authToken = "s3cret"
+	defer func() { authToken = "" }()
+	form := url.Values{"description": {"web auth test"}, csrfFieldName: {testCsrfToken}}
+
+	// no session, a form post with a good csrf token is still refused
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, newFormRequest("/list/create", form, testCsrfToken))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("post without a session wanted 401 got %d", w.Code)
+	}
+	for _, target := range []string{"/list", "/board", "/list?token=wrong"} {
+		if w := serve(mux, http.MethodGet, target, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s wanted 401 got %d", target, w.Code)
+		}
+	}
+
+	// the token is swapped for a cookie and dropped from the url
+	w = serve(mux, http.MethodGet, "/list?state=1&token=s3cret", "")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/list?state=1" {
+		t.Fatalf("sign in wanted a redirect to /list?state=1 got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != authCookieName || strings.Contains(cookies[0].Value, "s3cret") {
+		t.Fatalf("wanted a session cookie without the token got %+v", cookies)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/list", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("list with a session wanted 200 got %d", w.Code)
+	}
+	authToken = "changed"
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("session of an old token wanted 401 got %d", w.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+// SetRecur sets the task's repeat rule, {"recur":"weekly on mon,thu"}, empty or none stops it
+func SetRecur(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	var rule store.TodoListItem
+	if ok := json.NewDecoder(r.Body).Decode(&rule); ok != nil {
+		badRequest(w, fmt.Errorf("invalid json, want the repeat rule"))
+		return
+	}
+	if ok := actorDo(func() error { return store.RecurChange(r.Context(), id, rule.Recur) }); ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeTask(w, r, http.StatusOK, id)
+}
+
+// GetHistory is the completed occurrences of the task's series, oldest first
+func GetHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	history, ok := actorGet(func() ([]store.TodoListItem, error) { return store.History(id) })
+	if errors.Is(ok, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return
+	} else if ok != nil {
+		listFailed(w, ok)
+		return
+	}
+	if ok := json.NewEncoder(w).Encode(history); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "GetHistory", "error", ok)
+	}
+}
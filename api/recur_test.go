@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestRecurRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	ctx := t.Context()
+	task, _ := store.AddTask(ctx, "Water the plants")
+	defer store.DeleteTask(ctx, task)
+	complete := fmt.Sprintf(`{"line":%d,"description":"Water the plants","state":2}`, task)
+
+	var tests = []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{name: "bad rule", method: http.MethodPut, target: fmt.Sprintf("/recur/%d", task), body: `{"recur":"now and then"}`, want: http.StatusBadRequest},
+		{name: "repeat", method: http.MethodPut, target: fmt.Sprintf("/recur/%d", task), body: `{"recur":"weekly on sat"}`, want: http.StatusOK},
+		{name: "complete", method: http.MethodPut, target: "/update", body: complete, want: http.StatusOK},
+		{name: "history", method: http.MethodGet, target: fmt.Sprintf("/history/%d", task), want: http.StatusOK},
+		{name: "missing", method: http.MethodGet, target: "/history/999", want: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		w := serve(mux, tc.method, tc.target, tc.body)
+		if w.Code != tc.want {
+			t.Errorf("%s: wanted %d got %d %s", tc.name, tc.want, w.Code, w.Body.String())
+			continue
+		}
+		switch tc.name {
+		case "repeat":
+			var item store.TodoListItem
+			if json.NewDecoder(w.Body).Decode(&item); item.Recur != "FREQ=WEEKLY;BYDAY=SA" {
+				t.Errorf("%s: wanted the rule kept got %+v", tc.name, item)
+			}
+		case "history":
+			var history []store.TodoListItem
+			if json.NewDecoder(w.Body).Decode(&history); len(history) != 1 || history[0].Line != task {
+				t.Errorf("%s: wanted task %d got %+v", tc.name, task, history)
+			}
+		}
+	}
+	scan, _ := store.Scan()
+	for item := range scan {
+		if item.Series == task {
+			store.DeleteTask(ctx, item.Line)
+		}
+	}
+}
+
+// the repeat routes run on the request actors, a history that cannot be
+// read is the server failing rather than a task not found
+func TestRecurThroughActor(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	ctx := t.Context()
+	task, _ := store.AddTask(ctx, "Feed the fish")
+	defer store.DeleteTask(ctx, task)
+	before := actorCommandSeconds.Count()
+	if w := serve(mux, http.MethodPut, fmt.Sprintf("/recur/%d", task), `{"recur":"daily"}`); w.Code != http.StatusOK {
+		t.Fatalf("repeat wanted %d got %d %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if got := actorCommandSeconds.Count() - before; got < 2 {
+		t.Errorf("wanted the rule and the read on the actor, %d commands ran", got)
+	}
+
+	store.SetBackend(downBackend{})
+	defer store.SetBackend(nil)
+	if w := serve(mux, http.MethodGet, fmt.Sprintf("/history/%d", task), ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("history with the backend down wanted 503 got %d", w.Code)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/replica"
+)
+
+// longest a follower may ask a log read to be held open
+const maxPollWait = time.Minute
+
+// this server's replication, set up by newServer
+var replication *replica.Node
+
+// role, log position, the leader when following and the followers reading our log
+func GetReplication(w http.ResponseWriter, r *http.Request) {
+	if ok := json.NewEncoder(w).Encode(replication.Status()); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "GetReplication", "error", ok)
+	}
+}
+
+// the whole list and the log position it is good from
+func ReplicationSnapshot(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := replication.Log.Snapshot()
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(jsonError(err))
+		return
+	}
+	if ok := json.NewEncoder(w).Encode(&snapshot); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "ReplicationSnapshot", "error", ok)
+	}
+}
+
+// changes after ?epoch=&after=, held open up to ?wait= when there are none.
+// 410 Gone when the position is not in the log, the follower takes a snapshot.
+func ReplicationLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	epoch, epochErr := strconv.ParseInt(query.Get("epoch"), 10, 64)
+	after, afterErr := strconv.ParseUint(query.Get("after"), 10, 64)
+	wait := time.Duration(0)
+	var waitErr error
+	if query.Get("wait") != "" {
+		wait, waitErr = time.ParseDuration(query.Get("wait"))
+	}
+	if err := errors.Join(epochErr, afterErr, waitErr); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(fmt.Errorf("want ?epoch=n&after=n&wait=25s")))
+		return
+	}
+	follower := replica.FollowerSeen{Id: query.Get("follower"), Addr: r.RemoteAddr, Epoch: epoch, Seq: after}
+	batch, err := replication.Poll(r.Context(), follower, min(wait, maxPollWait))
+	if errors.Is(err, replica.ErrBehind) {
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(jsonError(err))
+		return
+	}
+	if ok := json.NewEncoder(w).Encode(&batch); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "ReplicationLog", "error", ok)
+	}
+}
+
+// stops following the leader and takes writes from now on
+func Promote(w http.ResponseWriter, r *http.Request) {
+	if err := replication.Promote(r.Context()); errors.Is(err, replica.ErrNotFollowing) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(jsonError(err))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(jsonError(err))
+		return
+	}
+	if ok := json.NewEncoder(w).Encode(replication.Status()); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Promote", "error", ok)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/config"
+	"github.com/anthriscus/appcli/replica"
+	"github.com/anthriscus/appcli/store"
+)
+
+func serve(handler http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, target, bytes.NewBufferString(body)))
+	return w
+}
+
+// a follower turns away api writes until promoted, reads carry on
+func TestFollowerReadOnly(t *testing.T) {
+	cfg := config.Default()
+	cfg.AutosaveInterval = 0
+	// nothing listens here so the follower never syncs
+	cfg.Follow = "127.0.0.1:1"
+	server := newServer(t.Context(), cfg)
+	t.Cleanup(func() {
+		handleShutdown(t.Context(), server, "test")
+		shuttingDown.Store(false)
+		store.SetReadOnly(false)
+	})
+	handler := server.srv.Handler
+
+	var tests = []struct {
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{method: http.MethodPost, target: "/create", body: `{"description": "to a follower"}`, want: http.StatusForbidden},
+		{method: http.MethodPut, target: "/update", body: `{"line": 1, "description": "to a follower"}`, want: http.StatusForbidden},
+		{method: http.MethodDelete, target: "/delete/1", want: http.StatusForbidden},
+		{method: http.MethodGet, target: "/get", want: http.StatusOK},
+		{method: http.MethodGet, target: "/replication", want: http.StatusOK},
+	}
+	for _, tc := range tests {
+		if w := serve(handler, tc.method, tc.target, tc.body); w.Code != tc.want {
+			t.Errorf("%s %s wanted %d got %d %s", tc.method, tc.target, tc.want, w.Code, w.Body.String())
+		}
+	}
+	if checks := readinessChecks(t.Context()).Checks; checks["replication"] == "ok" {
+		t.Error("a follower that has not caught up should not be ready")
+	}
+
+	w := serve(handler, http.MethodPost, "/replication/promote", "")
+	var status replica.Status
+	json.NewDecoder(w.Body).Decode(&status)
+	if w.Code != http.StatusOK || status.Role != replica.RoleLeader {
+		t.Fatalf("promote wanted a leader got %d %+v", w.Code, status)
+	}
+	if w := serve(handler, http.MethodPost, "/create", `{"description": "to the new leader"}`); w.Code != http.StatusCreated {
+		t.Errorf("create once promoted wanted 201 got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(handler, http.MethodPost, "/replication/promote", ""); w.Code != http.StatusConflict {
+		t.Errorf("promoting a leader wanted 409 got %d", w.Code)
+	}
+}
+
+// a held log read answers as soon as there is a change
+func TestReplicationLog(t *testing.T) {
+	cfg := config.Default()
+	cfg.AutosaveInterval = 0
+	server := newServer(t.Context(), cfg)
+	t.Cleanup(func() {
+		handleShutdown(t.Context(), server, "test")
+		shuttingDown.Store(false)
+	})
+	handler := server.srv.Handler
+	epoch, seq := replication.Log.Position()
+
+	read := make(chan *httptest.ResponseRecorder)
+	go func() {
+		read <- serve(handler, http.MethodGet, fmt.Sprintf("/replication/log?epoch=%d&after=%d&wait=10s", epoch, seq), "")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	created := serve(handler, http.MethodPost, "/create", `{"description": "shipped to followers"}`)
+	var item store.TodoListItem
+	json.NewDecoder(created.Body).Decode(&item)
+
+	select {
+	case w := <-read:
+		var batch replica.Batch
+		json.NewDecoder(w.Body).Decode(&batch)
+		if w.Code != http.StatusOK || len(batch.Entries) != 1 || batch.Entries[0].Item.Line != item.Line || batch.Entries[0].Kind != store.ChangeCreated {
+			t.Errorf("wanted the create in the log got %d %+v", w.Code, batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("held log read did not answer the change")
+	}
+
+	var tests = []struct {
+		target string
+		want   int
+	}{
+		{target: fmt.Sprintf("/replication/log?epoch=%d&after=%d", epoch+1, seq), want: http.StatusGone},
+		{target: "/replication/log?epoch=x", want: http.StatusBadRequest},
+		{target: "/replication/snapshot", want: http.StatusOK},
+	}
+	for _, tc := range tests {
+		if w := serve(handler, http.MethodGet, tc.target, ""); w.Code != tc.want {
+			t.Errorf("%s wanted %d got %d", tc.target, tc.want, w.Code)
+		}
+	}
+	serve(handler, http.MethodDelete, fmt.Sprintf("/delete/%d", item.Line), "")
+}
@@ -2,7 +2,6 @@ package api
 
 import (
 	"net/http"
-	"os"
 )
 
 // type apiHandler func(w http.ResponseWriter, r *http.Request)
@@ -12,6 +11,9 @@ type route struct {
 	route   string
 	handler http.HandlerFunc //apiHandler
 	isweb   bool             // flag type of endpoint to distinguish between api/webpage content
+	open    bool             // no auth, for supervisors and probes
+	follow  bool             // a write still taken by a read only follower
+	feed    bool             // subscribed to by apps that cannot set a header, the token may be in ?token=
 }
 
 var Routes = []route{}
@@ -25,17 +27,68 @@ func addRoutes(mux *http.ServeMux) {
 		{method: "GET", route: "/get", handler: GetList},
 		{method: "POST", route: "/create", handler: Create},
 		{method: "PUT", route: "/update", handler: UpdateTask},
+		{method: "GET", route: "/stats", handler: StoreStats},
+		{method: "PUT", route: "/sync/{taskId}", handler: SyncPut},
+		{method: "DELETE", route: "/sync/{taskId}", handler: SyncDelete},
+		{method: "GET", route: "/children/{taskId}", handler: GetChildren},
+		{method: "POST", route: "/children/{taskId}", handler: AddChild},
+		{method: "PUT", route: "/children/{taskId}", handler: ReorderChildren},
+		{method: "DELETE", route: "/children/{taskId}/{childId}", handler: RemoveChild},
+		{method: "POST", route: "/checklist/{taskId}", handler: AddCheckItem},
+		{method: "PUT", route: "/checklist/{taskId}", handler: ReorderChecklist},
+		{method: "PUT", route: "/checklist/{taskId}/{n}", handler: CheckItemDone},
+		{method: "DELETE", route: "/checklist/{taskId}/{n}", handler: RemoveCheckItem},
+		{method: "GET", route: "/blocked", handler: GetBlocked},
+		{method: "POST", route: "/blockers/{taskId}", handler: AddBlocker},
+		{method: "DELETE", route: "/blockers/{taskId}/{blockerId}", handler: RemoveBlocker},
+		{method: "PUT", route: "/recur/{taskId}", handler: SetRecur},
+		{method: "GET", route: "/history/{taskId}", handler: GetHistory},
+		{method: "GET", route: "/export", handler: Export},
+		{method: "POST", route: "/import", handler: Import},
+		{method: "GET", route: "/calendar.ics", handler: Calendar, feed: true},
+		{method: "GET", route: "/feed.atom", handler: FeedAtom, feed: true},
+		{method: "GET", route: "/feed.rss", handler: FeedRss, feed: true},
+		{method: "GET", route: "/backends", handler: GetBackends},
+		{method: "POST", route: "/backends", handler: AddBackend},
+		{method: "DELETE", route: "/backends/{addr}", handler: RemoveBackend},
+		{method: "POST", route: "/backends/rebalance", handler: Rebalance},
+		{method: "GET", route: "/replication", handler: GetReplication},
+		{method: "GET", route: "/replication/snapshot", handler: ReplicationSnapshot},
+		{method: "GET", route: "/replication/log", handler: ReplicationLog},
+		{method: "POST", route: "/replication/promote", handler: Promote, follow: true},
+		{method: "GET", route: "/healthz", handler: Healthz, open: true},
+		{method: "GET", route: "/readyz", handler: Readyz, open: true},
+		{method: "GET", route: "/version", handler: Version, open: true},
+		{method: "GET", route: "/metrics", handler: Metrics, open: true},
+		{method: "GET", route: "/list", handler: GetActiveList, isweb: true},
+		{method: "GET", route: "/list/{taskId}", handler: GetWebTask, isweb: true},
+		{method: "GET", route: "/list/{taskId}/delete", handler: GetWebDeleteConfirm, isweb: true},
+		{method: "POST", route: "/list/create", handler: WebCreate, isweb: true},
+		{method: "POST", route: "/list/{taskId}/update", handler: WebUpdate, isweb: true},
+		{method: "POST", route: "/list/{taskId}/delete", handler: WebDelete, isweb: true},
+		{method: "GET", route: "/board", handler: GetBoard, isweb: true},
+		{method: "POST", route: "/board/{taskId}/state", handler: BoardMove, isweb: true},
 	}
-	// the api routes have a json media type header
 	for _, r := range Routes {
-		mux.HandleFunc(r.method+" "+r.route, contentTypeMiddleware(r.handler))
+		if r.isweb {
+			// web pages set their own content type, sign in with a cookie and the form posts need a csrf token
+			mux.HandleFunc(r.method+" "+r.route, webAuthMiddleware(csrfMiddleware(r.handler)))
+		} else if r.open {
+			mux.HandleFunc(r.method+" "+r.route, contentTypeMiddleware(r.handler))
+		} else {
+			handler := r.handler
+			if r.method != "GET" && !r.follow {
+				handler = readOnlyMiddleware(handler)
+			}
+			guarded := authMiddleware(handler)
+			if r.feed {
+				guarded = queryTokenMiddleware(guarded)
+			}
+			// the api routes have a json media type header
+			mux.HandleFunc(r.method+" "+r.route, contentTypeMiddleware(guarded))
+		}
 	}
 
-	if pth, ok := os.Getwd(); ok == nil {
-		// add the static about page route without content type
-		fs := http.FileServer(http.Dir(pth + "\\files"))
-		mux.Handle("GET"+" "+"/", fs)
-	}
-	// add the dynamic list template route without content type
-	mux.HandleFunc("GET /list", GetActiveList)
+	// add the static files route without content type
+	mux.Handle("GET"+" "+"/", http.FileServerFS(staticFiles()))
 }
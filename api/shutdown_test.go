@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/config"
+	"github.com/anthriscus/appcli/store"
+)
+
+// clients keep writing while the server shuts down,
+// every create the server acknowledged must be in the committed file
+func TestShutdownKeepsAcknowledgedWrites(t *testing.T) {
+	ctx := t.Context()
+	cfg := config.Default()
+	cfg.ShutdownTimeout = 5 * time.Second
+	cfg.AutosaveInterval = 0
+
+	listener, ok := net.Listen("tcp", "127.0.0.1:0")
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	server := newServer(ctx, cfg)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+	go server.srv.Serve(listener)
+	target := "http://" + listener.Addr().String() + "/create"
+
+	numClients := 20
+	var mu sync.Mutex
+	acknowledged := []int64{}
+	started := make(chan struct{}, numClients)
+
+	var wg sync.WaitGroup
+	for i := range numClients {
+		wg.Add(1)
+		go func(clientId int) {
+			defer wg.Done()
+			client := &http.Client{Timeout: 5 * time.Second}
+			for n := 0; ; n++ {
+				body, _ := json.Marshal(store.TodoListItem{Description: fmt.Sprintf("shutdown client %d write %d", clientId, n)})
+				resp, ok := client.Post(target, "application/json", bytes.NewReader(body))
+				if ok != nil {
+					// server has stopped accepting
+					return
+				}
+				var created store.TodoListItem
+				json.NewDecoder(resp.Body).Decode(&created)
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusCreated {
+					mu.Lock()
+					acknowledged = append(acknowledged, created.Line)
+					mu.Unlock()
+				}
+				if n == 5 {
+					started <- struct{}{}
+				}
+			}
+		}(i)
+	}
+
+	// shut down mid flight once every client is busy
+	for range numClients {
+		<-started
+	}
+	if ok := handleShutdown(ctx, server, "test"); ok != nil {
+		t.Fatalf("shutdown commit failed %s", ok)
+	}
+	wg.Wait()
+
+	saved, ok := store.Restore(ctx, dataFile)
+	if ok != nil {
+		t.Fatalf("restore after shutdown failed %s", ok)
+	}
+	if len(acknowledged) == 0 {
+		t.Fatal("no writes were acknowledged")
+	}
+	for _, id := range acknowledged {
+		if _, found := saved[id]; !found {
+			t.Errorf("acknowledged write %d lost in shutdown", id)
+		}
+	}
+	t.Logf("%d acknowledged writes all committed", len(acknowledged))
+}
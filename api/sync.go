@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/remote"
+	"github.com/anthriscus/appcli/store"
+)
+
+// SyncPut writes the item as given, version and times included, for
+// appcli sync pushing the changes made offline. It goes over the version
+// in If-Match, or no item with If-None-Match: *, and without either only
+// over an older version than the one pushed. A stale push is a 409.
+func SyncPut(w http.ResponseWriter, r *http.Request) {
+	id, ok := strconv.ParseInt(r.PathValue("taskId"), 10, 64)
+	if ok != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(fmt.Errorf("bad taskid")))
+		return
+	}
+	var item store.TodoListItem
+	if ok := json.NewDecoder(r.Body).Decode(&item); ok != nil || item.Line != id {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(fmt.Errorf("invalid json, want the item with line %d", id)))
+		return
+	}
+	expect, given, ok := remote.ExpectedVersion(r.Header)
+	if ok != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return
+	}
+	resultsChan := make(chan StoreResult)
+	actorHandler(apiPutIf(StoreRequest{ctx: r.Context(), todoListItem: item}, expect, given), resultsChan)
+	result := <-resultsChan
+	if errors.Is(result.err, store.ErrVersionConflict) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(jsonError(result.err))
+		return
+	} else if result.err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(result.err))
+		return
+	}
+	if ok := json.NewEncoder(w).Encode(&result.todoListItem); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "SyncPut", "error", ok)
+	}
+}
+
+// SyncDelete deletes the item, fine when it is already gone
+func SyncDelete(w http.ResponseWriter, r *http.Request) {
+	id, ok := strconv.ParseInt(r.PathValue("taskId"), 10, 64)
+	if ok != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(fmt.Errorf("bad taskid")))
+		return
+	}
+	resultsChan := make(chan StoreResult)
+	actorHandler(apiRemove(StoreRequest{ctx: r.Context(), todoListItem: store.TodoListItem{Line: id}}), resultsChan)
+	// not found is what was asked for, anything else may have left the item in place
+	if result := <-resultsChan; result.err != nil && !errors.Is(result.err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(jsonError(result.err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+// items are written as given, version and times included
+func TestSyncRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	updated := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	item := store.TodoListItem{Line: 42, Id: 42, Description: "pushed by sync", Version: 7, Created: updated, Updated: updated}
+	body, _ := json.Marshal(item)
+
+	var tests = []struct {
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{method: http.MethodPut, target: "/sync/42", body: string(body), want: http.StatusOK},
+		{method: http.MethodPut, target: "/sync/43", body: string(body), want: http.StatusBadRequest},
+		{method: http.MethodPut, target: "/sync/x", body: string(body), want: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/get/42", want: http.StatusOK},
+		{method: http.MethodDelete, target: "/sync/42", want: http.StatusNoContent},
+		{method: http.MethodDelete, target: "/sync/42", want: http.StatusNoContent},
+	}
+	for _, tc := range tests {
+		w := serve(mux, tc.method, tc.target, tc.body)
+		if w.Code != tc.want {
+			t.Errorf("%s %s wanted %d got %d %s", tc.method, tc.target, tc.want, w.Code, w.Body.String())
+		}
+		if tc.method == http.MethodGet {
+			var got store.TodoListItem
+			json.NewDecoder(w.Body).Decode(&got)
+			if got.Version != 7 || !got.Updated.Equal(updated) {
+				t.Errorf("item not kept as given %+v", got)
+			}
+		}
+	}
+	if _, ok := store.GetByIndex(42); ok == nil {
+		t.Error("item 42 not deleted")
+	}
+}
+
+// a push made against an older version than the server's is turned away
+func TestSyncPutVersions(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	updated := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	item := store.TodoListItem{Line: 44, Id: 44, Description: "pushed by sync", Version: 3, Created: updated, Updated: updated}
+	defer store.Remove(t.Context(), 44)
+	push := func(version int64, header string, value string) int {
+		item.Version = version
+		body, _ := json.Marshal(item)
+		r := httptest.NewRequest(http.MethodPut, "/sync/44", strings.NewReader(string(body)))
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	var tests = []struct {
+		name    string
+		version int64
+		header  string
+		value   string
+		want    int
+	}{
+		{"new item", 3, "If-None-Match", "*", http.StatusOK},
+		{"new item again", 4, "If-None-Match", "*", http.StatusConflict},
+		{"over the version held", 5, "If-Match", `"3"`, http.StatusOK},
+		{"over an old version", 6, "If-Match", `"3"`, http.StatusConflict},
+		{"bad version", 6, "If-Match", `"x"`, http.StatusBadRequest},
+		{"no precondition, newer", 6, "", "", http.StatusOK},
+		{"no precondition, stale", 6, "", "", http.StatusConflict},
+	}
+	for _, tc := range tests {
+		if got := push(tc.version, tc.header, tc.value); got != tc.want {
+			t.Errorf("%s: wanted %d got %d", tc.name, tc.want, got)
+		}
+	}
+	if got, ok := store.GetByIndex(44); ok != nil || got.Version != 6 {
+		t.Errorf("wanted version 6 kept got %+v %v", got, ok)
+	}
+}
+
+// a backend whose store servers do not answer
+type downBackend struct{}
+
+var errDown = errors.New("store server down")
+
+func (downBackend) Get(ctx context.Context, id int64) (store.TodoListItem, bool, error) {
+	return store.TodoListItem{}, false, errDown
+}
+func (downBackend) Put(ctx context.Context, item store.TodoListItem) (bool, error) {
+	return false, errDown
+}
+func (downBackend) Delete(ctx context.Context, id int64) (store.TodoListItem, bool, error) {
+	return store.TodoListItem{}, false, errDown
+}
+func (downBackend) List(ctx context.Context) (store.TodoListItems, error) { return nil, errDown }
+func (downBackend) Count(ctx context.Context) (int, error)                { return 0, errDown }
+func (downBackend) Ping(ctx context.Context) error                        { return errDown }
+
+// a delete the backend could not make is not reported as done
+func TestSyncDeleteBackendDown(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	store.SetBackend(downBackend{})
+	defer store.SetBackend(nil)
+	if w := serve(mux, http.MethodDelete, "/sync/42", ""); w.Code != http.StatusBadGateway {
+		t.Errorf("delete with the backend down wanted 502 got %d", w.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+	"github.com/anthriscus/appcli/transfer"
+)
+
+// largest file taken by /import
+const maxImportBytes = 10 << 20
+
+// the format query parameter, json when not given
+func queryFormat(w http.ResponseWriter, r *http.Request) (transfer.Format, bool) {
+	value := r.URL.Query().Get("format")
+	if value == "" {
+		return transfer.Json, true
+	}
+	format, ok := transfer.ParseFormat(value)
+	if ok != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return "", false
+	}
+	return format, true
+}
+
+// the list in line order, read on the request actors
+func scanItems() ([]store.TodoListItem, error) {
+	items, err := store.Scan()
+	if err != nil {
+		return nil, err
+	}
+	return slices.Collect(items), nil
+}
+
+// Export serves the list as a file, GET /export?format=csv|markdown|todotxt|json
+func Export(w http.ResponseWriter, r *http.Request) {
+	format, found := queryFormat(w, r)
+	if !found {
+		return
+	}
+	items, ok := actorGet(scanItems)
+	if ok != nil {
+		listFailed(w, ok)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="todolist`+format.Extension()+`"`)
+	if ok := transfer.Export(w, format, items); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Export", "format", format, "error", ok)
+	}
+}
+
+// Import adds the tasks in the request body, POST /import?format=csv.
+// dryRun=true reports what would be added, keepDuplicates=true adds tasks
+// already in the list and map=Title=description,... maps the columns.
+func Import(w http.ResponseWriter, r *http.Request) {
+	format, found := queryFormat(w, r)
+	if !found {
+		return
+	}
+	query := r.URL.Query()
+	fields, ok := transfer.ParseFields(query.Get("map"))
+	if ok != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return
+	}
+	items, ok := transfer.Parse(http.MaxBytesReader(w, r.Body, maxImportBytes), format, fields)
+	if ok != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return
+	}
+	options := transfer.Options{DryRun: query.Get("dryRun") == "true", KeepDuplicates: query.Get("keepDuplicates") == "true"}
+	report, ok := actorGet(func() (transfer.Report, error) { return transfer.Import(r.Context(), items, options) })
+	if ok != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return
+	}
+	if !options.DryRun && len(report.Added) > 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if ok := json.NewEncoder(w).Encode(report); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Import", "error", ok)
+	}
+}
+
+// Calendar serves the list as iCalendar VTODOs for calendar apps to subscribe to
+func Calendar(w http.ResponseWriter, r *http.Request) {
+	items, ok := actorGet(scanItems)
+	if ok != nil {
+		listFailed(w, ok)
+		return
+	}
+	w.Header().Set("Content-Type", transfer.Ics.ContentType())
+	if ok := transfer.Export(w, transfer.Ics, items); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Calendar", "error", ok)
+	}
+}
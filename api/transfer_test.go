@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/anthriscus/appcli/store"
+	"github.com/anthriscus/appcli/transfer"
+)
+
+func TestTransferRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	body := "Title,Priority,Tags\nImported by csv,A,\"api,import\"\n"
+
+	var tests = []struct {
+		method     string
+		target     string
+		body       string
+		want       int
+		added      int
+		duplicates int
+	}{
+		{method: http.MethodPost, target: "/import?format=csv&dryRun=true", body: body, want: http.StatusOK, added: 1},
+		{method: http.MethodPost, target: "/import?format=csv", body: body, want: http.StatusCreated, added: 1},
+		{method: http.MethodPost, target: "/import?format=csv", body: body, want: http.StatusOK, duplicates: 1},
+		{method: http.MethodPost, target: "/import?format=csv&map=Title=nothing", body: body, want: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/import?format=xls", body: body, want: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/import?format=json", body: "{", want: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		w := serve(mux, tc.method, tc.target, tc.body)
+		if w.Code != tc.want {
+			t.Errorf("%s %s wanted %d got %d %s", tc.method, tc.target, tc.want, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code == http.StatusBadRequest {
+			continue
+		}
+		var report transfer.Report
+		json.NewDecoder(w.Body).Decode(&report)
+		if len(report.Added) != tc.added || len(report.Duplicates) != tc.duplicates {
+			t.Errorf("%s wanted %d added %d duplicates got %+v", tc.target, tc.added, tc.duplicates, report)
+		}
+		for _, item := range report.Added {
+			if !report.DryRun {
+				defer store.DeleteTask(t.Context(), item.Line)
+			}
+		}
+	}
+
+	w := serve(mux, http.MethodGet, "/export?format=markdown", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/markdown") {
+		t.Fatalf("export wanted markdown got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "| Imported by csv | Not started |") {
+		t.Errorf("imported task not exported %s", w.Body.String())
+	}
+	if w := serve(mux, http.MethodGet, "/export?format=pdf", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown export format wanted 400 got %d", w.Code)
+	}
+}
+
+// calendar apps are given a url, the token rides in the query
+func TestCalendar(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	authToken = "s3cret"
+	defer func() { authToken = "" }()
+	task, _ := store.AddTask(t.Context(), "On the calendar")
+	defer store.DeleteTask(t.Context(), task)
+
+	if w := serve(mux, http.MethodGet, "/calendar.ics", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("calendar without a token wanted 401 got %d", w.Code)
+	}
+	if w := serve(mux, http.MethodGet, "/export?token=s3cret", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("only feeds take the token in the query, export got %d", w.Code)
+	}
+	w := serve(mux, http.MethodGet, "/calendar.ics?token=s3cret", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("calendar wanted 200 text/calendar got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if body := w.Body.String(); !strings.Contains(body, "BEGIN:VTODO") || !strings.Contains(body, fmt.Sprintf("UID:%d@appcli", task)) {
+		t.Errorf("task missing from the calendar %s", body)
+	}
+}
+
+// import, export and the calendar run on the request actors
+func TestTransferThroughActor(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	before := actorCommandSeconds.Count()
+	w := serve(mux, http.MethodPost, "/import?format=csv", "Title\nImported on the actor\n")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("import wanted %d got %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var report transfer.Report
+	json.NewDecoder(w.Body).Decode(&report)
+	for _, item := range report.Added {
+		defer store.DeleteTask(t.Context(), item.Line)
+	}
+	for _, target := range []string{"/export?format=csv", "/calendar.ics"} {
+		if w := serve(mux, http.MethodGet, target, ""); w.Code != http.StatusOK {
+			t.Errorf("%s wanted %d got %d", target, http.StatusOK, w.Code)
+		}
+	}
+	if got := actorCommandSeconds.Count() - before; got < 3 {
+		t.Errorf("wanted the import, export and calendar on the actor, %d commands ran", got)
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+// subtasks and the checklist of one task, as served by /children/{taskId}
+type taskChildren struct {
+	Line      int64                `json:"line"`
+	Progress  store.Progress       `json:"progress"`
+	Children  []store.TodoListItem `json:"children"`
+	Checklist []store.CheckItem    `json:"checklist"`
+}
+
+func badRequest(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(jsonError(err))
+}
+
+func pathId(r *http.Request, name string) (int64, error) {
+	id, ok := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if ok != nil {
+		return 0, fmt.Errorf("bad %s", name)
+	}
+	return id, nil
+}
+
+// writes the task's subtasks and checklist as they are now
+func writeChildren(w http.ResponseWriter, r *http.Request, status int, id int64) {
+	children, ok := actorGet(func() (taskChildren, error) {
+		item, err := store.GetByIndex(id)
+		if err != nil {
+			return taskChildren{}, err
+		}
+		subtasks, err := store.Children(id)
+		if err != nil {
+			return taskChildren{}, err
+		}
+		return taskChildren{Line: id, Progress: store.TaskProgress(item, subtasks), Children: subtasks, Checklist: item.Checklist}, nil
+	})
+	if errors.Is(ok, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return
+	} else if ok != nil {
+		listFailed(w, ok)
+		return
+	}
+	if children.Checklist == nil {
+		children.Checklist = []store.CheckItem{}
+	}
+	w.WriteHeader(status)
+	if ok := json.NewEncoder(w).Encode(&children); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Children", "error", ok)
+	}
+}
+
+// GetChildren is the task's subtasks, checklist and progress
+func GetChildren(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeChildren(w, r, http.StatusOK, id)
+}
+
+// AddChild adds a subtask to the task, a new one from the description and
+// tags given or, given its line, a task already in the list moved under it
+func AddChild(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	var item store.TodoListItem
+	if ok := json.NewDecoder(r.Body).Decode(&item); ok != nil {
+		badRequest(w, fmt.Errorf("invalid json"))
+		return
+	}
+	ok = actorDo(func() error {
+		if item.Line != 0 {
+			return store.MoveTask(r.Context(), item.Line, id)
+		}
+		_, err := store.AddSubtask(r.Context(), id, item.Description, item.Tags)
+		return err
+	})
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeChildren(w, r, http.StatusCreated, id)
+}
+
+// ReorderChildren puts the subtasks in the order of the lines given, [3,1,2]
+func ReorderChildren(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	var order []int64
+	if ok := json.NewDecoder(r.Body).Decode(&order); ok != nil {
+		badRequest(w, fmt.Errorf("invalid json, want the subtask lines in order"))
+		return
+	}
+	if ok := actorDo(func() error { return store.ReorderChildren(r.Context(), id, order) }); ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeChildren(w, r, http.StatusOK, id)
+}
+
+// RemoveChild makes the subtask a top level task, deleting it is /delete
+func RemoveChild(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	childId, ok := pathId(r, "childId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	notChild := fmt.Errorf("%d is not a subtask of %d", childId, id)
+	ok = actorDo(func() error {
+		if child, err := store.GetByIndex(childId); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		} else if err != nil || child.Parent != id {
+			return notChild
+		}
+		return store.MoveTask(r.Context(), childId, 0)
+	})
+	if errors.Is(ok, notChild) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(jsonError(ok))
+		return
+	} else if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeChildren(w, r, http.StatusOK, id)
+}
+
+// AddCheckItem adds a step to the checklist, {"text":"..."}
+func AddCheckItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	var step store.CheckItem
+	if ok := json.NewDecoder(r.Body).Decode(&step); ok != nil {
+		badRequest(w, fmt.Errorf("invalid json"))
+		return
+	}
+	if ok := actorDo(func() error { return store.AddCheckItem(r.Context(), id, step.Text) }); ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeChildren(w, r, http.StatusCreated, id)
+}
+
+// ReorderChecklist puts the steps in the order of their numbers given, [2,1]
+func ReorderChecklist(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	var order []int
+	if ok := json.NewDecoder(r.Body).Decode(&order); ok != nil {
+		badRequest(w, fmt.Errorf("invalid json, want the checklist numbers in order"))
+		return
+	}
+	if ok := actorDo(func() error { return store.ReorderChecklist(r.Context(), id, order) }); ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeChildren(w, r, http.StatusOK, id)
+}
+
+// CheckItemDone ticks or unticks step n, numbered from 1, {"done":true}
+func CheckItemDone(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	n, ok := strconv.Atoi(r.PathValue("n"))
+	if ok != nil {
+		badRequest(w, fmt.Errorf("bad checklist number"))
+		return
+	}
+	var step store.CheckItem
+	if ok := json.NewDecoder(r.Body).Decode(&step); ok != nil {
+		badRequest(w, fmt.Errorf("invalid json"))
+		return
+	}
+	if ok := actorDo(func() error { return store.CheckItemDone(r.Context(), id, n, step.Done) }); ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeChildren(w, r, http.StatusOK, id)
+}
+
+// RemoveCheckItem removes step n, numbered from 1
+func RemoveCheckItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "taskId")
+	if ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	n, ok := strconv.Atoi(r.PathValue("n"))
+	if ok != nil {
+		badRequest(w, fmt.Errorf("bad checklist number"))
+		return
+	}
+	if ok := actorDo(func() error { return store.RemoveCheckItem(r.Context(), id, n) }); ok != nil {
+		badRequest(w, ok)
+		return
+	}
+	writeChildren(w, r, http.StatusOK, id)
+}
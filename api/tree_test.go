@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestChildrenRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	ctx := t.Context()
+	parent, _ := store.AddTask(ctx, "Plan the party")
+	other, _ := store.AddTask(ctx, "Book the hall")
+	defer store.DeleteTask(ctx, other)
+
+	var tests = []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		want     int
+		children int
+		progress string
+	}{
+		{name: "new subtask", method: http.MethodPost, target: "/children/%d", body: `{"description":"Send invites"}`, want: http.StatusCreated, children: 1, progress: "0/1"},
+		{name: "move a task under it", method: http.MethodPost, target: "/children/%d", body: fmt.Sprintf(`{"line":%d}`, other), want: http.StatusCreated, children: 2, progress: "0/2"},
+		{name: "under itself", method: http.MethodPost, target: "/children/%d", body: fmt.Sprintf(`{"line":%d}`, parent), want: http.StatusBadRequest},
+		{name: "checklist step", method: http.MethodPost, target: "/checklist/%d", body: `{"text":"Buy balloons"}`, want: http.StatusCreated, children: 2, progress: "0/3"},
+		{name: "tick the step", method: http.MethodPut, target: "/checklist/%d/1", body: `{"done":true}`, want: http.StatusOK, children: 2, progress: "1/3"},
+		{name: "missing step", method: http.MethodPut, target: "/checklist/%d/5", body: `{"done":true}`, want: http.StatusBadRequest},
+		{name: "bad reorder", method: http.MethodPut, target: "/children/%d", body: `[1,2]`, want: http.StatusBadRequest},
+		{name: "detach", method: http.MethodDelete, target: fmt.Sprintf("/children/%%d/%d", other), want: http.StatusOK, children: 1, progress: "1/2"},
+		{name: "detach again", method: http.MethodDelete, target: fmt.Sprintf("/children/%%d/%d", other), want: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		w := serve(mux, tc.method, fmt.Sprintf(tc.target, parent), tc.body)
+		if w.Code != tc.want {
+			t.Errorf("%s: wanted %d got %d %s", tc.name, tc.want, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code >= http.StatusBadRequest {
+			continue
+		}
+		var got taskChildren
+		json.NewDecoder(w.Body).Decode(&got)
+		if len(got.Children) != tc.children || got.Progress.String() != tc.progress {
+			t.Errorf("%s: wanted %d children %s done got %+v", tc.name, tc.children, tc.progress, got)
+		}
+	}
+
+	// the list page shows the tree, indented with the progress
+	w := httptest.NewRecorder()
+	GetActiveList(w, httptest.NewRequest(http.MethodGet, "/list", nil))
+	page := w.Body.String()
+	if !strings.Contains(page, "calc(1 * 2em)") || !strings.Contains(page, `class="progress" title="subtasks and checklist done">1/2`) {
+		t.Errorf("list page does not show the subtask tree")
+	}
+
+	if w := serve(mux, http.MethodDelete, fmt.Sprintf("/delete/%d?cascade=true", parent), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("cascade delete wanted 204 got %d", w.Code)
+	}
+	scan, _ := store.Scan()
+	for item := range scan {
+		if item.Description == "Send invites" {
+			t.Errorf("cascade delete left subtask %d", item.Line)
+		}
+	}
+}
+
+// the tree routes run on the request actors like the other writes
+func TestChildrenThroughActor(t *testing.T) {
+	mux := http.NewServeMux()
+	addRoutes(mux)
+	parent, _ := store.AddTask(t.Context(), "Plan the picnic")
+	before := actorCommandSeconds.Count()
+	if w := serve(mux, http.MethodPost, fmt.Sprintf("/children/%d", parent), `{"description":"Pack the basket"}`); w.Code != http.StatusCreated {
+		t.Fatalf("new subtask wanted %d got %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if got := actorCommandSeconds.Count() - before; got < 2 {
+		t.Errorf("wanted the add and the read on the actor, %d commands ran", got)
+	}
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+const (
+	filterAll int = -1 // list filter value showing every state
+)
+
+type stateOption struct {
+	Value int
+	Name  string
+}
+
+type webItem struct {
+	Line        int64
+	Description string
+	State       int
+	StateName   string
+	Created     string
+	Tags        []string
+	Depth       int    // subtasks are indented under their parent
+	Progress    string // done of total subtasks and checklist items, empty with neither
+	Checklist   []store.CheckItem
+	Blockers    []int64 // blocking tasks not yet completed
+	Repeats     string  // the repeat rule in words, empty when it does not repeat
+}
+
+type listPage struct {
+	Items     []webItem
+	States    []stateOption
+	Filter    int
+	Total     int
+	CSRFToken string
+	Error     string
+}
+
+type taskPage struct {
+	Item      webItem
+	States    []stateOption
+	Filter    int
+	CSRFToken string
+	Error     string
+}
+
+// the list page with a create form, inline edit and a status filter
+func GetActiveList(w http.ResponseWriter, r *http.Request) {
+	renderList(w, r, http.StatusOK, "")
+}
+
+// single task edit page
+func GetWebTask(w http.ResponseWriter, r *http.Request) {
+	renderTask(w, r, "task.html", http.StatusOK, "")
+}
+
+// delete confirmation page, the delete itself is the POST
+func GetWebDeleteConfirm(w http.ResponseWriter, r *http.Request) {
+	renderTask(w, r, "confirmdelete.html", http.StatusOK, "")
+}
+
+func WebCreate(w http.ResponseWriter, r *http.Request) {
+	item := store.TodoListItem{Description: r.PostFormValue("description"), Tags: store.ParseTags(r.PostFormValue("tags"))}
+	resultsChan := make(chan StoreResult)
+	actorHandler(apiCreate(StoreRequest{ctx: r.Context(), todoListItem: item}), resultsChan)
+	if result := <-resultsChan; result.err != nil {
+		renderList(w, r, http.StatusBadRequest, result.err.Error())
+		return
+	}
+	redirectToList(w, r)
+}
+
+func WebUpdate(w http.ResponseWriter, r *http.Request) {
+	id, ok := webTaskId(r)
+	if ok != nil {
+		renderList(w, r, http.StatusBadRequest, ok.Error())
+		return
+	}
+	state, ok := strconv.Atoi(r.PostFormValue("state"))
+	if ok != nil {
+		renderList(w, r, http.StatusBadRequest, "state is out of range")
+		return
+	}
+	item := store.TodoListItem{Line: id, Description: r.PostFormValue("description"), State: state}
+	// the inline list edit has no tags field, only the task page changes them
+	if r.PostForm.Has("tags") {
+		item.Tags = store.ParseTags(r.PostFormValue("tags"))
+	}
+	resultsChan := make(chan StoreResult)
+	actorHandler(apiUpdate(StoreRequest{ctx: r.Context(), todoListItem: item}), resultsChan)
+	if result := <-resultsChan; result.err != nil {
+		renderList(w, r, http.StatusBadRequest, result.err.Error())
+		return
+	}
+	redirectToList(w, r)
+}
+
+func WebDelete(w http.ResponseWriter, r *http.Request) {
+	id, ok := webTaskId(r)
+	if ok != nil {
+		renderList(w, r, http.StatusBadRequest, ok.Error())
+		return
+	}
+	resultsChan := make(chan StoreResult)
+	actorHandler(apiDelete(StoreRequest{ctx: r.Context(), todoListItem: store.TodoListItem{Line: id}}), resultsChan)
+	if result := <-resultsChan; result.err != nil {
+		renderList(w, r, http.StatusBadRequest, result.err.Error())
+		return
+	}
+	redirectToList(w, r)
+}
+
+func renderList(w http.ResponseWriter, r *http.Request, status int, message string) {
+	items, ok := store.GetList()
+	if ok != nil {
+		listFailed(w, ok)
+		return
+	}
+	filter := listFilter(r)
+	page := listPage{
+		Items:     filterItems(items.Items(), filter),
+		States:    stateOptions(),
+		Filter:    filter,
+		Total:     items.Len(),
+		CSRFToken: csrfToken(w, r),
+		Error:     message,
+	}
+	renderTemplate(w, r, "activetodolist.html", status, page)
+}
+
+func renderTask(w http.ResponseWriter, r *http.Request, name string, status int, message string) {
+	id, ok := webTaskId(r)
+	if ok != nil {
+		renderList(w, r, http.StatusBadRequest, ok.Error())
+		return
+	}
+	item, ok := store.GetByIndex(id)
+	if ok != nil {
+		renderList(w, r, http.StatusNotFound, fmt.Sprintf("cannot find item %d", id))
+		return
+	}
+	page := taskPage{
+		Item:      toWebItem(item),
+		States:    stateOptions(),
+		Filter:    listFilter(r),
+		CSRFToken: csrfToken(w, r),
+		Error:     message,
+	}
+	renderTemplate(w, r, name, status, page)
+}
+
+func renderTemplate(w http.ResponseWriter, r *http.Request, name string, status int, data any) {
+	if t, ok := loadTemplates(); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "template parse failed", "template", name, "error", ok)
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		var page bytes.Buffer
+		// execute into a buffer so a template error can still be a clean 500
+		if ok := t.ExecuteTemplate(&page, name, data); ok != nil {
+			logging.Log().ErrorContext(r.Context(), "template execute failed", "template", name, "error", ok)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		page.WriteTo(w)
+	}
+}
+
+// post redirect get, keeps the filter the user was looking at
+func redirectToList(w http.ResponseWriter, r *http.Request) {
+	target := "/list"
+	if filter := listFilter(r); filter != filterAll {
+		target = fmt.Sprintf("/list?state=%d", filter)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// the state filter comes from the query string or a hidden form field
+func listFilter(r *http.Request) int {
+	value := r.URL.Query().Get("state")
+	if value == "" && r.Method == http.MethodPost {
+		value = r.PostFormValue("filter")
+	}
+	if state, ok := strconv.Atoi(value); ok == nil {
+		if _, found := store.StatusName[state]; found {
+			return state
+		}
+	}
+	return filterAll
+}
+
+func webTaskId(r *http.Request) (int64, error) {
+	if id, ok := strconv.ParseInt(r.PathValue("taskId"), 10, 64); ok != nil {
+		return 0, fmt.Errorf("bad taskid")
+	} else {
+		return id, nil
+	}
+}
+
+// the tasks in the state filtered on as a tree, a subtask stays at its depth
+// when its parent is filtered out
+func filterItems(items store.TodoListItems, filter int) []webItem {
+	list := make([]webItem, 0, len(items))
+	for _, line := range store.Tree(items) {
+		if filter == filterAll || line.Item.State == filter {
+			item := toWebItem(line.Item)
+			item.Depth = line.Depth
+			item.Blockers = line.Blockers
+			if line.Progress.Total > 0 {
+				item.Progress = line.Progress.String()
+			}
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func toWebItem(item store.TodoListItem) webItem {
+	return webItem{
+		Line:        item.Line,
+		Description: item.Description,
+		State:       item.State,
+		StateName:   store.StatusName[item.State],
+		Created:     item.Created.Format(time.RFC822),
+		Tags:        item.Tags,
+		Checklist:   item.Checklist,
+		Repeats:     repeats(item.Recur),
+	}
+}
+
+func repeats(rule string) string {
+	if rule == "" {
+		return ""
+	}
+	return store.DescribeRecur(rule)
+}
+
+// workflow states in their natural order for select lists and filters
+func stateOptions() []stateOption {
+	states := make([]int, 0, len(store.StatusName))
+	for k := range store.StatusName {
+		states = append(states, k)
+	}
+	slices.Sort(states)
+	options := make([]stateOption, 0, len(states))
+	for _, s := range states {
+		options = append(options, stateOption{Value: s, Name: store.StatusName[s]})
+	}
+	return options
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+const testCsrfToken string = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func newFormRequest(target string, form url.Values, cookieToken string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookieToken != "" {
+		req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: cookieToken})
+	}
+	return req
+}
+
+func TestWebCsrf(t *testing.T) {
+	var tests = []struct {
+		cookie string
+		posted string
+		want   int
+	}{
+		{cookie: testCsrfToken, posted: testCsrfToken, want: http.StatusSeeOther},
+		{cookie: testCsrfToken, posted: "", want: http.StatusForbidden},
+		{cookie: "", posted: testCsrfToken, want: http.StatusForbidden},
+		{cookie: testCsrfToken, posted: strings.Repeat("f", 64), want: http.StatusForbidden},
+	}
+
+	for i, tc := range tests {
+		form := url.Values{"description": {fmt.Sprintf("web csrf test %d", i)}, csrfFieldName: {tc.posted}}
+		req := newFormRequest("/list/create", form, tc.cookie)
+		w := httptest.NewRecorder()
+		csrfMiddleware(http.HandlerFunc(WebCreate))(w, req)
+		if got := w.Result().StatusCode; got != tc.want {
+			t.Errorf("test %d wanted: %d got: %d", i, tc.want, got)
+		}
+	}
+}
+
+func TestWebCreateUpdateDelete(t *testing.T) {
+	description := "web form created task"
+	form := url.Values{"description": {description}, csrfFieldName: {testCsrfToken}, "filter": {"1"}}
+	w := httptest.NewRecorder()
+	csrfMiddleware(http.HandlerFunc(WebCreate))(w, newFormRequest("/list/create", form, testCsrfToken))
+	if w.Result().StatusCode != http.StatusSeeOther {
+		t.Fatalf("create wanted: %d got: %d", http.StatusSeeOther, w.Result().StatusCode)
+	} else if location := w.Result().Header.Get("Location"); location != "/list?state=1" {
+		t.Errorf("create redirect wanted: /list?state=1 got: %s", location)
+	}
+
+	var created store.TodoListItem
+	items, _ := store.GetList()
+	for v := range items.All() {
+		if v.Description == description {
+			created = v
+		}
+	}
+	if created.Line == 0 {
+		t.Fatalf("created task not found in list")
+	}
+
+	taskPath := fmt.Sprintf("/list/%d", created.Line)
+	form = url.Values{"description": {"web form updated task"}, "state": {"2"}, csrfFieldName: {testCsrfToken}}
+	req := newFormRequest(taskPath+"/update", form, testCsrfToken)
+	req.SetPathValue("taskId", fmt.Sprint(created.Line))
+	w = httptest.NewRecorder()
+	csrfMiddleware(http.HandlerFunc(WebUpdate))(w, req)
+	if w.Result().StatusCode != http.StatusSeeOther {
+		t.Errorf("update wanted: %d got: %d", http.StatusSeeOther, w.Result().StatusCode)
+	} else if updated, _ := store.GetByIndex(created.Line); updated.State != 2 || updated.Description != "web form updated task" {
+		t.Errorf("update not applied got: %+v", updated)
+	}
+
+	form = url.Values{csrfFieldName: {testCsrfToken}}
+	req = newFormRequest(taskPath+"/delete", form, testCsrfToken)
+	req.SetPathValue("taskId", fmt.Sprint(created.Line))
+	w = httptest.NewRecorder()
+	csrfMiddleware(http.HandlerFunc(WebDelete))(w, req)
+	if w.Result().StatusCode != http.StatusSeeOther {
+		t.Errorf("delete wanted: %d got: %d", http.StatusSeeOther, w.Result().StatusCode)
+	} else if _, ok := store.GetByIndex(created.Line); ok == nil {
+		t.Errorf("item %d should be deleted", created.Line)
+	}
+}
+
+func TestWebPages(t *testing.T) {
+	var tests = []struct {
+		route   string
+		handler http.HandlerFunc
+		webDir  string
+		want    string
+	}{
+		{route: "/list", handler: GetActiveList, want: "name=\"csrf_token\""},
+		{route: "/list?state=2", handler: GetActiveList, want: "class=\"current\">Completed"},
+		{route: "/board", handler: GetBoard, want: "class=\"column\""},
+		{route: "/about", handler: About, want: "todolist.png"},
+		// override folder used for development reload
+		{route: "/list", handler: GetActiveList, webDir: ".", want: "name=\"csrf_token\""},
+	}
+
+	for i, tc := range tests {
+		SetWebDir(tc.webDir)
+		req := httptest.NewRequest(http.MethodGet, tc.route, nil)
+		w := httptest.NewRecorder()
+		tc.handler(w, req)
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("test %d %s wanted: %d got: %d", i, tc.route, http.StatusOK, w.Result().StatusCode)
+		} else if !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("test %d %s page does not contain %s", i, tc.route, tc.want)
+		}
+	}
+	SetWebDir("")
+}
+
+// a list that cannot be read is the server failing, not a bad request
+func TestWebListDown(t *testing.T) {
+	store.SetBackend(downBackend{})
+	defer store.SetBackend(nil)
+	w := httptest.NewRecorder()
+	GetActiveList(w, httptest.NewRequest(http.MethodGet, "/list", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), errDown.Error()) {
+		t.Errorf("list with the backend down wanted 503 with the error got %d %s", w.Code, w.Body.String())
+	}
+}
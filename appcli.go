@@ -5,10 +5,13 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/anthriscus/appcli/api"
 	"github.com/anthriscus/appcli/appcontext"
+	"github.com/anthriscus/appcli/config"
 	"github.com/anthriscus/appcli/filer"
 	"github.com/anthriscus/appcli/logging"
 	"github.com/anthriscus/appcli/store"
@@ -18,6 +21,7 @@ const (
 	dataStorageFolderName string = "appcli"
 	dataFileName          string = "todolist.json"
 	logFileName           string = "todolistserver.log"
+	syncStateFileName     string = "syncstate.json"
 )
 
 type runmode int
@@ -33,13 +37,41 @@ var runMode runmode
 func main() {
 	// input flags
 	var flagAdd = flag.String("add", "", "add todolist item (\"description\")")
+	var flagTags = flag.String("tags", "", "optional, use this -tags with -add for comma separated tags -tags \"home,garden\"")
+	var flagDue = flag.String("due", "", "optional, use this -due with -add or -update to set when the task is due -due 2026-01-31, none clears it")
+	var flagRecur = flag.String("recur", "", "optional, use this -recur with -add or -update to repeat the task when completed -recur \"weekly on mon,thu\", daily, monthly on 15, every 2 weeks or RRULE text, none stops it")
 	var flagUpdate = flag.Int64("update", 0, "update task item description (id -description \"new description\")")
 	var flagNotStart = flag.Int64("notstart", 0, "set task item id number to not started ( id )")
 	var flagStart = flag.Int64("start", 0, "start a task item ( id )")
 	var flagComplete = flag.Int64("complete", 0, "complete a task item id ( id )")
-	var flagDelete = flag.Int64("delete", 0, "delete a task item id number ( id )")
+	var flagDelete = flag.Int64("delete", 0, "delete a task item id number ( id ), its subtasks move up unless -cascade is given")
+	var flagMove = flag.Int64("move", 0, "make a task a subtask of another ( id -parent id ), -parent 0 moves it to the top")
+	var flagParent = flag.Int64("parent", 0, "optional, use this -parent with -add to add a subtask or with -move")
+	var flagBlock = flag.Int64("block", 0, "mark a task as blocked by another ( id -by id ), it cannot start until that is completed")
+	var flagUnblock = flag.Int64("unblock", 0, "remove a blocker from a task ( id -by id )")
+	var flagBy = flag.Int64("by", 0, "the blocking task, use this -by with -block or -unblock")
+	var flagBlocked = flag.Bool("blocked", false, "list the tasks waiting on blockers that are not completed")
+	var flagForce = flag.Bool("force", false, "optional, use this -force with -start or -complete to override the task's blockers")
+	var flagCascade = flag.Bool("cascade", false, "optional, use this -cascade with -notstart, -start, -complete or -delete to include the subtasks")
+	var flagHistory = flag.Int64("history", 0, "list the completed occurrences of a repeating task ( id )")
 	var flagList = flag.Bool("list", false, "list items in the todolist item ( with additional optional -taskid num to show one item)")
 	var flagRunServer = flag.Bool("runserver", false, "run todolist as http server")
+	var flagConfig = flag.String("config", "", "optional, config file to use instead of config.json, .yaml, .yml or .toml in the config folder (env APPCLI_CONFIG)")
+
+	// settings flags, these override the config file and environment
+	flag.String("data-dir", "", "optional, folder for the todo list and log so profiles can be kept apart (env APPCLI_DATA_DIR)")
+	flag.String("web-dir", "", "optional, use this -web-dir with -runserver to serve templates and files from a folder instead of the built in copies (env APPCLI_WEB_DIR)")
+	flag.String("listen", "", "optional, server listen address, default :8080 (env APPCLI_LISTEN_ADDR)")
+	flag.String("debug-addr", "", "optional, with -runserver serve pprof, expvar and an actor dump on this address such as localhost:6060 (env APPCLI_DEBUG_ADDR)")
+	flag.String("log-level", "", "optional, debug info warn or error (env APPCLI_LOG_LEVEL)")
+	flag.String("log-format", "", "optional, json or text (env APPCLI_LOG_FORMAT)")
+	flag.String("log-destination", "", "optional, file stdout stderr or a log file path (env APPCLI_LOG_DESTINATION)")
+	flag.String("autosave-interval", "", "optional, server autosave interval such as 30s (env APPCLI_AUTOSAVE_INTERVAL)")
+	flag.String("shutdown-timeout", "", "optional, how long the server waits for open requests when stopping, default 10s (env APPCLI_SHUTDOWN_TIMEOUT)")
+	flag.String("shards", "", "optional, number of store shards, default 0 is one per cpu (env APPCLI_SHARDS)")
+	flag.String("backends", "", "optional, comma separated storeserver addresses to keep the list in instead of the local file (env APPCLI_BACKENDS)")
+	flag.String("follow", "", "optional, with -runserver replicate from the leader at this url and serve reads only (env APPCLI_FOLLOW)")
+	flag.String("autosave-changes", "", "optional, server saves once this many changes are waiting (env APPCLI_AUTOSAVE_CHANGES)")
 
 	// additional flag required for description updates
 	var taskDescription string
@@ -77,55 +109,248 @@ func main() {
 	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), appcontext.TraceIdKey, id))
 	defer cancel()
 
-	// resolve the appdata data sub folder
-	dir, err := filer.CreateAppDataFolder(dataStorageFolderName)
+	// settings given on the command line
+	setFlags := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+	appDirs, err := filer.ResolveAppDirs(dataStorageFolderName, "")
+	if err != nil {
+		fmt.Printf("Error:%s %s\n", "Cannot establish config folder", err)
+		return
+	}
+	cfg, err := config.Load(appDirs.Config, *flagConfig, setFlags)
+	if err != nil {
+		fmt.Printf("Error:%s %s\n", "Cannot load configuration", err)
+		return
+	}
+	if err := store.SetStates(cfg.States); err != nil {
+		fmt.Printf("Error:%s %s\n", "Cannot set workflow states", err)
+		return
+	}
+
+	// commands that do not need the todo list
+	if flag.NArg() > 0 && isConfigCommand(flag.Args()) {
+		if err := runConfigCommand(cfg, flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 && isPromoteCommand(flag.Args()) {
+		if err := runPromoteCommand(ctx, cfg, flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 && isLoadtestCommand(flag.Args()) {
+		if err := runLoadtestCommand(ctx, cfg, flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+
+	// resolve the appdata data, config and state sub folders
+	dirs, err := filer.CreateAppDirs(dataStorageFolderName, cfg.DataDir)
 	if err != nil {
 		// don't have a file logger yet!
-		fmt.Printf("Error:%s", "Cannot establish working data folder")
+		fmt.Printf("Error:%s %s\n", "Cannot establish working data folder", err)
+		return
+	}
+	if flag.NArg() > 0 && isProfileCommand(flag.Args()) {
+		if err := runProfileCommand(ctx, cfg, dirs.Data, flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
 		return
 	}
 
 	// wire up logger
-	logName := dir + "\\" + logFileName
-	if logFileHandle, err := filer.OpenLogFile(logName); err == nil {
-		defer logFileHandle.Close()
-		logOptions := logging.LoggerOptions()
-		logging.Setup(logFileHandle, logOptions)
+	if logWriter, closeLog, err := openLog(cfg.Log, dirs.State); err == nil {
+		defer closeLog()
+		logOptions, _ := logging.LoggerOptions(cfg.Log.Level, cfg.Log.Source)
+		logging.Setup(logWriter, cfg.Log.Format, logOptions)
 		logging.Log().InfoContext(ctx, "Starting up logging with static logger")
+	} else {
+		logging.Default()
 	}
 
 	// init / pickup current list before process command
-	storageFile := fmt.Sprintf("%s\\%s", dir, dataFileName)
-	// open the database for cli and api
-	openErr := store.OpenSession(ctx, storageFile)
-	if openErr != nil {
-		// fatal database is unavailable
+	storageFile := filepath.Join(dirs.Data, dataFileName)
+	if cfg.DataDir == "" {
+		if moved, err := filer.MoveLegacyFile(dataStorageFolderName, dataFileName, storageFile); err != nil {
+			logging.Log().ErrorContext(ctx, "Moving legacy data file failed", "err", err)
+		} else if moved {
+			fmt.Printf("Moved data file to %s\n", storageFile)
+			logging.Log().InfoContext(ctx, "Moved legacy data file", "storageFile", storageFile)
+		}
+	}
+	if len(cfg.Backends) > 0 && cfg.Follow != "" {
+		fmt.Printf("Error:%s\n", "A follower keeps its own copy of the list, it cannot use store servers")
+		return
+	}
+	if len(cfg.Backends) > 0 {
+		// the list lives in store servers, nothing to open here
+		if err := useBackends(ctx, cfg.Backends, *flagRunServer); err != nil {
+			fmt.Printf("Error:%s %s\n", "Cannot use store servers", err)
+			return
+		}
+	} else {
+		if err := store.SetShards(cfg.Shards); err != nil {
+			fmt.Printf("Error:%s %s\n", "Cannot set store shards", err)
+			return
+		}
+		// open the database for cli and api
+		openErr := store.OpenSession(ctx, storageFile)
+		if openErr != nil {
+			// fatal database is unavailable
+			return
+		}
+		// start the store actor for map
+		store.StartActor(ctx)
+	}
+
+	if flag.NArg() > 0 && isSyncCommand(flag.Args()) {
+		if err := runSyncCommand(ctx, cfg, filepath.Join(dirs.Data, syncStateFileName), flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 && isExportCommand(flag.Args()) {
+		if err := runExportCommand(flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 && isImportCommand(flag.Args()) {
+		if err := runImportCommand(ctx, flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 && isChecklistCommand(flag.Args()) {
+		if err := runChecklistCommand(ctx, flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 && isReorderCommand(flag.Args()) {
+		if err := runReorderCommand(ctx, flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 && isMergeCommand(flag.Args()) {
+		if err := runMergeCommand(ctx, flag.Args()); err != nil {
+			fmt.Printf("Error:%s\n", err)
+		}
+		return
+	}
+
+	due, dueErr := parseDue(*flagDue)
+	if dueErr != nil {
+		fmt.Printf("Error:%s\n", dueErr)
 		return
 	}
-	// start the store actor for map
-	store.StartActor(ctx)
+	if *flagRecur != "" && *flagRecur != "none" {
+		if _, ok := store.ParseRecurrence(*flagRecur); ok != nil {
+			fmt.Printf("Error:%s\n", ok)
+			return
+		}
+	}
+
+	if *flagForce {
+		ctx = store.OverrideBlockers(ctx)
+	}
 
 	// process the flags
 	switch {
+	case *flagAdd != "" && *flagParent != 0:
+		if nextKey, ok := store.AddSubtask(ctx, *flagParent, *flagAdd, store.ParseTags(*flagTags)); ok == nil {
+			if *flagDue != "" {
+				store.DueChange(ctx, nextKey, due)
+			}
+			if *flagRecur != "" {
+				store.RecurChange(ctx, nextKey, *flagRecur)
+			}
+			store.ListTask(*flagParent)
+		} else {
+			fmt.Printf("Error:%s\n", ok)
+		}
 	case *flagAdd != "":
-		if nextKey, ok := store.AddTask(ctx, *flagAdd); ok == nil {
+		if nextKey, ok := store.AddTaskWithTags(ctx, *flagAdd, store.ParseTags(*flagTags)); ok == nil {
+			if *flagDue != "" {
+				store.DueChange(ctx, nextKey, due)
+			}
+			if *flagRecur != "" {
+				store.RecurChange(ctx, nextKey, *flagRecur)
+			}
 			store.ListTask(nextKey)
 		}
 	case *flagUpdate > 0 && len(taskDescription) > 0:
 		if ok := store.DescriptionChange(ctx, *flagUpdate, taskDescription); ok == nil {
+			if *flagDue != "" {
+				store.DueChange(ctx, *flagUpdate, due)
+			}
+			if *flagRecur != "" {
+				store.RecurChange(ctx, *flagUpdate, *flagRecur)
+			}
 			store.ListTask(*flagUpdate)
 		}
+	case *flagUpdate > 0 && *flagDue != "":
+		if ok := store.DueChange(ctx, *flagUpdate, due); ok == nil {
+			if *flagRecur != "" {
+				store.RecurChange(ctx, *flagUpdate, *flagRecur)
+			}
+			store.ListTask(*flagUpdate)
+		}
+	case *flagUpdate > 0 && *flagRecur != "":
+		if ok := store.RecurChange(ctx, *flagUpdate, *flagRecur); ok == nil {
+			store.ListTask(*flagUpdate)
+		} else {
+			fmt.Printf("Error:%s\n", ok)
+		}
+	case *flagHistory > 0:
+		if ok := store.ListHistory(*flagHistory); ok != nil {
+			fmt.Printf("Error:%s\n", ok)
+		}
+	case *flagMove > 0:
+		if ok := store.MoveTask(ctx, *flagMove, *flagParent); ok == nil {
+			store.ListTask(-1)
+		} else {
+			fmt.Printf("Error:%s\n", ok)
+		}
+	case *flagBlock > 0:
+		if ok := store.AddBlocker(ctx, *flagBlock, *flagBy); ok == nil {
+			store.ListTask(*flagBlock)
+		} else {
+			fmt.Printf("Error:%s\n", ok)
+		}
+	case *flagUnblock > 0:
+		if ok := store.RemoveBlocker(ctx, *flagUnblock, *flagBy); ok == nil {
+			store.ListTask(*flagUnblock)
+		} else {
+			fmt.Printf("Error:%s\n", ok)
+		}
+	case *flagBlocked:
+		store.ListBlocked()
 	case *flagNotStart > 0:
-		if ok := store.StateChange(ctx, *flagNotStart, store.StateNotStarted); ok == nil {
+		if ok := changeState(ctx, *flagNotStart, store.StateNotStarted, *flagCascade); ok == nil {
 			store.ListTask(*flagNotStart)
 		}
 	case *flagStart > 0:
-		if ok := store.StateChange(ctx, *flagStart, store.StateStarted); ok == nil {
+		if ok := changeState(ctx, *flagStart, store.StateStarted, *flagCascade); ok == nil {
 			store.ListTask(*flagStart)
+		} else {
+			fmt.Printf("Error:%s\n", ok)
 		}
 	case *flagComplete > 0:
-		if ok := store.StateChange(ctx, *flagComplete, store.StateCompleted); ok == nil {
+		if ok := changeState(ctx, *flagComplete, store.StateCompleted, *flagCascade); ok == nil {
 			store.ListTask(*flagComplete)
+		} else {
+			fmt.Printf("Error:%s\n", ok)
+		}
+	case *flagDelete > 0 && *flagCascade:
+		if ok := store.DeleteTree(ctx, *flagDelete); ok == nil {
+			store.ListTask(-1)
 		}
 	case *flagDelete > 0:
 		if ok := store.DeleteTask(ctx, *flagDelete); ok == nil {
@@ -135,11 +360,34 @@ func main() {
 		store.ListTask(taskId)
 	case *flagRunServer:
 		runMode = runmode(RunModeServer)
-		api.Run()
+		api.Run(cfg)
 	}
 
-	if runMode == runmode(RunModeCLI) {
-		// write back to the file
+	if runMode == runmode(RunModeCLI) && store.Dirty() {
+		// write back to the file, only when something changed
 		store.SaveSession(ctx, storageFile)
 	}
 }
+
+// changeState sets the state of the task, with cascade its subtasks as well
+func changeState(ctx context.Context, id int64, state int, cascade bool) error {
+	if cascade {
+		return store.StateChangeTree(ctx, id, state)
+	}
+	return store.StateChange(ctx, id, state)
+}
+
+// parseDue reads -due as a date or an RFC 3339 time, none is no due time
+func parseDue(value string) (time.Time, error) {
+	if value == "" || value == "none" {
+		return time.Time{}, nil
+	}
+	if due, err := time.Parse(time.DateOnly, value); err == nil {
+		return due, nil
+	}
+	due, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot read due %q, want 2006-01-02 or RFC 3339", value)
+	}
+	return due.UTC(), nil
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anthriscus/appcli/api"
+	"github.com/anthriscus/appcli/api/loadtest"
+	"github.com/anthriscus/appcli/config"
+	"github.com/anthriscus/appcli/filer"
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/remote"
+	"github.com/anthriscus/appcli/replica"
+	"github.com/anthriscus/appcli/store"
+	"github.com/anthriscus/appcli/syncer"
+	"github.com/anthriscus/appcli/transfer"
+)
+
+func isConfigCommand(args []string) bool {
+	return args[0] == "config"
+}
+
+// appcli config show
+func runConfigCommand(cfg config.Config, args []string) error {
+	if len(args) == 1 || args[1] == "show" {
+		cfg.Show(os.Stdout)
+		return nil
+	}
+	return fmt.Errorf("unknown config command %s, try: config show", args[1])
+}
+
+func isProfileCommand(args []string) bool {
+	return args[0] == "profile"
+}
+
+// appcli -debug-addr localhost:6060 profile [cpu|heap|...] [seconds]
+// captures a profile from a running server into the data folder
+func runProfileCommand(ctx context.Context, cfg config.Config, dataDir string, args []string) error {
+	if cfg.DebugAddr == "" {
+		return fmt.Errorf("no debug address, give the server's -debug-addr or set APPCLI_DEBUG_ADDR")
+	}
+	kind, seconds := "cpu", 30
+	if len(args) > 1 {
+		kind = args[1]
+	}
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("seconds %q is not a positive whole number", args[2])
+		}
+		seconds = n
+	}
+	fmt.Printf("Capturing %s profile from %s\n", kind, cfg.DebugAddr)
+	fileName, err := api.CaptureProfile(ctx, cfg.DebugAddr, kind, seconds, dataDir)
+	if err != nil {
+		return err
+	}
+	viewer := "go tool pprof -http=:"
+	if kind == "trace" {
+		viewer = "go tool trace"
+	}
+	fmt.Printf("Saved %s, view with: %s %s\n", fileName, viewer, fileName)
+	return nil
+}
+
+func isLoadtestCommand(args []string) bool {
+	return args[0] == "loadtest"
+}
+
+// appcli loadtest [-target url] [-concurrency n] [-rate n] [-duration d] [-mix create=20,get=40,...]
+// the target defaults to this machine on the configured listen port
+func runLoadtestCommand(ctx context.Context, cfg config.Config, args []string) error {
+	defaults := loadtest.DefaultConfig()
+	defaults.Token = cfg.Auth.Token
+	if target, ok := localServer(cfg.ListenAddr); ok {
+		defaults.Target = target
+	}
+	// ctrl-c ends the run early and still prints the report
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	return loadtest.Command(ctx, defaults, args[1:], os.Stdout)
+}
+
+// the server on this machine at the listen address
+func localServer(listenAddr string) (string, bool) {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "", false
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port), true
+}
+
+func isPromoteCommand(args []string) bool {
+	return args[0] == "promote"
+}
+
+// appcli promote [url]
+// makes a follower the leader, the server defaults to this machine on the configured listen port
+func runPromoteCommand(ctx context.Context, cfg config.Config, args []string) error {
+	target, ok := localServer(cfg.ListenAddr)
+	if len(args) > 1 {
+		target, ok = args[1], true
+	}
+	if !ok {
+		return fmt.Errorf("cannot tell the server from listen address %q, give its url: promote http://host:port", cfg.ListenAddr)
+	}
+	status, err := replica.NewClient(target, cfg.Auth.Token).Promote(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now the %s, its log is at epoch %d seq %d\n", target, status.Role, status.Epoch, status.Seq)
+	return nil
+}
+
+func isSyncCommand(args []string) bool {
+	return args[0] == "sync"
+}
+
+// appcli sync [-server url] [-policy lww|keep-both|prompt] [-dry-run]
+// two way sync of the local list with a server, the state file keeps what was last synced
+func runSyncCommand(ctx context.Context, cfg config.Config, stateFile string, args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	server := flags.String("server", cfg.Sync.Server, "appcli server url to sync with (env APPCLI_SYNC_SERVER)")
+	policy := flags.String("policy", cfg.Sync.Policy, "items changed on both sides: lww, keep-both or prompt (env APPCLI_SYNC_POLICY)")
+	dryRun := flags.Bool("dry-run", false, "show what would change and change nothing")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *server == "" {
+		return fmt.Errorf("no server to sync with, give -server url or set APPCLI_SYNC_SERVER")
+	}
+	if store.Remote() {
+		return fmt.Errorf("sync keeps the local list, it cannot use store servers")
+	}
+	syncPolicy, err := syncer.ParsePolicy(*policy)
+	if err != nil {
+		return err
+	}
+	report, err := syncer.Run(ctx, syncer.Options{
+		Server:    *server,
+		Token:     cfg.Auth.Token,
+		Policy:    syncPolicy,
+		StateFile: stateFile,
+		DryRun:    *dryRun,
+		In:        os.Stdin,
+		Out:       os.Stdout,
+	})
+	verb := "Synced"
+	if *dryRun {
+		verb = "Dry run, would sync"
+	}
+	fmt.Printf("%s with %s: %d pushed, %d pulled, %d conflicts\n", verb, *server, report.Pushed, report.Pulled, report.Conflicts)
+	return err
+}
+
+func isMergeCommand(args []string) bool {
+	return args[0] == "merge"
+}
+
+// appcli merge other.json
+// folds another copy of the data file into the local list, edits on both sides are kept field by field
+func runMergeCommand(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("give the file to merge: merge other.json")
+	}
+	if store.Remote() {
+		return fmt.Errorf("merge keeps the local list, it cannot use store servers")
+	}
+	// restoring would make a missing file
+	if _, err := os.Stat(args[1]); err != nil {
+		return err
+	}
+	other, err := store.Restore(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	report, err := store.MergeList(ctx, other)
+	if err != nil {
+		return err
+	}
+	if store.Dirty() {
+		if err := store.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Merged %s: %d added, %d updated, %d deleted\n", args[1], report.Added, report.Updated, report.Deleted)
+	return nil
+}
+
+func isExportCommand(args []string) bool {
+	return args[0] == "export"
+}
+
+// appcli export [-format csv|markdown|todotxt|json] [-o file]
+// writes the list to stdout or the file, the format defaults to the file's extension
+func runExportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := flags.String("format", "", "csv, markdown, todotxt or json, default json or from the -o file name")
+	outFile := flags.String("o", "", "file to write instead of stdout")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	format := transfer.FormatFor(*outFile)
+	if *formatName != "" {
+		var err error
+		if format, err = transfer.ParseFormat(*formatName); err != nil {
+			return err
+		}
+	}
+	scan, err := store.Scan()
+	if err != nil {
+		return err
+	}
+	items := slices.Collect(scan)
+	if *outFile == "" {
+		return transfer.Export(os.Stdout, format, items)
+	}
+	out, err := os.Create(*outFile)
+	if err != nil {
+		return err
+	}
+	if err := transfer.Export(out, format, items); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d tasks to %s as %s\n", len(items), *outFile, format)
+	return nil
+}
+
+func isImportCommand(args []string) bool {
+	return args[0] == "import"
+}
+
+// appcli import [-format f] [-map Title=description,...] [-dry-run] [-keep-duplicates] file
+// adds the tasks in the file, skipping those the list has already
+func runImportCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := flags.String("format", "", "csv, markdown, todotxt or json, default from the file name")
+	mapping := flags.String("map", "", "csv or markdown columns to fields, such as Title=description,Done=state")
+	dryRun := flags.Bool("dry-run", false, "show what would be added and add nothing")
+	keepDuplicates := flags.Bool("keep-duplicates", false, "add tasks even when the list has one with the same description")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("give the file to import: import [-format csv] tasks.csv")
+	}
+	fileName := flags.Arg(0)
+	format := transfer.FormatFor(fileName)
+	if *formatName != "" {
+		var err error
+		if format, err = transfer.ParseFormat(*formatName); err != nil {
+			return err
+		}
+	}
+	fields, err := transfer.ParseFields(*mapping)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	items, err := transfer.Parse(in, format, fields)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fileName, err)
+	}
+	report, err := transfer.Import(ctx, items, transfer.Options{DryRun: *dryRun, KeepDuplicates: *keepDuplicates})
+	if err != nil {
+		return err
+	}
+	verb := "Imported"
+	if *dryRun {
+		verb = "Dry run, would import"
+		for _, item := range report.Added {
+			fmt.Printf("add\t%s\t%s\n", store.StatusName[item.State], item.Description)
+		}
+	}
+	for _, d := range report.Duplicates {
+		of := "an earlier task in the file"
+		if d.Of != 0 {
+			of = strconv.FormatInt(d.Of, 10)
+		}
+		fmt.Printf("skip\t%s\tduplicate of %s\n", d.Item.Description, of)
+	}
+	if store.Dirty() {
+		if err := store.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%s %d tasks from %s, %d duplicates skipped\n", verb, len(report.Added), fileName, len(report.Duplicates))
+	return nil
+}
+
+func isChecklistCommand(args []string) bool {
+	return args[0] == "checklist"
+}
+
+// appcli checklist add id "text" | check id n | uncheck id n | remove id n | order id n n ...
+// the steps are numbered from 1 as -list shows them
+func runChecklistCommand(ctx context.Context, args []string) error {
+	usage := fmt.Errorf("try: checklist add id \"text\", checklist check|uncheck|remove id n or checklist order id n n ...")
+	if len(args) < 4 {
+		return usage
+	}
+	id, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("task id %q is not a number", args[2])
+	}
+	numbers := make([]int, 0, len(args)-3)
+	for _, a := range args[3:] {
+		if n, err := strconv.Atoi(a); err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	if args[1] != "add" && len(numbers) != len(args)-3 {
+		return fmt.Errorf("checklist items are given by their numbers, %v", args[3:])
+	}
+	switch args[1] {
+	case "add":
+		err = store.AddCheckItem(ctx, id, strings.Join(args[3:], " "))
+	case "check", "uncheck":
+		err = store.CheckItemDone(ctx, id, numbers[0], args[1] == "check")
+	case "remove":
+		err = store.RemoveCheckItem(ctx, id, numbers[0])
+	case "order":
+		err = store.ReorderChecklist(ctx, id, numbers)
+	default:
+		return usage
+	}
+	if err != nil {
+		return err
+	}
+	store.ListTask(id)
+	return store.Commit(ctx)
+}
+
+func isReorderCommand(args []string) bool {
+	return args[0] == "reorder"
+}
+
+// appcli reorder parent id id ... puts the subtasks of parent in the order given
+func runReorderCommand(ctx context.Context, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("give the parent and its subtasks in order: reorder parent id id ...")
+	}
+	ids := make([]int64, 0, len(args)-1)
+	for _, a := range args[1:] {
+		id, err := strconv.ParseInt(a, 10, 64)
+		if err != nil {
+			return fmt.Errorf("task id %q is not a number", a)
+		}
+		ids = append(ids, id)
+	}
+	if err := store.ReorderChildren(ctx, ids[0], ids[1:]); err != nil {
+		return err
+	}
+	store.ListTask(ids[0])
+	return store.Commit(ctx)
+}
+
+// useBackends routes the store to the store servers. The server tidies up
+// first in case the server list changed since the last run, items a removed
+// server still holds are only found again once it is added back.
+func useBackends(ctx context.Context, addrs []string, rebalance bool) error {
+	router, err := remote.NewRouter(addrs)
+	if err != nil {
+		return err
+	}
+	store.SetBackend(router)
+	if !rebalance {
+		return nil
+	}
+	moved, err := router.Rebalance(ctx)
+	if err != nil {
+		// readyz reports the store servers until they answer
+		fmt.Printf("Rebalance across store servers failed after %d moves err:%s\n", moved, err)
+		logging.Log().ErrorContext(ctx, "Rebalance failed", "moved", moved, "err", err)
+		return nil
+	}
+	logging.Log().InfoContext(ctx, "Rebalanced store servers", "backends", addrs, "moved", moved)
+	return nil
+}
+
+// log destination is the log file in the state folder, stdout, stderr or a file path
+func openLog(cfg config.LogConfig, stateDir string) (io.Writer, func(), error) {
+	switch cfg.Destination {
+	case "stdout":
+		return os.Stdout, func() {}, nil
+	case "stderr":
+		return os.Stderr, func() {}, nil
+	}
+	logName := filepath.Join(stateDir, logFileName)
+	if cfg.Destination != "file" && cfg.Destination != "" {
+		logName = cfg.Destination
+	}
+	logFileHandle, err := filer.OpenLogFile(logName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logFileHandle, func() { logFileHandle.Close() }, nil
+}
@@ -0,0 +1,381 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are looked for in the config folder in this order, the first found is used
+var FileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+const (
+	SourceDefault string = "default"
+	SourceEnv     string = "env"
+	SourceFile    string = "file"
+	SourceFlag    string = "flag"
+)
+
+type LogConfig struct {
+	Level       string `json:"level"`       // debug, info, warn, error
+	Format      string `json:"format"`      // json or text
+	Destination string `json:"destination"` // file, stdout, stderr or a file path
+	Source      bool   `json:"source"`      // add source file and line to log records
+}
+
+type AuthConfig struct {
+	Token string `json:"token"` // bearer token required on the json api, empty is no auth
+}
+
+type SyncConfig struct {
+	Server string `json:"server"` // appcli server sync uses when none is given
+	Policy string `json:"policy"` // lww, keep-both or prompt for items changed on both sides
+}
+
+// the effective configuration, built up from defaults, the config file,
+// environment variables and finally command line flags
+type Config struct {
+	ListenAddr       string        `json:"listen_addr"`
+	DebugAddr        string        `json:"debug_addr"` // pprof and diagnostics listener, empty is off
+	DataDir          string        `json:"data_dir"`
+	WebDir           string        `json:"web_dir"`
+	Log              LogConfig     `json:"log"`
+	AutosaveInterval time.Duration `json:"autosave_interval"`
+	AutosaveChanges  uint64        `json:"autosave_changes"`
+	ShutdownTimeout  time.Duration `json:"shutdown_timeout"`
+	Shards           int           `json:"shards"`   // store shards, 0 is one per cpu
+	Backends         []string      `json:"backends"` // store servers to route to, empty keeps the list in this process
+	Follow           string        `json:"follow"`   // leader to replicate from, read only while set
+	Auth             AuthConfig    `json:"auth"`
+	Sync             SyncConfig    `json:"sync"`
+	States           []string      `json:"states"`
+
+	File    string            `json:"-"` // config file used, if any
+	Sources map[string]string `json:"-"` // where each setting came from
+}
+
+// one configurable value and how to read and write it as text
+type setting struct {
+	key    string // dotted name, also the config file path
+	env    string
+	flag   string
+	secret bool
+	set    func(c *Config, value string) error
+	get    func(c *Config) string
+}
+
+var settings = []setting{
+	{key: "listen_addr", env: "APPCLI_LISTEN_ADDR", flag: "listen",
+		set: func(c *Config, v string) error { c.ListenAddr = v; return nil },
+		get: func(c *Config) string { return c.ListenAddr }},
+	{key: "debug_addr", env: "APPCLI_DEBUG_ADDR", flag: "debug-addr",
+		set: func(c *Config, v string) error { c.DebugAddr = v; return nil },
+		get: func(c *Config) string { return c.DebugAddr }},
+	{key: "data_dir", env: "APPCLI_DATA_DIR", flag: "data-dir",
+		set: func(c *Config, v string) error { c.DataDir = v; return nil },
+		get: func(c *Config) string { return c.DataDir }},
+	{key: "web_dir", env: "APPCLI_WEB_DIR", flag: "web-dir",
+		set: func(c *Config, v string) error { c.WebDir = v; return nil },
+		get: func(c *Config) string { return c.WebDir }},
+	{key: "log.level", env: "APPCLI_LOG_LEVEL", flag: "log-level",
+		set: func(c *Config, v string) error { return oneOf(&c.Log.Level, v, "debug", "info", "warn", "error") },
+		get: func(c *Config) string { return c.Log.Level }},
+	{key: "log.format", env: "APPCLI_LOG_FORMAT", flag: "log-format",
+		set: func(c *Config, v string) error { return oneOf(&c.Log.Format, v, "json", "text") },
+		get: func(c *Config) string { return c.Log.Format }},
+	{key: "log.destination", env: "APPCLI_LOG_DESTINATION", flag: "log-destination",
+		set: func(c *Config, v string) error { c.Log.Destination = v; return nil },
+		get: func(c *Config) string { return c.Log.Destination }},
+	{key: "log.source", env: "APPCLI_LOG_SOURCE",
+		set: func(c *Config, v string) error { return parseBool(&c.Log.Source, v) },
+		get: func(c *Config) string { return strconv.FormatBool(c.Log.Source) }},
+	{key: "autosave_interval", env: "APPCLI_AUTOSAVE_INTERVAL", flag: "autosave-interval",
+		set: func(c *Config, v string) error { return parseDuration(&c.AutosaveInterval, v) },
+		get: func(c *Config) string { return c.AutosaveInterval.String() }},
+	{key: "autosave_changes", env: "APPCLI_AUTOSAVE_CHANGES", flag: "autosave-changes",
+		set: func(c *Config, v string) error { return parseCount(&c.AutosaveChanges, v) },
+		get: func(c *Config) string { return strconv.FormatUint(c.AutosaveChanges, 10) }},
+	{key: "shutdown_timeout", env: "APPCLI_SHUTDOWN_TIMEOUT", flag: "shutdown-timeout",
+		set: func(c *Config, v string) error { return parsePositiveDuration(&c.ShutdownTimeout, v) },
+		get: func(c *Config) string { return c.ShutdownTimeout.String() }},
+	{key: "shards", env: "APPCLI_SHARDS", flag: "shards",
+		set: func(c *Config, v string) error { return parseInt(&c.Shards, v) },
+		get: func(c *Config) string { return strconv.Itoa(c.Shards) }},
+	{key: "backends", env: "APPCLI_BACKENDS", flag: "backends",
+		set: func(c *Config, v string) error { return parseAddrs(&c.Backends, v) },
+		get: func(c *Config) string { return strings.Join(c.Backends, ",") }},
+	{key: "follow", env: "APPCLI_FOLLOW", flag: "follow",
+		set: func(c *Config, v string) error { c.Follow = strings.TrimSpace(v); return nil },
+		get: func(c *Config) string { return c.Follow }},
+	{key: "auth.token", env: "APPCLI_AUTH_TOKEN", secret: true,
+		set: func(c *Config, v string) error { c.Auth.Token = v; return nil },
+		get: func(c *Config) string { return c.Auth.Token }},
+	{key: "sync.server", env: "APPCLI_SYNC_SERVER",
+		set: func(c *Config, v string) error { c.Sync.Server = strings.TrimSpace(v); return nil },
+		get: func(c *Config) string { return c.Sync.Server }},
+	{key: "sync.policy", env: "APPCLI_SYNC_POLICY",
+		set: func(c *Config, v string) error { return oneOf(&c.Sync.Policy, v, "lww", "keep-both", "prompt") },
+		get: func(c *Config) string { return c.Sync.Policy }},
+	{key: "states", env: "APPCLI_STATES",
+		set: func(c *Config, v string) error { return parseStates(&c.States, v) },
+		get: func(c *Config) string { return strings.Join(c.States, ",") }},
+}
+
+func Default() Config {
+	c := Config{
+		ListenAddr:       ":8080",
+		Log:              LogConfig{Level: "info", Format: "json", Destination: "file"},
+		AutosaveInterval: 30 * time.Second,
+		AutosaveChanges:  100,
+		ShutdownTimeout:  10 * time.Second,
+		Sync:             SyncConfig{Policy: "lww"},
+		States:           []string{"Not started", "Started", "Completed"},
+		Sources:          map[string]string{},
+	}
+	for _, s := range settings {
+		c.Sources[s.key] = SourceDefault
+	}
+	return c
+}
+
+// Load builds the configuration, later layers win
+//
+//	defaults < config file < environment < flags
+//
+// configDir is where config.json, .yaml, .yml or .toml is looked for unless
+// file names one explicitly, flags holds only the flags given on the command line.
+func Load(configDir string, file string, flags map[string]string) (Config, error) {
+	c := Default()
+
+	explicit := file != ""
+	if !explicit {
+		file = os.Getenv("APPCLI_CONFIG")
+		explicit = file != ""
+	}
+	if !explicit && configDir != "" {
+		for _, name := range FileNames {
+			file = filepath.Join(configDir, name)
+			if _, err := os.Stat(file); err == nil {
+				break
+			}
+		}
+	}
+	if file != "" {
+		if f, err := os.Open(file); err == nil {
+			err = c.applyFile(f, file)
+			f.Close()
+			if err != nil {
+				return c, err
+			}
+		} else if explicit || !errors.Is(err, os.ErrNotExist) {
+			return c, fmt.Errorf("config file %s: %w", file, err)
+		}
+	}
+
+	// the original development switch, kept as a shortcut for debug logs
+	if os.Getenv("APP_ENV") == "development" {
+		c.Log.Level, c.Log.Source = "debug", true
+		c.Sources["log.level"], c.Sources["log.source"] = SourceEnv+":APP_ENV", SourceEnv+":APP_ENV"
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := s.set(&c, v); err != nil {
+				return c, fmt.Errorf("%s: %w", s.env, err)
+			}
+			c.Sources[s.key] = SourceEnv + ":" + s.env
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := flags[s.flag]; ok && s.flag != "" {
+			if err := s.set(&c, v); err != nil {
+				return c, fmt.Errorf("-%s: %w", s.flag, err)
+			}
+			c.Sources[s.key] = SourceFlag + ":-" + s.flag
+		}
+	}
+	return c, nil
+}
+
+// the config file is yaml or toml by its extension and json otherwise,
+// nested objects become dotted keys
+func (c *Config) applyFile(r io.Reader, name string) error {
+	raw := map[string]any{}
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		if err = yaml.NewDecoder(r).Decode(&raw); errors.Is(err, io.EOF) {
+			err = nil // an empty file sets nothing
+		}
+	case ".toml":
+		_, err = toml.NewDecoder(r).Decode(&raw)
+	default:
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", name, err)
+	}
+	values := map[string]string{}
+	flatten("", raw, values)
+	for key := range values {
+		if !slices.ContainsFunc(settings, func(s setting) bool { return s.key == key }) {
+			return fmt.Errorf("config file %s: unknown setting %s", name, key)
+		}
+	}
+	for _, s := range settings {
+		if v, ok := values[s.key]; ok {
+			if err := s.set(c, v); err != nil {
+				return fmt.Errorf("config file %s: %s: %w", name, s.key, err)
+			}
+			c.Sources[s.key] = SourceFile + ":" + name
+		}
+	}
+	c.File = name
+	return nil
+}
+
+func flatten(prefix string, raw map[string]any, values map[string]string) {
+	for k, v := range raw {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch value := v.(type) {
+		case map[string]any:
+			flatten(key, value, values)
+		case []any:
+			parts := make([]string, 0, len(value))
+			for _, p := range value {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			values[key] = strings.Join(parts, ",")
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// Show writes the effective configuration and where each value came from
+func (c Config) Show(w io.Writer) {
+	if c.File != "" {
+		fmt.Fprintf(w, "# config file: %s\n", c.File)
+	} else {
+		fmt.Fprintf(w, "# config file: none\n")
+	}
+	width := 0
+	for _, s := range settings {
+		width = max(width, len(s.key))
+	}
+	for _, s := range settings {
+		value := s.get(&c)
+		if s.secret && value != "" {
+			value = "********"
+		}
+		fmt.Fprintf(w, "%-*s = %-30q # %s\n", width, s.key, value, c.Sources[s.key])
+	}
+}
+
+func oneOf(target *string, value string, allowed ...string) error {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if !slices.Contains(allowed, value) {
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(allowed, ", "))
+	}
+	*target = value
+	return nil
+}
+
+func parseBool(target *bool, value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", value)
+	}
+	*target = b
+	return nil
+}
+
+// a bare number is taken as seconds
+func parseDuration(target *time.Duration, value string) error {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		*target = time.Duration(seconds) * time.Second
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+	}
+	*target = d
+	return nil
+}
+
+// zero would give open requests no time at all
+func parsePositiveDuration(target *time.Duration, value string) error {
+	var d time.Duration
+	if err := parseDuration(&d, value); err != nil {
+		return err
+	} else if d <= 0 {
+		return fmt.Errorf("%q must be longer than 0s", value)
+	}
+	*target = d
+	return nil
+}
+
+func parseCount(target *uint64, value string) error {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a whole number", value)
+	}
+	*target = n
+	return nil
+}
+
+func parseInt(target *int, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%q is not a whole number", value)
+	}
+	*target = n
+	return nil
+}
+
+// the first three states keep their meaning of not started, started and completed
+func parseStates(target *[]string, value string) error {
+	states := []string{}
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			states = append(states, s)
+		}
+	}
+	if len(states) < 3 {
+		return fmt.Errorf("need at least 3 workflow states, got %d", len(states))
+	}
+	*target = states
+	return nil
+}
+
+// comma separated host:port addresses, duplicates are an error as each
+// address is one place on the ring
+func parseAddrs(target *[]string, value string) error {
+	addrs := []string{}
+	for _, a := range strings.Split(value, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		} else if slices.Contains(addrs, a) {
+			return fmt.Errorf("address %s given twice", a)
+		}
+		addrs = append(addrs, a)
+	}
+	*target = addrs
+	return nil
+}
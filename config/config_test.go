@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, FileNames[0])
+	json := `{"listen_addr": ":9090", "data_dir": "/srv/file", "log": {"level": "warn", "source": true}, "autosave_interval": "1m", "states": ["Todo", "Doing", "Done", "Archived"]}`
+	if ok := os.WriteFile(file, []byte(json), 0600); ok != nil {
+		t.Fatal(ok)
+	}
+	t.Setenv("APP_ENV", "")
+	t.Setenv("APPCLI_CONFIG", "")
+	t.Setenv("APPCLI_DATA_DIR", "/srv/env")
+	t.Setenv("APPCLI_LOG_LEVEL", "error")
+	t.Setenv("APPCLI_AUTOSAVE_INTERVAL", "")
+
+	c, ok := Load(dir, "", map[string]string{"data-dir": "/srv/flag"})
+	if ok != nil {
+		t.Fatalf("load failed %s", ok)
+	}
+	var tests = []struct {
+		key    string
+		got    any
+		want   any
+		source string
+	}{
+		{key: "listen_addr", got: c.ListenAddr, want: ":9090", source: SourceFile + ":" + file},
+		{key: "data_dir", got: c.DataDir, want: "/srv/flag", source: SourceFlag + ":-data-dir"},
+		{key: "log.level", got: c.Log.Level, want: "error", source: SourceEnv + ":APPCLI_LOG_LEVEL"},
+		{key: "log.source", got: c.Log.Source, want: true, source: SourceFile + ":" + file},
+		{key: "log.format", got: c.Log.Format, want: "json", source: SourceDefault},
+		{key: "autosave_interval", got: c.AutosaveInterval, want: time.Minute, source: SourceFile + ":" + file},
+		{key: "states", got: len(c.States), want: 4, source: SourceFile + ":" + file},
+	}
+	for _, tc := range tests {
+		if tc.got != tc.want {
+			t.Errorf("%s got %v want %v", tc.key, tc.got, tc.want)
+		}
+		if c.Sources[tc.key] != tc.source {
+			t.Errorf("%s source got %s want %s", tc.key, c.Sources[tc.key], tc.source)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("APPCLI_CONFIG", "")
+	var tests = []struct {
+		json  string
+		file  string
+		flags map[string]string
+		want  bool
+	}{
+		{json: `{"listen_addr": ":9090"}`, want: true},
+		// missing default file is fine, a missing named file is not
+		{json: "", want: true},
+		{json: "", file: filepath.Join(dir, "missing.json"), want: false},
+		{json: `{"listen": ":9090"}`, want: false},
+		{json: `{"log": {"level": "loud"}}`, want: false},
+		{json: `{"states": ["one", "two"]}`, want: false},
+		{json: `{"autosave_interval": "soon"}`, want: false},
+		{json: `{"backends": ["127.0.0.1:9001", "127.0.0.1:9002"]}`, want: true},
+		{json: "", flags: map[string]string{"backends": "127.0.0.1:9001, 127.0.0.1:9001"}, want: false},
+		{json: `not json`, want: false},
+		{json: "", flags: map[string]string{"log-format": "xml"}, want: false},
+		{json: "", flags: map[string]string{"autosave-interval": "45"}, want: true},
+		{json: "", flags: map[string]string{"autosave-interval": "-45"}, want: false},
+		{json: `{"shutdown_timeout": "5s"}`, want: true},
+		{json: `{"shutdown_timeout": "0s"}`, want: false},
+		{json: `{"shutdown_timeout": 0}`, want: false},
+		{json: "", flags: map[string]string{"shutdown-timeout": "-1s"}, want: false},
+	}
+
+	for i, tc := range tests {
+		file := filepath.Join(dir, FileNames[0])
+		os.Remove(file)
+		if tc.json != "" {
+			os.WriteFile(file, []byte(tc.json), 0600)
+		}
+		if _, ok := Load(dir, tc.file, tc.flags); tc.want != (ok == nil) {
+			t.Errorf("test %d want ok %t got %v", i, tc.want, ok)
+		}
+	}
+}
+
+// the same settings as yaml and toml, found in the config folder when there is no config.json
+func TestLoadFormats(t *testing.T) {
+	t.Setenv("APP_ENV", "")
+	t.Setenv("APPCLI_CONFIG", "")
+	t.Setenv("APPCLI_LISTEN_ADDR", "")
+	t.Setenv("APPCLI_LOG_LEVEL", "")
+	var tests = []struct {
+		name string
+		text string
+	}{
+		{name: "config.yaml", text: "listen_addr: \":9090\"\nautosave_interval: 1m\nlog:\n  level: warn\n  source: true\nstates: [Todo, Doing, Done, Archived]\n"},
+		{name: "config.yml", text: "listen_addr: \":9090\"\nautosave_interval: 60\nlog:\n  level: warn\n  source: true\nstates:\n  - Todo\n  - Doing\n  - Done\n  - Archived\n"},
+		{name: "config.toml", text: "listen_addr = \":9090\"\nautosave_interval = \"1m\"\nstates = [\"Todo\", \"Doing\", \"Done\", \"Archived\"]\n\n[log]\nlevel = \"warn\"\nsource = true\n"},
+	}
+	for _, tc := range tests {
+		dir := t.TempDir()
+		file := filepath.Join(dir, tc.name)
+		if ok := os.WriteFile(file, []byte(tc.text), 0600); ok != nil {
+			t.Fatal(ok)
+		}
+		c, ok := Load(dir, "", nil)
+		if ok != nil {
+			t.Errorf("%s: load failed %s", tc.name, ok)
+			continue
+		}
+		if c.File != file || c.ListenAddr != ":9090" || c.AutosaveInterval != time.Minute || c.Log.Level != "warn" || !c.Log.Source || !slices.Equal(c.States, []string{"Todo", "Doing", "Done", "Archived"}) {
+			t.Errorf("%s: got %+v", tc.name, c)
+		}
+	}
+	for name, text := range map[string]string{"bad.yaml": "listen: [", "bad.toml": "listen_addr = ", "unknown.toml": "listen = \":9090\""} {
+		file := filepath.Join(t.TempDir(), name)
+		os.WriteFile(file, []byte(text), 0600)
+		if _, ok := Load("", file, nil); ok == nil {
+			t.Errorf("%s: wanted an error", name)
+		}
+	}
+}
@@ -1,22 +1,114 @@
 package filer
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
 )
 
-func CreateAppDataFolder(applicationName string) (string, error) {
-	dir, err := os.UserCacheDir()
+const (
+	folderMode os.FileMode = 0700 // owner only but traversable
+)
+
+// the folders the app keeps its files in
+type AppDirs struct {
+	Data   string // the todo list
+	Config string // config file
+	State  string // logs and other run state
+}
+
+// ResolveAppDirs finds the data, config and state folders for the application.
+// On Linux these follow the XDG base directory spec, elsewhere the os user folders.
+// A non empty dataDir override holds both the data and the state so
+// several profiles can sit side by side.
+func ResolveAppDirs(applicationName string, dataDir string) (AppDirs, error) {
+	var dirs AppDirs
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return dirs, err
+	}
+	dirs.Config = filepath.Join(config, applicationName)
+
+	switch {
+	case dataDir != "":
+		if dirs.Data, err = filepath.Abs(dataDir); err != nil {
+			return dirs, err
+		}
+		dirs.State = dirs.Data
+	case runtime.GOOS == "linux":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return dirs, err
+		}
+		dirs.Data = filepath.Join(xdgDir("XDG_DATA_HOME", filepath.Join(home, ".local", "share")), applicationName)
+		dirs.State = filepath.Join(xdgDir("XDG_STATE_HOME", filepath.Join(home, ".local", "state")), applicationName)
+	default:
+		// windows keeps the original local app data location
+		base, err := os.UserCacheDir()
+		if runtime.GOOS == "darwin" {
+			base, err = os.UserConfigDir()
+		}
+		if err != nil {
+			return dirs, err
+		}
+		dirs.Data = filepath.Join(base, applicationName)
+		dirs.State = dirs.Data
+	}
+	return dirs, nil
+}
+
+// the spec says relative paths in the variables are invalid and should be ignored
+func xdgDir(variable string, fallback string) string {
+	if dir := os.Getenv(variable); dir != "" && filepath.IsAbs(dir) {
+		return dir
+	}
+	return fallback
+}
+
+// CreateAppDirs resolves and makes the application folders
+func CreateAppDirs(applicationName string, dataDir string) (AppDirs, error) {
+	dirs, err := ResolveAppDirs(applicationName, dataDir)
 	if err != nil {
-		return "", err
+		return dirs, err
+	}
+	for _, dir := range []string{dirs.Data, dirs.Config, dirs.State} {
+		if err := CreateFolder(dir); err != nil {
+			return dirs, err
+		}
+	}
+	return dirs, nil
+}
+
+// CreateFolder makes a folder and its parents with the application folder mode
+func CreateFolder(dir string) error {
+	return os.MkdirAll(dir, folderMode)
+}
+
+// MoveLegacyFile moves a data file from where older builds wrote it, which on
+// linux was a file in the cache folder with back slashes in its name.
+// Nothing happens if the file is already in its new home.
+func MoveLegacyFile(applicationName string, fileName string, destination string) (bool, error) {
+	if runtime.GOOS == "windows" {
+		return false, nil
 	}
-	dir = dir + "\\" + applicationName
-	err = os.MkdirAll(dir, 0600)
+	cache, err := os.UserCacheDir()
 	if err != nil {
-		return "", err
+		return false, nil
+	}
+	legacy := cache + "\\" + applicationName + "\\" + fileName
+	if _, err := os.Stat(destination); !errors.Is(err, os.ErrNotExist) {
+		return false, nil
 	}
-	return dir, nil
+	if _, err := os.Stat(legacy); err != nil {
+		return false, nil
+	}
+	if err := os.Rename(legacy, destination); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func OpenLogFile(fileName string) (*os.File, error) {
@@ -48,3 +140,56 @@ func OpenFileTruncate(fileName string) (*os.File, error) {
 		return fi, nil
 	}
 }
+
+// WriteFileAtomic replaces the file with data. The data goes to a temp file in
+// the same folder, is synced and then renamed over the file, so a crash or a
+// full disk part way leaves the old file whole rather than a truncated one.
+// A link is followed and the file it points at replaced, with its mode kept.
+func WriteFileAtomic(fileName string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(fileName); err == nil {
+		fileName = target
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(fileName); err == nil {
+		mode = info.Mode().Perm()
+	}
+	temp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // gone already once renamed
+	if err := writeSynced(temp, data, mode); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), fileName); err != nil {
+		return err
+	}
+	return syncFolder(filepath.Dir(fileName))
+}
+
+func writeSynced(f *os.File, data []byte, mode os.FileMode) error {
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// the rename is only durable once the folder is synced, windows has no folder sync
+func syncFolder(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	folder, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer folder.Close()
+	return folder.Sync()
+}
@@ -0,0 +1,119 @@
+package filer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolveAppDirs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("xdg folders are linux only")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	var tests = []struct {
+		dataHome  string
+		stateHome string
+		dataDir   string
+		want      AppDirs
+	}{
+		{want: AppDirs{
+			Data:   filepath.Join(home, ".local", "share", "appcli"),
+			Config: filepath.Join(home, ".config", "appcli"),
+			State:  filepath.Join(home, ".local", "state", "appcli")}},
+		{dataHome: "/srv/data", stateHome: "/srv/state",
+			want: AppDirs{
+				Data:   filepath.Join("/srv/data", "appcli"),
+				Config: filepath.Join(home, ".config", "appcli"),
+				State:  filepath.Join("/srv/state", "appcli")}},
+		// relative xdg paths are ignored
+		{dataHome: "relative/data",
+			want: AppDirs{
+				Data:   filepath.Join(home, ".local", "share", "appcli"),
+				Config: filepath.Join(home, ".config", "appcli"),
+				State:  filepath.Join(home, ".local", "state", "appcli")}},
+		// a profile override keeps data and state together
+		{dataHome: "/srv/data", dataDir: "/srv/profile",
+			want: AppDirs{
+				Data:   "/srv/profile",
+				Config: filepath.Join(home, ".config", "appcli"),
+				State:  "/srv/profile"}},
+	}
+
+	for i, tc := range tests {
+		t.Setenv("XDG_DATA_HOME", tc.dataHome)
+		t.Setenv("XDG_STATE_HOME", tc.stateHome)
+		if got, ok := ResolveAppDirs("appcli", tc.dataDir); ok != nil {
+			t.Errorf("test %d unexpected error %s", i, ok)
+		} else if got != tc.want {
+			t.Errorf("test %d got %+v want %+v", i, got, tc.want)
+		}
+	}
+}
+
+func TestCreateAppDirs(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "profile")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	dirs, ok := CreateAppDirs("appcli", dataDir)
+	if ok != nil {
+		t.Fatalf("create failed %s", ok)
+	}
+	for _, dir := range []string{dirs.Data, dirs.Config, dirs.State} {
+		if info, ok := os.Stat(dir); ok != nil {
+			t.Errorf("folder %s not created", dir)
+		} else if runtime.GOOS != "windows" && info.Mode().Perm() != folderMode {
+			t.Errorf("folder %s mode %v want %v", dir, info.Mode().Perm(), folderMode)
+		}
+	}
+	// the data folder must be usable for the todo list file
+	if f, ok := OpenFileTruncate(filepath.Join(dirs.Data, "todolist.json")); ok != nil {
+		t.Errorf("cannot write in data folder %s", ok)
+	} else {
+		f.Close()
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "todolist.json")
+	for _, data := range []string{`{"1":{}}`, `{}`} {
+		if ok := WriteFileAtomic(fileName, []byte(data)); ok != nil {
+			t.Fatal(ok)
+		}
+		if got, _ := os.ReadFile(fileName); string(got) != data {
+			t.Errorf("wanted %s got %s", data, got)
+		}
+	}
+	link := filepath.Join(dir, "linked.json")
+	if ok := os.Symlink(fileName, link); ok == nil {
+		WriteFileAtomic(link, []byte(`{"2":{}}`))
+		if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+			t.Error("the link was replaced rather than the file it points at")
+		}
+		if got, _ := os.ReadFile(fileName); string(got) != `{"2":{}}` {
+			t.Errorf("linked file not written, got %s", got)
+		}
+	}
+
+	// a failed write leaves what was there and no temp file behind
+	blocked := filepath.Join(dir, "blocked")
+	os.MkdirAll(filepath.Join(blocked, "inside"), folderMode)
+	if ok := WriteFileAtomic(blocked, []byte(`{}`)); ok == nil {
+		t.Error("wanted an error writing over a folder")
+	}
+	if info, ok := os.Stat(blocked); ok != nil || !info.IsDir() {
+		t.Error("the folder written over was lost")
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temp file %s left behind", entry.Name())
+		}
+	}
+}
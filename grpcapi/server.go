@@ -0,0 +1,269 @@
+// Package grpcapi serves the todo store over gRPC, see todo.proto. It runs
+// on the same listener as the http api, requests with a grpc content type
+// over http/2 are handed to it.
+package grpcapi
+
+//go:generate buf generate
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/anthriscus/appcli/appcontext"
+	"github.com/anthriscus/appcli/grpcapi/todopb"
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+type server struct {
+	todopb.UnimplementedTodoStoreServer
+	done <-chan struct{} // closed when the process is stopping, ends the watch streams
+}
+
+// NewServer is the grpc server for the store. An empty token is no auth,
+// otherwise calls need an authorization: Bearer <token> header.
+// Watch streams end when done is closed so a shutdown is not held up by them.
+func NewServer(token string, done <-chan struct{}) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryAuth(token)),
+		grpc.ChainStreamInterceptor(streamAuth(token)),
+	)
+	todopb.RegisterTodoStoreServer(s, &server{done: done})
+	return s
+}
+
+// IsGrpc tells grpc calls from the rest of the http traffic
+func IsGrpc(contentType string, protoMajor int) bool {
+	return protoMajor == 2 && strings.HasPrefix(contentType, "application/grpc")
+}
+
+func authorised(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, got := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "unauthorised")
+}
+
+// every call gets a trace id like the http requests
+func traced(ctx context.Context, method string) context.Context {
+	ctx = context.WithValue(ctx, appcontext.TraceIdKey, appcontext.GenerateId())
+	logging.Log().InfoContext(ctx, "tracer", "grpc", method)
+	return ctx
+}
+
+func unaryAuth(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = traced(ctx, info.FullMethod)
+		if err := authorised(ctx, token); err != nil {
+			logging.Log().WarnContext(ctx, "unauthorised", "grpc", info.FullMethod)
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamAuth(token string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := traced(ss.Context(), info.FullMethod)
+		if err := authorised(ctx, token); err != nil {
+			logging.Log().WarnContext(ctx, "unauthorised", "grpc", info.FullMethod)
+			return err
+		}
+		return handler(srv, tracedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func toTask(item store.TodoListItem) *todopb.Task {
+	return &todopb.Task{
+		Line:        item.Line,
+		Description: item.Description,
+		State:       int32(item.State),
+		Created:     timestamppb.New(item.Created),
+		Id:          item.Id,
+		Tags:        item.Tags,
+	}
+}
+
+func notFound(line int64) error {
+	return status.Errorf(codes.NotFound, "task %d not found", line)
+}
+
+// a task that could not be read, not found only when the store says it is
+// not there rather than that a store server did not answer
+func readFailed(line int64, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return notFound(line)
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// a write the store turned away, a follower takes none
+func writeFailed(err error) error {
+	switch {
+	case errors.Is(err, store.ErrReadOnly):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, store.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// the list could not be read from the store servers
+func listFailed(err error) error {
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+func (s *server) Create(ctx context.Context, req *todopb.CreateRequest) (*todopb.Task, error) {
+	if req.Description == "" {
+		return nil, status.Error(codes.InvalidArgument, "description cannot be empty")
+	}
+	item, err := store.Create(ctx, store.TodoListItem{Description: req.Description, Tags: req.Tags})
+	if err != nil {
+		return nil, writeFailed(err)
+	}
+	return toTask(item), nil
+}
+
+func (s *server) Get(ctx context.Context, req *todopb.GetRequest) (*todopb.Task, error) {
+	item, err := store.GetByIndex(req.Line)
+	if err != nil {
+		return nil, readFailed(req.Line, err)
+	}
+	return toTask(item), nil
+}
+
+func (s *server) List(ctx context.Context, req *todopb.ListRequest) (*todopb.ListResponse, error) {
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit cannot be negative")
+	}
+	tags := store.ParseTags(strings.Join(req.Tags, ","))
+	contains := strings.ToLower(req.Contains)
+	items, err := store.Scan()
+	if err != nil {
+		return nil, listFailed(err)
+	}
+	tasks := []*todopb.Task{}
+	for item := range items {
+		if req.Limit > 0 && len(tasks) == int(req.Limit) {
+			break
+		}
+		if matches(item, req.States, tags, contains) {
+			tasks = append(tasks, toTask(item))
+		}
+	}
+	return &todopb.ListResponse{Tasks: tasks}, nil
+}
+
+// any of the states, every one of the tags and the text in the description
+func matches(item store.TodoListItem, states []int32, tags []string, contains string) bool {
+	if len(states) > 0 && !slices.Contains(states, int32(item.State)) {
+		return false
+	}
+	for _, t := range tags {
+		if !slices.Contains(item.Tags, t) {
+			return false
+		}
+	}
+	return strings.Contains(strings.ToLower(item.Description), contains)
+}
+
+func (s *server) Update(ctx context.Context, req *todopb.UpdateRequest) (*todopb.Task, error) {
+	if req.Description == "" {
+		return nil, status.Error(codes.InvalidArgument, "description cannot be empty")
+	}
+	if _, found := store.StatusName[int(req.State)]; !found {
+		return nil, status.Errorf(codes.InvalidArgument, "state %d is out of range", req.State)
+	}
+	if _, err := store.GetByIndex(req.Line); err != nil {
+		return nil, readFailed(req.Line, err)
+	}
+	item := store.TodoListItem{Line: req.Line, Description: req.Description, State: int(req.State)}
+	if req.ReplaceTags {
+		item.Tags = req.Tags
+		if item.Tags == nil {
+			item.Tags = []string{}
+		}
+	}
+	updated, err := store.Update(ctx, item)
+	if err != nil {
+		return nil, writeFailed(err)
+	}
+	return toTask(updated), nil
+}
+
+func (s *server) Delete(ctx context.Context, req *todopb.DeleteRequest) (*todopb.DeleteResponse, error) {
+	if _, err := store.GetByIndex(req.Line); err != nil {
+		return nil, readFailed(req.Line, err)
+	}
+	if err := store.Delete(ctx, req.Line); err != nil {
+		return nil, writeFailed(err)
+	}
+	return &todopb.DeleteResponse{}, nil
+}
+
+var eventKind = map[store.ChangeKind]todopb.TaskEvent_Kind{
+	store.ChangeCreated: todopb.TaskEvent_CREATED,
+	store.ChangeUpdated: todopb.TaskEvent_UPDATED,
+	store.ChangeDeleted: todopb.TaskEvent_DELETED,
+}
+
+func (s *server) Watch(req *todopb.WatchRequest, stream grpc.ServerStreamingServer[todopb.TaskEvent]) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	// watch before listing so nothing written in between is missed, a
+	// change to a listed task may then arrive twice which is harmless
+	changes := store.Watch(ctx)
+	if req.IncludeExisting {
+		items, err := store.Scan()
+		if err != nil {
+			return listFailed(err)
+		}
+		now := timestamppb.Now()
+		for item := range items {
+			if err := stream.Send(&todopb.TaskEvent{Kind: todopb.TaskEvent_CREATED, Task: toTask(item), At: now}); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		select {
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server shutting down")
+		case change, open := <-changes:
+			if !open {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return status.Error(codes.ResourceExhausted, "watcher fell behind, list again and watch")
+			}
+			event := &todopb.TaskEvent{Kind: eventKind[change.Kind], Task: toTask(change.Item), At: timestamppb.New(change.At)}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
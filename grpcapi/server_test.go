@@ -0,0 +1,255 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/anthriscus/appcli/grpcapi/todopb"
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+const testToken = "secret"
+
+func TestMain(m *testing.M) {
+	logging.Default()
+	ctx, cancel := context.WithCancel(context.Background())
+	workDir, _ := os.MkdirTemp("", "appcli")
+	store.OpenSession(ctx, filepath.Join(workDir, "todolist.json"))
+	store.StartActor(ctx)
+	code := m.Run()
+	cancel()
+	os.RemoveAll(workDir)
+	os.Exit(code)
+}
+
+// a client over an in memory connection, done ends the server's watch streams
+func testClient(t *testing.T) (todopb.TodoStoreClient, chan struct{}) {
+	listener := bufconn.Listen(1 << 20)
+	done := make(chan struct{})
+	srv := NewServer(testToken, done)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, ok := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return todopb.NewTodoStoreClient(conn), done
+}
+
+func authed(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+testToken)
+}
+
+func TestAuth(t *testing.T) {
+	client, _ := testClient(t)
+	if _, ok := client.List(t.Context(), &todopb.ListRequest{}); status.Code(ok) != codes.Unauthenticated {
+		t.Errorf("list without a token wanted Unauthenticated got %v", ok)
+	}
+	if _, ok := client.List(authed(t.Context()), &todopb.ListRequest{}); ok != nil {
+		t.Errorf("list with the token %v", ok)
+	}
+}
+
+func TestCrud(t *testing.T) {
+	client, _ := testClient(t)
+	ctx := authed(t.Context())
+
+	created, ok := client.Create(ctx, &todopb.CreateRequest{Description: "Buy apples", Tags: []string{"Shopping", "grpc"}})
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	if created.Line == 0 || created.Tags[0] != "shopping" || created.Created.AsTime().IsZero() {
+		t.Errorf("unexpected created task %v", created)
+	}
+	got, ok := client.Get(ctx, &todopb.GetRequest{Line: created.Line})
+	if ok != nil || got.Description != "Buy apples" {
+		t.Errorf("get %v %v", got, ok)
+	}
+
+	// tags stay unless replaced
+	updated, ok := client.Update(ctx, &todopb.UpdateRequest{Line: created.Line, Description: "Buy pears", State: int32(store.StateStarted)})
+	if ok != nil || updated.Description != "Buy pears" || updated.State != int32(store.StateStarted) || len(updated.Tags) != 2 {
+		t.Errorf("update %v %v", updated, ok)
+	}
+	updated, ok = client.Update(ctx, &todopb.UpdateRequest{Line: created.Line, Description: "Buy pears", ReplaceTags: true})
+	if ok != nil || len(updated.Tags) != 0 {
+		t.Errorf("replacing with no tags should clear them %v %v", updated, ok)
+	}
+
+	if _, ok := client.Delete(ctx, &todopb.DeleteRequest{Line: created.Line}); ok != nil {
+		t.Fatal(ok)
+	}
+	var tests = []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{name: "get deleted", want: codes.NotFound},
+		{name: "delete deleted", want: codes.NotFound},
+		{name: "update deleted", want: codes.NotFound},
+		{name: "create empty", want: codes.InvalidArgument},
+		{name: "update bad state", want: codes.InvalidArgument},
+	}
+	_, tests[0].err = client.Get(ctx, &todopb.GetRequest{Line: created.Line})
+	_, tests[1].err = client.Delete(ctx, &todopb.DeleteRequest{Line: created.Line})
+	_, tests[2].err = client.Update(ctx, &todopb.UpdateRequest{Line: created.Line, Description: "gone"})
+	_, tests[3].err = client.Create(ctx, &todopb.CreateRequest{})
+	_, tests[4].err = client.Update(ctx, &todopb.UpdateRequest{Line: created.Line, Description: "x", State: 99})
+	for _, tc := range tests {
+		if got := status.Code(tc.err); got != tc.want {
+			t.Errorf("%s wanted %s got %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	client, _ := testClient(t)
+	ctx := authed(t.Context())
+	for _, d := range []string{"Filter walk the dog", "Filter feed the cat", "Filter wash the car"} {
+		task, ok := client.Create(ctx, &todopb.CreateRequest{Description: d, Tags: []string{"filter", d[7:11]}})
+		if ok != nil {
+			t.Fatal(ok)
+		}
+		defer client.Delete(ctx, &todopb.DeleteRequest{Line: task.Line})
+		if d == "Filter feed the cat" {
+			client.Update(ctx, &todopb.UpdateRequest{Line: task.Line, Description: d, State: int32(store.StateCompleted)})
+		}
+	}
+
+	var tests = []struct {
+		request *todopb.ListRequest
+		want    int
+	}{
+		{request: &todopb.ListRequest{Tags: []string{"filter"}}, want: 3},
+		{request: &todopb.ListRequest{Tags: []string{"filter", "walk"}}, want: 1},
+		{request: &todopb.ListRequest{Tags: []string{"filter"}, States: []int32{int32(store.StateCompleted)}}, want: 1},
+		{request: &todopb.ListRequest{Tags: []string{"filter"}, Contains: "THE CA"}, want: 2},
+		{request: &todopb.ListRequest{Tags: []string{"filter"}, Limit: 2}, want: 2},
+		{request: &todopb.ListRequest{Tags: []string{"missing"}}, want: 0},
+	}
+	for _, tc := range tests {
+		got, ok := client.List(ctx, tc.request)
+		if ok != nil || len(got.Tasks) != tc.want {
+			t.Errorf("list %v wanted %d got %d %v", tc.request.String(), tc.want, len(got.GetTasks()), ok)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	client, done := testClient(t)
+	ctx := authed(t.Context())
+	existing, _ := client.Create(ctx, &todopb.CreateRequest{Description: "Already there"})
+	defer client.Delete(ctx, &todopb.DeleteRequest{Line: existing.Line})
+
+	stream, ok := client.Watch(ctx, &todopb.WatchRequest{IncludeExisting: true})
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	// the existing tasks come first, then the changes in order
+	seenExisting := false
+	for !seenExisting {
+		event, ok := stream.Recv()
+		if ok != nil {
+			t.Fatal(ok)
+		}
+		seenExisting = event.Task.Line == existing.Line && event.Kind == todopb.TaskEvent_CREATED
+	}
+	// an existing task may be listed after the watch began, so wait for the stream to drain
+	time.Sleep(50 * time.Millisecond)
+
+	task, _ := client.Create(ctx, &todopb.CreateRequest{Description: "Watch me"})
+	client.Update(ctx, &todopb.UpdateRequest{Line: task.Line, Description: "Watched", State: int32(store.StateStarted)})
+	client.Delete(ctx, &todopb.DeleteRequest{Line: task.Line})
+
+	want := []todopb.TaskEvent_Kind{todopb.TaskEvent_CREATED, todopb.TaskEvent_UPDATED, todopb.TaskEvent_DELETED}
+	for _, kind := range want {
+		event, ok := stream.Recv()
+		if ok != nil {
+			t.Fatal(ok)
+		}
+		if event.Kind != kind || event.Task.Line != task.Line {
+			t.Errorf("wanted %s for %d got %s for %d", kind, task.Line, event.Kind, event.Task.Line)
+		}
+	}
+
+	// stopping ends the stream rather than leaving it open
+	close(done)
+	if _, ok := stream.Recv(); status.Code(ok) != codes.Unavailable {
+		t.Errorf("wanted Unavailable once stopping got %v", ok)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	client, _ := testClient(t)
+	ctx := authed(t.Context())
+	store.SetReadOnly(true)
+	defer store.SetReadOnly(false)
+	if _, ok := client.Create(ctx, &todopb.CreateRequest{Description: "To a follower"}); status.Code(ok) != codes.FailedPrecondition {
+		t.Errorf("create on a follower wanted FailedPrecondition got %v", ok)
+	}
+	if _, ok := client.List(ctx, &todopb.ListRequest{}); ok != nil {
+		t.Errorf("list on a follower %v", ok)
+	}
+}
+
+// a backend whose store servers do not answer
+type downBackend struct{}
+
+var errDown = errors.New("store server down")
+
+func (downBackend) Get(ctx context.Context, id int64) (store.TodoListItem, bool, error) {
+	return store.TodoListItem{}, false, errDown
+}
+func (downBackend) Put(ctx context.Context, item store.TodoListItem) (bool, error) {
+	return false, errDown
+}
+func (downBackend) Delete(ctx context.Context, id int64) (store.TodoListItem, bool, error) {
+	return store.TodoListItem{}, false, errDown
+}
+func (downBackend) List(ctx context.Context) (store.TodoListItems, error) { return nil, errDown }
+func (downBackend) Count(ctx context.Context) (int, error)                { return 0, errDown }
+func (downBackend) Ping(ctx context.Context) error                        { return errDown }
+
+// a store server that does not answer is not a task that is not there
+func TestBackendDown(t *testing.T) {
+	client, _ := testClient(t)
+	ctx := authed(t.Context())
+	if _, ok := client.Get(ctx, &todopb.GetRequest{Line: 424242}); status.Code(ok) != codes.NotFound {
+		t.Errorf("get of a missing task wanted NotFound got %v", ok)
+	}
+	store.SetBackend(downBackend{})
+	defer store.SetBackend(nil)
+	var tests = []struct {
+		name string
+		call func() error
+	}{
+		{"get", func() error { _, ok := client.Get(ctx, &todopb.GetRequest{Line: 1}); return ok }},
+		{"update", func() error {
+			_, ok := client.Update(ctx, &todopb.UpdateRequest{Line: 1, Description: "Buy pears"})
+			return ok
+		}},
+		{"delete", func() error { _, ok := client.Delete(ctx, &todopb.DeleteRequest{Line: 1}); return ok }},
+	}
+	for _, tc := range tests {
+		if ok := tc.call(); status.Code(ok) != codes.Unavailable {
+			t.Errorf("%s with the backend down wanted Unavailable got %v", tc.name, ok)
+		}
+	}
+}
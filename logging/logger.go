@@ -32,8 +32,14 @@ func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
 	return h.Handler.Handle(ctx, r)
 }
 
-func Setup(w io.Writer, options slog.HandlerOptions) {
-	baseHandler := slog.NewJSONHandler(w, &options)
+// format is json or text
+func Setup(w io.Writer, format string, options slog.HandlerOptions) {
+	var baseHandler slog.Handler
+	if format == "text" {
+		baseHandler = slog.NewTextHandler(w, &options)
+	} else {
+		baseHandler = slog.NewJSONHandler(w, &options)
+	}
 	// add in the context handler
 	customHandler := &ContextHandler{Handler: baseHandler}
 	logger.Log = slog.New(customHandler)
@@ -2,7 +2,6 @@ package logging
 
 import (
 	"log/slog"
-	"os"
 )
 
 // slog levels are
@@ -11,17 +10,11 @@ import (
 // logger.Warn("Warning message")
 // logger.Error("Error message")
 
-// type logOptions struct {
-// 	option slog.HandlerOptions
-// }
-
-func LoggerOptions() slog.HandlerOptions {
-	appEnv := os.Getenv("APP_ENV")
-	var options slog.HandlerOptions
-	if appEnv == "development" {
-		options = slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug}
-	} else {
-		options = slog.HandlerOptions{AddSource: false}
+// handler options from the configured level name, debug info warn or error
+func LoggerOptions(level string, addSource bool) (slog.HandlerOptions, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return slog.HandlerOptions{}, err
 	}
-	return options
+	return slog.HandlerOptions{AddSource: addSource, Level: logLevel}, nil
 }
@@ -0,0 +1,289 @@
+package metrics
+
+// A small Prometheus text exposition writer, enough for counters, gauges
+// and histograms with labels without pulling in the client library.
+// Metrics register themselves in one static registry when created.
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// latency buckets in seconds, from half a millisecond to ten seconds
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]metric{}
+)
+
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, found := registry[m.name()]; found {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	registry[m.name()] = m
+}
+
+// Write the exposition text for every registered metric, in name order
+func Write(w io.Writer) {
+	registryMutex.Lock()
+	metrics := make([]metric, 0, len(registry))
+	for _, name := range sortedKeys(registry) {
+		metrics = append(metrics, registry[name])
+	}
+	registryMutex.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+	writeRuntime(w)
+}
+
+// label values kept in the order of the label names
+type series struct {
+	labels []string
+}
+
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func formatLabels(names []string, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", name, escape(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", extra[i], escape(extra[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sorted keys so output is stable between scrapes
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Counter only goes up
+type Counter struct {
+	metricName string
+	help       string
+	labelNames []string
+	mutex      sync.Mutex
+	values     map[string]float64
+	series     map[string]series
+}
+
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	c := &Counter{metricName: name, help: help, labelNames: labelNames, values: map[string]float64{}, series: map[string]series{}}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, found := c.series[key]; !found {
+		c.series[key] = series{labels: slices.Clone(labelValues)}
+	}
+	c.values[key] += v
+}
+
+// Value of one series, mostly for tests
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[labelKey(labelValues)]
+}
+
+func (c *Counter) name() string { return c.metricName }
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	writeHeader(w, c.metricName, c.help, "counter")
+	if len(c.labelNames) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.metricName)
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labelNames, c.series[key].labels), formatFloat(c.values[key]))
+	}
+}
+
+// Gauge goes up and down
+type Gauge struct {
+	metricName string
+	help       string
+	mutex      sync.Mutex
+	value      float64
+}
+
+func NewGauge(name string, help string) *Gauge {
+	g := &Gauge{metricName: name, help: help}
+	register(g)
+	return g
+}
+
+func (g *Gauge) Set(v float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.value = v
+}
+
+func (g *Gauge) Add(v float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.value += v
+}
+
+func (g *Gauge) Value() float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.value
+}
+
+func (g *Gauge) name() string { return g.metricName }
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.Value()))
+}
+
+// GaugeFunc is read when scraped, one series per key of the returned map
+type GaugeFunc struct {
+	metricName string
+	help       string
+	labelName  string
+	collect    func() map[string]float64
+}
+
+// NewGaugeFunc with an empty labelName expects a single series under the "" key
+func NewGaugeFunc(name string, help string, labelName string, collect func() map[string]float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, labelName: labelName, collect: collect}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) write(w io.Writer) {
+	values := g.collect()
+	writeHeader(w, g.metricName, g.help, "gauge")
+	for _, key := range sortedKeys(values) {
+		labels := ""
+		if g.labelName != "" {
+			labels = formatLabels([]string{g.labelName}, []string{key})
+		}
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, labels, formatFloat(values[key]))
+	}
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	metricName string
+	help       string
+	labelNames []string
+	buckets    []float64
+	mutex      sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // one per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{metricName: name, help: help, labelNames: labelNames, buckets: slices.Sorted(slices.Values(buckets)), series: map[string]*histogramSeries{}}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, found := h.series[key]
+	if !found {
+		s = &histogramSeries{labels: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count of observations in one series, mostly for tests
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s, found := h.series[labelKey(labelValues)]; found {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) name() string { return h.metricName }
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	writeHeader(w, h.metricName, h.help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labelNames, s.labels, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labelNames, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, formatLabels(h.labelNames, s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, formatLabels(h.labelNames, s.labels), s.count)
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// unregister drops the test metrics so the tests can run again with -count
+func unregister(t *testing.T, names ...string) {
+	t.Cleanup(func() {
+		registryMutex.Lock()
+		defer registryMutex.Unlock()
+		for _, name := range names {
+			delete(registry, name)
+		}
+	})
+}
+
+func TestWrite(t *testing.T) {
+	unregister(t, "test_requests_total", "test_queue_depth", "test_latency_seconds", "test_items")
+	requests := NewCounter("test_requests_total", "Requests.", "route", "code")
+	requests.Inc("GET /get", "200")
+	requests.Inc("GET /get", "200")
+	requests.Inc(`GET /say "hi"`, "400")
+	depth := NewGauge("test_queue_depth", "Depth.")
+	depth.Add(3)
+	depth.Add(-1)
+	latency := NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "GET /get")
+	latency.Observe(0.1, "GET /get")
+	latency.Observe(0.5, "GET /get")
+	latency.Observe(5, "GET /get")
+	NewGaugeFunc("test_items", "Items.", "state", func() map[string]float64 {
+		return map[string]float64{"Started": 2, "Completed": 1}
+	})
+
+	var b bytes.Buffer
+	Write(&b)
+	out := b.String()
+	var tests = []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{route="GET /get",code="200"} 2`,
+		`test_requests_total{route="GET /say \"hi\"",code="400"} 1`,
+		"# TYPE test_queue_depth gauge\ntest_queue_depth 2\n",
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{route="GET /get",le="0.1"} 2`,
+		`test_latency_seconds_bucket{route="GET /get",le="1"} 3`,
+		`test_latency_seconds_bucket{route="GET /get",le="+Inf"} 4`,
+		`test_latency_seconds_sum{route="GET /get"} 5.65`,
+		`test_latency_seconds_count{route="GET /get"} 4`,
+		`test_items{state="Completed"} 1`,
+		"go_goroutines ",
+		"go_memstats_alloc_bytes ",
+	}
+	for _, want := range tests {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestDuplicateMetricPanics(t *testing.T) {
+	unregister(t, "test_duplicate")
+	NewGauge("test_duplicate", "Duplicate.")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a name twice should panic")
+		}
+	}()
+	NewGauge("test_duplicate", "Duplicate.")
+}
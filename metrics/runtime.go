@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/pprof"
+)
+
+// go runtime stats read fresh on every scrape, named as the client library does
+func writeRuntime(w io.Writer) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	writeHeader(w, "go_goroutines", "Number of goroutines that currently exist.", "gauge")
+	fmt.Fprintf(w, "go_goroutines %d\n", runtime.NumGoroutine())
+	writeHeader(w, "go_info", "Information about the Go environment.", "gauge")
+	fmt.Fprintf(w, "go_info{version=\"%s\"} 1\n", runtime.Version())
+	writeHeader(w, "go_threads", "Number of OS threads created.", "gauge")
+	fmt.Fprintf(w, "go_threads %d\n", pprof.Lookup("threadcreate").Count())
+
+	gauges := []struct {
+		name  string
+		help  string
+		value uint64
+	}{
+		{name: "go_memstats_alloc_bytes", help: "Number of bytes allocated and still in use.", value: mem.Alloc},
+		{name: "go_memstats_heap_inuse_bytes", help: "Number of heap bytes that are in use.", value: mem.HeapInuse},
+		{name: "go_memstats_heap_objects", help: "Number of allocated objects.", value: mem.HeapObjects},
+		{name: "go_memstats_sys_bytes", help: "Number of bytes obtained from system.", value: mem.Sys},
+	}
+	for _, g := range gauges {
+		writeHeader(w, g.name, g.help, "gauge")
+		fmt.Fprintf(w, "%s %d\n", g.name, g.value)
+	}
+
+	writeHeader(w, "go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", "counter")
+	fmt.Fprintf(w, "go_memstats_alloc_bytes_total %d\n", mem.TotalAlloc)
+	writeHeader(w, "go_gc_cycles_total", "Number of completed GC cycles.", "counter")
+	fmt.Fprintf(w, "go_gc_cycles_total %d\n", mem.NumGC)
+	writeHeader(w, "go_gc_pause_seconds_total", "Total time spent in GC stop the world pauses.", "counter")
+	fmt.Fprintf(w, "go_gc_pause_seconds_total %s\n", formatFloat(float64(mem.PauseTotalNs)/1e9))
+}
@@ -0,0 +1,148 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+// Client talks to one store server
+type Client struct {
+	Addr string // host:port or a base url
+	base string
+	http *http.Client
+}
+
+func NewClient(addr string) *Client {
+	base := strings.TrimSuffix(addr, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return &Client{
+		Addr: addr,
+		base: base,
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: 64,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}
+
+// do sends the request and decodes a 2xx body into out, returning the status.
+// A 404 is not an error, the item is not on this server.
+func (c *Client) do(ctx context.Context, method string, path string, body any, out any) (int, error) {
+	return c.doWith(ctx, method, path, nil, body, out)
+}
+
+// doWith is do with extra request headers
+func (c *Client) doWith(ctx context.Context, method string, path string, header http.Header, body any, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("store server %s: %w", c.Addr, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		io.Copy(io.Discard, resp.Body)
+	case resp.StatusCode == http.StatusConflict:
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, fmt.Errorf("store server %s: %s %s: %w", c.Addr, method, path, store.ErrVersionConflict)
+	case resp.StatusCode >= 300:
+		var e errorBody
+		json.NewDecoder(resp.Body).Decode(&e)
+		return resp.StatusCode, fmt.Errorf("store server %s: %s %s: %d %s", c.Addr, method, path, resp.StatusCode, e.Error)
+	case out != nil:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("store server %s: %s %s: %w", c.Addr, method, path, err)
+		}
+	default:
+		io.Copy(io.Discard, resp.Body)
+	}
+	return resp.StatusCode, nil
+}
+
+func itemPath(id int64) string {
+	return "/items/" + strconv.FormatInt(id, 10)
+}
+
+func (c *Client) Get(ctx context.Context, id int64) (store.TodoListItem, bool, error) {
+	var item store.TodoListItem
+	status, err := c.do(ctx, http.MethodGet, itemPath(id), nil, &item)
+	return item, status == http.StatusOK, err
+}
+
+// Put adds or replaces the item, true when it replaced one
+func (c *Client) Put(ctx context.Context, item store.TodoListItem) (bool, error) {
+	status, err := c.do(ctx, http.MethodPut, itemPath(item.Line), item, nil)
+	return status == http.StatusOK, err
+}
+
+// PutIf is Put only over the item expected, ErrVersionConflict otherwise
+func (c *Client) PutIf(ctx context.Context, item store.TodoListItem, expect store.Expected) (bool, error) {
+	status, err := c.doWith(ctx, http.MethodPut, itemPath(item.Line), expectHeader(expect), item, nil)
+	return status == http.StatusOK, err
+}
+
+// Delete returns the item deleted, false when it was not on the server
+func (c *Client) Delete(ctx context.Context, id int64) (store.TodoListItem, bool, error) {
+	var item store.TodoListItem
+	status, err := c.do(ctx, http.MethodDelete, itemPath(id), nil, &item)
+	return item, status == http.StatusOK, err
+}
+
+func (c *Client) List(ctx context.Context) (store.TodoListItems, error) {
+	items := store.TodoListItems{}
+	_, err := c.do(ctx, http.MethodGet, "/items", nil, &items)
+	return items, err
+}
+
+func (c *Client) Count(ctx context.Context) (int, error) {
+	var n countBody
+	_, err := c.do(ctx, http.MethodGet, "/count", nil, &n)
+	return n.Items, err
+}
+
+// Subtasks is what is under parent on this server only
+func (c *Client) Subtasks(ctx context.Context, parent int64) (store.Subtasks, error) {
+	var s store.Subtasks
+	_, err := c.do(ctx, http.MethodGet, "/subtasks/"+strconv.FormatInt(parent, 10), nil, &s)
+	return s, err
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	status, err := c.do(ctx, http.MethodGet, "/healthz", nil, nil)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("store server %s: healthz answered %d", c.Addr, status)
+	}
+	return err
+}
@@ -0,0 +1,348 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestMain(m *testing.M) {
+	logging.Default()
+	m.Run()
+}
+
+// fakeStore speaks the store server protocol over a map, so a test can run
+// several servers in one process where the real store is a single global
+func fakeStore(t *testing.T) (*httptest.Server, func() store.TodoListItems) {
+	var mutex sync.Mutex
+	items := store.TodoListItems{}
+	id := func(r *http.Request) int64 {
+		n, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		return n
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		json.NewEncoder(w).Encode(items)
+	})
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if item, found := items[id(r)]; found {
+			json.NewEncoder(w).Encode(item)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("PUT /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var item store.TodoListItem
+		json.NewDecoder(r.Body).Decode(&item)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if _, found := items[id(r)]; !found {
+			w.WriteHeader(http.StatusCreated)
+		}
+		items[id(r)] = item
+		json.NewEncoder(w).Encode(item)
+	})
+	mux.HandleFunc("DELETE /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		item, found := items[id(r)]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(items, id(r))
+		json.NewEncoder(w).Encode(item)
+	})
+	mux.HandleFunc("GET /count", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		json.NewEncoder(w).Encode(countBody{Items: len(items)})
+	})
+	mux.HandleFunc("GET /subtasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		var s store.Subtasks
+		for _, item := range items {
+			if item.Parent == id(r) {
+				s.Count++
+				s.Rank = max(s.Rank, item.Rank)
+			}
+		}
+		json.NewEncoder(w).Encode(s)
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, func() store.TodoListItems {
+		mutex.Lock()
+		defer mutex.Unlock()
+		copied := store.TodoListItems{}
+		for k, v := range items {
+			copied[k] = v
+		}
+		return copied
+	}
+}
+
+func addr(server *httptest.Server) string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// every item sits on the server the ring gives for it and nowhere else
+func checkPlacement(t *testing.T, r *Router, servers map[string]func() store.TodoListItems, want int) {
+	t.Helper()
+	total := 0
+	for a, contents := range servers {
+		items := contents()
+		total += len(items)
+		for id := range items {
+			if owner := r.ring.Get(id); owner != a {
+				t.Fatalf("item %d on %s but owned by %s", id, a, owner)
+			}
+		}
+	}
+	if total != want {
+		t.Errorf("servers hold %d items wanted %d", total, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ctx := t.Context()
+	if ok := store.OpenSession(ctx, filepath.Join(t.TempDir(), "store.json")); ok != nil {
+		t.Fatal(ok)
+	}
+	store.StartActor(ctx)
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	c := NewClient(server.URL)
+
+	item := store.TodoListItem{Line: 42, Id: 42, Description: "Buy apples", Created: time.Now().UTC()}
+	if found, ok := c.Put(ctx, item); ok != nil || found {
+		t.Fatalf("first put found %t %v", found, ok)
+	}
+	if found, ok := c.Put(ctx, item); ok != nil || !found {
+		t.Errorf("second put should replace found %t %v", found, ok)
+	}
+	if got, found, ok := c.Get(ctx, 42); ok != nil || !found || got.Description != item.Description {
+		t.Errorf("get after put found %t %v %+v", found, ok, got)
+	}
+	if items, ok := c.List(ctx); ok != nil || len(items) != 1 {
+		t.Errorf("list wanted 1 item got %d %v", len(items), ok)
+	}
+	if n, ok := c.Count(ctx); ok != nil || n != 1 {
+		t.Errorf("count wanted 1 got %d %v", n, ok)
+	}
+	if ok := c.Ping(ctx); ok != nil {
+		t.Errorf("ping %v", ok)
+	}
+	child := store.TodoListItem{Line: 43, Id: 43, Description: "Buy pears", Parent: 42, Rank: 3, Created: time.Now().UTC()}
+	if _, ok := c.Put(ctx, child); ok != nil {
+		t.Fatal(ok)
+	}
+	stale := item
+	stale.Version = 9
+	if _, ok := c.PutIf(ctx, stale, store.Expected{Found: true, Version: 8}); !errors.Is(ok, store.ErrVersionConflict) {
+		t.Errorf("put over a version not held wanted a conflict got %v", ok)
+	}
+	if found, ok := c.PutIf(ctx, stale, store.Expected{Found: true, Version: item.Version}); ok != nil || !found {
+		t.Errorf("put over the version held found %t %v", found, ok)
+	}
+	if _, ok := c.PutIf(ctx, stale, store.Expected{}); !errors.Is(ok, store.ErrVersionConflict) {
+		t.Errorf("put expecting no item wanted a conflict got %v", ok)
+	}
+	if s, ok := c.Subtasks(ctx, 42); ok != nil || s != (store.Subtasks{Count: 1, Rank: 3}) {
+		t.Errorf("subtasks of 42 got %+v %v", s, ok)
+	}
+	c.Delete(ctx, 43)
+	if _, ok := c.Put(ctx, store.TodoListItem{Line: 7}); ok == nil {
+		t.Errorf("put without a description accepted")
+	}
+	if deleted, found, ok := c.Delete(ctx, 42); ok != nil || !found || deleted.Description != item.Description {
+		t.Errorf("delete found %t %v %+v", found, ok, deleted)
+	}
+	if _, found, ok := c.Get(ctx, 42); ok != nil || found {
+		t.Errorf("deleted item still found %t %v", found, ok)
+	}
+	if _, found, ok := c.Delete(ctx, 42); ok != nil || found {
+		t.Errorf("second delete found %t %v", found, ok)
+	}
+}
+
+func TestRouterRebalance(t *testing.T) {
+	ctx := t.Context()
+	a, contentsA := fakeStore(t)
+	b, contentsB := fakeStore(t)
+	servers := map[string]func() store.TodoListItems{addr(a): contentsA, addr(b): contentsB}
+	r, ok := NewRouter([]string{addr(a), addr(b)})
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	for i := range int64(300) {
+		id := 1761837306757785900 + i*7919
+		if _, ok := r.Put(ctx, store.TodoListItem{Line: id, Id: id, Description: "task"}); ok != nil {
+			t.Fatal(ok)
+		}
+	}
+	checkPlacement(t, r, servers, 300)
+	if len(contentsA()) == 0 || len(contentsB()) == 0 {
+		t.Errorf("items not spread a=%d b=%d", len(contentsA()), len(contentsB()))
+	}
+
+	// a third server takes about a third of the items
+	c, contentsC := fakeStore(t)
+	servers[addr(c)] = contentsC
+	moved, ok := r.AddBackend(ctx, addr(c))
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	if moved == 0 || moved != len(contentsC()) {
+		t.Errorf("moved %d items, the new server has %d", moved, len(contentsC()))
+	}
+	checkPlacement(t, r, servers, 300)
+	if items, ok := r.List(ctx); ok != nil || len(items) != 300 {
+		t.Errorf("list after add has %d items %v", len(items), ok)
+	}
+
+	// removing it hands its items back
+	moved, ok = r.RemoveBackend(ctx, addr(a))
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	delete(servers, addr(a))
+	if len(contentsA()) != 0 || moved == 0 {
+		t.Errorf("removed server still holds %d items after moving %d", len(contentsA()), moved)
+	}
+	checkPlacement(t, r, servers, 300)
+	if n, ok := r.Count(ctx); ok != nil || n != 300 {
+		t.Errorf("count wanted 300 got %d %v", n, ok)
+	}
+
+	// misplaced items, as after a restart with a different server list, are found by rebalance
+	stray := store.TodoListItem{Line: 99, Id: 99, Description: "stray"}
+	wrong := addr(b)
+	if r.ring.Get(99) == wrong {
+		wrong = addr(c)
+	}
+	NewClient(wrong).Put(ctx, stray)
+	if moved, ok := r.Rebalance(ctx); ok != nil || moved != 1 {
+		t.Errorf("rebalance moved %d %v wanted the stray item", moved, ok)
+	}
+	checkPlacement(t, r, servers, 301)
+}
+
+func TestRouterErrors(t *testing.T) {
+	ctx := t.Context()
+	a, _ := fakeStore(t)
+	if _, ok := NewRouter(nil); ok == nil {
+		t.Errorf("router with no servers")
+	}
+	if _, ok := NewRouter([]string{addr(a), addr(a)}); ok == nil {
+		t.Errorf("router with a server twice")
+	}
+	r, _ := NewRouter([]string{addr(a)})
+	if _, ok := r.RemoveBackend(ctx, addr(a)); ok == nil {
+		t.Errorf("removed the last server")
+	}
+	if _, ok := r.AddBackend(ctx, addr(a)); ok == nil {
+		t.Errorf("added a server twice")
+	}
+	// nothing listening, the add fails before the ring changes
+	down, _ := fakeStore(t)
+	down.Close()
+	timeout, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if _, ok := r.AddBackend(timeout, addr(down)); ok == nil || r.ring.Len() != 1 {
+		t.Errorf("unreachable server added %v", ok)
+	}
+}
+
+// the store package routes its task functions through the router
+func TestStoreWithBackend(t *testing.T) {
+	ctx := t.Context()
+	a, _ := fakeStore(t)
+	b, _ := fakeStore(t)
+	r, _ := NewRouter([]string{addr(a), addr(b)})
+	store.SetBackend(r)
+	defer store.SetBackend(nil)
+	changes := store.Watch(ctx)
+
+	id, ok := store.AddTaskWithTags(ctx, "Buy apples", []string{"Shopping"})
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	if ok := store.StateChange(ctx, id, store.StateStarted); ok != nil {
+		t.Fatal(ok)
+	}
+	item, ok := store.GetByIndex(id)
+	if ok != nil || item.State != store.StateStarted || item.Tags[0] != "shopping" {
+		t.Errorf("item not stored through the backend %+v %v", item, ok)
+	}
+	if items, ok := store.GetList(); ok != nil || items.Len() != 1 || store.Count() != 1 {
+		t.Errorf("list has %d items count %d %v", items.Len(), store.Count(), ok)
+	}
+	if ok := store.DeleteTask(ctx, id); ok != nil {
+		t.Fatal(ok)
+	}
+	if _, ok := store.GetByIndex(id); ok == nil {
+		t.Errorf("deleted item still found")
+	}
+	// the writes go to the store servers but are still watched here
+	for _, want := range []store.ChangeKind{store.ChangeCreated, store.ChangeUpdated, store.ChangeDeleted} {
+		if change := <-changes; change.Kind != want || change.Item.Line != id {
+			t.Errorf("wanted %s for %d got %s for %d", want, id, change.Kind, change.Item.Line)
+		}
+	}
+	if ok := store.Commit(ctx); ok != nil {
+		t.Errorf("commit with a backend should leave saving to the store servers %v", ok)
+	}
+}
+
+// the router adds up the subtasks each server holds, so ranks keep going up
+// across servers and a delete still lifts the subtasks
+func TestSubtasksWithBackend(t *testing.T) {
+	ctx := t.Context()
+	a, _ := fakeStore(t)
+	b, _ := fakeStore(t)
+	r, _ := NewRouter([]string{addr(a), addr(b)})
+	store.SetBackend(r)
+	defer store.SetBackend(nil)
+
+	parent, ok := store.AddTask(ctx, "Paint the shed")
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	children := []int64{}
+	for _, description := range []string{"Buy paint", "Sand the walls", "Paint the walls", "Clean the brushes"} {
+		child, ok := store.AddSubtask(ctx, parent, description, nil)
+		if ok != nil {
+			t.Fatal(ok)
+		}
+		children = append(children, child)
+	}
+	if s, ok := r.Subtasks(ctx, parent); ok != nil || s != (store.Subtasks{Count: 4, Rank: 4}) {
+		t.Errorf("subtasks of %d got %+v %v", parent, s, ok)
+	}
+	if ok := store.DeleteTask(ctx, parent); ok != nil {
+		t.Fatal(ok)
+	}
+	for _, child := range children {
+		if item, ok := store.GetByIndex(child); ok != nil || item.Parent != 0 {
+			t.Errorf("subtask %d not lifted %+v %v", child, item, ok)
+		}
+	}
+}
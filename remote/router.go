@@ -0,0 +1,245 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/anthriscus/appcli/ring"
+	"github.com/anthriscus/appcli/store"
+)
+
+// Router is a store.Backend spreading the items over store servers by task id.
+// Adding or removing a server moves the items whose owner changed; routed
+// calls wait while that happens so nothing is read from the wrong server.
+type Router struct {
+	mutex   sync.RWMutex // held for writing only while servers are added, removed or rebalanced
+	ring    *ring.Ring
+	clients map[string]*Client
+}
+
+// one store server as the front end sees it
+type BackendStatus struct {
+	Addr  string `json:"addr"`
+	Items int    `json:"items"`
+	Error string `json:"error,omitempty"`
+}
+
+func NewRouter(addrs []string) (*Router, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no store servers given")
+	}
+	r := &Router{ring: ring.New(ring.DefaultReplicas), clients: map[string]*Client{}}
+	for _, addr := range addrs {
+		if _, found := r.clients[addr]; found {
+			return nil, fmt.Errorf("store server %s given twice", addr)
+		}
+		r.clients[addr] = NewClient(addr)
+		r.ring.Add(addr)
+	}
+	return r, nil
+}
+
+// owner of id, called with the mutex held
+func (r *Router) owner(id int64) *Client {
+	return r.clients[r.ring.Get(id)]
+}
+
+func (r *Router) Get(ctx context.Context, id int64) (store.TodoListItem, bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.owner(id).Get(ctx, id)
+}
+
+func (r *Router) Put(ctx context.Context, item store.TodoListItem) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.owner(item.Line).Put(ctx, item)
+}
+
+func (r *Router) PutIf(ctx context.Context, item store.TodoListItem, expect store.Expected) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.owner(item.Line).PutIf(ctx, item, expect)
+}
+
+func (r *Router) Delete(ctx context.Context, id int64) (store.TodoListItem, bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.owner(id).Delete(ctx, id)
+}
+
+// List asks every server at once, a server failing fails the list rather
+// than showing part of it
+func (r *Router) List(ctx context.Context) (store.TodoListItems, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	parts := make([]store.TodoListItems, len(r.clients))
+	errs := make([]error, len(r.clients))
+	var wg sync.WaitGroup
+	for i, c := range r.list() {
+		wg.Go(func() { parts[i], errs[i] = c.List(ctx) })
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return store.TodoListItems{}, err
+	}
+	total := 0
+	for _, p := range parts {
+		total += len(p)
+	}
+	items := make(store.TodoListItems, total)
+	for _, p := range parts {
+		maps.Copy(items, p)
+	}
+	return items, nil
+}
+
+func (r *Router) Count(ctx context.Context) (int, error) {
+	total := 0
+	for _, b := range r.Backends(ctx) {
+		if b.Error != "" {
+			return total, errors.New(b.Error)
+		}
+		total += b.Items
+	}
+	return total, nil
+}
+
+// Subtasks adds up what every server holds under parent, the subtasks of
+// one task are spread over them by their own ids
+func (r *Router) Subtasks(ctx context.Context, parent int64) (store.Subtasks, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	parts := make([]store.Subtasks, len(r.clients))
+	errs := make([]error, len(r.clients))
+	var wg sync.WaitGroup
+	for i, c := range r.list() {
+		wg.Go(func() { parts[i], errs[i] = c.Subtasks(ctx, parent) })
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return store.Subtasks{}, err
+	}
+	var total store.Subtasks
+	for _, p := range parts {
+		total.Count += p.Count
+		total.Rank = max(total.Rank, p.Rank)
+	}
+	return total, nil
+}
+
+func (r *Router) Ping(ctx context.Context) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	errs := []error{}
+	for _, c := range r.list() {
+		errs = append(errs, c.Ping(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Backends lists the servers in the order they joined with their item counts
+func (r *Router) Backends(ctx context.Context) []BackendStatus {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	list := []BackendStatus{}
+	for _, addr := range r.ring.Nodes() {
+		status := BackendStatus{Addr: addr}
+		if n, err := r.clients[addr].Count(ctx); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Items = n
+		}
+		list = append(list, status)
+	}
+	return list
+}
+
+// AddBackend puts a server on the ring and moves over the items it now owns.
+// When a move fails the server stays, Rebalance finishes the job.
+func (r *Router) AddBackend(ctx context.Context, addr string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, found := r.clients[addr]; found {
+		return 0, fmt.Errorf("store server %s is already in use", addr)
+	}
+	c := NewClient(addr)
+	if err := c.Ping(ctx); err != nil {
+		return 0, err
+	}
+	others := r.list()
+	r.clients[addr] = c
+	r.ring.Add(addr)
+	return r.rebalance(ctx, others)
+}
+
+// RemoveBackend takes a server off the ring and moves its items to their new
+// owners. The server has to be reachable, when a move fails it goes back on
+// the ring and Rebalance is needed for the items already moved.
+func (r *Router) RemoveBackend(ctx context.Context, addr string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	c, found := r.clients[addr]
+	if !found {
+		return 0, fmt.Errorf("store server %s is not in use", addr)
+	}
+	if len(r.clients) == 1 {
+		return 0, fmt.Errorf("store server %s is the last one", addr)
+	}
+	delete(r.clients, addr)
+	r.ring.Remove(addr)
+	moved, err := r.rebalance(ctx, []*Client{c})
+	if err != nil {
+		r.clients[addr] = c
+		r.ring.Add(addr)
+		return moved, fmt.Errorf("store server %s kept, %d items moved before: %w", addr, moved, err)
+	}
+	return moved, nil
+}
+
+// Rebalance moves every item that is not on its owner, such as after the
+// server list changed between runs
+func (r *Router) Rebalance(ctx context.Context) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rebalance(ctx, r.list())
+}
+
+// the clients in ring order, called with the mutex held
+func (r *Router) list() []*Client {
+	list := []*Client{}
+	for _, addr := range r.ring.Nodes() {
+		list = append(list, r.clients[addr])
+	}
+	return list
+}
+
+// rebalance moves items off the given servers when the ring says they belong
+// elsewhere, written to the owner before being deleted so none go missing.
+// Called with the mutex held for writing.
+func (r *Router) rebalance(ctx context.Context, from []*Client) (int, error) {
+	moved := 0
+	for _, c := range from {
+		items, err := c.List(ctx)
+		if err != nil {
+			return moved, err
+		}
+		for id, item := range items {
+			owner := r.owner(id)
+			if owner == c {
+				continue
+			}
+			if _, err := owner.Put(ctx, item); err != nil {
+				return moved, err
+			}
+			if _, _, err := c.Delete(ctx, id); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
@@ -0,0 +1,206 @@
+// Package remote runs the todo store as its own server and routes the front
+// end to several of them over a consistent hash ring.
+//
+// The protocol is plain json over http, one item per task id:
+//
+//	GET    /items        every item on this server
+//	GET    /items/{id}   one item, 404 when it is not here
+//	PUT    /items/{id}   add or replace the item, 201 when it was added. With
+//	                     If-Match: "version" or If-None-Match: * only over
+//	                     that version or no item, 409 otherwise
+//	DELETE /items/{id}   the item deleted, 404 when it is not here
+//	GET    /count        {"items": n}
+//	GET    /subtasks/{id} {"count": n, "rank": r} for the subtasks on this server
+//	GET    /healthz      ok while the store actors run
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+type countBody struct {
+	Items int `json:"items"`
+}
+
+// Handler serves the store of this process, opened and started by the caller
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items", listItems)
+	mux.HandleFunc("GET /items/{id}", getItem)
+	mux.HandleFunc("PUT /items/{id}", putItem)
+	mux.HandleFunc("DELETE /items/{id}", deleteItem)
+	mux.HandleFunc("GET /count", count)
+	mux.HandleFunc("GET /subtasks/{id}", subtasks)
+	mux.HandleFunc("GET /healthz", healthz)
+	return jsonContent(mux)
+}
+
+func jsonContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody{Error: err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, r *http.Request, v any) {
+	if ok := json.NewEncoder(w).Encode(v); ok != nil {
+		logging.Log().ErrorContext(r.Context(), "Store server response", "path", r.URL.Path, "error", ok)
+	}
+}
+
+func pathId(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, ok := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if ok != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("bad id %q", r.PathValue("id")))
+		return 0, false
+	}
+	return id, true
+}
+
+// 404 only for an item that is not here, the front end takes any other
+// status as the server failing
+func readStatus(err error) int {
+	if errors.Is(err, store.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func listItems(w http.ResponseWriter, r *http.Request) {
+	items, ok := store.GetList()
+	if ok != nil {
+		writeError(w, http.StatusInternalServerError, ok)
+		return
+	}
+	writeJson(w, r, items)
+}
+
+func getItem(w http.ResponseWriter, r *http.Request) {
+	id, found := pathId(w, r)
+	if !found {
+		return
+	}
+	item, ok := store.GetByIndex(id)
+	if ok != nil {
+		writeError(w, readStatus(ok), ok)
+		return
+	}
+	writeJson(w, r, item)
+}
+
+func putItem(w http.ResponseWriter, r *http.Request) {
+	id, found := pathId(w, r)
+	if !found {
+		return
+	}
+	var item store.TodoListItem
+	if ok := json.NewDecoder(r.Body).Decode(&item); ok != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid json"))
+		return
+	}
+	if item.Line != id {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("item line %d does not match id %d", item.Line, id))
+		return
+	}
+	expect, given, ok := ExpectedVersion(r.Header)
+	if ok != nil {
+		writeError(w, http.StatusBadRequest, ok)
+		return
+	}
+	if given {
+		found, ok = store.PutIf(r.Context(), item, expect)
+	} else {
+		found, ok = store.Put(r.Context(), item)
+	}
+	if errors.Is(ok, store.ErrVersionConflict) {
+		writeError(w, http.StatusConflict, ok)
+		return
+	} else if ok != nil {
+		writeError(w, http.StatusBadRequest, ok)
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusCreated)
+	}
+	writeJson(w, r, item)
+}
+
+// ExpectedVersion reads If-Match: "version" or If-None-Match: * as the
+// item a write may replace, false when neither is given
+func ExpectedVersion(header http.Header) (store.Expected, bool, error) {
+	if header.Get("If-None-Match") == "*" {
+		return store.Expected{}, true, nil
+	}
+	match := header.Get("If-Match")
+	if match == "" {
+		return store.Expected{}, false, nil
+	}
+	version, ok := strconv.ParseInt(strings.Trim(match, `"`), 10, 64)
+	if ok != nil {
+		return store.Expected{}, false, fmt.Errorf("If-Match %q is not a version", match)
+	}
+	return store.Expected{Found: true, Version: version}, true, nil
+}
+
+// the header ExpectedVersion reads
+func expectHeader(expect store.Expected) http.Header {
+	if !expect.Found {
+		return http.Header{"If-None-Match": {"*"}}
+	}
+	return http.Header{"If-Match": {strconv.Quote(strconv.FormatInt(expect.Version, 10))}}
+}
+
+func deleteItem(w http.ResponseWriter, r *http.Request) {
+	id, found := pathId(w, r)
+	if !found {
+		return
+	}
+	item, ok := store.Remove(r.Context(), id)
+	if ok != nil {
+		writeError(w, readStatus(ok), ok)
+		return
+	}
+	writeJson(w, r, item)
+}
+
+func count(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, r, countBody{Items: store.Count()})
+}
+
+func subtasks(w http.ResponseWriter, r *http.Request) {
+	id, found := pathId(w, r)
+	if !found {
+		return
+	}
+	s, ok := store.SubtasksOf(id)
+	if ok != nil {
+		writeError(w, http.StatusInternalServerError, ok)
+		return
+	}
+	writeJson(w, r, s)
+}
+
+func healthz(w http.ResponseWriter, r *http.Request) {
+	if !store.ActorRunning() {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("store actor not running"))
+		return
+	}
+	writeJson(w, r, map[string]string{"status": "ok"})
+}
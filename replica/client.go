@@ -0,0 +1,102 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how long a leader holds a log read open waiting for a change
+const pollWait = 25 * time.Second
+
+// Client calls the replication routes of another appcli server
+type Client struct {
+	Addr  string // host:port or a base url
+	base  string
+	token string
+	http  *http.Client
+}
+
+func NewClient(addr string, token string) *Client {
+	base := strings.TrimSuffix(addr, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return &Client{
+		Addr:  addr,
+		base:  base,
+		token: token,
+		// long enough for a held log read and a large snapshot
+		http: &http.Client{Timeout: pollWait + 30*time.Second},
+	}
+}
+
+type errorBody struct {
+	Error string
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("appcli server %s: %w", c.Addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		io.Copy(io.Discard, resp.Body)
+		return ErrBehind
+	}
+	if resp.StatusCode >= 300 {
+		var e errorBody
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("appcli server %s: %s %s: %d %s", c.Addr, method, path, resp.StatusCode, e.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("appcli server %s: %s %s: %w", c.Addr, method, path, err)
+	}
+	return nil
+}
+
+func (c *Client) Snapshot(ctx context.Context) (Snapshot, error) {
+	var snapshot Snapshot
+	err := c.do(ctx, http.MethodGet, "/replication/snapshot", &snapshot)
+	return snapshot, err
+}
+
+// Log reads the changes after the position, the leader waits up to wait for one.
+// ErrBehind means catch up from a snapshot.
+func (c *Client) Log(ctx context.Context, follower string, epoch int64, after uint64, wait time.Duration) (Batch, error) {
+	query := url.Values{}
+	query.Set("follower", follower)
+	query.Set("epoch", strconv.FormatInt(epoch, 10))
+	query.Set("after", strconv.FormatUint(after, 10))
+	query.Set("wait", wait.String())
+	var batch Batch
+	err := c.do(ctx, http.MethodGet, "/replication/log?"+query.Encode(), &batch)
+	return batch, err
+}
+
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.do(ctx, http.MethodGet, "/replication", &status)
+	return status, err
+}
+
+// Promote stops the server following its leader and opens it for writes
+func (c *Client) Promote(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.do(ctx, http.MethodPost, "/replication/promote", &status)
+	return status, err
+}
@@ -0,0 +1,131 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+const (
+	batchSize = 1000 // changes asked for in one log read
+	minRetry  = 500 * time.Millisecond
+	maxRetry  = 10 * time.Second
+)
+
+// FollowState is how far a follower has got with its leader's log
+type FollowState struct {
+	Leader      string    `json:"leader"`
+	Epoch       int64     `json:"epoch"`     // of the leader's log, 0 until the first snapshot
+	Seq         uint64    `json:"seq"`       // the last change applied
+	LeaderSeq   uint64    `json:"leaderSeq"` // the newest change the leader had
+	Lag         uint64    `json:"lag"`
+	Synced      bool      `json:"synced"` // has caught up with the leader at least once
+	Snapshots   int       `json:"snapshots"`
+	LastContact time.Time `json:"lastContact"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Follower applies a leader's log to the store
+type Follower struct {
+	client *Client
+	id     string // how the leader lists this follower
+	mu     sync.Mutex
+	state  FollowState
+}
+
+func NewFollower(leader string, id string, token string) *Follower {
+	return &Follower{client: NewClient(leader, token), id: id, state: FollowState{Leader: leader}}
+}
+
+func (f *Follower) State() FollowState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// Run follows the leader until ctx ends, retrying with a backoff while it
+// cannot be reached
+func (f *Follower) Run(ctx context.Context) {
+	retry := minRetry
+	for ctx.Err() == nil {
+		err := f.step(ctx)
+		if err == nil {
+			retry = minRetry
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		f.mu.Lock()
+		f.state.LastError = err.Error()
+		f.mu.Unlock()
+		logging.Log().WarnContext(ctx, "Following leader failed", "leader", f.client.Addr, "retry", retry, "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, maxRetry)
+	}
+}
+
+// one snapshot or one read of the log
+func (f *Follower) step(ctx context.Context) error {
+	state := f.State()
+	if state.Epoch == 0 {
+		return f.catchUp(ctx)
+	}
+	batch, err := f.client.Log(ctx, f.id, state.Epoch, state.Seq, pollWait)
+	if errors.Is(err, ErrBehind) {
+		logging.Log().InfoContext(ctx, "Leader log has moved on, catching up from a snapshot", "leader", f.client.Addr, "epoch", state.Epoch, "seq", state.Seq)
+		f.mu.Lock()
+		f.state.Epoch = 0
+		f.mu.Unlock()
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, e := range batch.Entries {
+		if err := store.Apply(ctx, store.Change{Kind: e.Kind, Item: e.Item, At: e.At}); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		f.state.Seq = e.Seq
+		f.mu.Unlock()
+	}
+	f.contact(batch.Seq)
+	return nil
+}
+
+// replaces the list with the leader's and carries on from the snapshot's position
+func (f *Follower) catchUp(ctx context.Context) error {
+	snapshot, err := f.client.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	changes, err := store.Replace(ctx, snapshot.Items)
+	if err != nil {
+		return err
+	}
+	logging.Log().InfoContext(ctx, "Caught up from leader snapshot", "leader", f.client.Addr, "epoch", snapshot.Epoch, "seq", snapshot.Seq, "items", len(snapshot.Items), "changes", changes)
+	f.mu.Lock()
+	f.state.Epoch, f.state.Seq = snapshot.Epoch, snapshot.Seq
+	f.state.Snapshots++
+	f.mu.Unlock()
+	f.contact(snapshot.Seq)
+	return nil
+}
+
+func (f *Follower) contact(leaderSeq uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state.LeaderSeq = max(leaderSeq, f.state.Seq)
+	f.state.Lag = f.state.LeaderSeq - f.state.Seq
+	f.state.Synced = f.state.Synced || f.state.Lag == 0
+	f.state.LastContact = time.Now().UTC()
+	f.state.LastError = ""
+}
@@ -0,0 +1,165 @@
+// Package replica keeps copies of the todo list on other appcli servers.
+//
+// Every server keeps an ordered log of the changes to its list. A follower
+// reads a leader's log over http, applies each change to its own store and
+// serves reads only. A new follower, or one the log has moved past, first
+// copies a snapshot of the whole list and then reads the log from the
+// position the snapshot was taken at. Changes carry the whole item so
+// applying one a second time does no harm.
+package replica
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+const (
+	// changes kept for followers, one further behind catches up from a snapshot
+	DefaultLogSize = 10000
+	// changes the log may trail the store by, a bulk write such as a follower
+	// catching up can be well ahead of it
+	watchSize = 10000
+)
+
+// ErrBehind means the position asked for is not in the log, it is from another
+// epoch or the log has moved past it
+var ErrBehind = errors.New("position is not in the log, catch up from a snapshot")
+
+// Entry is one change in the log
+type Entry struct {
+	Seq  uint64             `json:"seq"`
+	Kind store.ChangeKind   `json:"kind"`
+	Item store.TodoListItem `json:"item"`
+	At   time.Time          `json:"at"`
+}
+
+// Snapshot is the whole list, holding every change up to Seq and maybe some after
+type Snapshot struct {
+	Epoch int64               `json:"epoch"`
+	Seq   uint64              `json:"seq"`
+	Items store.TodoListItems `json:"items"`
+}
+
+// Batch is the log after a position
+type Batch struct {
+	Epoch   int64   `json:"epoch"`
+	Seq     uint64  `json:"seq"` // the newest change in the log
+	Entries []Entry `json:"entries"`
+}
+
+// Log numbers the store's changes in the order they were made. A position is
+// only good in one epoch, a new epoch starts with each process and whenever
+// the log missed changes.
+type Log struct {
+	mu      sync.Mutex
+	size    int
+	epoch   int64
+	seq     uint64        // the newest entry
+	entries []Entry       // oldest first, at most size
+	changed chan struct{} // closed and replaced on every append
+}
+
+// StartLog watches the store until ctx ends, changes from now on are logged
+func StartLog(ctx context.Context, size int) *Log {
+	l := &Log{size: max(size, 1), epoch: newEpoch(), changed: make(chan struct{})}
+	changes := store.WatchBuffered(ctx, watchSize)
+	go l.run(ctx, changes)
+	return l
+}
+
+func newEpoch() int64 {
+	return store.GenerateId()
+}
+
+func (l *Log) run(ctx context.Context, changes <-chan store.Change) {
+	for {
+		for change := range changes {
+			l.append(change)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// fell behind the store and was dropped, watch again before the
+		// reset so a snapshot taken after it holds every change missed
+		changes = store.WatchBuffered(ctx, watchSize)
+		l.reset()
+		logging.Log().WarnContext(ctx, "Replication log missed changes, followers will catch up from a snapshot")
+	}
+}
+
+func (l *Log) append(change store.Change) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	if len(l.entries) == l.size {
+		l.entries = l.entries[1:]
+	}
+	l.entries = append(l.entries, Entry{Seq: l.seq, Kind: change.Kind, Item: change.Item, At: change.At})
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *Log) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.epoch = newEpoch()
+	l.entries = nil
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Position is the epoch and the newest change logged
+func (l *Log) Position() (int64, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.epoch, l.seq
+}
+
+// Since returns up to limit entries after the position, ErrBehind when the
+// position is not in the log
+func (l *Log) Since(epoch int64, after uint64, limit int) (Batch, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	batch := Batch{Epoch: l.epoch, Seq: l.seq, Entries: []Entry{}}
+	first := l.seq - uint64(len(l.entries)) + 1 // the oldest entry kept
+	if epoch != l.epoch || after > l.seq || after+1 < first {
+		return batch, ErrBehind
+	}
+	start := int(after + 1 - first)
+	end := min(len(l.entries), start+limit)
+	batch.Entries = slices.Clone(l.entries[start:end])
+	return batch, nil
+}
+
+// Tail is the newest n entries, oldest first
+func (l *Log) Tail(n int) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.entries[max(0, len(l.entries)-n):])
+}
+
+// Wait is closed once there is a change after seq, or on a new epoch
+func (l *Log) Wait(after uint64) <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seq > after {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return l.changed
+}
+
+// Snapshot copies the list. The position is read first so every change up to
+// it is in the copy, changes after it may be too and are applied again.
+func (l *Log) Snapshot() (Snapshot, error) {
+	epoch, seq := l.Position()
+	items, err := store.GetList()
+	return Snapshot{Epoch: epoch, Seq: seq, Items: items.Items()}, err
+}
@@ -0,0 +1,160 @@
+package replica
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+
+	// followers not heard from for this long are left out of the status
+	followerExpiry = 5 * time.Minute
+)
+
+var ErrNotFollowing = errors.New("not following a leader")
+
+// FollowerSeen is a follower as last seen reading the log
+type FollowerSeen struct {
+	Id       string    `json:"id"`
+	Addr     string    `json:"addr"`
+	Epoch    int64     `json:"epoch"`
+	Seq      uint64    `json:"seq"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+type Status struct {
+	Role      string         `json:"role"`
+	Epoch     int64          `json:"epoch"` // of this server's own log
+	Seq       uint64         `json:"seq"`
+	Following *FollowState   `json:"following,omitempty"`
+	Followers []FollowerSeen `json:"followers"`
+}
+
+// Node is this server's part in replication. It always keeps a log so other
+// servers can follow it, and follows a leader until it is promoted.
+type Node struct {
+	Log       *Log
+	done      chan struct{} // closed by Stop, ends held log reads
+	stopOnce  sync.Once
+	mu        sync.Mutex
+	follower  *Follower // nil when leading
+	stop      context.CancelFunc
+	stopped   chan struct{} // closed when the follower has stopped
+	followers map[string]FollowerSeen
+}
+
+// Start logs this server's changes and, given a leader, follows it with the
+// store read only. id is how the leader lists this server.
+func Start(ctx context.Context, leader string, id string, token string) *Node {
+	n := &Node{
+		Log:       StartLog(ctx, DefaultLogSize),
+		done:      make(chan struct{}),
+		followers: map[string]FollowerSeen{},
+	}
+	if leader == "" {
+		return n
+	}
+	store.SetReadOnly(true)
+	followCtx, stop := context.WithCancel(ctx)
+	follower, stopped := NewFollower(leader, id, token), make(chan struct{})
+	n.follower, n.stop, n.stopped = follower, stop, stopped
+	go func() {
+		defer close(stopped)
+		follower.Run(followCtx)
+	}()
+	logging.Log().InfoContext(ctx, "Following leader", "leader", leader)
+	return n
+}
+
+func (n *Node) Following() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.follower != nil
+}
+
+// Promote stops following and opens the store for writes. Followers of the
+// old leader can follow this server, they start from a snapshot.
+func (n *Node) Promote(ctx context.Context) error {
+	n.mu.Lock()
+	follower, stop, stopped := n.follower, n.stop, n.stopped
+	n.follower = nil
+	n.mu.Unlock()
+	if follower == nil {
+		return ErrNotFollowing
+	}
+	stop()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	store.SetReadOnly(false)
+	state := follower.State()
+	logging.Log().InfoContext(ctx, "Promoted to leader", "leader", state.Leader, "seq", state.Seq, "lag", state.Lag)
+	return nil
+}
+
+// Stop ends held log reads and following, for shutdown. The store stays read
+// only, a stopping follower takes no writes.
+func (n *Node) Stop() {
+	n.stopOnce.Do(func() { close(n.done) })
+	n.mu.Lock()
+	stop, stopped := n.stop, n.stopped
+	n.mu.Unlock()
+	if stop != nil {
+		stop()
+		<-stopped
+	}
+}
+
+// Poll reads the log after the position, waiting up to wait when there is
+// nothing new. The follower is noted for the status.
+func (n *Node) Poll(ctx context.Context, follower FollowerSeen, wait time.Duration) (Batch, error) {
+	follower.LastSeen = time.Now().UTC()
+	n.mu.Lock()
+	n.followers[follower.Id] = follower
+	n.mu.Unlock()
+
+	batch, err := n.Log.Since(follower.Epoch, follower.Seq, batchSize)
+	if err != nil || len(batch.Entries) > 0 || wait <= 0 {
+		return batch, err
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-n.Log.Wait(follower.Seq):
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-n.done:
+	}
+	return n.Log.Since(follower.Epoch, follower.Seq, batchSize)
+}
+
+func (n *Node) Status() Status {
+	epoch, seq := n.Log.Position()
+	status := Status{Role: RoleLeader, Epoch: epoch, Seq: seq, Followers: []FollowerSeen{}}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.follower != nil {
+		state := n.follower.State()
+		status.Role, status.Following = RoleFollower, &state
+	}
+	for id, f := range n.followers {
+		if time.Since(f.LastSeen) > followerExpiry {
+			delete(n.followers, id)
+			continue
+		}
+		status.Followers = append(status.Followers, f)
+	}
+	slices.SortFunc(status.Followers, func(a, b FollowerSeen) int { return cmp.Compare(a.Id, b.Id) })
+	return status
+}
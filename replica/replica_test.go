@@ -0,0 +1,226 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestMain(m *testing.M) {
+	logging.Default()
+	ctx, cancel := context.WithCancel(context.Background())
+	workDir, _ := os.MkdirTemp("", "appcli")
+	store.OpenSession(ctx, filepath.Join(workDir, "todolist.json"))
+	store.StartActor(ctx)
+	code := m.Run()
+	cancel()
+	os.RemoveAll(workDir)
+	os.Exit(code)
+}
+
+// waits for the log to reach seq, it is fed by a watcher so trails the store a little
+func waitSeq(t *testing.T, l *Log, seq uint64) {
+	t.Helper()
+	for range 100 {
+		if _, got := l.Position(); got >= seq {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("log did not reach %d", seq)
+}
+
+func TestLog(t *testing.T) {
+	ctx := t.Context()
+	l := StartLog(ctx, 3)
+	epoch, seq := l.Position()
+	if seq != 0 {
+		t.Fatalf("new log at %d", seq)
+	}
+	wait := l.Wait(0)
+
+	ids := []int64{}
+	for _, d := range []string{"Log one", "Log two", "Log three"} {
+		id, ok := store.AddTask(ctx, d)
+		if ok != nil {
+			t.Fatal(ok)
+		}
+		ids = append(ids, id)
+	}
+	store.DeleteTask(ctx, ids[0])
+	waitSeq(t, l, 4)
+	select {
+	case <-wait:
+	default:
+		t.Error("wait not closed by a change")
+	}
+
+	batch, ok := l.Since(epoch, 2, 10)
+	if ok != nil || batch.Seq != 4 || len(batch.Entries) != 2 {
+		t.Fatalf("since 2 got %v %v", batch, ok)
+	}
+	if e := batch.Entries[1]; e.Seq != 4 || e.Kind != store.ChangeDeleted || e.Item.Line != ids[0] {
+		t.Errorf("wanted the delete of %d at 4 got %v", ids[0], e)
+	}
+	if batch, _ := l.Since(epoch, 1, 1); len(batch.Entries) != 1 || batch.Entries[0].Seq != 2 {
+		t.Errorf("limit 1 got %v", batch.Entries)
+	}
+	if batch, ok := l.Since(epoch, 4, 10); ok != nil || len(batch.Entries) != 0 {
+		t.Errorf("up to date wanted nothing got %v %v", batch.Entries, ok)
+	}
+
+	var tests = []struct {
+		name  string
+		epoch int64
+		after uint64
+	}{
+		{name: "moved past", epoch: epoch, after: 0},
+		{name: "ahead", epoch: epoch, after: 5},
+		{name: "other epoch", epoch: epoch + 1, after: 3},
+	}
+	for _, tc := range tests {
+		if _, ok := l.Since(tc.epoch, tc.after, 10); !errors.Is(ok, ErrBehind) {
+			t.Errorf("%s wanted ErrBehind got %v", tc.name, ok)
+		}
+	}
+
+	// the snapshot holds everything up to its position
+	snapshot, ok := l.Snapshot()
+	if ok != nil || snapshot.Epoch != epoch || snapshot.Seq != 4 {
+		t.Fatalf("snapshot at %d %d %v", snapshot.Epoch, snapshot.Seq, ok)
+	}
+	if _, found := snapshot.Items[ids[1]]; !found {
+		t.Error("snapshot is missing an item")
+	}
+	for _, id := range ids[1:] {
+		store.DeleteTask(ctx, id)
+	}
+}
+
+// a leader serving a canned snapshot and log, the position is
+// behind until the follower has taken the snapshot
+type fakeLeader struct {
+	snapshot Snapshot
+	entries  []Entry
+	reads    atomic.Int32
+}
+
+func (f *fakeLeader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/replication/snapshot":
+		json.NewEncoder(w).Encode(f.snapshot)
+	case "/replication/log":
+		f.reads.Add(1)
+		epoch, _ := strconv.ParseInt(r.URL.Query().Get("epoch"), 10, 64)
+		after, _ := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+		if epoch != f.snapshot.Epoch {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		batch := Batch{Epoch: epoch, Seq: f.snapshot.Seq + uint64(len(f.entries)), Entries: []Entry{}}
+		for _, e := range f.entries {
+			if e.Seq > after {
+				batch.Entries = append(batch.Entries, e)
+			}
+		}
+		if len(batch.Entries) == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		json.NewEncoder(w).Encode(batch)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	created := time.Now().UTC().Round(time.Second)
+	stale, _ := store.AddTask(ctx, "Not on the leader")
+	leader := &fakeLeader{
+		snapshot: Snapshot{Epoch: 7, Seq: 10, Items: store.TodoListItems{
+			101: {Line: 101, Id: 101, Description: "From the snapshot", Created: created},
+			102: {Line: 102, Id: 102, Description: "Deleted by the log", Created: created},
+		}},
+		entries: []Entry{
+			{Seq: 11, Kind: store.ChangeUpdated, Item: store.TodoListItem{Line: 101, Id: 101, Description: "Updated by the log", State: store.StateStarted, Created: created}},
+			{Seq: 12, Kind: store.ChangeDeleted, Item: store.TodoListItem{Line: 102}},
+			{Seq: 13, Kind: store.ChangeCreated, Item: store.TodoListItem{Line: 103, Id: 103, Description: "Created by the log", Created: created}},
+		},
+	}
+	srv := httptest.NewServer(leader)
+	defer srv.Close()
+
+	f := NewFollower(srv.URL, "test", "")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.Run(ctx)
+	}()
+	for range 100 {
+		if f.State().Synced {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	state := f.State()
+	if !state.Synced || state.Epoch != 7 || state.Seq != 13 || state.Lag != 0 || state.Snapshots != 1 {
+		t.Errorf("unexpected follow state %+v", state)
+	}
+	list, _ := store.GetList()
+	items := list.Items()
+	if len(items) != 2 {
+		t.Errorf("wanted the leader's 2 items got %d", len(items))
+	}
+	if _, found := items[stale]; found {
+		t.Error("item not on the leader kept")
+	}
+	if item := items[101]; item.Description != "Updated by the log" || item.State != store.StateStarted {
+		t.Errorf("log update not applied %+v", item)
+	}
+	if _, found := items[103]; !found {
+		t.Error("log create not applied")
+	}
+	store.Replace(t.Context(), store.TodoListItems{})
+}
+
+func TestNodePromote(t *testing.T) {
+	defer store.SetReadOnly(false)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	n := Start(t.Context(), srv.URL, "test", "")
+	if status := n.Status(); status.Role != RoleFollower || status.Following == nil || status.Following.Synced {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if _, ok := store.AddTask(t.Context(), "Write to a follower"); !errors.Is(ok, store.ErrReadOnly) {
+		t.Errorf("wanted ErrReadOnly got %v", ok)
+	}
+	if ok := n.Promote(t.Context()); ok != nil {
+		t.Fatal(ok)
+	}
+	if status := n.Status(); status.Role != RoleLeader || status.Following != nil {
+		t.Errorf("unexpected status once promoted %+v", status)
+	}
+	id, ok := store.AddTask(t.Context(), "Write to the new leader")
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	store.DeleteTask(t.Context(), id)
+	if ok := n.Promote(t.Context()); !errors.Is(ok, ErrNotFollowing) {
+		t.Errorf("promoting a leader wanted ErrNotFollowing got %v", ok)
+	}
+	n.Stop()
+}
@@ -0,0 +1,114 @@
+// Package ring is a consistent hash ring for routing task ids to store servers.
+//
+// Each node is placed on the ring many times, its virtual nodes, so keys
+// spread evenly and adding or removing a node only moves the keys between
+// its points and their neighbours, about 1/n of them.
+package ring
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// virtual nodes per node when New is given zero
+const DefaultReplicas = 128
+
+// Ring maps keys to nodes, it is not safe for concurrent use
+type Ring struct {
+	replicas int
+	points   []uint64          // sorted hashes of every virtual node
+	owners   map[uint64]string // virtual node hash to node
+	nodes    []string
+}
+
+func New(replicas int, nodes ...string) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	r := &Ring{replicas: replicas, owners: map[uint64]string{}}
+	for _, node := range nodes {
+		r.Add(node)
+	}
+	return r
+}
+
+// Add places a node on the ring, adding a node twice does nothing
+func (r *Ring) Add(node string) {
+	if slices.Contains(r.nodes, node) {
+		return
+	}
+	r.nodes = append(r.nodes, node)
+	for i := range r.replicas {
+		// 64 bit points, a clash between two nodes is not worth handling
+		p := hashString(node + "#" + strconv.Itoa(i))
+		r.owners[p] = node
+		r.points = append(r.points, p)
+	}
+	slices.Sort(r.points)
+}
+
+// Remove takes a node off the ring, its keys go to the next points along
+func (r *Ring) Remove(node string) {
+	i := slices.Index(r.nodes, node)
+	if i < 0 {
+		return
+	}
+	r.nodes = slices.Delete(r.nodes, i, i+1)
+	r.points = slices.DeleteFunc(r.points, func(p uint64) bool {
+		if r.owners[p] == node {
+			delete(r.owners, p)
+			return true
+		}
+		return false
+	})
+}
+
+// Get is the node owning key, the first point at or after the key's hash.
+// Empty when the ring has no nodes.
+func (r *Ring) Get(key int64) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i, _ := slices.BinarySearch(r.points, h)
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Nodes in the order they were added
+func (r *Ring) Nodes() []string {
+	return slices.Clone(r.nodes)
+}
+
+func (r *Ring) Len() int {
+	return len(r.nodes)
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return mix(h.Sum64())
+}
+
+// ids are time based, so they are hashed as bytes and mixed rather than used as is
+func hashKey(key int64) uint64 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(key))
+	h := fnv.New64a()
+	h.Write(b[:])
+	return mix(h.Sum64())
+}
+
+// the murmur3 finaliser, fnv alone leaves similar inputs close together
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
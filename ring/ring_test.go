@@ -0,0 +1,77 @@
+package ring
+
+import (
+	"testing"
+)
+
+const firstId int64 = 1761837306757785900
+
+func owners(r *Ring, n int) map[int64]string {
+	got := make(map[int64]string, n)
+	for id := firstId; id < firstId+int64(n); id++ {
+		got[id] = r.Get(id)
+	}
+	return got
+}
+
+func TestGetSpreadsKeys(t *testing.T) {
+	r := New(0, "a:1", "b:2", "c:3", "d:4")
+	counts := map[string]int{}
+	for _, node := range owners(r, 40_000) {
+		counts[node]++
+	}
+	if len(counts) != 4 {
+		t.Fatalf("keys landed on %d of 4 nodes %v", len(counts), counts)
+	}
+	for node, c := range counts {
+		if c < 7_000 || c > 13_000 {
+			t.Errorf("node %s has %d of 40000 keys, spread is uneven %v", node, c, counts)
+		}
+	}
+}
+
+func TestAddRemoveMovesFewKeys(t *testing.T) {
+	r := New(0, "a:1", "b:2", "c:3")
+	before := owners(r, 30_000)
+
+	r.Add("d:4")
+	after := owners(r, 30_000)
+	moved := 0
+	for id, node := range after {
+		if node != before[id] {
+			moved++
+			if node != "d:4" {
+				t.Fatalf("key %d moved from %s to %s, only the new node should gain keys", id, before[id], node)
+			}
+		}
+	}
+	// a quarter should move to the new node, not a reshuffle
+	if moved < 5_000 || moved > 10_000 {
+		t.Errorf("adding a fourth node moved %d of 30000 keys", moved)
+	}
+
+	r.Remove("d:4")
+	for id, node := range owners(r, 30_000) {
+		if node != before[id] {
+			t.Fatalf("key %d on %s after removing the new node, was %s", id, node, before[id])
+		}
+	}
+}
+
+func TestEmptyAndNodes(t *testing.T) {
+	r := New(4)
+	if got := r.Get(firstId); got != "" {
+		t.Errorf("empty ring routed to %q", got)
+	}
+	r.Add("a:1")
+	r.Add("a:1")
+	r.Add("b:2")
+	if r.Len() != 2 || len(r.points) != 8 {
+		t.Errorf("wanted 2 nodes with 8 points got %v with %d points", r.Nodes(), len(r.points))
+	}
+	r.Remove("a:1")
+	r.Remove("missing")
+	if got := r.Get(firstId); got != "b:2" || r.Len() != 1 {
+		t.Errorf("wanted every key on b:2 got %q nodes %v", got, r.Nodes())
+	}
+}
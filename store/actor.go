@@ -15,30 +15,45 @@ type rdData struct {
 	key        int64
 	returnChan *chan TodoListRecord
 }
+type wrData struct {
+	record     TodoListRecord
+	remove     bool                 // delete the record's line instead of writing it
+	expect     *Expected            // write only over the item expected, as for a sync push
+	returnChan *chan TodoListRecord // the item as it was before
+}
 type rdKeysData struct {
 	returnChan *chan []int64
 }
+type rdSnapshotData struct {
+	returnChan *chan *listSnapshot
+}
 
 type TodoListRecord struct {
 	// index int64
 	item TodoListItem
 	ok   bool
+	err  error // from a backend, or a conditional write that found another version
 }
 
 type StoreChannels struct {
-	writeChan    chan TodoListRecord
+	writeChan    chan wrData
 	readChan     chan rdData
 	readKeysChan chan rdKeysData
+	snapshotChan chan rdSnapshotData
+	done         chan struct{} // closed when the actor ends
 }
 
 // exploring
 // channels way of enabling read, write aand iterator over todolist map during multi go routines
-// There is a case for Mutexes but here we are learnng about channels
-func NewStoreChannels(ctx context.Context) *StoreChannels {
+// There is a case for Mutexes but here we are learnng about channels.
+// Each shard has one of these owning the shard's map.
+func NewStoreChannels(ctx context.Context, s *shard) *StoreChannels {
 	chans := StoreChannels{
-		writeChan:    make(chan TodoListRecord),
+		writeChan:    make(chan wrData),
 		readChan:     make(chan rdData),
 		readKeysChan: make(chan rdKeysData),
+		snapshotChan: make(chan rdSnapshotData),
+		done:         make(chan struct{}),
 	}
 
 	// fetch the number keys from the map
@@ -52,6 +67,7 @@ func NewStoreChannels(ctx context.Context) *StoreChannels {
 
 	// actor
 	go func() {
+		defer close(chans.done)
 		for {
 			select {
 			// end
@@ -59,18 +75,52 @@ func NewStoreChannels(ctx context.Context) *StoreChannels {
 				return
 			// read record
 			case rdData := <-chans.readChan:
-				item, ok := sessionDatabase[rdData.key]
+				item, ok := s.items[rdData.key]
 				*rdData.returnChan <- TodoListRecord{
 					item: item, ok: ok,
 				}
 				close(*rdData.returnChan)
-			// write record
-			case rec := <-chans.writeChan:
-				sessionDatabase[rec.item.Line] = rec.item
+			// write or delete record
+			case wrData := <-chans.writeChan:
+				line := wrData.record.item.Line
+				before, found := s.items[line]
+				if wrData.expect != nil && !wrData.expect.matches(before, found) {
+					*wrData.returnChan <- TodoListRecord{item: before, ok: found, err: ErrVersionConflict}
+					close(*wrData.returnChan)
+					continue
+				}
+				switch {
+				case wrData.remove && found:
+					delete(s.items, line)
+					reparented(before.Parent, 0, 0)
+					restated(&before, nil)
+					publish(ChangeDeleted, before)
+				case !wrData.remove && found:
+					s.items[line] = wrData.record.item
+					reparented(before.Parent, wrData.record.item.Parent, wrData.record.item.Rank)
+					restated(&before, &wrData.record.item)
+					publish(ChangeUpdated, wrData.record.item)
+				case !wrData.remove:
+					s.items[line] = wrData.record.item
+					reparented(0, wrData.record.item.Parent, wrData.record.item.Rank)
+					restated(nil, &wrData.record.item)
+					publish(ChangeCreated, wrData.record.item)
+				}
+				if found || !wrData.remove {
+					s.touched(line)
+					markChanged()
+				}
+				// acknowledge so the writer can read its own write straight away
+				*wrData.returnChan <- TodoListRecord{item: before, ok: found}
+				close(*wrData.returnChan)
 			// get keys. needed a safe iterator over keys during writes on other routines
 			case rdKData := <-chans.readKeysChan:
-				*rdKData.returnChan <- getKeys(sessionDatabase)
+				*rdKData.returnChan <- getKeys(s.items)
 				close(*rdKData.returnChan)
+			// copy of the shard, shared by every reader until the next change
+			case rdSData := <-chans.snapshotChan:
+				*rdSData.returnChan <- s.snapshot()
+				close(*rdSData.returnChan)
 			}
 		}
 	}()
@@ -83,8 +133,26 @@ func (c *StoreChannels) Read(key int64) TodoListRecord {
 	return <-resultsChan
 }
 
-func (c *StoreChannels) Write(record TodoListRecord) {
-	c.writeChan <- record
+// Write adds or replaces the record's item, true when it replaced one
+func (c *StoreChannels) Write(record TodoListRecord) bool {
+	doneChan := make(chan TodoListRecord, 1)
+	c.writeChan <- wrData{record: record, returnChan: &doneChan}
+	return (<-doneChan).ok
+}
+
+// WriteIf is Write only when the item there is as expected, the record
+// holds the item as it was and ErrVersionConflict when it was not
+func (c *StoreChannels) WriteIf(record TodoListRecord, expect Expected) TodoListRecord {
+	doneChan := make(chan TodoListRecord, 1)
+	c.writeChan <- wrData{record: record, expect: &expect, returnChan: &doneChan}
+	return <-doneChan
+}
+
+// Remove deletes a line and returns the item it held, not ok when it was not in the list
+func (c *StoreChannels) Remove(key int64) TodoListRecord {
+	doneChan := make(chan TodoListRecord, 1)
+	c.writeChan <- wrData{record: TodoListRecord{item: TodoListItem{Line: key}}, remove: true, returnChan: &doneChan}
+	return <-doneChan
 }
 
 func (c *StoreChannels) Keys() []int64 {
@@ -92,3 +160,25 @@ func (c *StoreChannels) Keys() []int64 {
 	c.readKeysChan <- rdKeysData{returnChan: &resultsChan}
 	return <-resultsChan
 }
+
+// Snapshot is the shard as it is now, false once the actor has ended.
+// The copy is shared between readers and must not be changed.
+func (c *StoreChannels) Snapshot() (*listSnapshot, bool) {
+	resultsChan := make(chan *listSnapshot)
+	select {
+	case c.snapshotChan <- rdSnapshotData{returnChan: &resultsChan}:
+		return <-resultsChan, true
+	case <-c.done:
+		return nil, false
+	}
+}
+
+// the actor has ended
+func (c *StoreChannels) stopped() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
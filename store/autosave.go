@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+// save health for monitoring
+type SaveStats struct {
+	Changes      uint64        `json:"changes"`      // changes since the list was opened
+	Unsaved      uint64        `json:"unsaved"`      // changes not yet written to the file
+	Saves        uint64        `json:"saves"`        // successful saves
+	Failures     uint64        `json:"failures"`     // failed saves
+	LastSave     time.Time     `json:"lastSave"`     // when the last successful save finished
+	LastDuration time.Duration `json:"lastDuration"` // how long the last save attempt took
+	LastError    string        `json:"lastError"`    // error from the last save attempt, empty when it worked
+}
+
+var (
+	changeCount atomic.Uint64 // bumped on every change to the list
+	savedCount  atomic.Uint64 // change count held in the file
+	changed     = make(chan struct{}, 1)
+
+	statsMutex sync.Mutex
+	saveStats  SaveStats
+)
+
+// record a change and nudge the autosaver
+func markChanged() {
+	changeCount.Add(1)
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
+
+// Dirty reports changes not yet saved to the file
+func Dirty() bool {
+	return changeCount.Load() != savedCount.Load()
+}
+
+func Stats() SaveStats {
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+	stats := saveStats
+	stats.Changes = changeCount.Load()
+	stats.Unsaved = stats.Changes - savedCount.Load()
+	return stats
+}
+
+func resetChanges() {
+	changeCount.Store(0)
+	savedCount.Store(0)
+}
+
+func recordSave(started time.Time, version uint64, err error) {
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+	saveStats.LastDuration = time.Since(started)
+	saveSeconds.Observe(saveStats.LastDuration.Seconds())
+	if err != nil {
+		saveFailures.Inc()
+		saveStats.Failures++
+		saveStats.LastError = err.Error()
+		return
+	}
+	saveStats.Saves++
+	saveStats.LastSave = time.Now().UTC()
+	saveStats.LastError = ""
+	savedCount.Store(version)
+}
+
+// StartAutosave commits the list in the background every interval when it has
+// changed, or sooner once maxChanges changes are waiting. Zero turns either off.
+// The returned stop func ends the autosaver and waits for a save in progress.
+func StartAutosave(ctx context.Context, interval time.Duration, maxChanges uint64) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	logging.Log().InfoContext(ctx, "Autosave started", "interval", interval, "maxChanges", maxChanges)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+				if Dirty() {
+					autosave(ctx, "interval")
+				}
+			case <-changed:
+				if maxChanges > 0 && Stats().Unsaved >= maxChanges {
+					autosave(ctx, "changes")
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func autosave(ctx context.Context, reason string) {
+	if err := Commit(ctx); err != nil {
+		logging.Log().ErrorContext(ctx, "Autosave failed", "reason", reason, "err", err)
+	} else {
+		logging.Log().DebugContext(ctx, "Autosaved", "reason", reason)
+	}
+}
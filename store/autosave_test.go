@@ -0,0 +1,65 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirty(t *testing.T) {
+	ctx := t.Context()
+	storageFile := filepath.Join(t.TempDir(), "dirty.json")
+	if ok := OpenSession(ctx, storageFile); ok != nil {
+		t.Fatal(ok)
+	}
+	StartActor(ctx)
+
+	if Dirty() {
+		t.Errorf("freshly opened list should not be dirty")
+	}
+	added, _ := AddTask(ctx, "Original task description buy apples")
+	if !Dirty() {
+		t.Errorf("list should be dirty after an add")
+	}
+	if ok := SaveSession(ctx, storageFile); ok != nil {
+		t.Fatal(ok)
+	} else if Dirty() {
+		t.Errorf("list should be clean after a save")
+	}
+	StateChange(ctx, added, StateStarted)
+	if stats := Stats(); stats.Unsaved != 1 || stats.LastSave.IsZero() || stats.LastError != "" {
+		t.Errorf("unexpected stats after a change %+v", stats)
+	}
+}
+
+func TestAutosave(t *testing.T) {
+	var tests = []struct {
+		interval   time.Duration
+		maxChanges uint64
+		adds       int
+	}{
+		{interval: 0, maxChanges: 3, adds: 3},
+		{interval: 10 * time.Millisecond, maxChanges: 0, adds: 1},
+	}
+
+	for i, tc := range tests {
+		ctx := t.Context()
+		if ok := OpenSession(ctx, filepath.Join(t.TempDir(), "autosave.json")); ok != nil {
+			t.Fatal(ok)
+		}
+		StartActor(ctx)
+		stop := StartAutosave(ctx, tc.interval, tc.maxChanges)
+		saves := Stats().Saves
+		for range tc.adds {
+			AddTask(ctx, "Original task description buy apples")
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for Dirty() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		stop()
+		if Dirty() || Stats().Saves <= saves {
+			t.Errorf("test %d autosave did not run %+v", i, Stats())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+// Backend keeps the list in store servers rather than in this process.
+// Once set the item reads, writes and lists below the task functions go
+// through it, the checks and logging above them stay the same.
+type Backend interface {
+	Get(ctx context.Context, id int64) (TodoListItem, bool, error)
+	Put(ctx context.Context, item TodoListItem) (bool, error)         // true when it replaced an item
+	Delete(ctx context.Context, id int64) (TodoListItem, bool, error) // the item deleted
+	List(ctx context.Context) (TodoListItems, error)
+	Count(ctx context.Context) (int, error)
+	Ping(ctx context.Context) error
+}
+
+// how long one call to the backend may take when the caller has no context
+const backendTimeout = 10 * time.Second
+
+var backend Backend
+
+// SetBackend routes the store to b, nil goes back to the local shards.
+// Set it before the store is used, there is no local file to open with a backend.
+func SetBackend(b Backend) {
+	backend = b
+}
+
+// the backend set by SetBackend, nil when the list is local
+func CurrentBackend() Backend {
+	return backend
+}
+
+// the list lives in store servers
+func Remote() bool {
+	return backend != nil
+}
+
+// Ping checks the backends answer, always fine for the local list
+func Ping(ctx context.Context) error {
+	if backend == nil {
+		return nil
+	}
+	return backend.Ping(ctx)
+}
+
+func backendContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), backendTimeout)
+}
+
+func remoteRead(id int64) TodoListRecord {
+	ctx, cancel := backendContext()
+	defer cancel()
+	item, ok, err := backend.Get(ctx, id)
+	if err != nil {
+		logging.Log().ErrorContext(ctx, "Backend read failed", "ID", id, "err", err)
+	}
+	return TodoListRecord{item: item, ok: ok, err: err}
+}
+
+// the whole list from the backends, shaped like the merged shards
+func remoteList() (*mergedSnapshot, error) {
+	ctx, cancel := backendContext()
+	defer cancel()
+	items, err := backend.List(ctx)
+	if err != nil {
+		logging.Log().ErrorContext(ctx, "Backend list failed", "err", err)
+		return &mergedSnapshot{items: TodoListItems{}}, err
+	}
+	part := newListSnapshot(0, slices.SortedFunc(maps.Values(items), byLine))
+	return &mergedSnapshot{parts: []*listSnapshot{part}, count: part.count, items: items}, nil
+}
+
+func remoteCount() int {
+	ctx, cancel := backendContext()
+	defer cancel()
+	n, err := backend.Count(ctx)
+	if err != nil {
+		logging.Log().ErrorContext(ctx, "Backend count failed", "err", err)
+	}
+	return n
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+)
+
+var errListDown = errors.New("store server did not answer the list")
+
+// a backend in memory whose List can be made to fail
+type memoryBackend struct {
+	mu       sync.Mutex
+	items    TodoListItems
+	listDown bool
+	lists    int                     // calls to List
+	refuse   func(TodoListItem) bool // puts that fail
+}
+
+var errPutRefused = errors.New("store server refused the write")
+
+func (b *memoryBackend) Get(ctx context.Context, id int64) (TodoListItem, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	item, found := b.items[id]
+	return item, found, nil
+}
+
+func (b *memoryBackend) Put(ctx context.Context, item TodoListItem) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.refuse != nil && b.refuse(item) {
+		return false, errPutRefused
+	}
+	_, found := b.items[item.Line]
+	b.items[item.Line] = item
+	return found, nil
+}
+
+func (b *memoryBackend) Delete(ctx context.Context, id int64) (TodoListItem, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	item, found := b.items[id]
+	delete(b.items, id)
+	return item, found, nil
+}
+
+func (b *memoryBackend) List(ctx context.Context) (TodoListItems, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lists++
+	if b.listDown {
+		return nil, errListDown
+	}
+	return maps.Clone(b.items), nil
+}
+
+func (b *memoryBackend) Count(ctx context.Context) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.items), nil
+}
+
+func (b *memoryBackend) Ping(ctx context.Context) error {
+	return nil
+}
+
+// a list the store servers cannot give is an error, never an empty list
+func TestBackendListDown(t *testing.T) {
+	ctx := t.Context()
+	b := &memoryBackend{items: TodoListItems{}}
+	SetBackend(b)
+	defer SetBackend(nil)
+	parent, _ := AddTask(ctx, "Paint the shed")
+	child, _ := AddSubtask(ctx, parent, "Sand the walls", nil)
+	if ok := AddBlocker(ctx, parent, child); ok != nil {
+		t.Fatal(ok)
+	}
+	other, _ := AddTask(ctx, "Buy paint")
+	if ok := AddBlocker(ctx, parent, other); ok != nil {
+		t.Fatal(ok)
+	}
+	b.listDown = true
+
+	var tests = []struct {
+		name string
+		call func() error
+	}{
+		{"get list", func() error { _, ok := GetList(); return ok }},
+		{"scan", func() error { _, ok := Scan(); return ok }},
+		{"children", func() error { _, ok := Children(parent); return ok }},
+		{"blocked", func() error { _, ok := Blocked(); return ok }},
+		{"add subtask", func() error { _, ok := AddSubtask(ctx, parent, "Pick a colour", nil); return ok }},
+		{"delete", func() error { return DeleteTask(ctx, parent) }},
+		{"delete tree", func() error { return DeleteTree(ctx, parent) }},
+	}
+	for _, tc := range tests {
+		if ok := tc.call(); !errors.Is(ok, errListDown) {
+			t.Errorf("%s: wanted the list error got %v", tc.name, ok)
+		}
+	}
+	// the blocker checks read only the tasks they need
+	var blocked *BlockedError
+	if ok := StateChange(ctx, parent, StateStarted); !errors.As(ok, &blocked) {
+		t.Errorf("starting a blocked task wanted a BlockedError got %v", ok)
+	}
+	if ok := AddBlocker(ctx, child, parent); ok == nil {
+		t.Error("a loop was taken while the list was down")
+	}
+	if _, ok := GetByIndex(parent); ok != nil {
+		t.Errorf("parent deleted without its subtasks lifted")
+	}
+}
+
+// a failed write while completing a recurring task leaves one open occurrence
+func TestRecurWriteFails(t *testing.T) {
+	ctx := t.Context()
+	b := &memoryBackend{items: TodoListItems{}}
+	SetBackend(b)
+	defer SetBackend(nil)
+	chore, _ := AddTask(ctx, "Put the bins out")
+	if ok := RecurChange(ctx, chore, "weekly"); ok != nil {
+		t.Fatal(ok)
+	}
+
+	var tests = []struct {
+		name   string
+		refuse func(TodoListItem) bool
+	}{
+		{"next occurrence", func(item TodoListItem) bool { return item.Series != 0 }},
+		{"completed occurrence", func(item TodoListItem) bool { return item.Line == chore }},
+	}
+	for _, tc := range tests {
+		b.refuse = tc.refuse
+		if ok := StateChange(ctx, chore, StateCompleted); !errors.Is(ok, errPutRefused) {
+			t.Errorf("%s: wanted the write error got %v", tc.name, ok)
+		}
+		b.refuse = nil
+		if item, _ := GetByIndex(chore); item.State == StateCompleted || item.Recur != "FREQ=WEEKLY" {
+			t.Errorf("%s: the series should still repeat from the task got %+v", tc.name, item)
+		}
+		if n := Count(); n != 1 {
+			t.Errorf("%s: wanted only the one open occurrence got %d tasks", tc.name, n)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+// list sizes the list benchmarks run over
+var benchSizes = []int{500, 10_000, 100_000}
+
+var (
+	fixtureMutex sync.Mutex
+	fixtures     = map[int]TodoListItems{}
+)
+
+// fixture is the same list of n items on every run, so results can be compared
+// between commits with benchstat. Built once per size and shared read only.
+func fixture(n int) TodoListItems {
+	fixtureMutex.Lock()
+	defer fixtureMutex.Unlock()
+	if items, found := fixtures[n]; found {
+		return items
+	}
+	random := rand.New(rand.NewSource(int64(n)))
+	created := time.Date(2025, 10, 10, 9, 0, 0, 0, time.UTC)
+	items := make(TodoListItems, n)
+	for i := range n {
+		id := int64(1_000_000 + i)
+		items[id] = TodoListItem{
+			Line:        id,
+			Id:          id,
+			Description: fmt.Sprintf("Buy %d apples for task %d", random.Intn(1e4), i),
+			State:       random.Intn(3),
+			Created:     created.Add(time.Duration(i) * time.Minute),
+			Tags:        []string{"bench"},
+		}
+	}
+	fixtures[n] = items
+	return items
+}
+
+// quiet stops logs and the save messages on stdout skewing the timings
+func quiet(b *testing.B) {
+	b.Helper()
+	logging.Setup(io.Discard, "text", slog.HandlerOptions{})
+	stdout := os.Stdout
+	if devNull, ok := os.Open(os.DevNull); ok == nil {
+		os.Stdout = devNull
+	}
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		logging.Default()
+	})
+}
+
+// useFixture loads a copy of the n item fixture into the shards and starts their actors
+func useFixture(b *testing.B, n int) {
+	b.Helper()
+	quiet(b)
+	setList(fixture(n))
+	ctx, cancel := context.WithCancel(context.Background())
+	StartActor(ctx)
+	b.Cleanup(func() {
+		cancel()
+		for _, s := range shards {
+			<-s.actor.done
+		}
+		resetList()
+	})
+}
+
+func BenchmarkAddTask(b *testing.B) {
+	useFixture(b, 500)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		AddTask(ctx, "Buy apples for the benchmark")
+	}
+}
+
+// parallel writes over different shard counts, more shards than cores buys nothing
+func BenchmarkAddTaskParallel(b *testing.B) {
+	original := ShardCount()
+	defer SetShards(original)
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			if ok := SetShards(n); ok != nil {
+				b.Fatal(ok)
+			}
+			useFixture(b, 500)
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					AddTask(ctx, "Buy apples for the benchmark")
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGetList(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("items=%d", size), func(b *testing.B) {
+			useFixture(b, size)
+			b.ReportAllocs()
+			for b.Loop() {
+				if items, _ := GetList(); items.Len() != size {
+					b.Fatalf("wanted %d items got %d", size, items.Len())
+				}
+			}
+		})
+	}
+}
+
+// worst case for the snapshot, every list follows a write so each one copies
+func BenchmarkGetListAfterWrite(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("items=%d", size), func(b *testing.B) {
+			getListAfterWrite(b, size)
+		})
+	}
+}
+
+// the 100k case on its own, TestGetListAfterWriteCost holds it to a bound
+func BenchmarkGetListAfterWrite100k(b *testing.B) {
+	getListAfterWrite(b, 100_000)
+}
+
+func getListAfterWrite(b *testing.B, size int) {
+	useFixture(b, size)
+	item := fixture(size)[1_000_000]
+	// the first snapshot after loading is a full one, not what is measured
+	GetList()
+	b.ReportAllocs()
+	for b.Loop() {
+		writeItem(item)
+		GetList()
+	}
+}
+
+func BenchmarkAddSubtask100k(b *testing.B) {
+	useFixture(b, 100_000)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		AddSubtask(ctx, 1_000_000, "Buy apples for the benchmark", nil)
+	}
+}
+
+func BenchmarkMoveTask100k(b *testing.B) {
+	useFixture(b, 100_000)
+	ctx := context.Background()
+	parents := []int64{1_000_001, 1_000_002}
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		MoveTask(ctx, 1_000_000, parents[i%2])
+		i++
+	}
+}
+
+// the list as it was read before snapshots, keys then one actor read per key, to compare against
+func BenchmarkGetListKeysRead(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("items=%d", size), func(b *testing.B) {
+			useFixture(b, size)
+			b.ReportAllocs()
+			for b.Loop() {
+				items := TodoListItems{}
+				for _, s := range shards {
+					for _, k := range s.actor.Keys() {
+						if record := s.actor.Read(k); record.ok {
+							items[k] = record.item
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// readers in parallel while one writer keeps changing the list
+func BenchmarkGetListParallel(b *testing.B) {
+	size := 10_000
+	useFixture(b, size)
+	item := fixture(size)[1_000_000]
+	stop := make(chan struct{})
+	var writes sync.WaitGroup
+	writes.Add(1)
+	go func() {
+		defer writes.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				writeItem(item)
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			GetList()
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	writes.Wait()
+}
+
+func BenchmarkStoreChannels(b *testing.B) {
+	size := 10_000
+	useFixture(b, size)
+	key := int64(1_000_000 + size/2)
+	item := fixture(size)[key]
+	actor := shardFor(key).actor
+
+	b.Run("Read", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			actor.Read(key)
+		}
+	})
+	b.Run("Write", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			actor.Write(TodoListRecord{item: item})
+		}
+	})
+	b.Run("Keys", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			actor.Keys()
+		}
+	})
+	b.Run("Snapshot", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			actor.Snapshot()
+		}
+	})
+}
+
+// json save and restore of todolist.json, bytes per second is the file size
+func BenchmarkSave(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("items=%d", size), func(b *testing.B) {
+			quiet(b)
+			ctx := context.Background()
+			file := filepath.Join(b.TempDir(), "todolist.json")
+			items := fixture(size)
+			b.ReportAllocs()
+			for b.Loop() {
+				if ok := Save(ctx, file, items); ok != nil {
+					b.Fatal(ok)
+				}
+			}
+			if info, ok := os.Stat(file); ok == nil {
+				b.SetBytes(info.Size())
+			}
+		})
+	}
+}
+
+func BenchmarkRestore(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("items=%d", size), func(b *testing.B) {
+			quiet(b)
+			ctx := context.Background()
+			file := filepath.Join(b.TempDir(), "todolist.json")
+			if ok := Save(ctx, file, fixture(size)); ok != nil {
+				b.Fatal(ok)
+			}
+			if info, ok := os.Stat(file); ok == nil {
+				b.SetBytes(info.Size())
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				if items, ok := Restore(ctx, file); ok != nil || len(items) != size {
+					b.Fatalf("restore failed %v with %d items", ok, len(items))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+// A task may be blocked by others, it cannot be started or completed until
+// they are completed. The links are kept on the blocked task and one that
+// would close a loop is refused. A blocker deleted since no longer blocks.
+
+// BlockedError is a state change refused as the task's blockers are not completed
+type BlockedError struct {
+	Task     int64
+	Blockers []int64
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("task %d is blocked by %s, complete them first or override", e.Task, joinLines(e.Blockers))
+}
+
+func joinLines(lines []int64) string {
+	parts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		parts = append(parts, strconv.FormatInt(line, 10))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type overrideKey struct{}
+
+// OverrideBlockers lets the state changes made with ctx start blocked tasks
+func OverrideBlockers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, overrideKey{}, true)
+}
+
+func overridden(ctx context.Context) bool {
+	on, _ := ctx.Value(overrideKey{}).(bool)
+	return on
+}
+
+// the blockers of item in the list not yet completed, or in done
+func openBlockers(items TodoListItems, item TodoListItem, done map[int64]bool) []int64 {
+	open := []int64{}
+	for _, line := range item.BlockedBy {
+		if blocker, found := items[line]; found && blocker.State != StateCompleted && !done[line] {
+			open = append(open, line)
+		}
+	}
+	return open
+}
+
+// OpenBlockers is the lines of the tasks still blocking item, each read on its own
+func OpenBlockers(item TodoListItem) ([]int64, error) {
+	open := []int64{}
+	for _, line := range item.BlockedBy {
+		record := readItem(line)
+		if record.err != nil {
+			return nil, record.err
+		} else if record.ok && record.item.State != StateCompleted {
+			open = append(open, line)
+		}
+	}
+	return open, nil
+}
+
+// checkBlockers refuses to move item on from not started while it is
+// blocked, the tasks in done count as completed. Only the blockers are read.
+func checkBlockers(ctx context.Context, item TodoListItem, state int, done map[int64]bool) error {
+	if state == item.State || state == StateNotStarted || len(item.BlockedBy) == 0 || overridden(ctx) {
+		return nil
+	}
+	open, err := OpenBlockers(item)
+	if err != nil {
+		return err
+	}
+	open = slices.DeleteFunc(open, func(line int64) bool { return done[line] })
+	if len(open) > 0 {
+		return &BlockedError{Task: item.Line, Blockers: open}
+	}
+	return nil
+}
+
+// the chain of blocking links from line to target, nil when there is none.
+// Only the tasks along the links are read.
+func blockingPath(line int64, target int64, seen map[int64]bool) ([]int64, error) {
+	if line == target {
+		return []int64{line}, nil
+	}
+	if seen[line] {
+		return nil, nil
+	}
+	seen[line] = true
+	record := readItem(line)
+	if record.err != nil {
+		return nil, record.err
+	}
+	for _, next := range record.item.BlockedBy {
+		if path, err := blockingPath(next, target, seen); err != nil || path != nil {
+			return append([]int64{line}, path...), err
+		}
+	}
+	return nil, nil
+}
+
+// blocker links and the state changes that check them are made one at a
+// time, each reading the task again under it. Two links added at once in
+// opposite directions cannot both pass the loop check, a task is not started
+// after a link to an open blocker went in, neither write drops the other's
+// change, and a recurring task completed twice at once hands on once.
+var blockerMutex sync.Mutex
+
+// AddBlocker records that index cannot start until blocker is completed
+func AddBlocker(ctx context.Context, index int64, blocker int64) error {
+	blockerMutex.Lock()
+	defer blockerMutex.Unlock()
+	if record := readItem(blocker); record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find blocker %d", blocker)
+	}
+	if path, err := blockingPath(blocker, index, map[int64]bool{}); err != nil {
+		return err
+	} else if path != nil {
+		return fmt.Errorf("task %d cannot be blocked by %d, that would make a loop %s -> %d", index, blocker, strings.ReplaceAll(joinLines(path), ", ", " -> "), blocker)
+	}
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find item %d", index)
+	}
+	if slices.Contains(record.item.BlockedBy, blocker) {
+		return nil
+	}
+	previous := record.item
+	record.item.BlockedBy = append(slices.Clone(record.item.BlockedBy), blocker)
+	touch(previous, &record.item)
+	if _, err := writeItem(record.item); err != nil {
+		return err
+	}
+	logging.Log().InfoContext(ctx, "Added blocker", "ID", index, "blocker", blocker)
+	return nil
+}
+
+// RemoveBlocker drops the link, index no longer waits for blocker
+func RemoveBlocker(ctx context.Context, index int64, blocker int64) error {
+	blockerMutex.Lock()
+	defer blockerMutex.Unlock()
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find item %d", index)
+	}
+	if !slices.Contains(record.item.BlockedBy, blocker) {
+		return fmt.Errorf("task %d is not blocked by %d", index, blocker)
+	}
+	previous := record.item
+	record.item.BlockedBy = slices.DeleteFunc(slices.Clone(record.item.BlockedBy), func(line int64) bool { return line == blocker })
+	touch(previous, &record.item)
+	if _, err := writeItem(record.item); err != nil {
+		return err
+	}
+	logging.Log().InfoContext(ctx, "Removed blocker", "ID", index, "blocker", blocker)
+	return nil
+}
+
+// BlockedTask is a task not completed and the blockers it is waiting on
+type BlockedTask struct {
+	Item     TodoListItem `json:"item"`
+	Blockers []int64      `json:"blockers"`
+}
+
+// Blocked is every task waiting on a blocker, in list order
+func Blocked() ([]BlockedTask, error) {
+	list, err := mergedList()
+	if err != nil {
+		return nil, err
+	}
+	blocked := []BlockedTask{}
+	for _, line := range Tree(list.Items()) {
+		if line.Item.State == StateCompleted {
+			continue
+		}
+		if open := openBlockers(list.Items(), line.Item, nil); len(open) > 0 {
+			blocked = append(blocked, BlockedTask{Item: line.Item, Blockers: open})
+		}
+	}
+	return blocked, nil
+}
+
+// orderByBlockers moves each task after the tasks blocking it, keeping the
+// order given where the links allow. The groups are the top level tasks,
+// under 0, and the subtasks of each parent. A link between tasks in
+// different groups orders the two tasks' ancestors that share a parent.
+func orderByBlockers(items TodoListItems, groups map[int64][]TodoListItem) {
+	// the line of each task's top level ancestor and down to the task
+	chains := map[int64][]int64{}
+	chain := func(line int64) []int64 {
+		if c, found := chains[line]; found {
+			return c
+		}
+		c := []int64{line}
+		seen := map[int64]bool{line: true}
+		for up := items[line].Parent; up != 0; up = items[up].Parent {
+			if _, found := items[up]; !found || seen[up] {
+				break
+			}
+			seen[up] = true
+			c = append(c, up)
+		}
+		slices.Reverse(c)
+		chains[line] = c
+		return c
+	}
+	// before[group][task] are the tasks in the group that go ahead of it
+	before := map[int64]map[int64][]int64{}
+	for line, item := range items {
+		for _, blocker := range item.BlockedBy {
+			if _, found := items[blocker]; !found {
+				continue
+			}
+			a, b := chain(line), chain(blocker)
+			i := 0
+			for i < len(a) && i < len(b) && a[i] == b[i] {
+				i++
+			}
+			if i == len(a) || i == len(b) {
+				// one is inside the other, the tree already orders them
+				continue
+			}
+			var group int64
+			if i > 0 {
+				group = a[i-1]
+			}
+			if before[group] == nil {
+				before[group] = map[int64][]int64{}
+			}
+			before[group][a[i]] = append(before[group][a[i]], b[i])
+		}
+	}
+	for group, links := range before {
+		members := groups[group]
+		position := make(map[int64]int, len(members))
+		for i, item := range members {
+			position[item.Line] = i
+		}
+		ordered := make([]TodoListItem, 0, len(members))
+		placed := make(map[int64]bool, len(members))
+		var place func(item TodoListItem)
+		place = func(item TodoListItem) {
+			// marked before its blockers so a loop left by a merge ends here
+			if placed[item.Line] {
+				return
+			}
+			placed[item.Line] = true
+			ahead := slices.Clone(links[item.Line])
+			slices.SortFunc(ahead, func(x int64, y int64) int { return position[x] - position[y] })
+			for _, line := range ahead {
+				if i, found := position[line]; found {
+					place(members[i])
+				}
+			}
+			ordered = append(ordered, item)
+		}
+		for _, item := range members {
+			place(item)
+		}
+		groups[group] = ordered
+	}
+}
+
+// blocked tasks report, each with the tasks it is waiting on
+func ListBlocked() {
+	blocked, err := Blocked()
+	if err != nil {
+		fmt.Printf("\nCannot read the list: %v\n", err)
+		return
+	}
+	fmt.Printf("\nBlocked tasks:%d\n", len(blocked))
+	listTaskHeader()
+	for _, b := range blocked {
+		listTaskLine(TreeLine{Item: b.Item, Blockers: b.Blockers})
+	}
+}
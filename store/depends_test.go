@@ -0,0 +1,131 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBlockers(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	base, _ := AddTask(ctx, "Pour the base")
+	walls, _ := AddTask(ctx, "Build the walls")
+	roof, _ := AddTask(ctx, "Fit the roof")
+
+	if ok := AddBlocker(ctx, walls, base); ok != nil {
+		t.Fatal(ok)
+	}
+	if ok := AddBlocker(ctx, roof, walls); ok != nil {
+		t.Fatal(ok)
+	}
+	for _, tc := range []struct{ task, blocker int64 }{{base, roof}, {base, base}, {walls, 999}} {
+		if ok := AddBlocker(ctx, tc.task, tc.blocker); ok == nil {
+			t.Errorf("%d blocked by %d was taken", tc.task, tc.blocker)
+		}
+	}
+
+	var blocked *BlockedError
+	if ok := StateChange(ctx, roof, StateStarted); !errors.As(ok, &blocked) || len(blocked.Blockers) != 1 || blocked.Blockers[0] != walls {
+		t.Errorf("starting a blocked task wanted a BlockedError got %v", ok)
+	}
+	if _, ok := UpdateTask(ctx, TodoListItem{Line: walls, Description: "Build the walls", State: StateCompleted}); !errors.As(ok, &blocked) {
+		t.Errorf("completing a blocked task by update wanted a BlockedError got %v", ok)
+	}
+	if _, ok := UpdateTask(ctx, TodoListItem{Line: walls, Description: "Build the brick walls"}); ok != nil {
+		t.Errorf("an edit leaving the state alone was refused %v", ok)
+	}
+	if got, ok := Blocked(); ok != nil || len(got) != 2 || got[0].Item.Line != walls || got[1].Item.Line != roof {
+		t.Errorf("blocked wanted walls then roof got %+v", got)
+	}
+
+	if ok := StateChange(ctx, base, StateCompleted); ok != nil {
+		t.Fatal(ok)
+	}
+	if ok := StateChange(ctx, walls, StateStarted); ok != nil {
+		t.Errorf("walls are free once the base is done %v", ok)
+	}
+	if ok := StateChange(OverrideBlockers(ctx), roof, StateStarted); ok != nil {
+		t.Errorf("override was refused %v", ok)
+	}
+	if ok := RemoveBlocker(ctx, roof, walls); ok != nil {
+		t.Fatal(ok)
+	}
+	if got, ok := Blocked(); ok != nil || len(got) != 0 {
+		t.Errorf("nothing should be blocked got %+v", got)
+	}
+}
+
+// links added at once in opposite directions never both pass the loop check
+func TestAddBlockerRace(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	defer resetList()
+	for range 50 {
+		a, _ := AddTask(ctx, "Build the walls")
+		b, _ := AddTask(ctx, "Fit the roof")
+		var taken atomic.Int32
+		var wg sync.WaitGroup
+		for _, link := range [][2]int64{{a, b}, {b, a}} {
+			wg.Go(func() {
+				if AddBlocker(ctx, link[0], link[1]) == nil {
+					taken.Add(1)
+				}
+			})
+		}
+		wg.Wait()
+		if taken.Load() != 1 {
+			t.Fatalf("wanted one of the two links taken got %d", taken.Load())
+		}
+	}
+}
+
+// a task started while a blocker is linked to it is either refused or
+// started before the link, and neither change is lost
+func TestStateChangeBlockerRace(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	defer resetList()
+	for range 50 {
+		base, _ := AddTask(ctx, "Pour the base")
+		walls, _ := AddTask(ctx, "Build the walls")
+		var started, linked error
+		var wg sync.WaitGroup
+		wg.Go(func() { started = StateChange(ctx, walls, StateStarted) })
+		wg.Go(func() { linked = AddBlocker(ctx, walls, base) })
+		wg.Wait()
+		item, ok := GetByIndex(walls)
+		if ok != nil || linked != nil {
+			t.Fatal(ok, linked)
+		}
+		if !slices.Contains(item.BlockedBy, base) {
+			t.Fatalf("the blocker link was lost %+v", item)
+		}
+		if (started == nil) != (item.State == StateStarted) {
+			t.Fatalf("start returned %v but the task is %s", started, StatusName[item.State])
+		}
+	}
+}
+
+func TestOrderByBlockers(t *testing.T) {
+	items := TodoListItems{
+		1: {Line: 1, BlockedBy: []int64{3}},
+		2: {Line: 2},
+		3: {Line: 3, BlockedBy: []int64{5}},
+		4: {Line: 4, Parent: 2, Rank: 1, BlockedBy: []int64{6}},
+		5: {Line: 5},
+		6: {Line: 6, Parent: 2, Rank: 2},
+		7: {Line: 7, Parent: 2, Rank: 3, BlockedBy: []int64{1}}, // orders 2 after 1 at the top
+		8: {Line: 8, BlockedBy: []int64{9}},                     // a loop left by a merge
+		9: {Line: 9, BlockedBy: []int64{8}},
+	}
+	want := "5:0:0/0 3:0:0/0 1:0:0/0 2:0:0/3 6:1:0/0 4:1:0/0 7:1:0/0 9:0:0/0 8:0:0/0"
+	if got := treeString(Tree(items)); got != want {
+		t.Errorf("wanted %s\ngot    %s", want, got)
+	}
+}
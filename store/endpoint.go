@@ -2,53 +2,190 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
+
+	"github.com/anthriscus/appcli/logging"
 )
 
-// get by taskid
+// ErrNotFound is a task that is not in the list, told apart from a list or
+// store server that could not be read
+var ErrNotFound = errors.New("item not found")
+
+// get by taskid, from the shard's published snapshot when it is current,
+// otherwise one read from the shard actor rather than copying the shard
 func GetByIndex(taskId int64) (TodoListItem, error) {
-	if item, ok := sessionDatabase[taskId]; !ok {
-		empty := TodoListItem{}
-		return empty, fmt.Errorf("item not found")
+	var item TodoListItem
+	var ok bool
+	if p := localSnapshot(taskId); p != nil {
+		item, ok = p.get(taskId)
 	} else {
-		return item, nil
+		record := readItem(taskId)
+		if record.err != nil {
+			return TodoListItem{}, record.err
+		}
+		item, ok = record.item, record.ok
+	}
+	if !ok {
+		return TodoListItem{}, ErrNotFound
 	}
+	return item, nil
 }
 
-// list items
-func GetList() (TodoListItems, error) {
-	items := TodoListItems{}
-	keys := storeActor.Keys()
-	for _, v := range keys {
-		record := storeActor.Read(v)
-		if record.ok {
-			items[v] = record.item
-		}
+// list items, the list is shared with other readers so treat it as read only
+func GetList() (List, error) {
+	m, err := mergedList()
+	return List{m: m}, err
+}
+
+// Scan is every item in line order
+func Scan() (iter.Seq[TodoListItem], error) {
+	m, err := mergedList()
+	if err != nil {
+		return nil, err
 	}
-	return items, nil
+	return m.All(), nil
+}
+
+// number of items in the list
+func Count() int {
+	if backend != nil {
+		return remoteCount()
+	}
+	var n int64
+	for _, s := range shards {
+		n += s.size.Load()
+	}
+	return int(n)
 }
 
 func Create(ctx context.Context, candidate TodoListItem) (TodoListItem, error) {
-	if taskId, ok := AddTask(ctx, candidate.Description); ok != nil {
+	if taskId, ok := AddTaskWithTags(ctx, candidate.Description, candidate.Tags); ok != nil {
 		empty := TodoListItem{}
-		return empty, fmt.Errorf("not added")
+		return empty, fmt.Errorf("not added: %w", ok)
 	} else {
-		record := storeActor.Read(taskId)
+		record := readItem(taskId)
 		if record.ok {
 			return record.item, nil
 		}
+		if record.err != nil {
+			return TodoListItem{}, record.err
+		}
 		empty := TodoListItem{}
 		return empty, fmt.Errorf("not added")
 	}
 }
 
 func Update(ctx context.Context, item TodoListItem) (TodoListItem, error) {
-	record := storeActor.Read(item.Line)
+	record := readItem(item.Line)
 	if record.ok {
 		return UpdateTask(ctx, item)
 	}
-	empty := TodoListItem{}
-	return empty, fmt.Errorf("item not found")
+	if record.err != nil {
+		return TodoListItem{}, record.err
+	}
+	return TodoListItem{}, ErrNotFound
+}
+
+// Put writes the item as given, adding or replacing it, true when it replaced one.
+// The store server takes items this way as ids are made by the front end routing them.
+func Put(ctx context.Context, item TodoListItem) (bool, error) {
+	if item.Line == 0 {
+		return false, fmt.Errorf("item has no line")
+	}
+	if !isDescription(item.Description) {
+		return false, fmt.Errorf("description cannot be empty")
+	}
+	found, err := writeItem(item)
+	if err != nil {
+		return false, err
+	}
+	logging.Log().DebugContext(ctx, "Put item", "ID", item.Line, "replaced", found)
+	return found, nil
+}
+
+// ErrVersionConflict is a conditional write that found another version of
+// the item than the one it was made against
+var ErrVersionConflict = errors.New("the item has changed since the version given")
+
+// Expected is the item a conditional write may replace, one at this version
+// or none at all
+type Expected struct {
+	Found   bool
+	Version int64
+}
+
+func (e Expected) matches(item TodoListItem, found bool) bool {
+	return e.Found == found && (!found || item.Version == e.Version)
+}
+
+// VersionBackend is a Backend that can write an item only over the version
+// expected, checked where the item is kept
+type VersionBackend interface {
+	PutIf(ctx context.Context, item TodoListItem, expect Expected) (bool, error)
+}
+
+// PutIf is Put only when the item there now is as expected, otherwise
+// ErrVersionConflict and nothing is written. A sync push uses it so a client
+// holding an old version does not write over a newer change.
+func PutIf(ctx context.Context, item TodoListItem, expect Expected) (bool, error) {
+	if item.Line == 0 {
+		return false, fmt.Errorf("item has no line")
+	}
+	if !isDescription(item.Description) {
+		return false, fmt.Errorf("description cannot be empty")
+	}
+	if readOnly.Load() {
+		return false, ErrReadOnly
+	}
+	var found bool
+	switch b, ok := backend.(VersionBackend); {
+	case backend == nil:
+		record := shardFor(item.Line).actor.WriteIf(TodoListRecord{item: item}, expect)
+		if record.err != nil {
+			return record.ok, record.err
+		}
+		found = record.ok
+	case ok:
+		ctx, cancel := backendContext()
+		defer cancel()
+		var err error
+		if found, err = b.PutIf(ctx, item, expect); err != nil {
+			return found, err
+		}
+		if found {
+			publish(ChangeUpdated, item)
+		} else {
+			publish(ChangeCreated, item)
+		}
+	default:
+		// a backend that cannot check the version, checked here instead
+		record := readItem(item.Line)
+		if record.err != nil {
+			return false, record.err
+		} else if !expect.matches(record.item, record.ok) {
+			return record.ok, ErrVersionConflict
+		}
+		var err error
+		if found, err = putItem(item); err != nil {
+			return found, err
+		}
+	}
+	logging.Log().DebugContext(ctx, "Put item", "ID", item.Line, "replaced", found, "version", item.Version)
+	return found, nil
+}
+
+// Remove deletes the item and returns it as it was, for the store server
+func Remove(ctx context.Context, taskId int64) (TodoListItem, error) {
+	record, err := removeItem(taskId)
+	if err != nil {
+		return TodoListItem{}, err
+	} else if !record.ok {
+		return TodoListItem{}, ErrNotFound
+	}
+	logging.Log().DebugContext(ctx, "Removed item", "ID", taskId)
+	return record.item, nil
 }
 
 func Delete(ctx context.Context, taskId int64) error {
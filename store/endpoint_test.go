@@ -102,16 +102,14 @@ func TestGetList(t *testing.T) {
 			}
 			if r, ok := GetList(); tc.want != (ok == nil) {
 				t.Errorf("items %d not fetched\n", tc.item)
-			} else if tc.want != (r != nil) {
-				t.Errorf("items %d not fetched\n", tc.item)
-			} else if tc.want != (len(r) > 0) {
+			} else if tc.want != (r.Len() > 0) {
 				t.Errorf("items %d not fetched\n", tc.item)
 			}
 		case !tc.addToList:
 			resetList()
 			if r, ok := GetList(); tc.want != (ok == nil) {
 				t.Errorf("items %d not fetched\n", tc.item)
-			} else if tc.want != (len(r) == 0) {
+			} else if tc.want != (r.Len() == 0) {
 				t.Errorf("items %d not fetched\n", tc.item)
 			}
 		}
@@ -255,3 +253,36 @@ func TestDelete(t *testing.T) {
 		}
 	}
 }
+
+// readers share one copy until a write, a copy already handed out never changes
+func TestGetListSnapshot(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+
+	first, _ := AddTask(ctx, "Original task description buy apples")
+	before, _ := GetList()
+	again, _ := GetList()
+	if before.Len() != 1 || again.Len() != 1 {
+		t.Fatalf("wanted 1 item got %d and %d", before.Len(), again.Len())
+	}
+	if before.m != again.m {
+		t.Errorf("unchanged list should not be copied again")
+	}
+
+	second, _ := AddTask(ctx, "Second task description buy pears")
+	DeleteTask(ctx, first)
+	after, _ := GetList()
+	if _, found := after.Get(second); !found || after.Len() != 1 {
+		t.Errorf("list after writes wanted only %d got %v", second, after.Items())
+	}
+	if _, found := before.Get(first); !found || before.Len() != 1 {
+		t.Errorf("earlier copy changed by later writes %v", before.Items())
+	}
+	if got := Count(); got != 1 {
+		t.Errorf("count wanted 1 got %d", got)
+	}
+	if _, ok := GetByIndex(first); ok == nil {
+		t.Errorf("deleted item still fetched")
+	}
+}
@@ -0,0 +1,355 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+// Copies of the list made on different machines merge without conflicts.
+// Each field of an item is a last writer wins register stamped with a hybrid
+// logical clock, the newest stamp wins and equal stamps fall back to the
+// larger value so every copy picks the same one. A delete keeps the item as
+// a tombstone stamped with when it was deleted, it beats the fields written
+// before it and loses to a field changed after it.
+
+// HLC is a hybrid logical clock: the wall time, and a counter ordering the
+// events that share a wall time or happen while the wall clock is behind
+type HLC struct {
+	Wall    int64 // unix nanoseconds
+	Logical uint32
+}
+
+func (h HLC) Compare(o HLC) int {
+	if c := cmp.Compare(h.Wall, o.Wall); c != 0 {
+		return c
+	}
+	return cmp.Compare(h.Logical, o.Logical)
+}
+
+func (h HLC) IsZero() bool {
+	return h == HLC{}
+}
+
+func (h HLC) String() string {
+	return fmt.Sprintf("%d-%d", h.Wall, h.Logical)
+}
+
+// written to the file as wall-logical
+func (h HLC) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *HLC) UnmarshalText(text []byte) error {
+	wall, logical, found := strings.Cut(string(text), "-")
+	w, ok := strconv.ParseInt(wall, 10, 64)
+	if !found || ok != nil {
+		return fmt.Errorf("bad clock %q", text)
+	}
+	l, ok := strconv.ParseUint(logical, 10, 32)
+	if ok != nil {
+		return fmt.Errorf("bad clock %q", text)
+	}
+	*h = HLC{Wall: w, Logical: uint32(l)}
+	return nil
+}
+
+// FieldClocks stamps the fields of an item that can change
+type FieldClocks struct {
+	Description HLC `json:"description,omitzero"`
+	State       HLC `json:"state,omitzero"`
+	Tags        HLC `json:"tags,omitzero"`
+	Priority    HLC `json:"priority,omitzero"`
+	Due         HLC `json:"due,omitzero"`
+	Parent      HLC `json:"parent,omitzero"` // the parent and rank move together
+	Checklist   HLC `json:"checklist,omitzero"`
+	BlockedBy   HLC `json:"blockedBy,omitzero"`
+	Recur       HLC `json:"recur,omitzero"`
+}
+
+// the clock of this process, never behind a clock it has seen
+var clock struct {
+	sync.Mutex
+	last HLC
+}
+
+// tick is the clock for an event now, later than every one before
+func tick() HLC {
+	clock.Lock()
+	defer clock.Unlock()
+	if wall := time.Now().UnixNano(); wall > clock.last.Wall {
+		clock.last = HLC{Wall: wall}
+	} else {
+		clock.last.Logical++
+	}
+	return clock.last
+}
+
+// observe moves the clock past one seen in another copy of the list,
+// so a change made here after a merge beats what was merged
+func observe(h HLC) {
+	clock.Lock()
+	defer clock.Unlock()
+	if h.Compare(clock.last) > 0 {
+		clock.last = h
+	}
+}
+
+func observeItems(items TodoListItems) {
+	for _, item := range items {
+		observe(item.Deleted)
+		observe(item.Clocks.Description)
+		observe(item.Clocks.State)
+		observe(item.Clocks.Tags)
+		observe(item.Clocks.Priority)
+		observe(item.Clocks.Due)
+		observe(item.Clocks.Parent)
+		observe(item.Clocks.Checklist)
+		observe(item.Clocks.BlockedBy)
+		observe(item.Clocks.Recur)
+	}
+}
+
+// withClocks stamps fields written before there were clocks with the time
+// the item last changed
+func withClocks(item TodoListItem) TodoListItem {
+	when := item.Updated
+	if when.IsZero() {
+		when = item.Created
+	}
+	legacy := HLC{Wall: when.UnixNano()}
+	for _, c := range []*HLC{&item.Clocks.Description, &item.Clocks.State, &item.Clocks.Tags, &item.Clocks.Priority, &item.Clocks.Due, &item.Clocks.Parent, &item.Clocks.Checklist, &item.Clocks.BlockedBy, &item.Clocks.Recur} {
+		if c.IsZero() {
+			*c = legacy
+		}
+	}
+	return item
+}
+
+// the newest field clock
+func (item TodoListItem) lastWrite() HLC {
+	clocks := withClocks(item).Clocks
+	last := clocks.Description
+	for _, c := range []HLC{clocks.State, clocks.Tags, clocks.Priority, clocks.Due, clocks.Parent, clocks.Checklist, clocks.BlockedBy, clocks.Recur} {
+		if c.Compare(last) > 0 {
+			last = c
+		}
+	}
+	return last
+}
+
+// Tombstone is a deleted item, deleted after its fields were last written
+func (item TodoListItem) Tombstone() bool {
+	return !item.Deleted.IsZero() && item.Deleted.Compare(item.lastWrite()) >= 0
+}
+
+// Merge is the list holding the changes of both a and b. It is commutative,
+// associative and idempotent so copies merged in any order and any number of
+// times agree. Deleted items stay in the result as tombstones.
+func Merge(a TodoListItems, b TodoListItems) TodoListItems {
+	merged := make(TodoListItems, max(len(a), len(b)))
+	for id, item := range a {
+		merged[id] = withClocks(item)
+	}
+	for id, item := range b {
+		if have, found := merged[id]; found {
+			merged[id] = mergeItem(have, withClocks(item))
+		} else {
+			merged[id] = withClocks(item)
+		}
+	}
+	return merged
+}
+
+// the fields of a and b one by one, both with clocks
+func mergeItem(a TodoListItem, b TodoListItem) TodoListItem {
+	m := a
+	m.Description, m.Clocks.Description = lww(a.Description, a.Clocks.Description, b.Description, b.Clocks.Description, strings.Compare)
+	m.State, m.Clocks.State = lww(a.State, a.Clocks.State, b.State, b.Clocks.State, cmp.Compare[int])
+	m.Tags, m.Clocks.Tags = lww(a.Tags, a.Clocks.Tags, b.Tags, b.Clocks.Tags, slices.Compare[[]string])
+	m.Priority, m.Clocks.Priority = lww(a.Priority, a.Clocks.Priority, b.Priority, b.Clocks.Priority, strings.Compare)
+	m.Due, m.Clocks.Due = lww(a.Due, a.Clocks.Due, b.Due, b.Clocks.Due, time.Time.Compare)
+	var place placement
+	place, m.Clocks.Parent = lww(a.placement(), a.Clocks.Parent, b.placement(), b.Clocks.Parent, comparePlacement)
+	m.Parent, m.Rank = place.parent, place.rank
+	m.Checklist, m.Clocks.Checklist = lww(a.Checklist, a.Clocks.Checklist, b.Checklist, b.Clocks.Checklist, compareChecklist)
+	m.BlockedBy, m.Clocks.BlockedBy = lww(a.BlockedBy, a.Clocks.BlockedBy, b.BlockedBy, b.Clocks.BlockedBy, slices.Compare[[]int64])
+	m.Recur, m.Clocks.Recur = lww(a.Recur, a.Clocks.Recur, b.Recur, b.Clocks.Recur, strings.Compare)
+	if b.Deleted.Compare(a.Deleted) > 0 {
+		m.Deleted = b.Deleted
+	}
+	// the rest only ever grow or are fixed when the item is made
+	m.Version = max(a.Version, b.Version)
+	m.Series = max(a.Series, b.Series)
+	if b.Updated.After(a.Updated) {
+		m.Updated = b.Updated
+	}
+	if b.Created.Before(a.Created) {
+		m.Created = b.Created
+	}
+	m.Id = min(a.Id, b.Id)
+	return m
+}
+
+// lww is the register with the newer clock, the larger value on a tie
+func lww[T any](a T, ac HLC, b T, bc HLC, compare func(T, T) int) (T, HLC) {
+	if c := ac.Compare(bc); c > 0 || c == 0 && compare(a, b) >= 0 {
+		return a, ac
+	}
+	return b, bc
+}
+
+// where the item sits in the tree, one register so a move is never half merged
+type placement struct {
+	parent int64
+	rank   int64
+}
+
+func (item TodoListItem) placement() placement {
+	return placement{parent: item.Parent, rank: item.Rank}
+}
+
+func comparePlacement(a placement, b placement) int {
+	if c := cmp.Compare(a.parent, b.parent); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.rank, b.rank)
+}
+
+func compareChecklist(a []CheckItem, b []CheckItem) int {
+	return slices.CompareFunc(a, b, func(x CheckItem, y CheckItem) int {
+		if c := strings.Compare(x.Text, y.Text); c != 0 {
+			return c
+		}
+		return cmp.Compare(btoi(x.Done), btoi(y.Done))
+	})
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// the deleted items of the open list, saved with the list so a merge with
+// an older copy does not bring them back
+var tombstones struct {
+	sync.Mutex
+	items TodoListItems
+}
+
+func setTombstones(items TodoListItems) {
+	tombstones.Lock()
+	defer tombstones.Unlock()
+	tombstones.items = items
+}
+
+// Tombstones is a copy of the deleted items kept for merging
+func Tombstones() TodoListItems {
+	tombstones.Lock()
+	defer tombstones.Unlock()
+	return maps.Clone(tombstones.items)
+}
+
+// bury keeps a deleted item as a tombstone, stamped now
+func bury(item TodoListItem) {
+	item = withClocks(item)
+	observe(item.lastWrite())
+	item.Deleted = tick()
+	tombstones.Lock()
+	defer tombstones.Unlock()
+	if tombstones.items == nil {
+		tombstones.items = TodoListItems{}
+	}
+	tombstones.items[item.Line] = item
+}
+
+// splitTombstones parts a file's items into the live list and the tombstones
+func splitTombstones(items TodoListItems) (TodoListItems, TodoListItems) {
+	live := make(TodoListItems, len(items))
+	dead := TodoListItems{}
+	for id, item := range items {
+		if item.Tombstone() {
+			dead[id] = item
+		} else {
+			live[id] = item
+		}
+	}
+	return live, dead
+}
+
+// withTombstones is the list as saved, the tombstones of items not in it added
+func withTombstones(list TodoListItems) TodoListItems {
+	tombstones.Lock()
+	defer tombstones.Unlock()
+	if len(tombstones.items) == 0 {
+		return list
+	}
+	all := maps.Clone(list)
+	for id, item := range tombstones.items {
+		if _, found := all[id]; !found {
+			all[id] = item
+		}
+	}
+	return all
+}
+
+// MergeReport counts what a merge changed in the open list
+type MergeReport struct {
+	Added   int
+	Updated int
+	Deleted int
+}
+
+// MergeList folds another copy of the list, tombstones and all, into the
+// open one. Nothing else should write while it runs.
+func MergeList(ctx context.Context, other TodoListItems) (MergeReport, error) {
+	var report MergeReport
+	if Remote() {
+		return report, errors.New("the list is kept by store servers, merge needs the local list")
+	}
+	observeItems(other)
+	live := localList().Items()
+	merged := Merge(withTombstones(live), other)
+	dead := TodoListItems{}
+	for id, item := range merged {
+		have, found := live[id]
+		switch {
+		case item.Tombstone():
+			dead[id] = item
+			if found {
+				if _, err := removeItem(id); err != nil {
+					return report, err
+				}
+				report.Deleted++
+			}
+		case !found:
+			if _, err := writeItem(item); err != nil {
+				return report, err
+			}
+			report.Added++
+		case !sameItem(have, item):
+			if _, err := writeItem(item); err != nil {
+				return report, err
+			}
+			report.Updated++
+		}
+	}
+	if before := Tombstones(); !maps.EqualFunc(before, dead, sameItem) {
+		// new tombstones alone still need saving
+		setTombstones(dead)
+		markChanged()
+	}
+	logging.Log().InfoContext(ctx, "Merged list", "items", len(other), "added", report.Added, "updated", report.Updated, "deleted", report.Deleted)
+	return report, nil
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"maps"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// a random copy of a small list, the same ids edited and deleted at random clocks
+func randomCopy(r *rand.Rand) TodoListItems {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	items := TodoListItems{}
+	for id := int64(1); id <= 6; id++ {
+		if r.Intn(4) == 0 {
+			continue
+		}
+		at := func() HLC { return HLC{Wall: int64(r.Intn(5)), Logical: uint32(r.Intn(2))} }
+		item := TodoListItem{
+			Line:        id,
+			Id:          id,
+			Created:     created,
+			Description: []string{"apples", "pears", "plums"}[r.Intn(3)],
+			State:       r.Intn(3),
+			Tags:        [][]string{nil, {"home"}, {"home", "garden"}}[r.Intn(3)],
+			Priority:    []string{"", "A", "B"}[r.Intn(3)],
+			Due:         []time.Time{{}, created, created.AddDate(0, 0, 7)}[r.Intn(3)],
+			Parent:      int64(r.Intn(3)),
+			Rank:        int64(r.Intn(2)),
+			Checklist:   [][]CheckItem{nil, {{Text: "step"}}, {{Text: "step", Done: true}}}[r.Intn(3)],
+			BlockedBy:   [][]int64{nil, {1}, {2, 3}}[r.Intn(3)],
+			Recur:       []string{"", "FREQ=DAILY", "FREQ=WEEKLY;BYDAY=MO"}[r.Intn(3)],
+			Series:      int64(r.Intn(2)),
+			Version:     int64(r.Intn(4)),
+			Clocks:      FieldClocks{Description: at(), State: at(), Tags: at(), Priority: at(), Due: at(), Parent: at(), Checklist: at(), BlockedBy: at(), Recur: at()},
+		}
+		if r.Intn(3) == 0 {
+			item.Deleted = at()
+		}
+		items[id] = item
+	}
+	return items
+}
+
+func sameList(a TodoListItems, b TodoListItems) bool {
+	return maps.EqualFunc(a, b, sameItem)
+}
+
+func TestMergeProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(44))
+	for i := range 500 {
+		a, b, c := randomCopy(r), randomCopy(r), randomCopy(r)
+		if !sameList(Merge(a, b), Merge(b, a)) {
+			t.Fatalf("run %d: merge is not commutative\na %v\nb %v", i, a, b)
+		}
+		if !sameList(Merge(Merge(a, b), c), Merge(a, Merge(b, c))) {
+			t.Fatalf("run %d: merge is not associative\na %v\nb %v\nc %v", i, a, b, c)
+		}
+		if ab := Merge(a, b); !sameList(Merge(ab, ab), ab) || !sameList(Merge(ab, a), ab) {
+			t.Fatalf("run %d: merge is not idempotent\na %v\nb %v", i, a, b)
+		}
+	}
+}
+
+func TestMergeItem(t *testing.T) {
+	base := TodoListItem{Line: 1, Id: 1, Description: "buy apples", Clocks: FieldClocks{Description: HLC{Wall: 10}, State: HLC{Wall: 10}, Tags: HLC{Wall: 10}}}
+	edit := func(description string, wall int64) TodoListItem {
+		item := base
+		item.Description, item.Clocks.Description = description, HLC{Wall: wall}
+		return item
+	}
+	complete := func(wall int64) TodoListItem {
+		item := base
+		item.State, item.Clocks.State = StateCompleted, HLC{Wall: wall}
+		return item
+	}
+	deleted := func(wall int64) TodoListItem {
+		item := base
+		item.Deleted = HLC{Wall: wall}
+		return item
+	}
+	var tests = []struct {
+		name        string
+		a, b        TodoListItem
+		description string
+		state       int
+		tombstone   bool
+	}{
+		{name: "newer description wins", a: edit("buy pears", 20), b: edit("buy plums", 30), description: "buy plums"},
+		{name: "fields merge apart", a: edit("buy pears", 20), b: complete(30), description: "buy pears", state: StateCompleted},
+		{name: "tie goes to the larger value", a: edit("buy pears", 20), b: edit("buy plums", 20), description: "buy plums"},
+		{name: "delete beats an older edit", a: edit("buy pears", 20), b: deleted(40), description: "buy pears", tombstone: true},
+		{name: "a newer edit brings it back", a: edit("buy pears", 50), b: deleted(40), description: "buy pears"},
+	}
+	for _, tc := range tests {
+		got := Merge(TodoListItems{1: tc.a}, TodoListItems{1: tc.b})[1]
+		if got.Description != tc.description || got.Tombstone() != tc.tombstone {
+			t.Errorf("%s: wanted %q tombstone %t got %q tombstone %t", tc.name, tc.description, tc.tombstone, got.Description, got.Tombstone())
+		}
+		if tc.state != 0 && got.State != tc.state {
+			t.Errorf("%s: wanted state %d got %d", tc.name, tc.state, got.State)
+		}
+	}
+}
+
+func TestMergeList(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	defer resetList()
+	kept, _ := AddTask(ctx, "kept")
+	gone, _ := AddTask(ctx, "gone")
+	list, _ := GetList()
+	older := maps.Clone(list.Items())
+
+	// edited and deleted here after the other copy was taken
+	DescriptionChange(ctx, kept, "kept and edited")
+	DeleteTask(ctx, gone)
+	// the other copy gained an item and changed the state of the kept one
+	theirs := older[kept]
+	theirs.State = StateCompleted
+	theirs.Clocks.State = tick()
+	older[kept] = theirs
+	added := newTodoListItem("theirs", StateNotStarted)
+	older[added.Line] = added
+
+	report, ok := MergeList(ctx, older)
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	if report != (MergeReport{Added: 1, Updated: 1}) {
+		t.Errorf("unexpected report %+v", report)
+	}
+	got, _ := GetByIndex(kept)
+	if got.Description != "kept and edited" || got.State != StateCompleted {
+		t.Errorf("wanted both edits got %+v", got)
+	}
+	if _, ok := GetByIndex(gone); ok == nil {
+		t.Errorf("merging an older copy brought back a deleted item")
+	}
+
+	// the tombstone is saved with the list and stays out of it when opened
+	file := filepath.Join(t.TempDir(), "todolist.json")
+	if ok := SaveSession(ctx, file); ok != nil {
+		t.Fatal(ok)
+	}
+	saved, _ := Restore(ctx, file)
+	if !saved[gone].Tombstone() || len(saved) != 3 {
+		t.Errorf("wanted 2 items and a tombstone saved got %v", saved)
+	}
+	live, dead := splitTombstones(saved)
+	if len(live) != 2 || len(dead) != 1 {
+		t.Errorf("wanted 2 live and 1 dead got %d and %d", len(live), len(dead))
+	}
+}
@@ -0,0 +1,459 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+// A recurring task holds a rule, a subset of RFC 5545 RRULE: FREQ of DAILY,
+// WEEKLY, MONTHLY or YEARLY with INTERVAL, BYDAY for weekly rules,
+// BYMONTHDAY for monthly ones or one day for yearly ones, COUNT and UNTIL. Completing an occurrence
+// hands the rule on to a new task due on the next date, the completed one
+// stays in the list as the history of the series.
+
+// Recurrence is a parsed rule, COUNT is the occurrences left including this one
+type Recurrence struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int // days of the month, -1 is the last
+	Count      int
+	Until      time.Time
+}
+
+var rruleDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+const untilLayout = "20060102"
+
+// ParseRecurrence reads a rule as RRULE text, FREQ=WEEKLY;BYDAY=MO,TH, or
+// written out: daily, weekdays, weekly on mon,thu, monthly on 15, yearly,
+// every 2 weeks
+func ParseRecurrence(value string) (Recurrence, error) {
+	text := strings.TrimSpace(value)
+	upper := strings.ToUpper(strings.TrimPrefix(strings.ToUpper(text), "RRULE:"))
+	if strings.HasPrefix(upper, "FREQ=") {
+		return parseRrule(upper)
+	}
+	r, err := parseWords(strings.Fields(strings.ToLower(text)))
+	if err != nil {
+		return Recurrence{}, fmt.Errorf("cannot read repeat %q, %w", value, err)
+	}
+	return r, nil
+}
+
+func parseRrule(text string) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+	for part := range strings.SplitSeq(text, ";") {
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "FREQ":
+			r.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Recurrence{}, fmt.Errorf("interval %q is not a positive whole number", value)
+			}
+			r.Interval = n
+		case "BYDAY":
+			for day := range strings.SplitSeq(value, ",") {
+				d, found := rruleDays[day]
+				if !found {
+					return Recurrence{}, fmt.Errorf("day %q is not one of MO to SU", day)
+				}
+				if !slices.Contains(r.ByDay, d) {
+					r.ByDay = append(r.ByDay, d)
+				}
+			}
+		case "BYMONTHDAY":
+			for day := range strings.SplitSeq(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -1 || n > 31 {
+					return Recurrence{}, fmt.Errorf("day of the month %q is not 1 to 31 or -1", day)
+				}
+				if !slices.Contains(r.ByMonthDay, n) {
+					r.ByMonthDay = append(r.ByMonthDay, n)
+				}
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Recurrence{}, fmt.Errorf("count %q is not a positive whole number", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, err := time.Parse(untilLayout, value[:min(len(value), len(untilLayout))])
+			if err != nil {
+				return Recurrence{}, fmt.Errorf("until %q is not a date", value)
+			}
+			r.Until = until
+		default:
+			return Recurrence{}, fmt.Errorf("rule part %q is not supported", name)
+		}
+	}
+	switch {
+	case !slices.Contains([]string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}, r.Freq):
+		return Recurrence{}, fmt.Errorf("frequency %q is not daily, weekly, monthly or yearly", r.Freq)
+	case len(r.ByDay) > 0 && r.Freq != "WEEKLY":
+		return Recurrence{}, fmt.Errorf("days of the week need a weekly rule")
+	case len(r.ByMonthDay) > 1 && r.Freq == "YEARLY":
+		return Recurrence{}, fmt.Errorf("a yearly rule takes one day of the month")
+	case len(r.ByMonthDay) > 0 && r.Freq != "MONTHLY" && r.Freq != "YEARLY":
+		return Recurrence{}, fmt.Errorf("days of the month need a monthly or yearly rule")
+	}
+	slices.Sort(r.ByDay)
+	slices.Sort(r.ByMonthDay)
+	return r, nil
+}
+
+var wordFreq = map[string]string{
+	"daily": "DAILY", "weekly": "WEEKLY", "monthly": "MONTHLY", "yearly": "YEARLY",
+	"day": "DAILY", "days": "DAILY", "week": "WEEKLY", "weeks": "WEEKLY",
+	"month": "MONTHLY", "months": "MONTHLY", "year": "YEARLY", "years": "YEARLY",
+}
+
+// the written out forms turned into rule parts
+func parseWords(words []string) (Recurrence, error) {
+	parts := []string{}
+	if len(words) > 0 && words[0] == "weekdays" {
+		words = append([]string{"weekly", "on", "mon,tue,wed,thu,fri"}, words[1:]...)
+	}
+	switch {
+	case len(words) == 0:
+		return Recurrence{}, fmt.Errorf("give a rule such as weekly on mon,thu")
+	case words[0] == "every" && len(words) >= 3:
+		if _, err := strconv.Atoi(words[1]); err != nil {
+			return Recurrence{}, fmt.Errorf("every needs a number, every 2 weeks")
+		}
+		parts = append(parts, "INTERVAL="+words[1])
+		words = words[2:]
+	case words[0] == "every":
+		words = words[1:]
+	}
+	freq, found := wordFreq[words[0]]
+	if !found {
+		return Recurrence{}, fmt.Errorf("%q is not daily, weekly, monthly or yearly", words[0])
+	}
+	parts = append(parts, "FREQ="+freq)
+	rest := words[1:]
+	if len(rest) > 0 && rest[0] == "on" {
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		var on []string
+		for _, day := range strings.Split(strings.Join(rest, ","), ",") {
+			if day = strings.TrimSpace(day); day == "" {
+				continue
+			} else if day == "last" {
+				on = append(on, "-1")
+			} else if len(day) >= 2 && freq == "WEEKLY" {
+				on = append(on, strings.ToUpper(day[:2]))
+			} else {
+				on = append(on, day)
+			}
+		}
+		if freq == "WEEKLY" {
+			parts = append(parts, "BYDAY="+strings.Join(on, ","))
+		} else {
+			parts = append(parts, "BYMONTHDAY="+strings.Join(on, ","))
+		}
+	}
+	return parseRrule(strings.ToUpper(strings.Join(parts, ";")))
+}
+
+// String is the rule as RRULE text, as kept on the task
+func (r Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := []string{}
+		for _, d := range r.ByDay {
+			days = append(days, strings.ToUpper(d.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := []string{}
+		for _, d := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(d))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+var freqUnits = map[string]string{"DAILY": "days", "WEEKLY": "weeks", "MONTHLY": "months", "YEARLY": "years"}
+
+// Describe is the rule in words for the list, weekly on Mon Thu
+func (r Recurrence) Describe() string {
+	text := strings.ToLower(r.Freq)
+	if r.Interval > 1 {
+		text = fmt.Sprintf("every %d %s", r.Interval, freqUnits[r.Freq])
+	}
+	on := []string{}
+	for _, d := range r.ByDay {
+		on = append(on, d.String()[:3])
+	}
+	for _, d := range r.ByMonthDay {
+		if d == -1 {
+			on = append(on, "last")
+		} else {
+			on = append(on, strconv.Itoa(d))
+		}
+	}
+	if len(on) > 0 {
+		text += " on " + strings.Join(on, " ")
+	}
+	if r.Count > 0 {
+		text += fmt.Sprintf(", %d left", r.Count)
+	}
+	if !r.Until.IsZero() {
+		text += " until " + r.Until.Format(time.DateOnly)
+	}
+	return text
+}
+
+// DescribeRecur is a task's stored rule in words
+func DescribeRecur(rule string) string {
+	r, err := ParseRecurrence(rule)
+	if err != nil {
+		return rule
+	}
+	return r.Describe()
+}
+
+// Next is the first date after due the rule falls on, keeping due's time of
+// day, and the rule for the occurrence then. Not ok when the rule has run out.
+// A monthly or yearly date past the end of a shorter month is its last day,
+// the rule handed on keeping the day it started from.
+func (r Recurrence) Next(due time.Time) (time.Time, Recurrence, bool) {
+	if r.Count == 1 {
+		return time.Time{}, r, false
+	}
+	var next time.Time
+	switch r.Freq {
+	case "DAILY":
+		next = due.AddDate(0, 0, r.Interval)
+	case "WEEKLY":
+		next = r.nextWeekly(due)
+	case "MONTHLY":
+		next = r.nextMonthly(due)
+		if len(r.ByMonthDay) == 0 && next.Day() != due.Day() {
+			// hold on to the 31st through a shorter month
+			r.ByMonthDay = []int{due.Day()}
+		}
+	case "YEARLY":
+		day := due.Day()
+		if len(r.ByMonthDay) > 0 {
+			day = r.ByMonthDay[0]
+		}
+		next = addMonths(due, 12*r.Interval, day)
+		if len(r.ByMonthDay) == 0 && next.Day() != due.Day() {
+			// hold on to the 29th of february through the years between
+			r.ByMonthDay = []int{due.Day()}
+		}
+	}
+	// until is a whole day, an occurrence any time on it still falls
+	if !r.Until.IsZero() && !next.Before(r.Until.AddDate(0, 0, 1)) {
+		return time.Time{}, r, false
+	}
+	if r.Count > 1 {
+		r.Count--
+	}
+	return next, r, true
+}
+
+func (r Recurrence) nextWeekly(due time.Time) time.Time {
+	if len(r.ByDay) == 0 {
+		return due.AddDate(0, 0, 7*r.Interval)
+	}
+	// weeks start on monday, an interval of 2 skips every other week
+	monday := func(t time.Time) time.Time {
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	}
+	first := monday(due)
+	for next := due.AddDate(0, 0, 1); ; next = next.AddDate(0, 0, 1) {
+		weeks := int(monday(next).Sub(first).Hours()+12) / (24 * 7)
+		if weeks%r.Interval == 0 && slices.Contains(r.ByDay, next.Weekday()) {
+			return next
+		}
+	}
+}
+
+func (r Recurrence) nextMonthly(due time.Time) time.Time {
+	if len(r.ByMonthDay) == 0 {
+		return addMonths(due, r.Interval, due.Day())
+	}
+	// later days this month first, then the months on from it
+	for months := 0; ; months += r.Interval {
+		candidates := []time.Time{}
+		for _, day := range r.ByMonthDay {
+			if next := addMonths(due, months, day); next.After(due) {
+				candidates = append(candidates, next)
+			}
+		}
+		if len(candidates) > 0 {
+			return slices.MinFunc(candidates, time.Time.Compare)
+		}
+	}
+}
+
+// the day of the month months on from t, -1 or a day past its end is the last day
+func addMonths(t time.Time, months int, day int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	if day == -1 || day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// RecurChange sets the task's repeat rule, empty or none stops it repeating
+func RecurChange(ctx context.Context, index int64, rule string) error {
+	value := ""
+	if rule != "" && rule != "none" {
+		r, err := ParseRecurrence(rule)
+		if err != nil {
+			return err
+		}
+		value = r.String()
+	}
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find item %d", index)
+	}
+	previous := record.item
+	record.item.Recur = value
+	touch(previous, &record.item)
+	if _, err := writeItem(record.item); err != nil {
+		return err
+	}
+	logging.Log().InfoContext(ctx, "Updated item repeat", "ID", index, "before", previous.Recur, "after", value)
+	return nil
+}
+
+// handOn is the next occurrence of a recurring task being completed. The
+// completed one gives up its rule and stays as the series' history, the
+// next is due on the rule's next date after the completed one's due date,
+// or after today when it had none.
+func handOn(previous TodoListItem, item *TodoListItem) (TodoListItem, bool) {
+	if item.Recur == "" || item.State != StateCompleted || previous.State == StateCompleted {
+		return TodoListItem{}, false
+	}
+	rule, err := ParseRecurrence(item.Recur)
+	if err != nil {
+		return TodoListItem{}, false
+	}
+	due := item.Due
+	if due.IsZero() {
+		due = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	series := item.Series
+	if series == 0 {
+		series = item.Line
+	}
+	item.Recur = ""
+	nextDue, nextRule, ok := rule.Next(due)
+	if !ok {
+		return TodoListItem{}, false
+	}
+	next := newTodoListItem(item.Description, StateNotStarted)
+	next.Tags = slices.Clone(item.Tags)
+	next.Priority = item.Priority
+	next.Parent = item.Parent
+	next.Rank = item.Rank
+	for _, step := range item.Checklist {
+		next.Checklist = append(next.Checklist, CheckItem{Text: step.Text})
+	}
+	next.Due = nextDue
+	next.Recur = nextRule.String()
+	next.Series = series
+	return next, true
+}
+
+// writeWithNext writes item and the next occurrence handOn made for it. The
+// next is written first so a failure never ends the series, and taken out
+// again when item cannot be written.
+func writeWithNext(ctx context.Context, item TodoListItem, next TodoListItem, found bool) error {
+	if found {
+		if _, err := writeItem(next); err != nil {
+			logging.Log().ErrorContext(ctx, "Next occurrence not added", "ID", item.Line, "series", next.Series, "err", err)
+			return err
+		}
+	}
+	if _, err := writeItem(item); err != nil {
+		if found {
+			if record, dropErr := removeItem(next.Line); dropErr != nil {
+				logging.Log().ErrorContext(ctx, "Next occurrence not taken out", "ID", next.Line, "err", dropErr)
+			} else if record.ok && !Remote() {
+				bury(record.item)
+			}
+		}
+		return err
+	}
+	if found {
+		logging.Log().InfoContext(ctx, "Added next occurrence", "ID", next.Line, "series", next.Series, "due", next.Due)
+	}
+	return nil
+}
+
+// History is the completed occurrences of the task's series, oldest first
+func History(index int64) ([]TodoListItem, error) {
+	item, err := GetByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	series := item.Series
+	if series == 0 {
+		series = item.Line
+	}
+	items, err := Scan()
+	if err != nil {
+		return nil, err
+	}
+	history := []TodoListItem{}
+	for other := range items {
+		if (other.Series == series || other.Line == series) && other.State == StateCompleted {
+			history = append(history, other)
+		}
+	}
+	slices.SortFunc(history, func(a TodoListItem, b TodoListItem) int {
+		if c := a.Due.Compare(b.Due); c != 0 {
+			return c
+		}
+		return a.Updated.Compare(b.Updated)
+	})
+	return history, nil
+}
+
+// ListHistory prints the completed occurrences of the task's series
+func ListHistory(index int64) error {
+	history, err := History(index)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nCompleted occurrences:%d\n", len(history))
+	listTaskHeader()
+	for _, item := range history {
+		listTaskLine(TreeLine{Item: item})
+	}
+	return nil
+}
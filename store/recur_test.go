@@ -0,0 +1,195 @@
+package store
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	var tests = []struct {
+		value string
+		want  string
+	}{
+		{"daily", "FREQ=DAILY"},
+		{"weekly on mon,thu", "FREQ=WEEKLY;BYDAY=MO,TH"},
+		{"Weekly on Thursday, Monday", "FREQ=WEEKLY;BYDAY=MO,TH"},
+		{"weekdays", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"},
+		{"monthly on 15", "FREQ=MONTHLY;BYMONTHDAY=15"},
+		{"monthly on last", "FREQ=MONTHLY;BYMONTHDAY=-1"},
+		{"every 2 weeks", "FREQ=WEEKLY;INTERVAL=2"},
+		{"every month", "FREQ=MONTHLY"},
+		{"yearly", "FREQ=YEARLY"},
+		{"yearly on 29", "FREQ=YEARLY;BYMONTHDAY=29"},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=SA;COUNT=4", "FREQ=WEEKLY;INTERVAL=2;BYDAY=SA;COUNT=4"},
+		{"FREQ=DAILY;UNTIL=20261231T000000Z", "FREQ=DAILY;UNTIL=20261231"},
+		{"fortnightly", ""},
+		{"every other week", ""},
+		{"FREQ=HOURLY", ""},
+		{"FREQ=DAILY;BYDAY=MO", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", ""},
+		{"FREQ=YEARLY;BYMONTHDAY=1,15", ""},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", ""},
+		{"FREQ=WEEKLY;BYSETPOS=1", ""},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		r, ok := ParseRecurrence(tc.value)
+		if tc.want == "" {
+			if ok == nil {
+				t.Errorf("%q: wanted an error got %s", tc.value, r)
+			}
+			continue
+		}
+		if ok != nil || r.String() != tc.want {
+			t.Errorf("%q: wanted %s got %s %v", tc.value, tc.want, r, ok)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// a thursday
+	due := time.Date(2026, 1, 29, 9, 30, 0, 0, time.UTC)
+	var tests = []struct {
+		rule string
+		from time.Time // due when not given
+		want []string
+		ends bool
+	}{
+		{rule: "daily", want: []string{"2026-01-30", "2026-01-31", "2026-02-01"}},
+		{rule: "every 3 days", want: []string{"2026-02-01", "2026-02-04"}},
+		{rule: "weekly", want: []string{"2026-02-05", "2026-02-12"}},
+		{rule: "weekly on mon,thu", want: []string{"2026-02-02", "2026-02-05", "2026-02-09"}},
+		{rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH", want: []string{"2026-02-10", "2026-02-12", "2026-02-24"}},
+		{rule: "monthly", want: []string{"2026-02-28", "2026-03-29", "2026-04-29"}}, // february's last day, then back to the 29th
+		{rule: "monthly on 1,15", want: []string{"2026-02-01", "2026-02-15", "2026-03-01"}},
+		{rule: "monthly on last", want: []string{"2026-01-31", "2026-02-28", "2026-03-31"}},
+		{rule: "yearly", want: []string{"2027-01-29", "2028-01-29"}},
+		{rule: "yearly", from: time.Date(2028, 2, 29, 9, 30, 0, 0, time.UTC), want: []string{"2029-02-28", "2030-02-28", "2031-02-28", "2032-02-29"}}, // back to the 29th in a leap year
+		{rule: "FREQ=DAILY;COUNT=3", want: []string{"2026-01-30", "2026-01-31"}, ends: true},
+		{rule: "FREQ=WEEKLY;UNTIL=20260212", want: []string{"2026-02-05", "2026-02-12"}, ends: true},
+		{rule: "FREQ=DAILY;UNTIL=20260131", from: time.Date(2026, 1, 29, 0, 0, 0, 0, time.UTC), want: []string{"2026-01-30", "2026-01-31"}, ends: true}, // not the midnight after
+	}
+	for _, tc := range tests {
+		r, ok := ParseRecurrence(tc.rule)
+		if ok != nil {
+			t.Fatal(ok)
+		}
+		at, more := due, true
+		if !tc.from.IsZero() {
+			at = tc.from
+		}
+		clock := at.Format(time.TimeOnly)
+		for _, want := range tc.want {
+			if at, r, more = r.Next(at); !more || at.Format(time.DateOnly) != want || at.Format(time.TimeOnly) != clock {
+				t.Errorf("%s: wanted %s %s got %s %v", tc.rule, want, clock, at, more)
+				break
+			}
+		}
+		if _, _, more = r.Next(at); more == tc.ends {
+			t.Errorf("%s: wanted it to end %v after %v", tc.rule, tc.ends, tc.want)
+		}
+	}
+}
+
+func TestRecurringTasks(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	chore, _ := AddTaskWithTags(ctx, "Put the bins out", []string{"home"})
+	due := time.Date(2026, 1, 29, 0, 0, 0, 0, time.UTC)
+	DueChange(ctx, chore, due)
+	AddCheckItem(ctx, chore, "Recycling")
+	if ok := RecurChange(ctx, chore, "weekly on mon,thu"); ok != nil {
+		t.Fatal(ok)
+	}
+	if ok := RecurChange(ctx, chore, "now and then"); ok == nil {
+		t.Error("a rule that cannot be read was taken")
+	}
+	CheckItemDone(ctx, chore, 1, true)
+
+	// the next occurrence of what's open in the series
+	open := func() TodoListItem {
+		t.Helper()
+		var found []TodoListItem
+		scan, _ := Scan()
+		for item := range scan {
+			if item.State != StateCompleted {
+				found = append(found, item)
+			}
+		}
+		if len(found) != 1 {
+			t.Fatalf("wanted one open occurrence got %+v", found)
+		}
+		return found[0]
+	}
+
+	if ok := StateChange(ctx, chore, StateStarted); ok != nil {
+		t.Fatal(ok)
+	}
+	if ok := StateChange(ctx, chore, StateCompleted); ok != nil {
+		t.Fatal(ok)
+	}
+	next := open()
+	if next.Line == chore || !next.Due.Equal(due.AddDate(0, 0, 4)) || next.Recur != "FREQ=WEEKLY;BYDAY=MO,TH" || next.Series != chore ||
+		next.Description != "Put the bins out" || len(next.Tags) != 1 || len(next.Checklist) != 1 || next.Checklist[0].Done {
+		t.Errorf("next occurrence wanted monday the 2nd, unticked, got %+v", next)
+	}
+	if done, _ := GetByIndex(chore); done.Recur != "" || done.State != StateCompleted {
+		t.Errorf("completed occurrence should stop repeating got %+v", done)
+	}
+	// completing it again makes no new one
+	if ok := StateChange(ctx, chore, StateCompleted); ok != nil || Count() != 2 {
+		t.Errorf("completing twice wanted 2 tasks got %d %v", Count(), ok)
+	}
+
+	completed := next
+	completed.State = StateCompleted
+	if _, ok := UpdateTask(ctx, completed); ok != nil {
+		t.Fatal(ok)
+	}
+	last := open()
+	if !last.Due.Equal(due.AddDate(0, 0, 7)) || last.Series != chore {
+		t.Errorf("next occurrence wanted thursday the 5th got %+v", last)
+	}
+
+	for _, id := range []int64{chore, next.Line, last.Line} {
+		history, ok := History(id)
+		if ok != nil || len(history) != 2 || history[0].Line != chore || history[1].Line != next.Line {
+			t.Errorf("history of %d wanted %d then %d got %+v %v", id, chore, next.Line, history, ok)
+		}
+	}
+
+	// a rule run out stops with the last one
+	if ok := RecurChange(ctx, last.Line, "FREQ=DAILY;COUNT=1"); ok != nil {
+		t.Fatal(ok)
+	}
+	StateChange(ctx, last.Line, StateCompleted)
+	if got := Count(); got != 3 {
+		t.Errorf("wanted no occurrence after the count ran out, %d tasks", got)
+	}
+}
+
+// completing an occurrence twice at once adds one next occurrence, the
+// second completion finds it completed already
+func TestRecurConcurrentCompletion(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	defer resetList()
+	for i := range 50 {
+		chore, _ := AddTask(ctx, "Put the bins out")
+		if ok := RecurChange(ctx, chore, "weekly"); ok != nil {
+			t.Fatal(ok)
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() { StateChange(ctx, chore, StateCompleted) })
+		wg.Go(func() {
+			UpdateTask(ctx, TodoListItem{Line: chore, Description: "Put the bins out", State: StateCompleted})
+		})
+		wg.Wait()
+		if got := Count(); got != 2*(i+1) {
+			t.Fatalf("wanted one next occurrence for each completed chore, %d tasks after %d", got, i+1)
+		}
+	}
+}
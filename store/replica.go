@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+// A follower keeps a copy of a leader's list. Its store is read only, the
+// only writes it takes are the leader's changes through Apply and Replace.
+
+var ErrReadOnly = errors.New("read only, this server follows a leader")
+
+var readOnly atomic.Bool
+
+// SetReadOnly turns away every write except Apply and Replace
+func SetReadOnly(on bool) {
+	readOnly.Store(on)
+}
+
+func ReadOnly() bool {
+	return readOnly.Load()
+}
+
+// Apply makes one change from the leader, a delete of a missing item is fine
+// as a change may be applied again after catching up from a snapshot
+func Apply(ctx context.Context, change Change) error {
+	switch change.Kind {
+	case ChangeCreated, ChangeUpdated:
+		if change.Item.Line == 0 {
+			return fmt.Errorf("change has no line")
+		}
+		_, err := putItem(change.Item)
+		return err
+	case ChangeDeleted:
+		_, err := dropItem(change.Item.Line)
+		return err
+	}
+	return fmt.Errorf("unknown change kind %d", change.Kind)
+}
+
+// Replace makes the list match items, writing only what differs so watchers
+// see a change for each item that moved. Returns the number of changes.
+func Replace(ctx context.Context, items TodoListItems) (int, error) {
+	list, err := mergedList()
+	if err != nil {
+		return 0, err
+	}
+	current := list.Items()
+	changes := 0
+	for id := range current {
+		if _, found := items[id]; !found {
+			if _, err := dropItem(id); err != nil {
+				return changes, err
+			}
+			changes++
+		}
+	}
+	for id, item := range items {
+		if have, found := current[id]; found && sameItem(have, item) {
+			continue
+		}
+		if _, err := putItem(item); err != nil {
+			return changes, err
+		}
+		changes++
+	}
+	logging.Log().InfoContext(ctx, "Replaced list", "items", len(items), "changes", changes)
+	return changes, nil
+}
+
+func sameItem(a TodoListItem, b TodoListItem) bool {
+	return a.Line == b.Line && a.Description == b.Description && a.State == b.State &&
+		a.Created.Equal(b.Created) && a.Id == b.Id && slices.Equal(a.Tags, b.Tags) && a.Priority == b.Priority && a.Due.Equal(b.Due) &&
+		a.Parent == b.Parent && a.Rank == b.Rank && slices.Equal(a.Checklist, b.Checklist) && slices.Equal(a.BlockedBy, b.BlockedBy) &&
+		a.Recur == b.Recur && a.Series == b.Series &&
+		a.Version == b.Version && a.Updated.Equal(b.Updated) && a.Clocks == b.Clocks && a.Deleted == b.Deleted
+}
@@ -5,29 +5,38 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/anthriscus/appcli/filer"
 	"github.com/anthriscus/appcli/logging"
 )
 
 var (
-	sessionDatabase TodoListItems = TodoListItems{}
-	datastoreFile   string
+	datastoreFile string
+	saveMutex     sync.Mutex // one save at a time, autosave and shutdown can overlap
 )
 
 func currentList() TodoListItems {
-	return sessionDatabase
+	return localList().Items()
 }
 func resetList() {
-	sessionDatabase = TodoListItems{}
+	setList(TodoListItems{})
+	setTombstones(nil)
+}
+
+// the file the list was opened from and commits go to
+func DataFile() string {
+	return datastoreFile
 }
 
 func IsOpen() bool {
-	return (sessionDatabase != nil)
+	return len(shards) > 0
 }
 
+// the list is saved by the store servers when there is a backend
 func Commit(ctx context.Context) error {
-	if IsOpen() {
+	if IsOpen() && !Remote() {
 		return SaveSession(ctx, datastoreFile)
 	}
 	return nil
@@ -40,35 +49,29 @@ func OpenSession(ctx context.Context, storageFile string) error {
 		logging.Log().ErrorContext(ctx, "Fatal error restoring list file err", "err", err, "storageFile", storageFile)
 		return err
 	}
-	sessionDatabase = list
+	observeItems(list)
+	live, dead := splitTombstones(list)
+	setList(live)
+	setTombstones(dead)
 	datastoreFile = storageFile
+	resetChanges()
 	return nil
 }
 
-// save list back to json file
+// save list back to json file, with the tombstones
 func SaveSession(ctx context.Context, storageFile string) error {
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
+	started := time.Now()
+	version := changeCount.Load()
+	err := Save(ctx, storageFile, withTombstones(snapshotList()))
+	recordSave(started, version, err)
+	return err
+}
 
-	if data, err := json.Marshal(sessionDatabase); err != nil {
-		fmt.Printf("Save failed converting todo list to json err:%s\n", err)
-		logging.Log().ErrorContext(ctx, "Save failed converting todo list to json", "err", err)
-		return err
-	} else {
-		if destination, err := filer.OpenFileTruncate(storageFile); err != nil {
-			fmt.Printf("Save failed getting file err:%s storageFile: %s\n", err, storageFile)
-			logging.Log().ErrorContext(ctx, "Save failed getting file", "err", err, "storageFile", storageFile)
-			return err
-		} else {
-			defer destination.Close()
-			if _, err := destination.Write(data); err != nil {
-				fmt.Printf("Save to file failed err:%s storageFile:%s\n", err, storageFile)
-				logging.Log().ErrorContext(ctx, "Save to file failed ", "err", err, "storageFile", storageFile)
-				return err
-			}
-		}
-	}
-	fmt.Printf("Saved data storageFile:%s\n", storageFile)
-	logging.Log().InfoContext(ctx, "Saved data", "storageFile", storageFile)
-	return nil
+// a copy of the whole list, through the shard actors when they are running
+func snapshotList() TodoListItems {
+	return localList().Items()
 }
 
 // restore from json file
@@ -110,7 +113,7 @@ func restoreList(ctx context.Context, destination io.Reader) (TodoListItems, err
 	}
 }
 
-// save list back to json file
+// save list back to json file, the old file is kept whole until the new one is written
 func Save(ctx context.Context, storageFile string, list TodoListItems) error {
 
 	if data, err := json.Marshal(list); err != nil {
@@ -118,17 +121,10 @@ func Save(ctx context.Context, storageFile string, list TodoListItems) error {
 		logging.Log().ErrorContext(ctx, "Save failed converting todo list to json", "err", err)
 		return err
 	} else {
-		if destination, err := filer.OpenFileTruncate(storageFile); err != nil {
-			fmt.Printf("Save failed getting file err:%s storageFile: %s\n", err, storageFile)
-			logging.Log().ErrorContext(ctx, "Save failed getting file", "err", err, "storageFile", storageFile)
+		if err := filer.WriteFileAtomic(storageFile, data); err != nil {
+			fmt.Printf("Save to file failed err:%s storageFile:%s\n", err, storageFile)
+			logging.Log().ErrorContext(ctx, "Save to file failed ", "err", err, "storageFile", storageFile)
 			return err
-		} else {
-			defer destination.Close()
-			if _, err := destination.Write(data); err != nil {
-				fmt.Printf("Save to file failed err:%s storageFile:%s\n", err, storageFile)
-				logging.Log().ErrorContext(ctx, "Save to file failed ", "err", err, "storageFile", storageFile)
-				return err
-			}
 		}
 	}
 	fmt.Printf("Saved data storageFile:%s\n", storageFile)
@@ -3,6 +3,7 @@ package store
 import (
 	"bytes"
 	"context"
+	"path/filepath"
 	"testing"
 
 	"github.com/anthriscus/appcli/appcontext"
@@ -16,10 +17,10 @@ func TestOpenSession(t *testing.T) {
 		want     bool
 	}{
 		{
-			datafile: dir + "\\testData.json",
+			datafile: filepath.Join(dir, "testData.json"),
 			want:     true},
 		{
-			datafile: dir + "\\",
+			datafile: dir + string(filepath.Separator),
 			want:     false},
 	}
 	ctx := context.Background()
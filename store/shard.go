@@ -0,0 +1,505 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// The list is split over shards, each with its own map and actor, so writes to
+// different shards run side by side. A task always lives in the shard its id
+// hashes to. Readers take published snapshots: a shard keeps its items in line
+// order in chunks and a change copies only the chunks it touched. The whole
+// list is the shard snapshots side by side, nothing is copied to read it.
+
+type shard struct {
+	items     TodoListItems      // owned by the shard actor while it runs
+	dirty     map[int64]struct{} // lines changed since the last snapshot, nil to build it afresh
+	actor     *StoreChannels
+	version   atomic.Uint64 // bumped on every change to items
+	size      atomic.Int64  // len(items) for readers outside the actor
+	published atomic.Pointer[listSnapshot]
+}
+
+// a read only copy of one shard as it was at one version, chunks are shared
+// with earlier and later copies so they are never changed
+type listSnapshot struct {
+	version uint64
+	chunks  [][]TodoListItem // by line, none empty
+	count   int
+}
+
+// items per snapshot chunk, a change copies the chunk it falls in
+var snapshotChunk = 256
+
+// the whole list as the shard snapshots at the versions recorded
+type mergedSnapshot struct {
+	shards    []*shard
+	versions  []uint64
+	parts     []*listSnapshot // one per shard, or one for a backend
+	count     int
+	itemsOnce sync.Once
+	items     TodoListItems // built on first use
+}
+
+// List is the whole list as the shards last published it, read only and
+// shared with other readers
+type List struct {
+	m *mergedSnapshot
+}
+
+var (
+	shards = newShards(runtime.GOMAXPROCS(0))
+	merged atomic.Pointer[mergedSnapshot]
+)
+
+func newShards(n int) []*shard {
+	list := make([]*shard, n)
+	for i := range list {
+		list[i] = &shard{items: TodoListItems{}}
+	}
+	return list
+}
+
+// SetShards splits the list over n shards, 0 is one per cpu.
+// The items are moved to their new shards, it must be called before StartActor.
+func SetShards(n int) error {
+	if n < 0 {
+		return fmt.Errorf("shard count %d cannot be negative", n)
+	}
+	if n == 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if ActorRunning() {
+		return errors.New("cannot change the shard count while the store is running")
+	}
+	items := localList().Items()
+	shards = newShards(n)
+	setList(items)
+	return nil
+}
+
+// the number of shards the list is split over
+func ShardCount() int {
+	return len(shards)
+}
+
+// ids are time based so they are mixed before taking the modulus, the
+// finaliser from murmur3 spreads neighbouring ids over every shard
+func shardIndex(id int64, n int) int {
+	x := uint64(id)
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return int(x % uint64(n))
+}
+
+func shardFor(id int64) *shard {
+	return shards[shardIndex(id, len(shards))]
+}
+
+// setList replaces the whole list, only while the actors are not running
+// or from tests between their own calls
+func setList(items TodoListItems) {
+	for _, s := range shards {
+		s.items = make(TodoListItems, len(items)/len(shards)+1)
+		s.dirty = nil
+	}
+	for k, v := range items {
+		shardFor(k).items[k] = v
+	}
+	for _, s := range shards {
+		s.changed()
+	}
+	countSubtasks(items)
+	countStates(items)
+}
+
+// StartActor starts an actor for each shard, they end with ctx
+func StartActor(ctx context.Context) {
+	for _, s := range shards {
+		s.actor = NewStoreChannels(ctx, s)
+	}
+}
+
+// every shard actor has started and not yet ended
+func ActorRunning() bool {
+	for _, s := range shards {
+		if s.actor == nil || s.actor.stopped() {
+			return false
+		}
+	}
+	return len(shards) > 0
+}
+
+// the shard's items changed, snapshots taken before are now stale
+func (s *shard) changed() {
+	s.version.Add(1)
+	s.size.Store(int64(len(s.items)))
+}
+
+// the line was written or removed by the shard actor
+func (s *shard) touched(line int64) {
+	if s.dirty != nil {
+		s.dirty[line] = struct{}{}
+	}
+	s.changed()
+}
+
+// snapshot copies the items when they changed since the last copy, only the
+// chunks holding changed lines. Called by the shard actor, or by anyone once
+// the actor is not running.
+func (s *shard) snapshot() *listSnapshot {
+	version := s.version.Load()
+	p := s.published.Load()
+	if p != nil && p.version == version {
+		return p
+	}
+	if p == nil || s.dirty == nil {
+		p = newListSnapshot(version, slices.SortedFunc(maps.Values(s.items), byLine))
+	} else {
+		p = p.patched(version, s.items, s.dirty)
+	}
+	s.dirty = map[int64]struct{}{}
+	s.published.Store(p)
+	return p
+}
+
+func newListSnapshot(version uint64, sorted []TodoListItem) *listSnapshot {
+	p := &listSnapshot{version: version, count: len(sorted)}
+	for chunk := range slices.Chunk(sorted, snapshotChunk) {
+		p.chunks = append(p.chunks, chunk)
+	}
+	return p
+}
+
+// patched is p with the dirty lines brought up to date from items. Each
+// chunk holding a dirty line is copied with the change, the rest are shared.
+func (p *listSnapshot) patched(version uint64, items TodoListItems, dirty map[int64]struct{}) *listSnapshot {
+	if len(p.chunks) == 0 {
+		return newListSnapshot(version, slices.SortedFunc(maps.Values(items), byLine))
+	}
+	lines := slices.Sorted(maps.Keys(dirty))
+	next := &listSnapshot{version: version, chunks: make([][]TodoListItem, 0, len(p.chunks)+1), count: len(items)}
+	for i, chunk := range p.chunks {
+		// lines up to this chunk's last, everything left for the last chunk
+		n := len(lines)
+		if i < len(p.chunks)-1 {
+			last := chunk[len(chunk)-1].Line
+			n, _ = slices.BinarySearch(lines, last+1)
+		}
+		if n == 0 {
+			next.chunks = append(next.chunks, chunk)
+			continue
+		}
+		changed := patchChunk(chunk, lines[:n], items)
+		lines = lines[n:]
+		if len(changed) > 2*snapshotChunk {
+			for part := range slices.Chunk(changed, snapshotChunk) {
+				next.chunks = append(next.chunks, part)
+			}
+		} else if len(changed) > 0 {
+			next.chunks = append(next.chunks, changed)
+		}
+	}
+	// deletes leave small chunks behind, start again once there are far too many
+	if len(next.chunks) > 4*(next.count/snapshotChunk+1) {
+		return newListSnapshot(version, slices.Collect(next.All()))
+	}
+	return next
+}
+
+// a copy of the chunk with the lines taken from items, a line no longer in items is dropped
+func patchChunk(chunk []TodoListItem, lines []int64, items TodoListItems) []TodoListItem {
+	patched := make([]TodoListItem, 0, len(chunk)+len(lines))
+	i := 0
+	for _, line := range lines {
+		for i < len(chunk) && chunk[i].Line < line {
+			patched = append(patched, chunk[i])
+			i++
+		}
+		if i < len(chunk) && chunk[i].Line == line {
+			i++
+		}
+		if item, found := items[line]; found {
+			patched = append(patched, item)
+		}
+	}
+	return append(patched, chunk[i:]...)
+}
+
+// the item on line, by binary search of the chunks
+func (p *listSnapshot) get(line int64) (TodoListItem, bool) {
+	i, _ := slices.BinarySearchFunc(p.chunks, line, func(chunk []TodoListItem, line int64) int {
+		return cmp.Compare(chunk[len(chunk)-1].Line, line)
+	})
+	if i == len(p.chunks) {
+		return TodoListItem{}, false
+	}
+	chunk := p.chunks[i]
+	if j, found := slices.BinarySearchFunc(chunk, line, func(item TodoListItem, line int64) int {
+		return cmp.Compare(item.Line, line)
+	}); found {
+		return chunk[j], true
+	}
+	return TodoListItem{}, false
+}
+
+// All is the snapshot's items in line order
+func (p *listSnapshot) All() iter.Seq[TodoListItem] {
+	return func(yield func(TodoListItem) bool) {
+		for _, chunk := range p.chunks {
+			for _, item := range chunk {
+				if !yield(item) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// the published snapshot when it is current, nil when a write made it stale
+func (s *shard) current() *listSnapshot {
+	if p := s.published.Load(); p != nil && p.version == s.version.Load() {
+		return p
+	}
+	return nil
+}
+
+// the current snapshot of the shard holding id, nil with a backend or when stale
+func localSnapshot(id int64) *listSnapshot {
+	if backend != nil {
+		return nil
+	}
+	return shardFor(id).current()
+}
+
+// current snapshot of the shard, through the actor when it is running
+func (s *shard) read() *listSnapshot {
+	if p := s.current(); p != nil {
+		return p
+	}
+	if s.actor != nil {
+		if p, ok := s.actor.Snapshot(); ok {
+			return p
+		}
+	}
+	return s.snapshot()
+}
+
+func (m *mergedSnapshot) isCurrent() bool {
+	if len(m.shards) != len(shards) {
+		return false
+	}
+	for i, s := range shards {
+		if m.shards[i] != s || m.versions[i] != s.version.Load() {
+			return false
+		}
+	}
+	return true
+}
+
+// mergedList is the whole list. With a backend that is a list from every
+// store server on each call, nothing is cached, and its error is passed on.
+func mergedList() (*mergedSnapshot, error) {
+	if backend != nil {
+		return remoteList()
+	}
+	return localList(), nil
+}
+
+// localList is the shard snapshots side by side. Only the shards changed
+// since the last call are read again. Each shard copy is consistent, a
+// write landing while the shards are read shows up in the next.
+func localList() *mergedSnapshot {
+	if m := merged.Load(); m != nil && m.isCurrent() {
+		return m
+	}
+	current := shards
+	m := &mergedSnapshot{
+		shards:   current,
+		versions: make([]uint64, len(current)),
+		parts:    make([]*listSnapshot, len(current)),
+	}
+	for i, s := range current {
+		m.parts[i] = s.read()
+		m.versions[i] = m.parts[i].version
+		m.count += m.parts[i].count
+	}
+	merged.Store(m)
+	return m
+}
+
+// Items is the whole list as one map, built on first use and shared by every
+// reader of this snapshot, so read only. Views that need the tree or the
+// blockers use it, Get and All do not copy.
+func (m *mergedSnapshot) Items() TodoListItems {
+	m.itemsOnce.Do(func() {
+		if m.items != nil {
+			return
+		}
+		m.items = make(TodoListItems, m.count)
+		for item := range m.All() {
+			m.items[item.Line] = item
+		}
+	})
+	return m.items
+}
+
+// the item on line
+func (m *mergedSnapshot) Get(line int64) (TodoListItem, bool) {
+	if len(m.parts) == 0 {
+		return TodoListItem{}, false
+	}
+	return m.parts[shardIndex(line, len(m.parts))].get(line)
+}
+
+// All is every item in line order, a k way merge of the shards. The shard
+// count is small so picking the lowest head each time is enough.
+func (m *mergedSnapshot) All() iter.Seq[TodoListItem] {
+	if len(m.parts) == 1 {
+		return m.parts[0].All()
+	}
+	return func(yield func(TodoListItem) bool) {
+		type head struct{ chunk, i int }
+		heads := make([]head, len(m.parts))
+		for {
+			lowest := -1
+			var item TodoListItem
+			for k, p := range m.parts {
+				if h := heads[k]; h.chunk < len(p.chunks) {
+					if next := p.chunks[h.chunk][h.i]; lowest < 0 || next.Line < item.Line {
+						lowest, item = k, next
+					}
+				}
+			}
+			if lowest < 0 {
+				return
+			}
+			if !yield(item) {
+				return
+			}
+			h := &heads[lowest]
+			if h.i++; h.i == len(m.parts[lowest].chunks[h.chunk]) {
+				h.chunk, h.i = h.chunk+1, 0
+			}
+		}
+	}
+}
+
+// the snapshot behind the list, an empty one for the zero List
+func (l List) snapshot() *mergedSnapshot {
+	if l.m == nil {
+		return &mergedSnapshot{}
+	}
+	return l.m
+}
+
+// Len is the number of items
+func (l List) Len() int {
+	return l.snapshot().count
+}
+
+// Get is the item on line
+func (l List) Get(line int64) (TodoListItem, bool) {
+	return l.snapshot().Get(line)
+}
+
+// All is every item in line order
+func (l List) All() iter.Seq[TodoListItem] {
+	return l.snapshot().All()
+}
+
+// Items is the list as one map, built once per snapshot and shared, read only
+func (l List) Items() TodoListItems {
+	return l.snapshot().Items()
+}
+
+// MarshalJSON writes the list as the map the data file holds, keyed by line
+func (l List) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for item := range l.snapshot().All() {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('"')
+		b.WriteString(strconv.FormatInt(item.Line, 10))
+		b.WriteString(`":`)
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func byLine(a TodoListItem, b TodoListItem) int {
+	return cmp.Compare(a.Line, b.Line)
+}
+
+func readItem(id int64) TodoListRecord {
+	if backend != nil {
+		return remoteRead(id)
+	}
+	return shardFor(id).actor.Read(id)
+}
+
+// writeItem adds or replaces the item, true when it replaced one
+func writeItem(item TodoListItem) (bool, error) {
+	if readOnly.Load() {
+		return false, ErrReadOnly
+	}
+	return putItem(item)
+}
+
+// putItem is writeItem without the read only check, for changes from the leader
+func putItem(item TodoListItem) (bool, error) {
+	if backend != nil {
+		ctx, cancel := backendContext()
+		defer cancel()
+		found, err := backend.Put(ctx, item)
+		if err == nil && found {
+			publish(ChangeUpdated, item)
+		} else if err == nil {
+			publish(ChangeCreated, item)
+		}
+		return found, err
+	}
+	return shardFor(item.Line).actor.Write(TodoListRecord{item: item}), nil
+}
+
+// removeItem deletes the item and returns it as it was, not ok when it was not there
+func removeItem(id int64) (TodoListRecord, error) {
+	if readOnly.Load() {
+		return TodoListRecord{}, ErrReadOnly
+	}
+	return dropItem(id)
+}
+
+func dropItem(id int64) (TodoListRecord, error) {
+	if backend != nil {
+		ctx, cancel := backendContext()
+		defer cancel()
+		item, found, err := backend.Delete(ctx, id)
+		if found {
+			publish(ChangeDeleted, item)
+		}
+		return TodoListRecord{item: item, ok: found}, err
+	}
+	return shardFor(id).actor.Remove(id), nil
+}
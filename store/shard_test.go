@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+// waitActors waits for actors started by earlier tests, they end with the
+// test context but only after the test has returned
+func waitActors(t *testing.T) {
+	t.Helper()
+	for _, s := range shards {
+		if s.actor == nil {
+			continue
+		}
+		select {
+		case <-s.actor.done:
+		case <-time.After(time.Second):
+			t.Fatal("store actors still running")
+		}
+	}
+}
+
+func TestShardIndex(t *testing.T) {
+	n := 8
+	counts := make([]int, n)
+	// neighbouring time based ids still land on every shard
+	for id := int64(1761837306757785900); id < 1761837306757785900+8000; id++ {
+		i := shardIndex(id, n)
+		if i != shardIndex(id, n) {
+			t.Fatalf("id %d routed to different shards", id)
+		}
+		counts[i]++
+	}
+	for i, c := range counts {
+		if c < 800 || c > 1200 {
+			t.Errorf("shard %d has %d of 8000 ids, routing is uneven %v", i, c, counts)
+		}
+	}
+}
+
+func TestShardedList(t *testing.T) {
+	waitActors(t)
+	original := ShardCount()
+	if ok := SetShards(4); ok != nil {
+		t.Fatal(ok)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	resetList()
+	StartActor(ctx)
+	// the shard count only goes back once the actors have ended
+	defer func() {
+		cancel()
+		for _, s := range shards {
+			<-s.actor.done
+		}
+		SetShards(original)
+	}()
+
+	added := []int64{}
+	for range 50 {
+		id, ok := AddTask(ctx, "Original task description buy apples")
+		if ok != nil {
+			t.Fatal(ok)
+		}
+		added = append(added, id)
+	}
+	used := map[*shard]bool{}
+	for _, id := range added {
+		used[shardFor(id)] = true
+		if _, ok := GetByIndex(id); ok != nil {
+			t.Errorf("item %d not found in its shard", id)
+		}
+	}
+	if len(used) < 2 {
+		t.Errorf("50 items all landed in one shard")
+	}
+
+	// scan merges the shards in line order
+	slices.Sort(added)
+	lines := []int64{}
+	scan, _ := Scan()
+	for item := range scan {
+		lines = append(lines, item.Line)
+	}
+	if !slices.Equal(lines, added) {
+		t.Errorf("scan out of order or missing items got %d want %d", len(lines), len(added))
+	}
+	if items, _ := GetList(); items.Len() != len(added) || Count() != len(added) {
+		t.Errorf("list has %d count %d wanted %d", items.Len(), Count(), len(added))
+	}
+
+	// changing the shard count needs the actors stopped
+	if ok := SetShards(2); ok == nil {
+		t.Errorf("shards changed while the actors run")
+	}
+}
+
+func TestSetShardsKeepsItems(t *testing.T) {
+	waitActors(t)
+	original := ShardCount()
+	defer SetShards(original)
+	items := TodoListItems{}
+	for i := range int64(100) {
+		items[i+1] = TodoListItem{Line: i + 1, Description: "keep me"}
+	}
+	if ok := SetShards(3); ok != nil {
+		t.Fatal(ok)
+	}
+	setList(items)
+
+	for _, n := range []int{7, 1, 0} {
+		if ok := SetShards(n); ok != nil {
+			t.Fatal(ok)
+		}
+		if got := len(currentList()); got != len(items) {
+			t.Errorf("shards=%d kept %d of %d items", n, got, len(items))
+		}
+		for id := range items {
+			if _, found := shardFor(id).items[id]; !found {
+				t.Errorf("shards=%d item %d not in its shard", n, id)
+				break
+			}
+		}
+	}
+	resetList()
+}
+
+// the chunks patched after each write read back the same as the shard maps
+func TestSnapshotPatches(t *testing.T) {
+	waitActors(t)
+	original, chunk := ShardCount(), snapshotChunk
+	snapshotChunk = 4
+	if ok := SetShards(3); ok != nil {
+		t.Fatal(ok)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	want := TodoListItems{}
+	for i := range int64(60) {
+		want[i*10] = TodoListItem{Line: i * 10, Description: "start"}
+	}
+	setList(want)
+	want = maps.Clone(want)
+	StartActor(ctx)
+	defer func() {
+		cancel()
+		for _, s := range shards {
+			<-s.actor.done
+		}
+		snapshotChunk = chunk
+		resetList()
+		SetShards(original)
+	}()
+
+	random := rand.New(rand.NewPCG(1, 2))
+	for step := range 500 {
+		line := random.Int64N(800)
+		if _, found := want[line]; found && random.IntN(3) == 0 {
+			dropItem(line)
+			delete(want, line)
+		} else {
+			item := TodoListItem{Line: line, Description: fmt.Sprintf("step %d", step)}
+			putItem(item)
+			want[line] = item
+		}
+		if step%7 != 0 {
+			continue
+		}
+		list, _ := GetList()
+		got := slices.Collect(list.All())
+		if !slices.EqualFunc(got, slices.SortedFunc(maps.Values(want), byLine), func(a, b TodoListItem) bool {
+			return a.Line == b.Line && a.Description == b.Description
+		}) {
+			t.Fatalf("step %d: list %v wanted %v", step, got, want)
+		}
+		for line, item := range want {
+			if found, ok := list.Get(line); !ok || found.Description != item.Description {
+				t.Fatalf("step %d: line %d got %+v %v", step, line, found, ok)
+			}
+		}
+		if list.Len() != len(want) {
+			t.Fatalf("step %d: length %d wanted %d", step, list.Len(), len(want))
+		}
+	}
+}
+
+// a read after a write copies a few chunks, not the whole list. The bound is
+// far above what the patch needs and far below one copy of 100k items.
+func TestGetListAfterWriteCost(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmarks a 100k item list")
+	}
+	waitActors(t)
+	result := testing.Benchmark(BenchmarkGetListAfterWrite100k)
+	if bytes := result.AllocedBytesPerOp(); bytes > 2<<20 {
+		t.Errorf("a read after a write allocated %d bytes, the list is being copied again", bytes)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -26,22 +27,50 @@ var StatusName = map[int]string{
 	StateCompleted:  "Completed",
 }
 
+// SetStates renames the workflow states, extra names add states after completed.
+// The first three keep the meaning of not started, started and completed.
+func SetStates(names []string) error {
+	if len(names) < 3 {
+		return fmt.Errorf("need at least 3 workflow states, got %d", len(names))
+	}
+	states := make(map[int]string, len(names))
+	for i, name := range names {
+		if name == "" {
+			return fmt.Errorf("workflow state %d has no name", i)
+		}
+		states[i] = name
+	}
+	StatusName = states
+	return nil
+}
+
 // note point on unique keys in
 // https://go.dev/ref/spec#Composite_literals
 // https://go.dev/ref/spec#Order_of_evaluation
 
 type TodoListItem struct {
-	Line        int64     `json:"line"` // tags just to show understanding of useage for flipping case in the file.
-	Description string    `json:"description"`
-	State       int       `json:"state"`
-	Created     time.Time `json:"created"`
-	Id          int64     `json:"id"`
+	Line        int64       `json:"line"` // tags just to show understanding of useage for flipping case in the file.
+	Description string      `json:"description"`
+	State       int         `json:"state"`
+	Created     time.Time   `json:"created"`
+	Id          int64       `json:"id"`
+	Tags        []string    `json:"tags,omitempty"`
+	Priority    string      `json:"priority,omitempty"` // A highest to Z, empty for none
+	Due         time.Time   `json:"due,omitzero"`
+	Parent      int64       `json:"parent,omitempty"` // line of the task this is a subtask of, 0 at the top
+	Rank        int64       `json:"rank,omitempty"`   // order among the subtasks of one parent
+	Checklist   []CheckItem `json:"checklist,omitempty"`
+	BlockedBy   []int64     `json:"blockedBy,omitempty"` // lines of the tasks to complete before this starts
+	Recur       string      `json:"recur,omitempty"`     // repeat rule as RRULE text, see recur.go
+	Series      int64       `json:"series,omitempty"`    // line of the first occurrence of a repeating task
+	Version     int64       `json:"version,omitempty"`   // bumped on every change, sync compares it
+	Updated     time.Time   `json:"updated,omitzero"`    // when it last changed
+	Clocks      FieldClocks `json:"clocks,omitzero"`     // when each field last changed, for merging
+	Deleted     HLC         `json:"deleted,omitzero"`    // set on tombstones, see merge.go
 }
 
 type TodoListItems map[int64]TodoListItem
 
-var storeActor *StoreChannels
-
 // more unique (ish) id perhaps
 // todo consider using https://github.com/google/uuid
 // note point on unique keys in
@@ -58,11 +87,11 @@ func GenerateId() int64 {
 	return t
 }
 
-func StartActor(ctx context.Context) {
-	storeActor = NewStoreChannels(ctx)
+func AddTask(ctx context.Context, newItem string) (int64, error) {
+	return AddTaskWithTags(ctx, newItem, nil)
 }
 
-func AddTask(ctx context.Context, newItem string) (int64, error) {
+func AddTaskWithTags(ctx context.Context, newItem string, tags []string) (int64, error) {
 
 	if !isDescription(newItem) {
 		return 0, errors.New("description cannot be empty")
@@ -73,14 +102,87 @@ func AddTask(ctx context.Context, newItem string) (int64, error) {
 	// just using the psuedo random int64 number for now. to avoid changing all the code for ids to uuid at this point.
 	// So needs refactor !
 	item := newTodoListItem(newItem, StateNotStarted)
-	// sessionDatabase[nextKey] = item
-	record := TodoListRecord{item: item}
-	storeActor.Write(record)
+	item.Tags = normaliseTags(tags)
+	addMutex.Lock()
+	defer addMutex.Unlock()
+	if _, err := writeItem(item); err != nil {
+		logging.Log().ErrorContext(ctx, "Add item failed", "ID", item.Id, "err", err)
+		return 0, err
+	}
 
-	logging.Log().InfoContext(ctx, "Added item", "ID", item.Id, "description", newItem)
+	logging.Log().InfoContext(ctx, "Added item", "ID", item.Id, "description", newItem, "tags", item.Tags)
 	return item.Id, nil
 }
 
+// addMutex holds the adds off while AddItems reads the list and adds what it
+// chose from it, a task created in between is not missed by an import's
+// duplicate check
+var addMutex sync.Mutex
+
+// AddItem adds a copy of candidate under a new id keeping its state, created
+// time, priority, due time, tags, checklist and repeat rule, for imports. A zero created
+// time is now.
+func AddItem(ctx context.Context, candidate TodoListItem) (TodoListItem, error) {
+	addMutex.Lock()
+	defer addMutex.Unlock()
+	return addItem(ctx, candidate)
+}
+
+// AddItems adds the items choose picks given the list as it is, each as
+// AddItem would. No other add lands between the read and the last item going
+// in, so two imports, or an import and a create, cannot both add a task.
+// The items added before a failure are returned with it.
+func AddItems(ctx context.Context, choose func(List) []TodoListItem) ([]TodoListItem, error) {
+	addMutex.Lock()
+	defer addMutex.Unlock()
+	list, err := GetList()
+	if err != nil {
+		return nil, err
+	}
+	added := []TodoListItem{}
+	for _, candidate := range choose(list) {
+		item, err := addItem(ctx, candidate)
+		if err != nil {
+			return added, err
+		}
+		added = append(added, item)
+	}
+	return added, nil
+}
+
+func addItem(ctx context.Context, candidate TodoListItem) (TodoListItem, error) {
+	if !isDescription(candidate.Description) {
+		return TodoListItem{}, errors.New("description cannot be empty")
+	} else if !isState(candidate.State) {
+		return TodoListItem{}, errors.New("state is out of range")
+	}
+	priority, err := ParsePriority(candidate.Priority)
+	if err != nil {
+		return TodoListItem{}, err
+	}
+	item := newTodoListItem(candidate.Description, candidate.State)
+	if !candidate.Created.IsZero() {
+		item.Created = candidate.Created.UTC()
+	}
+	item.Priority = priority
+	item.Due = candidate.Due
+	item.Tags = normaliseTags(candidate.Tags)
+	item.Checklist = slices.Clone(candidate.Checklist)
+	if candidate.Recur != "" {
+		rule, err := ParseRecurrence(candidate.Recur)
+		if err != nil {
+			return TodoListItem{}, err
+		}
+		item.Recur = rule.String()
+	}
+	if _, err := writeItem(item); err != nil {
+		logging.Log().ErrorContext(ctx, "Add item failed", "ID", item.Id, "err", err)
+		return TodoListItem{}, err
+	}
+	logging.Log().InfoContext(ctx, "Added item", "ID", item.Id, "description", item.Description, "tags", item.Tags)
+	return item, nil
+}
+
 func newTodoListItem(description string, state int) TodoListItem {
 	newId := GenerateId()
 	item := TodoListItem{
@@ -89,49 +191,120 @@ func newTodoListItem(description string, state int) TodoListItem {
 		State:       state,
 		Created:     time.Now().UTC(),
 		Line:        newId,
+		Version:     1,
 	}
+	item.Updated = item.Created
+	now := tick()
+	item.Clocks = FieldClocks{Description: now, State: now, Tags: now, Priority: now, Due: now, Parent: now, Checklist: now, BlockedBy: now, Recur: now}
 	return item
 }
 
+// touch marks the item as changed now, stamping the fields that differ from before
+func touch(before TodoListItem, item *TodoListItem) {
+	now := tick()
+	item.Clocks = withClocks(before).Clocks
+	if item.Description != before.Description {
+		item.Clocks.Description = now
+	}
+	if item.State != before.State {
+		item.Clocks.State = now
+	}
+	if !slices.Equal(item.Tags, before.Tags) {
+		item.Clocks.Tags = now
+	}
+	if item.Priority != before.Priority {
+		item.Clocks.Priority = now
+	}
+	if !item.Due.Equal(before.Due) {
+		item.Clocks.Due = now
+	}
+	if item.placement() != before.placement() {
+		item.Clocks.Parent = now
+	}
+	if !slices.Equal(item.Checklist, before.Checklist) {
+		item.Clocks.Checklist = now
+	}
+	if !slices.Equal(item.BlockedBy, before.BlockedBy) {
+		item.Clocks.BlockedBy = now
+	}
+	if item.Recur != before.Recur {
+		item.Clocks.Recur = now
+	}
+	item.Version++
+	item.Updated = time.Now().UTC()
+}
+
 func DescriptionChange(ctx context.Context, index int64, newDescription string) error {
-	if len(sessionDatabase) > 0 {
-		if !isDescription(newDescription) {
-			return errors.New("description cannot be empty")
-		} else if record, ok := sessionDatabase[index]; !ok {
-			return fmt.Errorf("cannot find item %d", index)
-		} else {
-			fmt.Printf("Current description: %s\n", sessionDatabase[index].Description)
-			fmt.Printf("Changing task %d description to : %s\n", index, newDescription)
-			before := record.Description
-			record.Description = newDescription
-			sessionDatabase[index] = record
-			logging.Log().InfoContext(ctx, "Updated item description", "ID", index, "before", before, "after", newDescription)
-			return nil
-		}
+	if !isDescription(newDescription) {
+		return errors.New("description cannot be empty")
+	}
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find item %d", index)
 	}
-	return errors.New("cannot set description")
+	fmt.Printf("Current description: %s\n", record.item.Description)
+	fmt.Printf("Changing task %d description to : %s\n", index, newDescription)
+	previous := record.item
+	before := record.item.Description
+	record.item.Description = newDescription
+	touch(previous, &record.item)
+	if _, err := writeItem(record.item); err != nil {
+		return err
+	}
+	logging.Log().InfoContext(ctx, "Updated item description", "ID", index, "before", before, "after", newDescription)
+	return nil
 }
 
-// change the state
+// change the state, a blocked task is not started unless ctx overrides it
 func StateChange(ctx context.Context, index int64, state int) error {
-	if len(sessionDatabase) > 0 {
-		if !isState(state) {
-			return errors.New("state is out of range")
-		} else if record, ok := sessionDatabase[index]; !ok {
-			return fmt.Errorf("cannot find item %d", index)
-		} else {
-			fmt.Printf("Current state: %s\n", StatusName[sessionDatabase[index].State])
-			fmt.Printf("Changing task %d state to : %s\n", index, StatusName[state])
-			before := StatusName[sessionDatabase[index].State]
-			after := StatusName[state]
-			fmt.Printf("before:%s after:%s\n", before, after)
-			record.State = state
-			sessionDatabase[index] = record
-			logging.Log().InfoContext(ctx, "Updated item status", "ID", index, "before", before, "after", after)
-			return nil
-		}
+	if !isState(state) {
+		return errors.New("state is out of range")
+	}
+	blockerMutex.Lock()
+	defer blockerMutex.Unlock()
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find item %d", index)
+	}
+	if err := checkBlockers(ctx, record.item, state, nil); err != nil {
+		return err
+	}
+	before := StatusName[record.item.State]
+	after := StatusName[state]
+	fmt.Printf("Current state: %s\n", before)
+	fmt.Printf("Changing task %d state to : %s\n", index, after)
+	fmt.Printf("before:%s after:%s\n", before, after)
+	previous := record.item
+	record.item.State = state
+	next, found := handOn(previous, &record.item)
+	touch(previous, &record.item)
+	if err := writeWithNext(ctx, record.item, next, found); err != nil {
+		return err
+	}
+	logging.Log().InfoContext(ctx, "Updated item status", "ID", index, "before", before, "after", after)
+	return nil
+}
+
+// DueChange sets when the task is due, a zero time clears it
+func DueChange(ctx context.Context, index int64, due time.Time) error {
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find item %d", index)
+	}
+	previous := record.item
+	record.item.Due = due
+	touch(previous, &record.item)
+	if _, err := writeItem(record.item); err != nil {
+		return err
 	}
-	return errors.New("cannote set state")
+	logging.Log().InfoContext(ctx, "Updated item due", "ID", index, "before", previous.Due, "after", due)
+	return nil
 }
 
 func UpdateTask(ctx context.Context, item TodoListItem) (TodoListItem, error) {
@@ -140,20 +313,32 @@ func UpdateTask(ctx context.Context, item TodoListItem) (TodoListItem, error) {
 	} else if !isState(item.State) {
 		return TodoListItem{}, errors.New("state is out of range")
 	}
+	blockerMutex.Lock()
+	defer blockerMutex.Unlock()
 	//if current, ok := sessionDatabase[item.Line]; !ok {
-	record := storeActor.Read(item.Line)
+	record := readItem(item.Line)
 	ok := record.ok
 	current := record.item
-	if !ok {
-		empty := TodoListItem{}
-		return empty, fmt.Errorf("error: %s", "item not found")
+	if record.err != nil {
+		return TodoListItem{}, record.err
+	} else if !ok {
+		return TodoListItem{}, ErrNotFound
+	} else if err := checkBlockers(ctx, current, item.State, nil); err != nil {
+		return TodoListItem{}, err
 	} else {
+		previous := current
 		// only update the task and description
 		current.Description = item.Description
 		current.State = item.State
-		// sessionDatabase[item.Line] = current
-		record := TodoListRecord{item: current}
-		storeActor.Write(record)
+		// nil tags means leave them alone, an empty list clears them
+		if item.Tags != nil {
+			current.Tags = normaliseTags(item.Tags)
+		}
+		next, found := handOn(previous, &current)
+		touch(previous, &current)
+		if err := writeWithNext(ctx, current, next, found); err != nil {
+			return TodoListItem{}, err
+		}
 		index := item.Line
 		after := item.Description
 		logging.Log().InfoContext(ctx, "Updated item", "ID", index, "description", after)
@@ -163,36 +348,61 @@ func UpdateTask(ctx context.Context, item TodoListItem) (TodoListItem, error) {
 
 // delete a task
 func DeleteTask(ctx context.Context, index int64) error {
-	if len(sessionDatabase) > 0 {
-		if record, ok := sessionDatabase[index]; !ok {
-			return errors.New("item not found")
-		} else {
-			fmt.Printf("Deleting item: %d\n", index)
-			before := record.Description
-			fmt.Printf("before:%s\n", before)
-			delete(sessionDatabase, index)
-			logging.Log().InfoContext(ctx, "Deleted item", "ID", index, "before", before)
-			return nil
+	// no subtask is added or moved under the task between reading what it
+	// has and lifting them
+	treeMutex.Lock()
+	defer treeMutex.Unlock()
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return ErrNotFound
+	}
+	// the list is read before the delete and only when there are subtasks to
+	// lift, a list that cannot be read leaves the task in place rather than
+	// its subtasks under a parent that is gone
+	var items TodoListItems
+	if found, err := hasSubtasks(index); err != nil {
+		return err
+	} else if found {
+		list, err := mergedList()
+		if err != nil {
+			return err
 		}
+		items = list.Items()
+	}
+	fmt.Printf("Deleting item: %d\n", index)
+	before := record.item.Description
+	fmt.Printf("before:%s\n", before)
+	if record, err := removeItem(index); err != nil {
+		return err
+	} else if !record.ok {
+		return ErrNotFound
+	} else if !Remote() {
+		// kept so merging an older copy of the list does not bring it back
+		bury(record.item)
 	}
-	return errors.New("item cannot be deleted")
+	logging.Log().InfoContext(ctx, "Deleted item", "ID", index, "before", before)
+	// subtasks are kept, they take the deleted task's place
+	return liftChildren(ctx, items, record.item)
 }
 
-// task list report
+// task list report, subtasks indented under their parent
 func ListTask(index int64) {
-	fmt.Printf("\nList length:%d\n", len(sessionDatabase))
+	list, err := mergedList()
+	if err != nil {
+		fmt.Printf("\nCannot read the list: %v\n", err)
+		return
+	}
+	fmt.Printf("\nList length:%d\n", list.count)
 
 	listTaskHeader()
-	if len(sessionDatabase) > 0 {
-		if record, ok := sessionDatabase[index]; ok {
-			listTaskLine(record)
-		} else {
-			itemKeys := collectKeys(sessionDatabase)
-			slices.Sort(itemKeys)
-			for _, i := range itemKeys {
-				listTaskLine(sessionDatabase[i])
-			}
-		}
+	lines := subtree(list.Items(), index)
+	if lines == nil {
+		lines = Tree(list.Items())
+	}
+	for _, line := range lines {
+		listTaskLine(line)
 	}
 }
 
@@ -201,8 +411,36 @@ func listTaskHeader() {
 	fmt.Printf("%s\t%s\t%s\n", strings.Repeat("-", 1), strings.Repeat("-", 12), strings.Repeat("-", 120))
 }
 
-func listTaskLine(listItem TodoListItem) {
-	fmt.Printf("%d\t%s\t%s\t[%s]\n", listItem.Line, StatusName[listItem.State], listItem.Description, listItem.Created.Format(time.RFC822))
+func listTaskLine(line TreeLine) {
+	listItem := line.Item
+	indent := strings.Repeat("  ", line.Depth)
+	done := ""
+	if line.Progress.Total > 0 {
+		done = " (" + line.Progress.String() + ")"
+	}
+	tags := ""
+	if len(listItem.Tags) > 0 {
+		tags = " #" + strings.Join(listItem.Tags, " #")
+	}
+	due := ""
+	if !listItem.Due.IsZero() {
+		due = " due " + listItem.Due.Format(time.DateOnly)
+	}
+	if listItem.Recur != "" {
+		due += " repeats " + DescribeRecur(listItem.Recur)
+	}
+	blocked := ""
+	if len(line.Blockers) > 0 {
+		blocked = " blocked by " + joinLines(line.Blockers)
+	}
+	fmt.Printf("%d\t%s\t%s%s%s%s%s%s\t[%s]\n", listItem.Line, StatusName[listItem.State], indent, listItem.Description, done, tags, due, blocked, listItem.Created.Format(time.RFC822))
+	for i, step := range listItem.Checklist {
+		mark := " "
+		if step.Done {
+			mark = "x"
+		}
+		fmt.Printf("\t\t%s  %d [%s] %s\n", indent, i+1, mark, step.Text)
+	}
 }
 
 // fetch the number keys from the map
@@ -228,6 +466,35 @@ func isDescription(description string) bool {
 	return description != ""
 }
 
+// ParseTags splits a comma separated tag list as typed on the cli or in a web form
+func ParseTags(value string) []string {
+	return normaliseTags(strings.Split(value, ","))
+}
+
+// tags are trimmed, lower case and unique, keeping the order given
+func normaliseTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	clean := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(t), "#")))
+		if t != "" && !slices.Contains(clean, t) {
+			clean = append(clean, t)
+		}
+	}
+	return clean
+}
+
+// ParsePriority is a letter A to Z, in any case and with or without (), or empty for none
+func ParsePriority(value string) (string, error) {
+	p := strings.ToUpper(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "("), ")"))
+	if p == "" || len(p) == 1 && p[0] >= 'A' && p[0] <= 'Z' {
+		return p, nil
+	}
+	return "", fmt.Errorf("priority %q is not a letter A to Z", value)
+}
+
 func isState(state int) bool {
 	states := make([]int, 0, len(StatusName))
 	for i := range StatusName {
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"slices"
 	"testing"
 	"time"
 
@@ -117,6 +118,23 @@ func TestDescriptionChange(t *testing.T) {
 	}
 }
 
+func TestVersionBump(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	added, _ := AddTask(ctx, "versioned")
+	created, _ := GetByIndex(added)
+	if created.Version != 1 || !created.Updated.Equal(created.Created) {
+		t.Errorf("new item wanted version 1 updated when created got %+v", created)
+	}
+	StateChange(ctx, added, StateStarted)
+	DescriptionChange(ctx, added, "versioned again")
+	changed, _ := GetByIndex(added)
+	if changed.Version != 3 || changed.Updated.Before(created.Updated) {
+		t.Errorf("two changes wanted version 3 got %+v", changed)
+	}
+}
+
 func TestUpdateTask(t *testing.T) {
 	var tests = []struct {
 		description string
@@ -229,3 +247,61 @@ func TestDeleteTask(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTags(t *testing.T) {
+	var tests = []struct {
+		value string
+		want  []string
+	}{
+		{value: "home,garden", want: []string{"home", "garden"}},
+		{value: " Home , #garden,, home ", want: []string{"home", "garden"}},
+		{value: "", want: []string{}},
+	}
+
+	for i, tc := range tests {
+		got := ParseTags(tc.value)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("test %d ParseTags(%q) = %v, want %v", i, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestUpdateTaskTags(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+
+	added, ok := AddTaskWithTags(ctx, "Original task description buy apples", []string{"shopping"})
+	if ok != nil {
+		t.Fatalf("item not added %s", ok)
+	}
+	// nil tags leave the tags alone
+	if updated, _ := UpdateTask(ctx, TodoListItem{Line: added, Description: "buy pears", State: StateStarted}); !slices.Equal(updated.Tags, []string{"shopping"}) {
+		t.Errorf("tags should be kept got %v", updated.Tags)
+	}
+	// an empty list clears them
+	if updated, _ := UpdateTask(ctx, TodoListItem{Line: added, Description: "buy pears", State: StateStarted, Tags: []string{}}); len(updated.Tags) != 0 {
+		t.Errorf("tags should be cleared got %v", updated.Tags)
+	}
+}
+
+func TestSetStates(t *testing.T) {
+	original := StatusName
+	defer func() { StatusName = original }()
+	var tests = []struct {
+		names []string
+		want  bool
+	}{
+		{names: []string{"Todo", "Doing", "Done", "Archived"}, want: true},
+		{names: []string{"Todo", "Done"}, want: false},
+		{names: []string{"Todo", "", "Done"}, want: false},
+	}
+
+	for i, tc := range tests {
+		if ok := SetStates(tc.names); tc.want != (ok == nil) {
+			t.Errorf("test %d want ok %t got %v", i, tc.want, ok)
+		} else if tc.want && (len(StatusName) != len(tc.names) || !isState(len(tc.names)-1) || isState(len(tc.names))) {
+			t.Errorf("test %d states not applied %v", i, StatusName)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/anthriscus/appcli/metrics"
+)
+
+var (
+	saveSeconds  = metrics.NewHistogram("appcli_store_save_seconds", "Time taken to save the todo list file.", metrics.DefaultBuckets)
+	saveFailures = metrics.NewCounter("appcli_store_save_failures_total", "Saves of the todo list file that failed.")
+
+	_ = metrics.NewGaugeFunc("appcli_store_items", "Todo list items in each workflow state.", "state", itemsByState)
+	_ = metrics.NewGaugeFunc("appcli_store_unsaved_changes", "Changes not yet written to the todo list file.", "", func() map[string]float64 {
+		return map[string]float64{"": float64(Stats().Unsaved)}
+	})
+)
+
+// items in each workflow state, kept by the shard actors as they write so a
+// scrape of /metrics reads no list
+var states = struct {
+	sync.Mutex
+	count map[int]int
+}{count: map[int]int{}}
+
+// restated records a write taking an item out of one state and into another,
+// nil for no item before or after
+func restated(before *TodoListItem, after *TodoListItem) {
+	if before != nil && after != nil && before.State == after.State {
+		return
+	}
+	states.Lock()
+	defer states.Unlock()
+	if before != nil {
+		if states.count[before.State] <= 1 {
+			delete(states.count, before.State)
+		} else {
+			states.count[before.State]--
+		}
+	}
+	if after != nil {
+		states.count[after.State]++
+	}
+}
+
+// countStates starts the counts again from the whole list
+func countStates(items TodoListItems) {
+	states.Lock()
+	defer states.Unlock()
+	clear(states.count)
+	for _, item := range items {
+		states.count[item.State]++
+	}
+}
+
+// the gauge is left empty with a backend, each store server holds a part of
+// the list and counting it here would fetch all of it on every scrape
+func itemsByState() map[string]float64 {
+	counts := map[string]float64{}
+	if !ActorRunning() || Remote() {
+		return counts
+	}
+	byState, err := CountByState()
+	if err != nil {
+		return counts
+	}
+	for state, n := range byState {
+		counts[StatusName[state]] = float64(n)
+	}
+	return counts
+}
+
+// CountByState counts the items in each workflow state, every state is
+// present. A backend has its list read.
+func CountByState() (map[int]int, error) {
+	if backend == nil {
+		states.Lock()
+		defer states.Unlock()
+		counts := make(map[int]int, len(StatusName))
+		for state := range StatusName {
+			counts[state] = 0
+		}
+		maps.Copy(counts, states.count)
+		return counts, nil
+	}
+	list, err := mergedList()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int, len(StatusName))
+	for state := range StatusName {
+		counts[state] = 0
+	}
+	for item := range list.All() {
+		counts[item.State]++
+	}
+	return counts, nil
+}
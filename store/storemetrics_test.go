@@ -0,0 +1,54 @@
+package store
+
+import (
+	"maps"
+	"testing"
+)
+
+// the counts kept by the actors match a count of the list after each change
+func TestCountByState(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	first, _ := AddTask(ctx, "Sweep the yard")
+	second, _ := AddTask(ctx, "Wash the car")
+
+	var tests = []struct {
+		name   string
+		change func() error
+	}{
+		{"added", func() error { return nil }},
+		{"started", func() error { return StateChange(ctx, first, StateStarted) }},
+		{"completed", func() error { return StateChange(ctx, first, StateCompleted) }},
+		{"renamed", func() error { return DescriptionChange(ctx, second, "Wash the van") }},
+		{"deleted", func() error { return DeleteTask(ctx, first) }},
+	}
+	for _, tc := range tests {
+		if ok := tc.change(); ok != nil {
+			t.Fatalf("%s: %v", tc.name, ok)
+		}
+		want := map[int]int{}
+		for state := range StatusName {
+			want[state] = 0
+		}
+		for item := range localList().All() {
+			want[item.State]++
+		}
+		if got, ok := CountByState(); ok != nil || !maps.Equal(got, want) {
+			t.Errorf("%s: got %v wanted %v", tc.name, got, want)
+		}
+	}
+	DeleteTask(ctx, second)
+}
+
+// a scrape with a backend reads no list from the store servers
+func TestItemsByStateRemote(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	b := &memoryBackend{items: TodoListItems{}}
+	SetBackend(b)
+	defer SetBackend(nil)
+	if got := itemsByState(); len(got) != 0 || b.lists != 0 {
+		t.Errorf("wanted no counts and no list read, got %v after %d reads", got, b.lists)
+	}
+}
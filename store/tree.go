@@ -0,0 +1,570 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/anthriscus/appcli/logging"
+)
+
+// Tasks form a tree, a task with a parent is one of its subtasks and is
+// ordered among its siblings by rank. A task may also hold a checklist of
+// steps too small to be tasks of their own. A parent's progress counts both.
+
+// Subtasks is how many subtasks a parent has and the highest rank given to
+// one, the next subtask added or moved under it ranks after that
+type Subtasks struct {
+	Count int   `json:"count"`
+	Rank  int64 `json:"rank"`
+}
+
+// SubtaskBackend is a Backend that can say what is under a parent without
+// the whole list, such as by asking each store server for its own count
+type SubtaskBackend interface {
+	Subtasks(ctx context.Context, parent int64) (Subtasks, error)
+}
+
+// the subtasks under each parent line in the local shards, kept by the shard
+// actors so a delete knows without reading the list whether it has subtasks
+// to lift and an add or move knows the rank to give. The rank is the highest
+// seen while the parent has subtasks, a reorder lowering it leaves a gap.
+var subtasks = struct {
+	sync.Mutex
+	under map[int64]Subtasks
+}{under: map[int64]Subtasks{}}
+
+// treeMutex holds the tree's checks and the writes after them together, the
+// parent loop check of a move and the rank of an added or moved subtask, and
+// a delete's read of the subtasks it lifts
+var treeMutex sync.Mutex
+
+// reparented records a task moving from one parent to another, 0 for none,
+// with its rank under the new one
+func reparented(from int64, to int64, rank int64) {
+	if from == 0 && to == 0 {
+		return
+	}
+	subtasks.Lock()
+	defer subtasks.Unlock()
+	if from != 0 && from != to {
+		if s := subtasks.under[from]; s.Count <= 1 {
+			delete(subtasks.under, from)
+		} else {
+			s.Count--
+			subtasks.under[from] = s
+		}
+	}
+	if to != 0 {
+		s := subtasks.under[to]
+		if from != to {
+			s.Count++
+		}
+		s.Rank = max(s.Rank, rank)
+		subtasks.under[to] = s
+	}
+}
+
+// countSubtasks starts the index again from the whole list
+func countSubtasks(items TodoListItems) {
+	subtasks.Lock()
+	defer subtasks.Unlock()
+	clear(subtasks.under)
+	for _, item := range items {
+		if item.Parent != 0 {
+			s := subtasks.under[item.Parent]
+			s.Count++
+			s.Rank = max(s.Rank, item.Rank)
+			subtasks.under[item.Parent] = s
+		}
+	}
+}
+
+// SubtasksOf is what is under parent, from the shard index or the backend.
+// A backend that cannot count them has its list read.
+func SubtasksOf(parent int64) (Subtasks, error) {
+	if backend == nil {
+		subtasks.Lock()
+		defer subtasks.Unlock()
+		return subtasks.under[parent], nil
+	}
+	if b, ok := backend.(SubtaskBackend); ok {
+		ctx, cancel := backendContext()
+		defer cancel()
+		return b.Subtasks(ctx, parent)
+	}
+	list, err := remoteList()
+	if err != nil {
+		return Subtasks{}, err
+	}
+	var s Subtasks
+	for _, child := range childrenOf(list.Items(), parent) {
+		s.Count++
+		s.Rank = max(s.Rank, child.Rank)
+	}
+	return s, nil
+}
+
+// the task has subtasks
+func hasSubtasks(line int64) (bool, error) {
+	s, err := SubtasksOf(line)
+	return s.Count > 0, err
+}
+
+// the rank after the last subtask of parent
+func nextRank(parent int64) (int64, error) {
+	s, err := SubtasksOf(parent)
+	return s.Rank + 1, err
+}
+
+// CheckItem is one step of a task's checklist
+type CheckItem struct {
+	Text string `json:"text"`
+	Done bool   `json:"done,omitempty"`
+}
+
+// Progress is how many of a task's subtasks and checklist items are done
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+func (p Progress) String() string {
+	return fmt.Sprintf("%d/%d", p.Done, p.Total)
+}
+
+// TreeLine is a task, how deep it sits, 0 at the top, its progress and the
+// tasks blocking it that are not completed
+type TreeLine struct {
+	Item     TodoListItem
+	Depth    int
+	Progress Progress
+	Blockers []int64
+}
+
+// the subtasks of parent in rank order
+func childrenOf(items TodoListItems, parent int64) []TodoListItem {
+	return childIndex(items)[parent]
+}
+
+// the subtasks of every task in rank order, by the parent's line, built once
+// so walking the tree does not scan the list for each task
+func childIndex(items TodoListItems) map[int64][]TodoListItem {
+	index := map[int64][]TodoListItem{}
+	for _, item := range items {
+		if item.Parent != item.Line {
+			index[item.Parent] = append(index[item.Parent], item)
+		}
+	}
+	for _, children := range index {
+		slices.SortFunc(children, byRank)
+	}
+	return index
+}
+
+func byRank(a TodoListItem, b TodoListItem) int {
+	if c := cmp.Compare(a.Rank, b.Rank); c != 0 {
+		return c
+	}
+	return byLine(a, b)
+}
+
+// Children is the subtasks of the task in rank order
+func Children(parent int64) ([]TodoListItem, error) {
+	list, err := mergedList()
+	if err != nil {
+		return nil, err
+	}
+	return childrenOf(list.Items(), parent), nil
+}
+
+// TaskProgress counts the task's completed subtasks, as from Children, and
+// ticked checklist items
+func TaskProgress(item TodoListItem, children []TodoListItem) Progress {
+	return progressOf(item, children)
+}
+
+func progressOf(item TodoListItem, children []TodoListItem) Progress {
+	var p Progress
+	for _, child := range children {
+		p.Total++
+		if child.State == StateCompleted {
+			p.Done++
+		}
+	}
+	for _, step := range item.Checklist {
+		p.Total++
+		if step.Done {
+			p.Done++
+		}
+	}
+	return p
+}
+
+// Tree is every task depth first, top level tasks in line order and subtasks
+// under their parent, each after the tasks blocking it. A task whose parent
+// is gone is at the top, as is one left in a loop by merging two copies
+// that each moved a task.
+func Tree(items TodoListItems) []TreeLine {
+	index := listIndex(items)
+	lines := make([]TreeLine, 0, len(items))
+	seen := make(map[int64]bool, len(items))
+	for _, item := range index[0] {
+		lines = appendTree(lines, items, index, seen, item, 0)
+	}
+	for _, item := range slices.SortedFunc(maps.Values(items), byLine) {
+		lines = appendTree(lines, items, index, seen, item, 0)
+	}
+	return lines
+}
+
+// the task and everything under it, depth counted from the task
+func subtree(items TodoListItems, id int64) []TreeLine {
+	item, found := items[id]
+	if !found {
+		return nil
+	}
+	return appendTree(nil, items, listIndex(items), map[int64]bool{}, item, 0)
+}
+
+// listIndex is childIndex in the order the list shows, the top level tasks
+// under 0 with those whose parent is gone
+func listIndex(items TodoListItems) map[int64][]TodoListItem {
+	index := childIndex(items)
+	roots := []TodoListItem{}
+	for _, item := range slices.SortedFunc(maps.Values(items), byLine) {
+		if _, found := items[item.Parent]; item.Parent == 0 || !found {
+			roots = append(roots, item)
+		}
+	}
+	index[0] = roots
+	orderByBlockers(items, index)
+	return index
+}
+
+func appendTree(lines []TreeLine, items TodoListItems, index map[int64][]TodoListItem, seen map[int64]bool, item TodoListItem, depth int) []TreeLine {
+	if seen[item.Line] {
+		return lines
+	}
+	seen[item.Line] = true
+	children := index[item.Line]
+	lines = append(lines, TreeLine{Item: item, Depth: depth, Progress: progressOf(item, children), Blockers: openBlockers(items, item, nil)})
+	for _, child := range children {
+		lines = appendTree(lines, items, index, seen, child, depth+1)
+	}
+	return lines
+}
+
+// AddSubtask adds a task under parent, after its other subtasks
+func AddSubtask(ctx context.Context, parent int64, description string, tags []string) (int64, error) {
+	if !isDescription(description) {
+		return 0, errors.New("description cannot be empty")
+	}
+	treeMutex.Lock()
+	defer treeMutex.Unlock()
+	if record := readItem(parent); record.err != nil {
+		return 0, record.err
+	} else if !record.ok {
+		return 0, fmt.Errorf("cannot find parent %d", parent)
+	}
+	rank, err := nextRank(parent)
+	if err != nil {
+		return 0, err
+	}
+	item := newTodoListItem(description, StateNotStarted)
+	item.Tags = normaliseTags(tags)
+	item.Parent = parent
+	item.Rank = rank
+	if _, err := writeItem(item); err != nil {
+		logging.Log().ErrorContext(ctx, "Add subtask failed", "ID", item.Id, "parent", parent, "err", err)
+		return 0, err
+	}
+	logging.Log().InfoContext(ctx, "Added subtask", "ID", item.Id, "parent", parent, "description", description)
+	return item.Id, nil
+}
+
+// MoveTask makes the task a subtask of parent, after its other subtasks,
+// or a top level task when parent is 0
+func MoveTask(ctx context.Context, index int64, parent int64) error {
+	// the loop check holds until the write, two moves of a task under each
+	// other cannot both pass it
+	treeMutex.Lock()
+	defer treeMutex.Unlock()
+	// walking up from the new parent must not reach the task
+	seen := map[int64]bool{}
+	for up := parent; up != 0 && !seen[up]; {
+		if up == index {
+			return fmt.Errorf("task %d cannot be a subtask of itself or its own subtask %d", index, parent)
+		}
+		seen[up] = true
+		record := readItem(up)
+		if record.err != nil {
+			return record.err
+		} else if !record.ok {
+			if up == parent {
+				return fmt.Errorf("cannot find parent %d", parent)
+			}
+			break
+		}
+		up = record.item.Parent
+	}
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find item %d", index)
+	}
+	if record.item.Parent == parent {
+		return nil
+	}
+	rank, err := nextRank(parent)
+	if err != nil {
+		return err
+	}
+	previous := record.item
+	record.item.Parent = parent
+	record.item.Rank = rank
+	touch(previous, &record.item)
+	if _, err := writeItem(record.item); err != nil {
+		return err
+	}
+	logging.Log().InfoContext(ctx, "Moved item", "ID", index, "before", previous.Parent, "after", parent)
+	return nil
+}
+
+// ReorderChildren ranks the subtasks of parent in the order given, which
+// must name each of them once
+func ReorderChildren(ctx context.Context, parent int64, order []int64) error {
+	children, err := Children(parent)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(children))
+	for _, child := range children {
+		ids = append(ids, child.Line)
+	}
+	given := slices.Clone(order)
+	slices.Sort(given)
+	if !slices.Equal(given, slices.Sorted(slices.Values(ids))) {
+		return fmt.Errorf("the order must list each of the %d subtasks of %d once", len(ids), parent)
+	}
+	for i, id := range order {
+		record := readItem(id)
+		if record.err != nil {
+			return record.err
+		} else if !record.ok {
+			return fmt.Errorf("cannot find item %d", id)
+		}
+		if record.item.Rank == int64(i+1) {
+			continue
+		}
+		previous := record.item
+		record.item.Rank = int64(i + 1)
+		touch(previous, &record.item)
+		if _, err := writeItem(record.item); err != nil {
+			return err
+		}
+	}
+	logging.Log().InfoContext(ctx, "Reordered subtasks", "parent", parent, "order", order)
+	return nil
+}
+
+// StateChangeTree changes the state of the task and every task under it,
+// completing them ticks their checklists too. Nothing changes when one of
+// them is blocked by a task outside the tree.
+func StateChangeTree(ctx context.Context, index int64, state int) error {
+	if !isState(state) {
+		return errors.New("state is out of range")
+	}
+	blockerMutex.Lock()
+	defer blockerMutex.Unlock()
+	list, err := mergedList()
+	if err != nil {
+		return err
+	}
+	items := list.Items()
+	lines := subtree(items, index)
+	if lines == nil {
+		return fmt.Errorf("cannot find item %d", index)
+	}
+	done := map[int64]bool{}
+	if state == StateCompleted {
+		for _, line := range lines {
+			done[line.Item.Line] = true
+		}
+	}
+	for _, line := range lines {
+		if err := checkBlockers(ctx, line.Item, state, done); err != nil {
+			return err
+		}
+	}
+	for _, line := range lines {
+		record := readItem(line.Item.Line)
+		if record.err != nil {
+			return record.err
+		} else if !record.ok {
+			continue
+		}
+		previous := record.item
+		record.item.State = state
+		if state == StateCompleted {
+			record.item.Checklist = tickAll(record.item.Checklist)
+		}
+		next, found := handOn(previous, &record.item)
+		touch(previous, &record.item)
+		if err := writeWithNext(ctx, record.item, next, found); err != nil {
+			return err
+		}
+	}
+	logging.Log().InfoContext(ctx, "Updated tree status", "ID", index, "tasks", len(lines), "after", StatusName[state])
+	return nil
+}
+
+func tickAll(steps []CheckItem) []CheckItem {
+	ticked := slices.Clone(steps)
+	for i := range ticked {
+		ticked[i].Done = true
+	}
+	return ticked
+}
+
+// DeleteTree deletes the task and every task under it
+func DeleteTree(ctx context.Context, index int64) error {
+	list, err := mergedList()
+	if err != nil {
+		return err
+	}
+	lines := subtree(list.Items(), index)
+	if lines == nil {
+		return ErrNotFound
+	}
+	// deepest first so no subtask is lifted up on the way
+	slices.Reverse(lines)
+	for _, line := range lines {
+		if err := DeleteTask(ctx, line.Item.Line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liftChildren gives the subtasks of a deleted task its parent, after the
+// parent's other subtasks and in the order they were. items is the list as
+// read before the delete, nil when the task had no subtasks.
+func liftChildren(ctx context.Context, items TodoListItems, deleted TodoListItem) error {
+	children := childrenOf(items, deleted.Line)
+	if len(children) == 0 {
+		return nil
+	}
+	rank, err := nextRank(deleted.Parent)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		record := readItem(child.Line)
+		if record.err != nil {
+			return record.err
+		} else if !record.ok {
+			continue
+		}
+		previous := record.item
+		record.item.Parent = deleted.Parent
+		record.item.Rank = rank
+		rank++
+		touch(previous, &record.item)
+		if _, err := writeItem(record.item); err != nil {
+			return err
+		}
+		logging.Log().InfoContext(ctx, "Lifted subtask", "ID", child.Line, "parent", deleted.Parent)
+	}
+	return nil
+}
+
+// changeChecklist rewrites the task's checklist with change, which is
+// given a copy it may modify
+func changeChecklist(ctx context.Context, index int64, change func([]CheckItem) ([]CheckItem, error)) error {
+	record := readItem(index)
+	if record.err != nil {
+		return record.err
+	} else if !record.ok {
+		return fmt.Errorf("cannot find item %d", index)
+	}
+	steps, err := change(slices.Clone(record.item.Checklist))
+	if err != nil {
+		return err
+	}
+	previous := record.item
+	record.item.Checklist = steps
+	touch(previous, &record.item)
+	if _, err := writeItem(record.item); err != nil {
+		return err
+	}
+	logging.Log().InfoContext(ctx, "Updated item checklist", "ID", index, "steps", len(steps))
+	return nil
+}
+
+// checklist items are numbered from 1 as shown in the list
+func checkIndex(steps []CheckItem, n int) (int, error) {
+	if n < 1 || n > len(steps) {
+		return 0, fmt.Errorf("checklist item %d is out of range, the task has %d", n, len(steps))
+	}
+	return n - 1, nil
+}
+
+// AddCheckItem adds a step to the end of the task's checklist
+func AddCheckItem(ctx context.Context, index int64, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return errors.New("checklist item cannot be empty")
+	}
+	return changeChecklist(ctx, index, func(steps []CheckItem) ([]CheckItem, error) {
+		return append(steps, CheckItem{Text: text}), nil
+	})
+}
+
+// CheckItemDone ticks or unticks step n of the task's checklist
+func CheckItemDone(ctx context.Context, index int64, n int, done bool) error {
+	return changeChecklist(ctx, index, func(steps []CheckItem) ([]CheckItem, error) {
+		i, err := checkIndex(steps, n)
+		if err != nil {
+			return nil, err
+		}
+		steps[i].Done = done
+		return steps, nil
+	})
+}
+
+// RemoveCheckItem removes step n of the task's checklist
+func RemoveCheckItem(ctx context.Context, index int64, n int) error {
+	return changeChecklist(ctx, index, func(steps []CheckItem) ([]CheckItem, error) {
+		i, err := checkIndex(steps, n)
+		if err != nil {
+			return nil, err
+		}
+		return slices.Delete(steps, i, i+1), nil
+	})
+}
+
+// ReorderChecklist puts the steps in the order given by their numbers,
+// which must name each of them once
+func ReorderChecklist(ctx context.Context, index int64, order []int) error {
+	return changeChecklist(ctx, index, func(steps []CheckItem) ([]CheckItem, error) {
+		valid := len(order) == len(steps)
+		for i, n := range slices.Sorted(slices.Values(order)) {
+			valid = valid && n == i+1
+		}
+		if !valid {
+			return nil, fmt.Errorf("the order must list each of the %d checklist items once", len(steps))
+		}
+		ordered := make([]CheckItem, 0, len(steps))
+		for _, n := range order {
+			ordered = append(ordered, steps[n-1])
+		}
+		return ordered, nil
+	})
+}
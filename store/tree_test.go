@@ -0,0 +1,242 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// the tree as id:depth:progress, 1:0:1/2 2:1:0/0 ...
+func treeString(lines []TreeLine) string {
+	parts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		parts = append(parts, fmt.Sprintf("%d:%d:%s", line.Item.Line, line.Depth, line.Progress))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTree(t *testing.T) {
+	items := TodoListItems{
+		1: {Line: 1, Checklist: []CheckItem{{Text: "a", Done: true}}},
+		2: {Line: 2, Parent: 1, Rank: 2, State: StateCompleted},
+		3: {Line: 3, Parent: 1, Rank: 1},
+		4: {Line: 4, Parent: 3, Rank: 1},
+		5: {Line: 5, Parent: 99}, // parent deleted in another copy
+		6: {Line: 6, Parent: 7},  // a loop left by two merged moves
+		7: {Line: 7, Parent: 6},
+	}
+	want := "1:0:2/3 3:1:0/1 4:2:0/0 2:1:0/0 5:0:0/0 6:0:0/1 7:1:0/1"
+	if got := treeString(Tree(items)); got != want {
+		t.Errorf("wanted %s got %s", want, got)
+	}
+	if got := treeString(subtree(items, 3)); got != "3:0:0/1 4:1:0/0" {
+		t.Errorf("subtree of 3 got %s", got)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	parent, _ := AddTask(ctx, "Paint the shed")
+	first, _ := AddSubtask(ctx, parent, "Buy paint", nil)
+	second, _ := AddSubtask(ctx, parent, "Sand the walls", nil)
+	grandchild, _ := AddSubtask(ctx, first, "Pick a colour", nil)
+	if _, ok := AddSubtask(ctx, 12345, "Nowhere", nil); ok == nil {
+		t.Error("a subtask of a missing task was added")
+	}
+	lines := func() []int64 {
+		ids := []int64{}
+		children, ok := Children(parent)
+		if ok != nil {
+			t.Fatal(ok)
+		}
+		for _, child := range children {
+			ids = append(ids, child.Line)
+		}
+		return ids
+	}
+
+	if got := lines(); !slices.Equal(got, []int64{first, second}) {
+		t.Errorf("subtasks wanted in the order added got %v", got)
+	}
+	if ok := ReorderChildren(ctx, parent, []int64{second, first}); ok != nil {
+		t.Fatal(ok)
+	}
+	if got := lines(); !slices.Equal(got, []int64{second, first}) {
+		t.Errorf("reorder wanted %v got %v", []int64{second, first}, got)
+	}
+	if ok := ReorderChildren(ctx, parent, []int64{second}); ok == nil {
+		t.Error("an order missing a subtask was taken")
+	}
+	if ok := MoveTask(ctx, parent, grandchild); ok == nil {
+		t.Error("a task was moved under its own subtask")
+	}
+
+	if ok := StateChange(ctx, second, StateCompleted); ok != nil {
+		t.Fatal(ok)
+	}
+	AddCheckItem(ctx, parent, "Move the bikes")
+	item, _ := GetByIndex(parent)
+	children, _ := Children(parent)
+	if got := TaskProgress(item, children); got != (Progress{Done: 1, Total: 3}) {
+		t.Errorf("progress wanted 1/3 got %s", got)
+	}
+
+	// the grandchild takes its deleted parent's place
+	if ok := DeleteTask(ctx, first); ok != nil {
+		t.Fatal(ok)
+	}
+	if got := lines(); !slices.Equal(got, []int64{second, grandchild}) {
+		t.Errorf("after the delete wanted %v got %v", []int64{second, grandchild}, got)
+	}
+
+	if ok := StateChangeTree(ctx, parent, StateCompleted); ok != nil {
+		t.Fatal(ok)
+	}
+	for _, line := range subtree(localList().Items(), parent) {
+		if line.Item.State != StateCompleted || line.Progress.Done != line.Progress.Total {
+			t.Errorf("cascade left %d %s with %s done", line.Item.Line, StatusName[line.Item.State], line.Progress)
+		}
+	}
+	if ok := DeleteTree(ctx, parent); ok != nil || Count() != 0 {
+		t.Errorf("delete tree left %d tasks %v", Count(), ok)
+	}
+}
+
+func TestChecklist(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	id, _ := AddTask(ctx, "Pack for the trip")
+	for _, step := range []string{"passport", "tickets", "charger"} {
+		if ok := AddCheckItem(ctx, id, step); ok != nil {
+			t.Fatal(ok)
+		}
+	}
+	var tests = []struct {
+		name   string
+		change func() error
+		want   string
+		err    bool
+	}{
+		{name: "tick", change: func() error { return CheckItemDone(ctx, id, 2, true) }, want: "passport tickets+ charger"},
+		{name: "out of range", change: func() error { return CheckItemDone(ctx, id, 4, true) }, err: true},
+		{name: "reorder", change: func() error { return ReorderChecklist(ctx, id, []int{3, 1, 2}) }, want: "charger passport tickets+"},
+		{name: "reorder repeats", change: func() error { return ReorderChecklist(ctx, id, []int{1, 1, 2}) }, err: true},
+		{name: "remove", change: func() error { return RemoveCheckItem(ctx, id, 1) }, want: "passport tickets+"},
+		{name: "empty", change: func() error { return AddCheckItem(ctx, id, " ") }, err: true},
+	}
+	for _, tc := range tests {
+		if ok := tc.change(); tc.err != (ok != nil) {
+			t.Errorf("%s: wanted error %t got %v", tc.name, tc.err, ok)
+			continue
+		}
+		if tc.err {
+			continue
+		}
+		item, _ := GetByIndex(id)
+		steps := []string{}
+		for _, step := range item.Checklist {
+			if step.Done {
+				step.Text += "+"
+			}
+			steps = append(steps, step.Text)
+		}
+		if got := strings.Join(steps, " "); got != tc.want {
+			t.Errorf("%s: wanted %s got %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+// the subtask counts follow adds, moves and deletes, so a delete only reads
+// the whole list when there is something to lift
+func TestSubtaskIndex(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	parent, _ := AddTask(ctx, "Paint the shed")
+	other, _ := AddTask(ctx, "Clear the garden")
+	child, _ := AddSubtask(ctx, parent, "Buy paint", nil)
+	leaf, _ := AddSubtask(ctx, child, "Pick a colour", nil)
+
+	var tests = []struct {
+		name   string
+		change func() error
+		want   map[int64]bool
+	}{
+		{"added", func() error { return nil }, map[int64]bool{parent: true, child: true, other: false, leaf: false}},
+		{"moved", func() error { return MoveTask(ctx, leaf, other) }, map[int64]bool{parent: true, child: false, other: true}},
+		{"moved to the top", func() error { return MoveTask(ctx, leaf, 0) }, map[int64]bool{other: false}},
+		{"deleted", func() error { return DeleteTask(ctx, child) }, map[int64]bool{parent: false}},
+	}
+	for _, tc := range tests {
+		if ok := tc.change(); ok != nil {
+			t.Fatalf("%s: %v", tc.name, ok)
+		}
+		for line, want := range tc.want {
+			if got, ok := hasSubtasks(line); ok != nil || got != want {
+				t.Errorf("%s: %d has subtasks %v wanted %v", tc.name, line, got, want)
+			}
+		}
+	}
+
+	// deleting a task with no subtasks leaves the list unread
+	before := localList()
+	if ok := DeleteTask(ctx, leaf); ok != nil {
+		t.Fatal(ok)
+	}
+	if merged.Load() != before {
+		t.Error("the list was read to delete a task with no subtasks")
+	}
+	setList(TodoListItems{1: {Line: 1}, 2: {Line: 2, Parent: 1, Rank: 4}, 3: {Line: 3, Parent: 1, Rank: 2}})
+	if got, _ := SubtasksOf(1); got != (Subtasks{Count: 2, Rank: 4}) {
+		t.Errorf("subtasks not counted again for a new list, got %+v", got)
+	}
+	if got, _ := SubtasksOf(2); got != (Subtasks{}) {
+		t.Errorf("a task with no subtasks counted %+v", got)
+	}
+	resetList()
+}
+
+// two tasks moved under each other at once, one move is refused
+func TestMoveTaskRace(t *testing.T) {
+	ctx := t.Context()
+	StartActor(ctx)
+	resetList()
+	defer resetList()
+	for range 50 {
+		a, _ := AddTask(ctx, "Build the walls")
+		b, _ := AddTask(ctx, "Fit the roof")
+		var taken atomic.Int32
+		var wg sync.WaitGroup
+		for _, move := range [][2]int64{{a, b}, {b, a}} {
+			wg.Go(func() {
+				if MoveTask(ctx, move[0], move[1]) == nil {
+					taken.Add(1)
+				}
+			})
+		}
+		wg.Wait()
+		if taken.Load() != 1 {
+			t.Fatalf("wanted one of the two moves taken got %d", taken.Load())
+		}
+	}
+}
+
+// adding and moving subtasks reads the items it needs, not the whole list
+func TestTreeWriteCost(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmarks a 100k item list")
+	}
+	waitActors(t)
+	for name, bench := range map[string]func(*testing.B){"add": BenchmarkAddSubtask100k, "move": BenchmarkMoveTask100k} {
+		result := testing.Benchmark(bench)
+		if bytes := result.AllocedBytesPerOp(); bytes > 64<<10 {
+			t.Errorf("%s allocated %d bytes a subtask, the list is being read", name, bytes)
+		}
+	}
+}
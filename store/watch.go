@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ChangeKind int
+
+const (
+	ChangeCreated ChangeKind = iota + 1
+	ChangeUpdated
+	ChangeDeleted
+)
+
+var changeKindName = map[ChangeKind]string{
+	ChangeCreated: "created",
+	ChangeUpdated: "updated",
+	ChangeDeleted: "deleted",
+}
+
+func (k ChangeKind) String() string {
+	return changeKindName[k]
+}
+
+// changes are sent by name to followers
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	if _, found := changeKindName[k]; !found {
+		return nil, fmt.Errorf("unknown change kind %d", k)
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *ChangeKind) UnmarshalText(text []byte) error {
+	for kind, name := range changeKindName {
+		if name == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown change kind %q", text)
+}
+
+// Change is one write to the list, the item after it or as it was when deleted
+type Change struct {
+	Kind ChangeKind
+	Item TodoListItem
+	At   time.Time
+}
+
+// changes a watcher can fall behind by before it is dropped
+const watchBuffer = 256
+
+// Each watcher has a feed per shard and an item's changes always go through
+// the same feed, so they arrive in order. A write locks only its own feed of
+// each watcher, writes in different shards never wait on each other.
+type feed struct {
+	mu      sync.Mutex
+	changes chan Change
+	closed  bool
+}
+
+type watcher struct {
+	feeds   []*feed
+	changes chan Change   // the feeds merged, what the watcher reads
+	behind  chan struct{} // closed once a feed was full
+	once    sync.Once
+}
+
+var (
+	watchMutex sync.Mutex                 // taken to add or drop a watcher, never by a write
+	watching   atomic.Pointer[[]*watcher] // replaced whole, read by publish without a lock
+)
+
+// Watch streams changes to the list until ctx ends. The channel is closed when
+// ctx ends or when the watcher falls behind, a closed channel with ctx still
+// live means changes were missed and the list should be read again.
+func Watch(ctx context.Context) <-chan Change {
+	return WatchBuffered(ctx, watchBuffer)
+}
+
+// WatchBuffered is Watch letting the watcher fall behind by size changes in
+// any one shard
+func WatchBuffered(ctx context.Context, size int) <-chan Change {
+	w := &watcher{
+		feeds:   make([]*feed, len(shards)),
+		changes: make(chan Change),
+		behind:  make(chan struct{}),
+	}
+	var merging sync.WaitGroup
+	for i := range w.feeds {
+		f := &feed{changes: make(chan Change, size)}
+		w.feeds[i] = f
+		merging.Go(func() {
+			for change := range f.changes {
+				select {
+				case w.changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+	changeWatchers(func(list []*watcher) []*watcher {
+		return append(list, w)
+	})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.behind:
+		}
+		changeWatchers(func(list []*watcher) []*watcher {
+			return slices.DeleteFunc(list, func(other *watcher) bool { return other == w })
+		})
+		// what is already in the feeds is still passed on before the close
+		for _, f := range w.feeds {
+			f.close()
+		}
+		merging.Wait()
+		close(w.changes)
+	}()
+	return w.changes
+}
+
+// changeWatchers replaces the watcher list with a changed copy
+func changeWatchers(change func([]*watcher) []*watcher) {
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	var list []*watcher
+	if current := watching.Load(); current != nil {
+		list = slices.Clone(*current)
+	}
+	list = change(list)
+	watching.Store(&list)
+}
+
+// send passes the change on without blocking, false when the feed was full
+func (f *feed) send(change Change) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return true
+	}
+	select {
+	case f.changes <- change:
+		return true
+	default:
+		f.closed = true
+		close(f.changes)
+		return false
+	}
+}
+
+func (f *feed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.changes)
+	}
+}
+
+// publish never blocks the writer, a watcher with a full feed is dropped
+func publish(kind ChangeKind, item TodoListItem) {
+	list := watching.Load()
+	if list == nil || len(*list) == 0 {
+		return
+	}
+	change := Change{Kind: kind, Item: item, At: time.Now().UTC()}
+	for _, w := range *list {
+		if !w.feeds[shardIndex(item.Line, len(w.feeds))].send(change) {
+			w.once.Do(func() { close(w.behind) })
+		}
+	}
+}
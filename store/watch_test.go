@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchDropsSlowWatcher(t *testing.T) {
+	ctx := t.Context()
+	slow := Watch(ctx)
+	keeping, stop := context.WithCancel(ctx)
+	fast := Watch(keeping)
+
+	item := TodoListItem{Line: 1, Description: "watched"}
+	// slow's feed fills, with one more change held while it waits to be read
+	for range watchBuffer + 1 {
+		publish(ChangeUpdated, item)
+		if change := <-fast; change.Kind != ChangeUpdated || change.Item.Line != 1 {
+			t.Fatalf("unexpected change %v", change)
+		}
+	}
+	// the next change drops slow but not fast
+	publish(ChangeDeleted, item)
+	if change := <-fast; change.Kind != ChangeDeleted {
+		t.Errorf("wanted deleted got %s", change.Kind)
+	}
+	n := 0
+	for open := true; open; {
+		select {
+		case _, open = <-slow:
+			if open {
+				n++
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("slow watcher not dropped after %d changes", n)
+		}
+	}
+	if n < watchBuffer || n > watchBuffer+1 {
+		t.Errorf("slow watcher wanted the %d buffered changes got %d", watchBuffer, n)
+	}
+
+	// ending the context closes the channel
+	stop()
+	select {
+	case _, open := <-fast:
+		if open {
+			t.Error("wanted the channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("watcher not closed once its context ended")
+	}
+}
+
+// writes from many shards at once reach a watcher with each item's changes in order
+func TestWatchOrderPerItem(t *testing.T) {
+	waitActors(t)
+	original := ShardCount()
+	if ok := SetShards(4); ok != nil {
+		t.Fatal(ok)
+	}
+	defer SetShards(original)
+	ctx := t.Context()
+	changes := WatchBuffered(ctx, 1000)
+
+	const items, writes = 8, 100
+	var writers sync.WaitGroup
+	for line := range int64(items) {
+		writers.Go(func() {
+			for n := range writes {
+				publish(ChangeUpdated, TodoListItem{Line: line + 1, Rank: int64(n)})
+			}
+		})
+	}
+	next := map[int64]int64{}
+	for range items * writes {
+		change := <-changes
+		if change.Item.Rank != next[change.Item.Line] {
+			t.Fatalf("item %d change %d arrived after %d", change.Item.Line, change.Item.Rank, next[change.Item.Line]-1)
+		}
+		next[change.Item.Line]++
+	}
+	writers.Wait()
+}
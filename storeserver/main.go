@@ -0,0 +1,106 @@
+// storeserver keeps one part of the todo list and serves it to the appcli
+// front end, which routes each task id to a store server over a hash ring.
+//
+//	storeserver -listen 127.0.0.1:9001
+//	storeserver -listen 127.0.0.1:9002
+//	appcli -runserver -backends 127.0.0.1:9001,127.0.0.1:9002
+//
+// Each server saves its part to its own file, store-<port>.json in the data folder.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/anthriscus/appcli/filer"
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/remote"
+	"github.com/anthriscus/appcli/store"
+)
+
+const dataStorageFolderName string = "appcli"
+
+func main() {
+	var flagListen = flag.String("listen", "127.0.0.1:9001", "address to serve the store on, keep it off public interfaces as there is no auth")
+	var flagDataDir = flag.String("data-dir", "", "optional, folder for the store file, default is the appcli data folder")
+	var flagShards = flag.Int("shards", 0, "optional, number of store shards, default 0 is one per cpu")
+	var flagAutosave = flag.Duration("autosave-interval", 30*time.Second, "how often changes are saved, 0 saves only on shutdown")
+	var flagAutosaveChanges = flag.Uint64("autosave-changes", 100, "save once this many changes are waiting, 0 is off")
+	var flagShutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for open requests when stopping")
+	var flagLogLevel = flag.String("log-level", "info", "debug info warn or error")
+	flag.Parse()
+
+	if err := run(*flagListen, *flagDataDir, *flagShards, *flagAutosave, *flagAutosaveChanges, *flagShutdownTimeout, *flagLogLevel); err != nil {
+		fmt.Printf("Error:%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(listen string, dataDir string, shards int, autosaveInterval time.Duration, autosaveChanges uint64, shutdownTimeout time.Duration, logLevel string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logOptions, err := logging.LoggerOptions(logLevel, false)
+	if err != nil {
+		return fmt.Errorf("log level %q: %w", logLevel, err)
+	}
+	logging.Setup(os.Stderr, "text", logOptions)
+
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("listen address %q: %w", listen, err)
+	}
+	dirs, err := filer.CreateAppDirs(dataStorageFolderName, dataDir)
+	if err != nil {
+		return fmt.Errorf("cannot establish data folder: %w", err)
+	}
+	storageFile := filepath.Join(dirs.Data, "store-"+port+".json")
+
+	if err := store.SetShards(shards); err != nil {
+		return err
+	}
+	if err := store.OpenSession(ctx, storageFile); err != nil {
+		return err
+	}
+	storeCtx, stopStore := context.WithCancel(context.Background())
+	defer stopStore()
+	store.StartActor(storeCtx)
+	stopAutosave := store.StartAutosave(storeCtx, autosaveInterval, autosaveChanges)
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: remote.Handler()}
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Log().ErrorContext(ctx, "Listening ended", "error", err)
+		}
+	}()
+	fmt.Printf("Store server listening on %s with %d items from %s\n", listener.Addr(), store.Count(), storageFile)
+	logging.Log().InfoContext(ctx, "Store server started", "listeningOn", listener.Addr().String(), "storageFile", storageFile)
+
+	<-ctx.Done()
+	stop()
+	logging.Log().InfoContext(storeCtx, "Store server stopping")
+	drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		srv.Close()
+	}
+	stopAutosave()
+	if err := store.Commit(storeCtx); err != nil {
+		return fmt.Errorf("final save failed: %w", err)
+	}
+	logging.Log().InfoContext(storeCtx, "Store server stopped")
+	return nil
+}
@@ -0,0 +1,143 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/replica"
+	"github.com/anthriscus/appcli/store"
+)
+
+// how a sync shows in the server's list of log readers
+const readerId = "appcli sync"
+
+// remote is the server being synced with, reads come from its replication
+// log and snapshot, writes go to its sync routes
+type remote struct {
+	addr    string
+	base    string
+	token   string
+	http    *http.Client
+	replica *replica.Client
+}
+
+// normaliseServer gives the url a scheme and no trailing slash, the state is kept by it
+func normaliseServer(addr string) string {
+	base := strings.TrimSuffix(strings.TrimSpace(addr), "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return base
+}
+
+func newRemote(addr string, token string) *remote {
+	base := normaliseServer(addr)
+	return &remote{
+		addr:    addr,
+		base:    base,
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+		replica: replica.NewClient(base, token),
+	}
+}
+
+// changes since the state's position, each the item as it is now or nil when
+// deleted. A snapshot replaces the log when the position is not in it, true
+// when it did. Returns the position read up to.
+func (r *remote) changes(ctx context.Context, state *ServerState) (map[int64]*store.TodoListItem, int64, uint64, bool, error) {
+	if state.Epoch != 0 {
+		changes := map[int64]*store.TodoListItem{}
+		epoch, seq := state.Epoch, state.Seq
+		for {
+			batch, err := r.replica.Log(ctx, readerId, epoch, seq, 0)
+			if errors.Is(err, replica.ErrBehind) {
+				break
+			} else if err != nil {
+				return nil, 0, 0, false, err
+			}
+			if len(batch.Entries) == 0 {
+				return changes, epoch, seq, false, nil
+			}
+			for _, e := range batch.Entries {
+				if e.Kind == store.ChangeDeleted {
+					changes[e.Item.Line] = nil
+				} else {
+					item := e.Item
+					changes[e.Item.Line] = &item
+				}
+				seq = e.Seq
+			}
+		}
+	}
+	snapshot, err := r.replica.Snapshot(ctx)
+	if err != nil {
+		return nil, 0, 0, false, err
+	}
+	changes := map[int64]*store.TodoListItem{}
+	for id, item := range snapshot.Items {
+		changes[id] = &item
+	}
+	for id := range state.Items {
+		if _, found := snapshot.Items[id]; !found {
+			changes[id] = nil
+		}
+	}
+	return changes, snapshot.Epoch, snapshot.Seq, true, nil
+}
+
+func (r *remote) do(ctx context.Context, method string, path string, header http.Header, body any) error {
+	data := []byte{}
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.base+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("appcli server %s: %w", r.addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct{ Error string }
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("appcli server %s: %s %s: %d %s", r.addr, method, path, resp.StatusCode, e.Error)
+	}
+	return nil
+}
+
+// put writes the item over the server's version expected, nil when it is not
+// known and the server takes it over any older version
+func (r *remote) put(ctx context.Context, item store.TodoListItem, expect *store.Expected) error {
+	header := http.Header{}
+	switch {
+	case expect == nil:
+	case expect.Found:
+		header.Set("If-Match", strconv.Quote(strconv.FormatInt(expect.Version, 10)))
+	default:
+		header.Set("If-None-Match", "*")
+	}
+	return r.do(ctx, http.MethodPut, "/sync/"+strconv.FormatInt(item.Line, 10), header, item)
+}
+
+func (r *remote) delete(ctx context.Context, id int64) error {
+	return r.do(ctx, http.MethodDelete, "/sync/"+strconv.FormatInt(id, 10), nil, nil)
+}
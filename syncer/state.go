@@ -0,0 +1,76 @@
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+// State is what was last synced with each server, keyed by server url
+type State struct {
+	Servers map[string]*ServerState `json:"servers"`
+}
+
+// ServerState is one server's position and the items as they were last synced
+type ServerState struct {
+	Epoch    int64            `json:"epoch"` // the server's replication log position
+	Seq      uint64           `json:"seq"`
+	LastSync time.Time        `json:"lastSync"`
+	Items    map[int64]string `json:"items"`              // hash of each item
+	Versions map[int64]int64  `json:"versions,omitempty"` // version of each item, pushes go over it
+}
+
+// LoadState reads the state file, a missing file is a first sync
+func LoadState(fileName string) (*State, error) {
+	state := &State{Servers: map[string]*ServerState{}}
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("sync state %s: %w", fileName, err)
+	}
+	if state.Servers == nil {
+		state.Servers = map[string]*ServerState{}
+	}
+	return state, nil
+}
+
+// Save writes the state to a temporary file first so a failed write keeps the old state
+func (s *State) Save(fileName string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp := fileName + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, fileName)
+}
+
+// the state for a server, new when it has not been synced with
+func (s *State) server(url string) *ServerState {
+	if s.Servers[url] == nil {
+		s.Servers[url] = &ServerState{Items: map[int64]string{}}
+	}
+	if s.Servers[url].Items == nil {
+		s.Servers[url].Items = map[int64]string{}
+	}
+	return s.Servers[url]
+}
+
+// itemHash tells whether an item changed since it was synced, any field counts
+func itemHash(item store.TodoListItem) string {
+	data, _ := json.Marshal(item)
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,343 @@
+// Package syncer reconciles the local todo list with an appcli server so the
+// cli can be used offline and synced later.
+//
+// The state file keeps a hash of each item as it was last synced. An item
+// changed on one side since then is copied to the other, one changed on both
+// sides is a conflict settled by the policy. The server's changes are read
+// from its replication log after the position of the last sync, or from a
+// snapshot of its whole list on the first sync and when the log has moved on.
+package syncer
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+type Policy string
+
+const (
+	PolicyLastWriter Policy = "lww"       // the later change wins
+	PolicyKeepBoth   Policy = "keep-both" // the local change is kept as a new item
+	PolicyPrompt     Policy = "prompt"    // ask for each conflict
+)
+
+var Policies = []Policy{PolicyLastWriter, PolicyKeepBoth, PolicyPrompt}
+
+// the tag on the local copy a keep-both conflict makes
+const conflictTag = "conflict"
+
+func ParsePolicy(value string) (Policy, error) {
+	policy := Policy(strings.ToLower(strings.TrimSpace(value)))
+	if !slices.Contains(Policies, policy) {
+		return "", fmt.Errorf("sync policy %q is not one of lww, keep-both, prompt", value)
+	}
+	return policy, nil
+}
+
+type Options struct {
+	Server    string
+	Token     string
+	Policy    Policy
+	StateFile string
+	DryRun    bool      // report what would change and change nothing
+	In        io.Reader // answers for the prompt policy
+	Out       io.Writer // each change made and the prompt
+}
+
+type Report struct {
+	Pushed    int
+	Pulled    int
+	Conflicts int
+	Snapshot  bool // the server's changes came from a copy of its whole list
+}
+
+// an item as it is now on one side, nil when deleted
+type version = *store.TodoListItem
+
+// one sync run, the base is updated as each change lands so a failed
+// run keeps what it did
+type run struct {
+	opts     Options
+	remote   *remote
+	base     map[int64]string
+	versions map[int64]int64 // of the items in base, the same on both sides then
+	answer   *bufio.Scanner
+	report   Report
+}
+
+// Run syncs the local store, opened by the caller, with the server and saves
+// the local list before the state so a failure between them only repeats work
+func Run(ctx context.Context, opts Options) (Report, error) {
+	opts.Server = normaliseServer(opts.Server)
+	states, err := LoadState(opts.StateFile)
+	if err != nil {
+		return Report{}, err
+	}
+	state := states.server(opts.Server)
+	r := &run{opts: opts, remote: newRemote(opts.Server, opts.Token), base: maps.Clone(state.Items), versions: maps.Clone(state.Versions)}
+	if r.versions == nil {
+		r.versions = map[int64]int64{}
+	}
+	if opts.In != nil {
+		r.answer = bufio.NewScanner(opts.In)
+	}
+
+	remoteChanges, epoch, seq, full, err := r.remote.changes(ctx, state)
+	if err != nil {
+		return r.report, err
+	}
+	r.report.Snapshot = full
+	list, err := store.GetList()
+	if err != nil {
+		return r.report, err
+	}
+	local := list.Items()
+	localChanges := map[int64]version{}
+	for id, item := range local {
+		localChanges[id] = &item
+	}
+	for id := range state.Items {
+		if _, found := local[id]; !found {
+			localChanges[id] = nil
+		}
+	}
+	r.unchanged(localChanges)
+	r.unchanged(remoteChanges)
+
+	ids := slices.Collect(maps.Keys(localChanges))
+	for id := range remoteChanges {
+		if _, found := localChanges[id]; !found {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		l, localChanged := localChanges[id]
+		rv, remoteChanged := remoteChanges[id]
+		switch {
+		case localChanged && !remoteChanged:
+			err = r.push(ctx, id, l, r.synced(id))
+		case remoteChanged && !localChanged:
+			err = r.pull(ctx, id, rv)
+		case sameVersion(l, rv):
+			r.setBase(id, l)
+		default:
+			err = r.conflict(ctx, id, l, rv)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if opts.DryRun {
+		return r.report, err
+	}
+
+	if store.Dirty() {
+		if saveErr := store.Commit(ctx); saveErr != nil {
+			return r.report, errors.Join(err, saveErr)
+		}
+	}
+	// the position only moves on once every server change is in the local list
+	if err == nil {
+		state.Epoch, state.Seq, state.LastSync = epoch, seq, time.Now().UTC()
+	}
+	state.Items = r.base
+	state.Versions = r.versions
+	if saveErr := states.Save(opts.StateFile); saveErr != nil {
+		return r.report, errors.Join(err, saveErr)
+	}
+	logging.Log().InfoContext(ctx, "Synced", "server", opts.Server, "pushed", r.report.Pushed, "pulled", r.report.Pulled, "conflicts", r.report.Conflicts, "snapshot", full, "err", err)
+	return r.report, err
+}
+
+// drops the versions that are as last synced
+func (r *run) unchanged(changes map[int64]version) {
+	for id, v := range changes {
+		hash, synced := r.base[id]
+		if v == nil && !synced || v != nil && synced && itemHash(*v) == hash {
+			delete(changes, id)
+		}
+	}
+}
+
+func (r *run) setBase(id int64, v version) {
+	if v == nil {
+		delete(r.base, id)
+		delete(r.versions, id)
+	} else {
+		r.base[id] = itemHash(*v)
+		r.versions[id] = v.Version
+	}
+}
+
+// what the server holds of an item it has not changed since the last sync,
+// nil for an item synced before versions were kept
+func (r *run) synced(id int64) *store.Expected {
+	if _, found := r.base[id]; !found {
+		return &store.Expected{}
+	}
+	if version, found := r.versions[id]; found {
+		return &store.Expected{Found: true, Version: version}
+	}
+	return nil
+}
+
+// what the server holds as read this run
+func expected(v version) *store.Expected {
+	if v == nil {
+		return &store.Expected{}
+	}
+	return &store.Expected{Found: true, Version: v.Version}
+}
+
+func (r *run) say(format string, args ...any) {
+	if r.opts.Out != nil {
+		fmt.Fprintf(r.opts.Out, format+"\n", args...)
+	}
+}
+
+func describe(v version) string {
+	if v == nil {
+		return "deleted"
+	}
+	tags := ""
+	if len(v.Tags) > 0 {
+		tags = " #" + strings.Join(v.Tags, " #")
+	}
+	return fmt.Sprintf("%q %s%s, updated %s", v.Description, store.StatusName[v.State], tags, changedAt(v).Format(time.RFC822))
+}
+
+// copies the local version to the server over the server's version expected
+func (r *run) push(ctx context.Context, id int64, v version, expect *store.Expected) error {
+	r.say("push %d %s", id, describe(v))
+	if !r.opts.DryRun {
+		var err error
+		if v == nil {
+			err = r.remote.delete(ctx, id)
+		} else {
+			err = r.remote.put(ctx, *v, expect)
+		}
+		if err != nil {
+			return err
+		}
+		r.setBase(id, v)
+	}
+	r.report.Pushed++
+	return nil
+}
+
+// copies the server's version to the local list
+func (r *run) pull(ctx context.Context, id int64, v version) error {
+	r.say("pull %d %s", id, describe(v))
+	if !r.opts.DryRun {
+		var err error
+		if v == nil {
+			_, err = store.Remove(ctx, id)
+			if _, ok := store.GetByIndex(id); ok != nil {
+				// already gone is what was asked for
+				err = nil
+			}
+		} else {
+			_, err = store.Put(ctx, *v)
+		}
+		if err != nil {
+			return err
+		}
+		r.setBase(id, v)
+	}
+	r.report.Pulled++
+	return nil
+}
+
+func sameVersion(a version, b version) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return itemHash(*a) == itemHash(*b)
+}
+
+func changedAt(v version) time.Time {
+	if v.Updated.IsZero() {
+		return v.Created
+	}
+	return v.Updated
+}
+
+// an edit beats a delete as when the delete was made is not known,
+// otherwise the later change, the higher version, then the server's
+func lastWriter(l version, rv version) string {
+	switch {
+	case l == nil:
+		return "remote"
+	case rv == nil:
+		return "local"
+	}
+	order := cmp.Or(changedAt(l).Compare(changedAt(rv)), cmp.Compare(l.Version, rv.Version))
+	if order > 0 {
+		return "local"
+	}
+	return "remote"
+}
+
+func (r *run) conflict(ctx context.Context, id int64, l version, rv version) error {
+	r.report.Conflicts++
+	r.say("conflict %d\n  local:  %s\n  remote: %s", id, describe(l), describe(rv))
+	choice := lastWriter(l, rv)
+	switch {
+	case r.opts.Policy == PolicyPrompt:
+		var err error
+		if choice, err = r.ask(); err != nil {
+			return err
+		}
+	case r.opts.Policy == PolicyKeepBoth && l != nil && rv != nil:
+		choice = "both"
+	}
+	switch {
+	case choice == "local":
+		return r.push(ctx, id, l, expected(rv))
+	case choice == "remote" || l == nil:
+		return r.pull(ctx, id, rv)
+	case rv == nil:
+		return r.push(ctx, id, l, expected(rv))
+	}
+	// the server's version keeps the id, the local one is copied to a new item
+	if err := r.pull(ctx, id, rv); err != nil {
+		return err
+	}
+	copied := *l
+	copied.Id = store.GenerateId()
+	copied.Line = copied.Id
+	copied.Tags = append(slices.Clone(l.Tags), conflictTag)
+	if !r.opts.DryRun {
+		if _, err := store.Put(ctx, copied); err != nil {
+			return err
+		}
+	}
+	return r.push(ctx, copied.Line, &copied, expected(nil))
+}
+
+func (r *run) ask() (string, error) {
+	choices := map[string]string{"l": "local", "r": "remote", "b": "both"}
+	for {
+		if r.opts.Out != nil {
+			fmt.Fprint(r.opts.Out, "keep [l]ocal, [r]emote or [b]oth? ")
+		}
+		if r.answer == nil || !r.answer.Scan() {
+			return "", errors.New("no answer for the conflict")
+		}
+		if choice, found := choices[strings.ToLower(strings.TrimSpace(r.answer.Text()))]; found {
+			return choice, nil
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/replica"
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestMain(m *testing.M) {
+	logging.Default()
+	ctx, cancel := context.WithCancel(context.Background())
+	workDir, _ := os.MkdirTemp("", "appcli")
+	store.OpenSession(ctx, filepath.Join(workDir, "todolist.json"))
+	store.StartActor(ctx)
+	code := m.Run()
+	cancel()
+	os.RemoveAll(workDir)
+	os.Exit(code)
+}
+
+// a server with its own list and change log
+type fakeServer struct {
+	mu      sync.Mutex
+	epoch   int64
+	items   store.TodoListItems
+	entries []replica.Entry
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, string) {
+	f := &fakeServer{epoch: 1, items: store.TodoListItems{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv.URL
+}
+
+func (f *fakeServer) write(item store.TodoListItem) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items[item.Line] = item
+	f.entries = append(f.entries, replica.Entry{Seq: uint64(len(f.entries) + 1), Kind: store.ChangeUpdated, Item: item})
+}
+
+func (f *fakeServer) delete(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.items, id)
+	f.entries = append(f.entries, replica.Entry{Seq: uint64(len(f.entries) + 1), Kind: store.ChangeDeleted, Item: store.TodoListItem{Line: id}})
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/replication/snapshot":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(replica.Snapshot{Epoch: f.epoch, Seq: uint64(len(f.entries)), Items: f.items})
+	case r.URL.Path == "/replication/log":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		epoch, _ := strconv.ParseInt(r.URL.Query().Get("epoch"), 10, 64)
+		after, _ := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+		if epoch != f.epoch {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		json.NewEncoder(w).Encode(replica.Batch{Epoch: f.epoch, Seq: uint64(len(f.entries)), Entries: f.entries[after:]})
+	case strings.HasPrefix(r.URL.Path, "/sync/") && r.Method == http.MethodPut:
+		var item store.TodoListItem
+		json.NewDecoder(r.Body).Decode(&item)
+		// the push must say which version it goes over
+		current, found := f.item(item.Line)
+		match := strconv.Quote(strconv.FormatInt(current.Version, 10))
+		if found && r.Header.Get("If-Match") != match || !found && r.Header.Get("If-None-Match") != "*" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.write(item)
+		json.NewEncoder(w).Encode(item)
+	case strings.HasPrefix(r.URL.Path, "/sync/") && r.Method == http.MethodDelete:
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/sync/"), 10, 64)
+		f.delete(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeServer) item(id int64) (store.TodoListItem, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, found := f.items[id]
+	return item, found
+}
+
+func remoteItem(id int64, description string, updated time.Time) store.TodoListItem {
+	return store.TodoListItem{Line: id, Id: id, Description: description, Created: updated, Updated: updated, Version: 1}
+}
+
+func testOptions(t *testing.T, server string, policy Policy) Options {
+	return Options{Server: server, Policy: policy, StateFile: filepath.Join(t.TempDir(), "syncstate.json")}
+}
+
+func emptyLocal(t *testing.T) {
+	t.Cleanup(func() { store.Replace(context.Background(), store.TodoListItems{}) })
+	store.Replace(t.Context(), store.TodoListItems{})
+}
+
+func TestSync(t *testing.T) {
+	emptyLocal(t)
+	ctx := t.Context()
+	server, url := newFakeServer(t)
+	opts := testOptions(t, url, PolicyLastWriter)
+
+	localOnly, _ := store.AddTask(ctx, "Made offline")
+	server.write(remoteItem(1, "Made on the server", time.Now().UTC()))
+
+	// the first sync copies each side's items to the other
+	report, ok := Run(ctx, opts)
+	if ok != nil || report.Pushed != 1 || report.Pulled != 1 || !report.Snapshot {
+		t.Fatalf("first sync %+v %v", report, ok)
+	}
+	if _, found := server.item(localOnly); !found {
+		t.Error("local item not pushed")
+	}
+	if _, ok := store.GetByIndex(1); ok != nil {
+		t.Error("server item not pulled")
+	}
+
+	// nothing changed, the log shows only the sync's own pushes
+	if report, ok := Run(ctx, opts); ok != nil || report.Pushed+report.Pulled+report.Conflicts != 0 || report.Snapshot {
+		t.Errorf("second sync wanted no changes from the log got %+v %v", report, ok)
+	}
+
+	// one change each way
+	store.DescriptionChange(ctx, localOnly, "Edited offline")
+	server.delete(1)
+	if report, ok := Run(ctx, opts); ok != nil || report.Pushed != 1 || report.Pulled != 1 {
+		t.Errorf("third sync %+v %v", report, ok)
+	}
+	if item, _ := server.item(localOnly); item.Description != "Edited offline" || item.Version != 2 {
+		t.Errorf("local edit not pushed %+v", item)
+	}
+	if _, ok := store.GetByIndex(1); ok == nil {
+		t.Error("server delete not pulled")
+	}
+
+	// the server's log started over, the next sync reads a snapshot
+	server.mu.Lock()
+	server.epoch++
+	server.mu.Unlock()
+	if report, ok := Run(ctx, opts); ok != nil || !report.Snapshot || report.Pushed+report.Pulled != 0 {
+		t.Errorf("sync after the log started over %+v %v", report, ok)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	var tests = []struct {
+		name          string
+		policy        Policy
+		answer        string
+		remoteNewer   bool
+		remoteDeletes bool
+		want          string // local description after the sync
+		wantCopy      bool
+	}{
+		{name: "lww local newer", policy: PolicyLastWriter, want: "local edit"},
+		{name: "lww remote newer", policy: PolicyLastWriter, remoteNewer: true, want: "remote edit"},
+		{name: "lww edit beats delete", policy: PolicyLastWriter, remoteDeletes: true, want: "local edit"},
+		{name: "keep both", policy: PolicyKeepBoth, want: "remote edit", wantCopy: true},
+		{name: "prompt local", policy: PolicyPrompt, answer: "x\nl\n", remoteNewer: true, want: "local edit"},
+		{name: "prompt both", policy: PolicyPrompt, answer: "b\n", want: "remote edit", wantCopy: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			emptyLocal(t)
+			ctx := t.Context()
+			server, url := newFakeServer(t)
+			opts := testOptions(t, url, tc.policy)
+			opts.In = strings.NewReader(tc.answer)
+
+			id, _ := store.AddTask(ctx, "shared")
+			if _, ok := Run(ctx, opts); ok != nil {
+				t.Fatal(ok)
+			}
+			synced, _ := server.item(id)
+
+			store.DescriptionChange(ctx, id, "local edit")
+			edited := synced
+			edited.Description, edited.Version, edited.Updated = "remote edit", 2, time.Now().UTC().Add(-time.Hour)
+			if tc.remoteNewer {
+				edited.Updated = time.Now().UTC().Add(time.Hour)
+			}
+			if tc.remoteDeletes {
+				server.delete(id)
+			} else {
+				server.write(edited)
+			}
+
+			report, ok := Run(ctx, opts)
+			if ok != nil || report.Conflicts != 1 {
+				t.Fatalf("wanted one conflict got %+v %v", report, ok)
+			}
+			local, _ := store.GetByIndex(id)
+			remote, _ := server.item(id)
+			if local.Description != tc.want || remote.Description != tc.want {
+				t.Errorf("wanted %q on both sides got local %q remote %q", tc.want, local.Description, remote.Description)
+			}
+			copies := 0
+			scan, _ := store.Scan()
+			for item := range scan {
+				if slices.Contains(item.Tags, conflictTag) && item.Description == "local edit" {
+					copies++
+					if _, found := server.item(item.Line); !found {
+						t.Error("conflict copy not pushed")
+					}
+				}
+			}
+			if tc.wantCopy != (copies == 1) {
+				t.Errorf("wanted a conflict copy %t got %d", tc.wantCopy, copies)
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	emptyLocal(t)
+	ctx := t.Context()
+	server, url := newFakeServer(t)
+	opts := testOptions(t, url, PolicyLastWriter)
+	opts.DryRun = true
+	id, _ := store.AddTask(ctx, "Not pushed")
+	server.write(remoteItem(1, "Not pulled", time.Now().UTC()))
+
+	if report, ok := Run(ctx, opts); ok != nil || report.Pushed != 1 || report.Pulled != 1 {
+		t.Errorf("dry run %+v %v", report, ok)
+	}
+	if _, found := server.item(id); found {
+		t.Error("dry run pushed")
+	}
+	if _, ok := store.GetByIndex(1); ok == nil {
+		t.Error("dry run pulled")
+	}
+	if _, ok := os.Stat(opts.StateFile); ok == nil {
+		t.Error("dry run saved the state")
+	}
+}
@@ -0,0 +1,90 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+var csvHeader = []string{fieldId, fieldDescription, fieldState, fieldCreated, fieldPriority, fieldTags}
+
+// a cell starting with one of these is run as a formula by spreadsheet apps
+const formulaStart = "=+-@\t\r"
+
+// escapeCell quotes text that would be taken as a formula, 'cell shows as cell
+func escapeCell(value string) string {
+	if value != "" && strings.ContainsRune(formulaStart, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCell takes off the quote escapeCell added
+func unescapeCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaStart, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+func writeCsv(w io.Writer, items []store.TodoListItem) error {
+	out := csv.NewWriter(w)
+	out.Write(csvHeader)
+	for _, item := range items {
+		out.Write([]string{
+			strconv.FormatInt(item.Line, 10),
+			escapeCell(item.Description),
+			store.StatusName[item.State],
+			item.Created.Format(time.RFC3339),
+			item.Priority,
+			escapeCell(strings.Join(item.Tags, ",")),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// the first row names the columns, see headings
+func readCsv(r io.Reader, fields map[string]string) ([]store.TodoListItem, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+	in.TrimLeadingSpace = true
+	columns, err := in.Read()
+	if err == io.EOF {
+		return []store.TodoListItem{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	mapped, err := columnFields(columns, fields)
+	if err != nil {
+		return nil, err
+	}
+	items := []store.TodoListItem{}
+	for {
+		row, err := in.Read()
+		if err == io.EOF {
+			return items, nil
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := in.FieldPos(0)
+		var item store.TodoListItem
+		for i, value := range row {
+			if i >= len(mapped) {
+				break
+			}
+			if mapped[i] == fieldDescription || mapped[i] == fieldTags {
+				value = unescapeCell(value)
+			}
+			if err := setField(&item, mapped[i], value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		items = append(items, item)
+	}
+}
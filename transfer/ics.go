@@ -0,0 +1,288 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+// iCalendar, RFC 5545. Every task is a VTODO with a uid made from its id so
+// a calendar app subscribed to the list updates its copy rather than adding one.
+
+const (
+	icsUidDomain = "@appcli"
+	icsDateTime  = "20060102T150405Z"
+	icsDate      = "20060102"
+	icsLocal     = "20060102T150405"
+	icsLineLimit = 75 // octets before a line is folded
+)
+
+// the status of each state, a workflow state past completed is in progress.
+// The state's name goes in X-APPCLI-STATE so renamed workflows come back as they were.
+func icsStatus(state int) string {
+	switch state {
+	case store.StateNotStarted:
+		return "NEEDS-ACTION"
+	case store.StateCompleted:
+		return "COMPLETED"
+	}
+	return "IN-PROCESS"
+}
+
+// priorities A to I are 1 to 9, the rest of the alphabet is 9
+func icsPriority(priority string) int {
+	if priority == "" {
+		return 0
+	}
+	return min(int(priority[0]-'A')+1, 9)
+}
+
+func writeIcs(w io.Writer, items []store.TodoListItem) error {
+	out := bufio.NewWriter(w)
+	line := func(name string, value string) {
+		writeFolded(out, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//anthriscus//appcli//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("X-WR-CALNAME", "Todo list")
+	stamp := time.Now().UTC().Format(icsDateTime)
+	for _, item := range items {
+		line("BEGIN", "VTODO")
+		line("UID", strconv.FormatInt(item.Line, 10)+icsUidDomain)
+		line("DTSTAMP", stamp)
+		line("CREATED", item.Created.UTC().Format(icsDateTime))
+		if !item.Updated.IsZero() {
+			line("LAST-MODIFIED", item.Updated.UTC().Format(icsDateTime))
+		}
+		line("SUMMARY", icsEscape(item.Description))
+		line("STATUS", icsStatus(item.State))
+		line("X-APPCLI-STATE", icsEscape(store.StatusName[item.State]))
+		if item.State == store.StateCompleted && !item.Updated.IsZero() {
+			line("COMPLETED", item.Updated.UTC().Format(icsDateTime))
+		}
+		if p := icsPriority(item.Priority); p > 0 {
+			line("PRIORITY", strconv.Itoa(p))
+		}
+		if !item.Due.IsZero() {
+			if due := item.Due.UTC(); due.Equal(due.Truncate(24 * time.Hour)) {
+				line("DUE;VALUE=DATE", due.Format(icsDate))
+			} else {
+				line("DUE", due.Format(icsDateTime))
+			}
+		}
+		if item.Recur != "" {
+			line("RRULE", item.Recur)
+		}
+		if len(item.Tags) > 0 {
+			tags := make([]string, len(item.Tags))
+			for i, t := range item.Tags {
+				tags[i] = icsEscape(t)
+			}
+			line("CATEGORIES", strings.Join(tags, ","))
+		}
+		line("END", "VTODO")
+	}
+	line("END", "VCALENDAR")
+	return out.Flush()
+}
+
+// writeFolded ends the line with crlf, folding it so no line is longer than
+// the limit without splitting a utf-8 character
+func writeFolded(out *bufio.Writer, text string) {
+	limit := icsLineLimit
+	for len(text) > limit {
+		cut := limit
+		for cut > 0 && text[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		out.WriteString(text[:cut])
+		out.WriteString("\r\n ")
+		text = text[cut:]
+		// the space starting a folded line counts
+		limit = icsLineLimit - 1
+	}
+	out.WriteString(text)
+	out.WriteString("\r\n")
+}
+
+var (
+	icsEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	icsUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+func icsEscape(text string) string {
+	return icsEscaper.Replace(text)
+}
+
+// property is one content line: NAME;PARAM=x:VALUE
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func parseProperty(text string) (property, bool) {
+	// the value starts at the first colon outside a quoted parameter
+	quoted := false
+	split := -1
+	for i, c := range text {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			split = i
+			break
+		}
+	}
+	if split < 0 {
+		return property{}, false
+	}
+	parts := strings.Split(text[:split], ";")
+	p := property{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: text[split+1:]}
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return p, true
+}
+
+// the lines with folding undone
+func unfold(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) {
+			lines[len(lines)-1] += text[1:]
+		} else if text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// a date, a utc time, or a local time in the zone given by TZID
+func icsTime(p property) (time.Time, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == len(icsDate) {
+		return time.Parse(icsDate, p.value)
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		return time.Parse(icsDateTime, p.value)
+	}
+	zone := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if loc, ok := time.LoadLocation(tzid); ok == nil {
+			zone = loc
+		}
+	}
+	t, err := time.ParseInLocation(icsLocal, p.value, zone)
+	return t.UTC(), err
+}
+
+// readIcs takes the VTODOs, the rest of the calendar is left
+func readIcs(r io.Reader) ([]store.TodoListItem, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	items := []store.TodoListItem{}
+	var item *store.TodoListItem
+	named := false // X-APPCLI-STATE set the state
+	for n, text := range lines {
+		p, found := parseProperty(text)
+		if !found {
+			continue
+		}
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VTODO"):
+			item = &store.TodoListItem{}
+			named = false
+		case item == nil:
+		case p.name == "END" && strings.EqualFold(p.value, "VTODO"):
+			items = append(items, *item)
+			item = nil
+		default:
+			if err := setIcsProperty(item, p, &named); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		}
+	}
+	return items, nil
+}
+
+func setIcsProperty(item *store.TodoListItem, p property, named *bool) error {
+	var err error
+	switch p.name {
+	case "UID":
+		// ours carry the task id, others are left for the description to match
+		if id, found := strings.CutSuffix(p.value, icsUidDomain); found {
+			if line, ok := strconv.ParseInt(id, 10, 64); ok == nil {
+				item.Line, item.Id = line, line
+			}
+		}
+	case "SUMMARY":
+		item.Description = icsUnescaper.Replace(p.value)
+	case "STATUS":
+		if *named {
+			break
+		}
+		switch strings.ToUpper(p.value) {
+		case "COMPLETED", "CANCELLED":
+			item.State = store.StateCompleted
+		case "IN-PROCESS":
+			item.State = store.StateStarted
+		default:
+			item.State = store.StateNotStarted
+		}
+	case "X-APPCLI-STATE":
+		if state, ok := parseState(icsUnescaper.Replace(p.value)); ok == nil {
+			item.State, *named = state, true
+		}
+	case "CREATED":
+		item.Created, err = icsTime(p)
+	case "DUE":
+		item.Due, err = icsTime(p)
+	case "RRULE":
+		// rules beyond what the list can repeat are left off
+		if rule, ok := store.ParseRecurrence(p.value); ok == nil {
+			item.Recur = rule.String()
+		}
+	case "PRIORITY":
+		var n int
+		if n, err = strconv.Atoi(strings.TrimSpace(p.value)); err == nil && n >= 1 && n <= 9 {
+			item.Priority = string(rune('A' + n - 1))
+		}
+	case "CATEGORIES":
+		tags := []string{}
+		for _, t := range splitEscaped(p.value) {
+			tags = append(tags, icsUnescaper.Replace(t))
+		}
+		item.Tags = append(item.Tags, store.ParseTags(strings.Join(tags, ","))...)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.name, err)
+	}
+	return nil
+}
+
+// splitEscaped splits a list value on the commas that are not escaped
+func splitEscaped(value string) []string {
+	parts := []string{}
+	start := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' {
+			i++
+		} else if value[i] == ',' {
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
@@ -0,0 +1,95 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+type Options struct {
+	DryRun         bool // report what would be added and add nothing
+	KeepDuplicates bool // add items that look like ones already there
+}
+
+// Duplicate is an item left out as the list has it already
+type Duplicate struct {
+	Item store.TodoListItem `json:"item"`
+	Of   int64              `json:"of"` // the line it repeats, 0 for an earlier item in the same import
+}
+
+type Report struct {
+	Added      []store.TodoListItem `json:"added"`
+	Duplicates []Duplicate          `json:"duplicates"`
+	DryRun     bool                 `json:"dryRun"`
+}
+
+// duplicates have the same description ignoring case and spacing
+func descriptionKey(description string) string {
+	return strings.Join(strings.Fields(strings.ToLower(description)), " ")
+}
+
+// Import adds the parsed items to the store under new ids. An item with the
+// id or description of one in the list, or of one earlier in the import, is
+// a duplicate. Every item is checked before any is added.
+func Import(ctx context.Context, items []store.TodoListItem, options Options) (Report, error) {
+	report := Report{Added: []store.TodoListItem{}, Duplicates: []Duplicate{}, DryRun: options.DryRun}
+	for i, item := range items {
+		if strings.TrimSpace(item.Description) == "" {
+			return report, fmt.Errorf("item %d has no description", i+1)
+		}
+		if _, ok := store.ParsePriority(item.Priority); ok != nil {
+			return report, fmt.Errorf("item %d: %w", i+1, ok)
+		}
+		if _, found := store.StatusName[item.State]; !found {
+			return report, fmt.Errorf("item %d: state %d is out of range", i+1, item.State)
+		}
+	}
+
+	if options.DryRun {
+		list, err := store.GetList()
+		if err != nil {
+			return report, err
+		}
+		report.Added = report.choose(list, items, options)
+		return report, nil
+	}
+	added, err := store.AddItems(ctx, func(list store.List) []store.TodoListItem {
+		return report.choose(list, items, options)
+	})
+	report.Added = append(report.Added, added...)
+	if err != nil {
+		return report, err
+	}
+	logging.Log().InfoContext(ctx, "Imported items", "added", len(report.Added), "duplicates", len(report.Duplicates))
+	return report, nil
+}
+
+// choose is the items to add, those already in the list or earlier in the
+// import go in the duplicates unless they are kept
+func (report *Report) choose(list store.List, items []store.TodoListItem, options Options) []store.TodoListItem {
+	existing := map[string]int64{}
+	for item := range list.All() {
+		existing[descriptionKey(item.Description)] = item.Line
+	}
+	toAdd := []store.TodoListItem{}
+	for _, item := range items {
+		item.Description = strings.TrimSpace(item.Description)
+		key := descriptionKey(item.Description)
+		of, found := existing[key]
+		if item.Line != 0 && !found {
+			if _, ok := list.Get(item.Line); ok {
+				of, found = item.Line, true
+			}
+		}
+		if found && !options.KeepDuplicates {
+			report.Duplicates = append(report.Duplicates, Duplicate{Item: item, Of: of})
+			continue
+		}
+		existing[key] = 0
+		toAdd = append(toAdd, item)
+	}
+	return toAdd
+}
@@ -0,0 +1,51 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+// written like the data file, a map of items by line
+func writeJson(w io.Writer, items []store.TodoListItem) error {
+	list := make(store.TodoListItems, len(items))
+	for _, item := range items {
+		list[item.Line] = item
+	}
+	out := json.NewEncoder(w)
+	out.SetIndent("", "  ")
+	return out.Encode(list)
+}
+
+// a map of items by line as in the data file, or a list of them
+func readJson(r io.Reader) ([]store.TodoListItem, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return []store.TodoListItem{}, nil
+	}
+	if data[0] == '[' {
+		items := []store.TodoListItem{}
+		err := json.Unmarshal(data, &items)
+		return items, err
+	}
+	list := store.TodoListItems{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	// tombstones in a data file are not tasks
+	items := []store.TodoListItem{}
+	for _, line := range slices.Sorted(maps.Keys(list)) {
+		if !list[line].Tombstone() {
+			items = append(items, list[line])
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,110 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+// exported as a table, read back from a table or a task list such as
+// - [ ] buy apples #shopping
+func writeMarkdown(w io.Writer, items []store.TodoListItem) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "| Description | State | Created | Priority | Tags |")
+	fmt.Fprintln(out, "| --- | --- | --- | --- | --- |")
+	for _, item := range items {
+		fmt.Fprintf(out, "| %s | %s | %s | %s | %s |\n",
+			cell(item.Description), cell(store.StatusName[item.State]), item.Created.Format(time.DateOnly),
+			item.Priority, cell(strings.Join(item.Tags, ", ")))
+	}
+	return out.Flush()
+}
+
+// a pipe would end the cell early
+func cell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+var (
+	taskLine     = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.*)$`)
+	separatorRow = regexp.MustCompile(`^\|?[\s:|-]+\|?$`)
+)
+
+func readMarkdown(r io.Reader, fields map[string]string) ([]store.TodoListItem, error) {
+	items := []store.TodoListItem{}
+	var mapped []string // columns of the table being read
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(text, "|") && separatorRow.MatchString(text):
+		case strings.HasPrefix(text, "|") && mapped == nil:
+			var err error
+			if mapped, err = columnFields(cells(text), fields); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+		case strings.HasPrefix(text, "|"):
+			var item store.TodoListItem
+			for i, value := range cells(text) {
+				if i >= len(mapped) {
+					break
+				}
+				if err := setField(&item, mapped[i], value); err != nil {
+					return nil, fmt.Errorf("line %d: %w", n, err)
+				}
+			}
+			items = append(items, item)
+		default:
+			// anything else ends a table
+			mapped = nil
+			if m := taskLine.FindStringSubmatch(text); m != nil {
+				item := store.TodoListItem{State: store.StateNotStarted}
+				if m[1] != " " {
+					item.State = store.StateCompleted
+				}
+				item.Description, item.Tags = hashTags(m[2])
+				items = append(items, item)
+			}
+		}
+	}
+	return items, scanner.Err()
+}
+
+// the cells of a table row, a \| stays in the cell
+func cells(row string) []string {
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	parts := []string{}
+	var current strings.Builder
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+			current.WriteByte('|')
+			i++
+		case row[i] == '|':
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(row[i])
+		}
+	}
+	return append(parts, strings.TrimSpace(current.String()))
+}
+
+// hashTags takes the #tags out of a task's text
+func hashTags(text string) (string, []string) {
+	words := []string{}
+	tags := []string{}
+	for _, w := range strings.Fields(text) {
+		if len(w) > 1 && w[0] == '#' {
+			tags = append(tags, w)
+		} else {
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " "), store.ParseTags(strings.Join(tags, ","))
+}
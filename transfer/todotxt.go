@@ -0,0 +1,120 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+// one task a line as in http://todotxt.org:
+//
+//	x 2026-01-03 2026-01-02 buy apples +shopping pri:A
+//	(A) 2026-01-02 buy pears +shopping
+//
+// tags are +projects, @contexts read back as tags too. todo.txt has no
+// started, other states than not started and completed go in state:n.
+func writeTodoTxt(w io.Writer, items []store.TodoListItem) error {
+	out := bufio.NewWriter(w)
+	for _, item := range items {
+		parts := []string{}
+		switch {
+		case item.State == store.StateCompleted:
+			done := item.Updated
+			if done.IsZero() {
+				done = item.Created
+			}
+			parts = append(parts, "x", done.Format(time.DateOnly))
+		case item.Priority != "":
+			parts = append(parts, "("+item.Priority+")")
+		}
+		parts = append(parts, item.Created.Format(time.DateOnly), item.Description)
+		for _, t := range item.Tags {
+			parts = append(parts, "+"+strings.ReplaceAll(t, " ", "-"))
+		}
+		if item.State == store.StateCompleted && item.Priority != "" {
+			// a completed task loses its (A), the priority is kept as pri:A
+			parts = append(parts, "pri:"+item.Priority)
+		}
+		if item.State != store.StateCompleted && item.State != store.StateNotStarted {
+			parts = append(parts, "state:"+strconv.Itoa(item.State))
+		}
+		fmt.Fprintln(out, strings.Join(parts, " "))
+	}
+	return out.Flush()
+}
+
+func readTodoTxt(r io.Reader) ([]store.TodoListItem, error) {
+	items := []store.TodoListItem{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		item, err := todoTxtItem(words)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+func todoTxtItem(words []string) (store.TodoListItem, error) {
+	item := store.TodoListItem{State: store.StateNotStarted}
+	isDate := func(i int) bool {
+		if i >= len(words) {
+			return false
+		}
+		_, ok := time.Parse(time.DateOnly, words[i])
+		return ok == nil
+	}
+	if words[0] == "x" {
+		item.State = store.StateCompleted
+		words = words[1:]
+		// the completion date comes before the created date
+		if isDate(0) && isDate(1) {
+			words = words[1:]
+		}
+	} else if len(words[0]) == 3 && words[0][0] == '(' && words[0][2] == ')' {
+		if p, ok := store.ParsePriority(words[0]); ok == nil {
+			item.Priority = p
+			words = words[1:]
+		}
+	}
+	if isDate(0) {
+		item.Created, _ = parseCreated(words[0])
+		words = words[1:]
+	}
+	description := []string{}
+	tags := []string{}
+	for _, w := range words {
+		key, value, _ := strings.Cut(w, ":")
+		switch {
+		case len(w) > 1 && (w[0] == '+' || w[0] == '@'):
+			tags = append(tags, w[1:])
+		case key == "pri" && value != "":
+			p, err := store.ParsePriority(value)
+			if err != nil {
+				return item, err
+			}
+			item.Priority = p
+		case key == "state" && value != "":
+			state, err := parseState(value)
+			if err != nil {
+				return item, err
+			}
+			item.State = state
+		default:
+			description = append(description, w)
+		}
+	}
+	item.Description = strings.Join(description, " ")
+	item.Tags = store.ParseTags(strings.Join(tags, ","))
+	return item, nil
+}
@@ -0,0 +1,232 @@
+// Package transfer moves the todo list in and out of other formats: csv,
+// a markdown table, todo.txt, iCalendar and json. Each carries the description,
+// state, created date, priority and tags of an item, json carries every field.
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthriscus/appcli/store"
+)
+
+type Format string
+
+const (
+	Csv      Format = "csv"
+	Markdown Format = "markdown"
+	TodoTxt  Format = "todotxt"
+	Json     Format = "json"
+	Ics      Format = "ics"
+)
+
+var Formats = []Format{Csv, Markdown, TodoTxt, Json, Ics}
+
+func ParseFormat(value string) (Format, error) {
+	f := Format(strings.ToLower(strings.TrimSpace(value)))
+	switch f {
+	case "md":
+		return Markdown, nil
+	case "todo.txt", "txt":
+		return TodoTxt, nil
+	case "ical", "icalendar":
+		return Ics, nil
+	}
+	if !slices.Contains(Formats, f) {
+		return "", fmt.Errorf("unknown format %q, use csv, markdown, todotxt, json or ics", value)
+	}
+	return f, nil
+}
+
+// FormatFor guesses the format from a file name, json when it cannot tell
+func FormatFor(fileName string) Format {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return Csv
+	case ".md", ".markdown":
+		return Markdown
+	case ".txt":
+		return TodoTxt
+	case ".ics", ".ical":
+		return Ics
+	}
+	return Json
+}
+
+// ContentType is the media type served for the format
+func (f Format) ContentType() string {
+	switch f {
+	case Csv:
+		return "text/csv; charset=utf-8"
+	case Markdown:
+		return "text/markdown; charset=utf-8"
+	case TodoTxt:
+		return "text/plain; charset=utf-8"
+	case Ics:
+		return "text/calendar; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// Extension is the file extension for the format, with the dot
+func (f Format) Extension() string {
+	switch f {
+	case Markdown:
+		return ".md"
+	case TodoTxt:
+		return ".txt"
+	}
+	return "." + string(f)
+}
+
+// Export writes the items in the format, in the order given
+func Export(w io.Writer, format Format, items []store.TodoListItem) error {
+	switch format {
+	case Csv:
+		return writeCsv(w, items)
+	case Markdown:
+		return writeMarkdown(w, items)
+	case TodoTxt:
+		return writeTodoTxt(w, items)
+	case Json:
+		return writeJson(w, items)
+	case Ics:
+		return writeIcs(w, items)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// Parse reads the items from the format. The items are not in the store
+// yet, a missing created time is left zero. fields maps csv and markdown
+// column headings to item fields on top of the usual names.
+func Parse(r io.Reader, format Format, fields map[string]string) ([]store.TodoListItem, error) {
+	switch format {
+	case Csv:
+		return readCsv(r, fields)
+	case Markdown:
+		return readMarkdown(r, fields)
+	case TodoTxt:
+		return readTodoTxt(r)
+	case Json:
+		return readJson(r)
+	case Ics:
+		return readIcs(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// the item fields a column can map to
+const (
+	fieldId          = "id"
+	fieldDescription = "description"
+	fieldState       = "state"
+	fieldCreated     = "created"
+	fieldPriority    = "priority"
+	fieldTags        = "tags"
+)
+
+// column headings other tools use for the fields
+var headings = map[string]string{
+	"id": fieldId, "line": fieldId,
+	"description": fieldDescription, "title": fieldDescription, "task": fieldDescription, "name": fieldDescription, "summary": fieldDescription,
+	"state": fieldState, "status": fieldState,
+	"created": fieldCreated, "date": fieldCreated, "created date": fieldCreated, "created at": fieldCreated,
+	"priority": fieldPriority, "pri": fieldPriority,
+	"tags": fieldTags, "tag": fieldTags, "labels": fieldTags,
+}
+
+// ParseFields reads column=field pairs such as "Title=description,Done=state"
+func ParseFields(value string) (map[string]string, error) {
+	fields := map[string]string{}
+	for pair := range strings.SplitSeq(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		column, field, found := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !found || !slices.Contains([]string{fieldId, fieldDescription, fieldState, fieldCreated, fieldPriority, fieldTags}, field) {
+			return nil, fmt.Errorf("bad field mapping %q, want column=field with field one of description, state, created, priority, tags or id", pair)
+		}
+		fields[heading(column)] = field
+	}
+	return fields, nil
+}
+
+func heading(column string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(column, "_", " "))), " ")
+}
+
+// columnFields is the field of each column, empty for columns left out
+func columnFields(columns []string, fields map[string]string) ([]string, error) {
+	mapped := make([]string, len(columns))
+	for i, c := range columns {
+		if f, found := fields[heading(c)]; found {
+			mapped[i] = f
+		} else {
+			mapped[i] = headings[heading(c)]
+		}
+	}
+	if !slices.Contains(mapped, fieldDescription) {
+		return nil, fmt.Errorf("no description column in %q, map one with column=description", strings.Join(columns, ","))
+	}
+	return mapped, nil
+}
+
+// setField sets one field of item from text as exported
+func setField(item *store.TodoListItem, field string, value string) error {
+	value = strings.TrimSpace(value)
+	var err error
+	switch field {
+	case fieldId:
+		if value != "" {
+			item.Id, err = strconv.ParseInt(value, 10, 64)
+			item.Line = item.Id
+		}
+	case fieldDescription:
+		item.Description = value
+	case fieldState:
+		item.State, err = parseState(value)
+	case fieldCreated:
+		item.Created, err = parseCreated(value)
+	case fieldPriority:
+		item.Priority, err = store.ParsePriority(value)
+	case fieldTags:
+		item.Tags = store.ParseTags(value)
+	}
+	return err
+}
+
+// a state by name in any case or by number, empty is not started
+func parseState(value string) (int, error) {
+	if value == "" {
+		return store.StateNotStarted, nil
+	}
+	if n, ok := strconv.Atoi(value); ok == nil {
+		if _, found := store.StatusName[n]; found {
+			return n, nil
+		}
+	}
+	for state, name := range store.StatusName {
+		if strings.EqualFold(name, value) {
+			return state, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown state %q", value)
+}
+
+func parseCreated(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, ok := time.Parse(layout, value); ok == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot read created date %q, want 2006-01-02 or RFC 3339", value)
+}
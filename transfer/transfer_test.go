@@ -0,0 +1,248 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata" // the calendar test reads a TZID
+
+	"github.com/anthriscus/appcli/logging"
+	"github.com/anthriscus/appcli/store"
+)
+
+func TestMain(m *testing.M) {
+	logging.Default()
+	ctx, cancel := context.WithCancel(context.Background())
+	workDir, _ := os.MkdirTemp("", "appcli")
+	store.OpenSession(ctx, filepath.Join(workDir, "todolist.json"))
+	store.StartActor(ctx)
+	code := m.Run()
+	cancel()
+	os.RemoveAll(workDir)
+	os.Exit(code)
+}
+
+func TestRoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	items := []store.TodoListItem{
+		{Line: 1, Id: 1, Description: "Buy apples | pears", State: store.StateNotStarted, Created: created, Priority: "A", Tags: []string{"shopping", "home"}},
+		{Line: 2, Id: 2, Description: "Walk the dog", State: store.StateStarted, Created: created, Tags: []string{}},
+		{Line: 3, Id: 3, Description: "Fix the fence", State: store.StateCompleted, Created: created, Priority: "C", Tags: []string{"garden"}},
+		{Line: 4, Id: 4, Description: "=1+1 apples", State: store.StateNotStarted, Created: created, Tags: []string{}},
+	}
+	for _, format := range Formats {
+		var out bytes.Buffer
+		if ok := Export(&out, format, items); ok != nil {
+			t.Fatalf("%s export %v", format, ok)
+		}
+		got, ok := Parse(&out, format, nil)
+		if ok != nil {
+			t.Fatalf("%s parse %v", format, ok)
+		}
+		if len(got) != len(items) {
+			t.Fatalf("%s wanted %d items got %d", format, len(items), len(got))
+		}
+		for i, want := range items {
+			g := got[i]
+			if g.Description != want.Description || g.State != want.State || g.Priority != want.Priority ||
+				!g.Created.Equal(want.Created) || !slices.Equal(g.Tags, want.Tags) {
+				t.Errorf("%s item %d wanted %+v got %+v", format, i, want, g)
+			}
+		}
+	}
+}
+
+// text a spreadsheet would run as a formula is written quoted
+func TestCsvFormulas(t *testing.T) {
+	var tests = []struct {
+		description string
+		want        string
+	}{
+		{"=HYPERLINK(\"http://example.com\")", `'=HYPERLINK(""http://example.com"")`},
+		{"+1 more", "'+1 more"},
+		{"-2 eggs", "'-2 eggs"},
+		{"@mention", "'@mention"},
+		{"Buy = milk", "Buy = milk"},
+		{"'quoted", "'quoted"},
+	}
+	for _, tc := range tests {
+		items := []store.TodoListItem{{Line: 1, Description: tc.description, Tags: []string{}}}
+		var out bytes.Buffer
+		if ok := Export(&out, Csv, items); ok != nil {
+			t.Fatal(ok)
+		}
+		if !strings.Contains(out.String(), ","+tc.want+",") && !strings.Contains(out.String(), `,"`+tc.want+`",`) {
+			t.Errorf("%q: wanted the cell %s got %s", tc.description, tc.want, out.String())
+		}
+		if got, ok := Parse(&out, Csv, nil); ok != nil || len(got) != 1 || got[0].Description != tc.description {
+			t.Errorf("%q: read back as %+v %v", tc.description, got, ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		name   string
+		format Format
+		fields string
+		input  string
+		want   []store.TodoListItem
+		err    bool
+	}{
+		{name: "csv headings from another tool", format: Csv,
+			input: "Title,Status,Labels,Notes\nBuy milk,completed,\"Home, shop\",skim\n",
+			want:  []store.TodoListItem{{Description: "Buy milk", State: store.StateCompleted, Tags: []string{"home", "shop"}}}},
+		{name: "csv with a field mapping", format: Csv, fields: "What=description,Urgency=priority",
+			input: "What,Urgency\nCall mum,b\n",
+			want:  []store.TodoListItem{{Description: "Call mum", Priority: "B"}}},
+		{name: "csv without a description", format: Csv, input: "Notes\nx\n", err: true},
+		{name: "csv bad state", format: Csv, input: "description,state\nx,sleeping\n", err: true},
+		{name: "markdown task list", format: Markdown,
+			input: "# Week\n\n- [ ] Buy milk #home\n- [x] Post letter\nsome notes\n",
+			want: []store.TodoListItem{
+				{Description: "Buy milk", Tags: []string{"home"}},
+				{Description: "Post letter", State: store.StateCompleted, Tags: []string{}},
+			}},
+		{name: "todo.txt", format: TodoTxt,
+			input: "x 2026-01-03 2026-01-02 Post letter +errands pri:B\n(A) 2026-01-02 Call mum @phone see:notes\n\nPlain task\n",
+			want: []store.TodoListItem{
+				{Description: "Post letter", State: store.StateCompleted, Priority: "B", Created: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), Tags: []string{"errands"}},
+				{Description: "Call mum see:notes", Priority: "A", Created: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), Tags: []string{"phone"}},
+				{Description: "Plain task", Tags: []string{}},
+			}},
+		{name: "json list", format: Json, input: `[{"description":"Buy milk","priority":"a"}]`,
+			want: []store.TodoListItem{{Description: "Buy milk", Priority: "a"}}},
+	}
+	for _, tc := range tests {
+		fields, _ := ParseFields(tc.fields)
+		got, ok := Parse(strings.NewReader(tc.input), tc.format, fields)
+		if tc.err != (ok != nil) {
+			t.Errorf("%s: wanted error %t got %v", tc.name, tc.err, ok)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: wanted %d items got %+v", tc.name, len(tc.want), got)
+			continue
+		}
+		for i, want := range tc.want {
+			g := got[i]
+			if g.Description != want.Description || g.State != want.State || g.Priority != want.Priority ||
+				!g.Created.Equal(want.Created) || !slices.Equal(g.Tags, want.Tags) {
+				t.Errorf("%s: item %d wanted %+v got %+v", tc.name, i, want, g)
+			}
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := t.Context()
+	existing, _ := store.AddTask(ctx, "Already  THERE")
+	defer store.DeleteTask(ctx, existing)
+	items := []store.TodoListItem{
+		{Description: "already there"},
+		{Description: "Imported once", Priority: "b", State: store.StateStarted},
+		{Description: "imported ONCE"},
+		{Line: existing, Description: "Renamed elsewhere"},
+	}
+
+	report, ok := Import(ctx, items, Options{DryRun: true})
+	if ok != nil {
+		t.Fatal(ok)
+	}
+	if len(report.Added) != 1 || len(report.Duplicates) != 3 || report.Duplicates[0].Of != existing || report.Duplicates[1].Of != 0 {
+		t.Errorf("unexpected dry run %+v", report)
+	}
+	if store.Count() != 1 {
+		t.Errorf("a dry run added items, count %d", store.Count())
+	}
+
+	report, ok = Import(ctx, items, Options{})
+	if ok != nil || len(report.Added) != 1 {
+		t.Fatalf("import %+v %v", report, ok)
+	}
+	added := report.Added[0]
+	defer store.DeleteTask(ctx, added.Line)
+	if got, _ := store.GetByIndex(added.Line); got.Priority != "B" || got.State != store.StateStarted || got.Description != "Imported once" {
+		t.Errorf("fields not kept %+v", got)
+	}
+
+	if _, ok := Import(ctx, []store.TodoListItem{{Description: "ok"}, {Description: " "}}, Options{}); ok == nil {
+		t.Error("an item without a description should fail the import")
+	}
+	if store.Count() != 2 {
+		t.Errorf("a failed import added items, count %d", store.Count())
+	}
+}
+
+// imports running at once see each other's tasks, one of them adds the task
+func TestImportRace(t *testing.T) {
+	ctx := t.Context()
+	items := []store.TodoListItem{{Description: "Imported from two files at once"}}
+	var wg sync.WaitGroup
+	reports := make([]Report, 8)
+	for i := range reports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report, ok := Import(ctx, items, Options{})
+			if ok != nil {
+				t.Error(ok)
+			}
+			reports[i] = report
+		}()
+	}
+	wg.Wait()
+	added := 0
+	for _, report := range reports {
+		for _, item := range report.Added {
+			defer store.DeleteTask(ctx, item.Line)
+			added++
+		}
+	}
+	if added != 1 {
+		t.Errorf("wanted the task added once, added %d times", added)
+	}
+}
+
+func TestIcs(t *testing.T) {
+	due := time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)
+	items := []store.TodoListItem{
+		{Line: 7, Id: 7, Description: "Ring the plumber; ask about the boiler, the radiators and the tap that drips in the bathroom", State: store.StateStarted, Created: due, Due: due, Priority: "B", Tags: []string{"home"}, Recur: "FREQ=WEEKLY;BYDAY=MO,TH"},
+	}
+	var out bytes.Buffer
+	if ok := Export(&out, Ics, items); ok != nil {
+		t.Fatal(ok)
+	}
+	text := out.String()
+	for _, want := range []string{"UID:7@appcli\r\n", "STATUS:IN-PROCESS\r\n", "DUE;VALUE=DATE:20260304\r\n", "PRIORITY:2\r\n", "RRULE:FREQ=WEEKLY;BYDAY=MO,TH\r\n", `boiler\, the`} {
+		if !strings.Contains(strings.ReplaceAll(text, "\r\n ", ""), want) {
+			t.Errorf("wanted %q in\n%s", want, text)
+		}
+	}
+	for _, line := range strings.Split(text, "\r\n") {
+		if len(line) > icsLineLimit {
+			t.Errorf("line longer than %d octets %q", icsLineLimit, line)
+		}
+	}
+
+	// from another calendar app, the event is not a task
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR", "BEGIN:VEVENT", "SUMMARY:Meeting", "END:VEVENT",
+		"BEGIN:VTODO", "UID:abc-123", "SUMMARY:Renew the car", "  insurance", "STATUS:NEEDS-ACTION",
+		"DUE;TZID=Europe/London:20260701T090000", "PRIORITY:1", "CATEGORIES:Car,Bills", "RRULE:FREQ=YEARLY", "END:VTODO",
+		"END:VCALENDAR", ""}, "\r\n")
+	got, ok := Parse(strings.NewReader(calendar), Ics, nil)
+	if ok != nil || len(got) != 1 {
+		t.Fatalf("wanted one task got %v %v", got, ok)
+	}
+	want := store.TodoListItem{Description: "Renew the car insurance", Priority: "A", Due: time.Date(2026, 7, 1, 8, 0, 0, 0, time.UTC), Tags: []string{"car", "bills"}, Recur: "FREQ=YEARLY"}
+	if g := got[0]; g.Description != want.Description || g.Priority != want.Priority || !g.Due.Equal(want.Due) || !slices.Equal(g.Tags, want.Tags) || g.Recur != want.Recur || g.Line != 0 {
+		t.Errorf("wanted %+v got %+v", want, g)
+	}
+}